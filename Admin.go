@@ -0,0 +1,245 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"strings"
+)
+
+// reserved webservice path for the admin api; modules can't use it
+const AdminWebservicePath = "/_admin"
+
+// setup the admin api (e.g. inspect / reset scenarios, toggle faults, change rate limits) on the webservice container
+func (srv *Server) setupAdmin(wsContainer *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path(AdminWebservicePath).Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("/scenarios").To(srv._adminListScenarios))
+	ws.Route(ws.POST("/scenarios/reset").To(srv._adminResetScenarios))
+	ws.Route(ws.GET("/scenarios/{name}").To(srv._adminGetScenario))
+	ws.Route(ws.POST("/scenarios/{name}/reset").To(srv._adminResetScenario))
+
+	ws.Route(ws.GET("/faults").To(srv._adminListFaults))
+	ws.Route(ws.POST("/faults").To(srv._adminAddFault))
+	ws.Route(ws.POST("/faults/enable").To(srv._adminToggleFaults))
+	ws.Route(ws.POST("/faults/disable").To(srv._adminToggleFaults))
+	ws.Route(ws.PUT("/faults/{id}").To(srv._adminReplaceFault))
+	ws.Route(ws.DELETE("/faults/{id}").To(srv._adminRemoveFault))
+	ws.Route(ws.POST("/faults/{id}/enable").To(srv._adminToggleFault))
+	ws.Route(ws.POST("/faults/{id}/disable").To(srv._adminToggleFault))
+
+	ws.Route(ws.GET("/ratelimits").To(srv._adminListRateLimits))
+	ws.Route(ws.POST("/ratelimits").To(srv._adminAddRateLimit))
+	ws.Route(ws.POST("/ratelimits/reset").To(srv._adminResetRateLimits))
+	ws.Route(ws.PUT("/ratelimits/{id}").To(srv._adminReplaceRateLimit))
+	ws.Route(ws.DELETE("/ratelimits/{id}").To(srv._adminRemoveRateLimit))
+
+	wsContainer.Add(ws)
+
+	srv.logger.LogWithFuncName(fmt.Sprintf("admin api available at %v", AdminWebservicePath), "setupAdmin", srv.logConfig)
+}
+
+// list all scenarios and their current state
+func (srv *Server) _adminListScenarios(request *restful.Request, response *restful.Response) {
+	srv._writeAdminResponse(request, response, http.StatusOK, srv.scenarios.List())
+}
+
+// show a single scenario
+func (srv *Server) _adminGetScenario(request *restful.Request, response *restful.Response) {
+	scenario, found := srv.scenarios.Get(request.PathParameter("name"))
+	if !found {
+		srv._writeAdminError(request, response, http.StatusNotFound, fmt.Errorf("unknown scenario [%v]", request.PathParameter("name")))
+		return
+	}
+	srv._writeAdminResponse(request, response, http.StatusOK, scenario)
+}
+
+// reset every scenario back to its initial state
+func (srv *Server) _adminResetScenarios(request *restful.Request, response *restful.Response) {
+	srv.scenarios.ResetAll()
+	logger := srv._requestLogger(request)
+	logger.Log("all scenarios reset", LogLevelInfo, "", "")
+	srv._writeAdminResponse(request, response, http.StatusOK, srv.scenarios.List())
+}
+
+// reset a single scenario back to its initial state
+func (srv *Server) _adminResetScenario(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+	if err := srv.scenarios.Reset(name); err != nil {
+		srv._writeAdminError(request, response, http.StatusNotFound, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("scenario [%v] reset", name), LogLevelInfo, "", "")
+
+	scenario, _ := srv.scenarios.Get(name)
+	srv._writeAdminResponse(request, response, http.StatusOK, scenario)
+}
+
+// list all faults and whether fault injection is switched on
+func (srv *Server) _adminListFaults(request *restful.Request, response *restful.Response) {
+	srv._writeAdminResponse(request, response, http.StatusOK, map[string]interface{}{
+		"enabled": srv.faults.IsEnabled(),
+		"faults":  srv.faults.List(),
+	})
+}
+
+// add a fault
+func (srv *Server) _adminAddFault(request *restful.Request, response *restful.Response) {
+	var fault FaultConfig
+	if err := json.NewDecoder(request.Request.Body).Decode(&fault); err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	added, err := srv.faults.Add(fault)
+	if err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("fault [%v] added on %v", added.Id, added.Module), LogLevelInfo, "", "")
+	srv._writeAdminResponse(request, response, http.StatusCreated, added)
+}
+
+// replace a fault
+func (srv *Server) _adminReplaceFault(request *restful.Request, response *restful.Response) {
+	var fault FaultConfig
+	if err := json.NewDecoder(request.Request.Body).Decode(&fault); err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	replaced, err := srv.faults.Replace(request.PathParameter("id"), fault)
+	if err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("fault [%v] replaced", replaced.Id), LogLevelInfo, "", "")
+	srv._writeAdminResponse(request, response, http.StatusOK, replaced)
+}
+
+// remove a fault
+func (srv *Server) _adminRemoveFault(request *restful.Request, response *restful.Response) {
+	id := request.PathParameter("id")
+	if err := srv.faults.Remove(id); err != nil {
+		srv._writeAdminError(request, response, http.StatusNotFound, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("fault [%v] removed", id), LogLevelInfo, "", "")
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// enable / disable a single fault (based on the last segment of the path)
+func (srv *Server) _adminToggleFault(request *restful.Request, response *restful.Response) {
+	isEnabled := strings.HasSuffix(request.Request.URL.Path, "/enable")
+	fault, err := srv.faults.SetFaultEnabled(request.PathParameter("id"), isEnabled)
+	if err != nil {
+		srv._writeAdminError(request, response, http.StatusNotFound, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("fault [%v] enabled => %v", fault.Id, isEnabled), LogLevelInfo, "", "")
+	srv._writeAdminResponse(request, response, http.StatusOK, fault)
+}
+
+// switch fault injection on / off as a whole (based on the last segment of the path)
+func (srv *Server) _adminToggleFaults(request *restful.Request, response *restful.Response) {
+	isEnabled := strings.HasSuffix(request.Request.URL.Path, "/enable")
+	srv.faults.SetEnabled(isEnabled)
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("fault injection enabled => %v", isEnabled), LogLevelInfo, "", "")
+	srv._adminListFaults(request, response)
+}
+
+// list all rate limits
+func (srv *Server) _adminListRateLimits(request *restful.Request, response *restful.Response) {
+	srv._writeAdminResponse(request, response, http.StatusOK, srv.rateLimits.List())
+}
+
+// add a rate limit
+func (srv *Server) _adminAddRateLimit(request *restful.Request, response *restful.Response) {
+	var rateLimit RateLimitConfig
+	if err := json.NewDecoder(request.Request.Body).Decode(&rateLimit); err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	added, err := srv.rateLimits.Add(rateLimit)
+	if err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("rate limit [%v] added on %v", added.Id, added.Module), LogLevelInfo, "", "")
+	srv._writeAdminResponse(request, response, http.StatusCreated, added)
+}
+
+// replace a rate limit (e.g. change the limit); its buckets start full
+func (srv *Server) _adminReplaceRateLimit(request *restful.Request, response *restful.Response) {
+	var rateLimit RateLimitConfig
+	if err := json.NewDecoder(request.Request.Body).Decode(&rateLimit); err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	replaced, err := srv.rateLimits.Replace(request.PathParameter("id"), rateLimit)
+	if err != nil {
+		srv._writeAdminError(request, response, http.StatusBadRequest, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("rate limit [%v] replaced", replaced.Id), LogLevelInfo, "", "")
+	srv._writeAdminResponse(request, response, http.StatusOK, replaced)
+}
+
+// remove a rate limit
+func (srv *Server) _adminRemoveRateLimit(request *restful.Request, response *restful.Response) {
+	id := request.PathParameter("id")
+	if err := srv.rateLimits.Remove(id); err != nil {
+		srv._writeAdminError(request, response, http.StatusNotFound, err)
+		return
+	}
+	logger := srv._requestLogger(request)
+	logger.Log(fmt.Sprintf("rate limit [%v] removed", id), LogLevelInfo, "", "")
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// refill the buckets of every client
+func (srv *Server) _adminResetRateLimits(request *restful.Request, response *restful.Response) {
+	srv.rateLimits.Reset()
+	logger := srv._requestLogger(request)
+	logger.Log("rate limit buckets refilled", LogLevelInfo, "", "")
+	srv._adminListRateLimits(request, response)
+}
+
+// method to write an admin api response as json
+func (srv *Server) _writeAdminResponse(request *restful.Request, response *restful.Response, status int, model interface{}) {
+	if err := response.WriteHeaderAndJson(status, model, restful.MIME_JSON); err != nil {
+		logger := srv._requestLogger(request)
+		logger.Log(err.Error(), LogLevelError, "", "")
+	}
+}
+
+// method to write an admin api error as json
+func (srv *Server) _writeAdminError(request *restful.Request, response *restful.Response, status int, err error) {
+	srv._writeAdminResponse(request, response, status, map[string]string{"error": err.Error()})
+}
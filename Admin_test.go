@@ -0,0 +1,63 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"github.com/emicklei/go-restful"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// method to create a server with the request id filter and the admin api; its log lines are kept
+func newTestAdminServer() (*Server, *restful.Container, *recordingSink) {
+	srv := NewServer("")
+	sink := new(recordingSink)
+	srv.logger.Sink = sink
+	wsContainerPtr := restful.NewContainer()
+	srv.setupRequestId(wsContainerPtr)
+	srv.setupAdmin(wsContainerPtr)
+	return srv, wsContainerPtr, sink
+}
+
+// method to send the request to the container; the caller's request id is X-Request-ID
+func serveTestRequest(wsContainerPtr *restful.Container, method string, target string, body io.Reader, requestId string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, body)
+	request.Header.Set("Content-Type", restful.MIME_JSON)
+	if requestId != "" {
+		request.Header.Set(HeaderRequestId, requestId)
+	}
+	recorder := httptest.NewRecorder()
+	wsContainerPtr.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminLogsCarryTheRequestId(t *testing.T) {
+	_, wsContainerPtr, sink := newTestAdminServer()
+
+	recorder := serveTestRequest(wsContainerPtr, http.MethodPost, AdminWebservicePath+"/scenarios/reset", nil, "admin-req-1")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %v", recorder.Code)
+	}
+	entry := lastLogEntry(t, sink)
+	if entry.Message != "all scenarios reset" || entry.RequestId != "admin-req-1" {
+		t.Errorf("expected the admin line with the request id, got %q [requestId=%v]", entry.Message, entry.RequestId)
+	}
+}
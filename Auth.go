@@ -0,0 +1,439 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const JwtAlgorithmHS256 = "HS256"
+const JwtAlgorithmRS256 = "RS256"
+
+// default header carrying the api key
+const DefaultApiKeyHeader = "X-API-Key"
+
+// request attribute holding the authenticated principal (*AuthPrincipal)
+const authRequestAttribute = "echogogo.auth"
+
+// structure of an auth requirement; applies to a whole module or to a single endpoint of it. A request
+// passes if any of the configured schemes accepts its credentials
+type AuthConfig struct {
+	Module         string           `json:"module" description:"webservice path of the module e.g. /orders"`
+	Endpoint       string           `json:"endpoint" description:"optional endpoint in the GetRestConfig format e.g. GET::/{id}; empty means every endpoint"`
+	Realm          string           `json:"realm" description:"realm of the WWW-Authenticate challenges (default echogogo)"`
+	Basic          *BasicAuthConfig `json:"basic" description:"accept basic auth of static users"`
+	ApiKey         *ApiKeyConfig    `json:"apiKey" description:"accept api keys in a header or query parameter"`
+	Jwt            *JwtConfig       `json:"jwt" description:"accept bearer JWTs signed with HS256 or RS256"`
+	RequiredScopes []string         `json:"requiredScopes" description:"scopes a JWT must carry (scope or scp claim); missing scopes answer 403"`
+}
+
+type BasicAuthConfig struct {
+	Users map[string]string `json:"users" description:"user name => password"`
+}
+
+type ApiKeyConfig struct {
+	Header string   `json:"header" description:"header carrying the key (default X-API-Key unless query is given)"`
+	Query  string   `json:"query" description:"query parameter carrying the key e.g. api_key"`
+	Keys   []string `json:"keys" description:"accepted keys"`
+}
+
+type JwtConfig struct {
+	Algorithm     string `json:"algorithm" description:"HS256 (default) or RS256"`
+	SecretFile    string `json:"secretFile" description:"file holding the HS256 secret (surrounding whitespace is trimmed); relative to the config file's directory"`
+	PublicKeyFile string `json:"publicKeyFile" description:"PEM file holding the RS256 public key or certificate; relative to the config file's directory"`
+	Issuer        string `json:"issuer" description:"expected iss claim; not checked if empty"`
+	Audience      string `json:"audience" description:"expected aud claim; not checked if empty"`
+	LeewaySeconds int    `json:"leewaySeconds" description:"clock skew tolerated for exp and nbf"`
+}
+
+// structure of the authenticated caller; given to DoAction as options["auth"]
+type AuthPrincipal struct {
+	Scheme  string                 `json:"scheme"`
+	Subject string                 `json:"subject"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+}
+
+// structure of a rejected request
+type authFailure struct {
+	status      int
+	error       string // oauth style error code of the bearer challenge e.g. invalid_token
+	description string
+	scheme      string // scheme the failing credentials were given for; "" if none were given
+}
+
+// structure of an auth requirement ready to check requests (keys loaded)
+type authPolicy struct {
+	config       AuthConfig
+	hmacSecret   []byte
+	rsaPublicKey *rsa.PublicKey
+}
+
+// method to validate and fill in the defaults of the auth requirement
+func (a *AuthConfig) Validate() error {
+	if err := a.selector().validate(); err != nil {
+		return fmt.Errorf("auth [%v]: %v", a.Module, err)
+	}
+	if a.Basic == nil && a.ApiKey == nil && a.Jwt == nil {
+		return fmt.Errorf("auth [%v]: at least one of basic, apiKey or jwt is required", a.Module)
+	}
+	if a.Realm == "" {
+		a.Realm = "echogogo"
+	}
+	if a.ApiKey != nil && a.ApiKey.Header == "" && a.ApiKey.Query == "" {
+		a.ApiKey.Header = DefaultApiKeyHeader
+	}
+	if a.Jwt != nil {
+		switch a.Jwt.Algorithm {
+		case "":
+			a.Jwt.Algorithm = JwtAlgorithmHS256
+			fallthrough
+		case JwtAlgorithmHS256:
+			if a.Jwt.SecretFile == "" {
+				return fmt.Errorf("auth [%v]: jwt.secretFile is required for HS256", a.Module)
+			}
+		case JwtAlgorithmRS256:
+			if a.Jwt.PublicKeyFile == "" {
+				return fmt.Errorf("auth [%v]: jwt.publicKeyFile is required for RS256", a.Module)
+			}
+		default:
+			return fmt.Errorf("auth [%v]: jwt.algorithm must be HS256 or RS256 => %v", a.Module, a.Jwt.Algorithm)
+		}
+	}
+	if len(a.RequiredScopes) > 0 && a.Jwt == nil {
+		return fmt.Errorf("auth [%v]: requiredScopes need jwt", a.Module)
+	}
+	return nil
+}
+
+// method to get what the auth requirement applies to
+func (a *AuthConfig) selector() EndpointSelector {
+	return EndpointSelector{Module: a.Module, Endpoint: a.Endpoint}
+}
+
+// ctor. Create the auth requirements of the config; the jwt keys are read from their files
+func newAuthPolicies(authConfigs []AuthConfig) ([]*authPolicy, error) {
+	policies := make([]*authPolicy, 0, len(authConfigs))
+	for _, authConfig := range authConfigs {
+		if err := authConfig.Validate(); err != nil {
+			return nil, err
+		}
+		policy := &authPolicy{config: authConfig}
+		if authConfig.Jwt != nil {
+			var err error
+			if authConfig.Jwt.Algorithm == JwtAlgorithmRS256 {
+				policy.rsaPublicKey, err = LoadRsaPublicKey(authConfig.Jwt.PublicKeyFile)
+			} else {
+				policy.hmacSecret, err = _loadHmacSecret(authConfig.Jwt.SecretFile)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("auth [%v]: %v", authConfig.Module, err)
+			}
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// method to find the auth requirement of the request; an endpoint requirement wins over a module wide one
+func (srv *Server) _findAuthPolicy(modulePath string, method string, routePath string) *authPolicy {
+	idx := _findEndpointSelector(len(srv.authPolicies), func(idx int) *EndpointSelector {
+		selector := srv.authPolicies[idx].config.selector()
+		return &selector
+	}, modulePath, method, routePath)
+	if idx < 0 {
+		return nil
+	}
+	return srv.authPolicies[idx]
+}
+
+// method to check the request's credentials against the module's (or endpoint's) auth requirement; rejected
+// requests are answered with 401 / 403 and the WWW-Authenticate challenges. Returns false if rejected
+func (srv *Server) _authenticate(modulePtr *EchoModule, request *restful.Request, response *restful.Response, logger Logger) bool {
+	policy := srv._findAuthPolicy(modulePtr.WebservicePath, request.Request.Method, request.SelectedRoutePath())
+	if policy == nil {
+		return true
+	}
+	principal, failure := policy.authenticate(request.Request)
+	if failure == nil {
+		request.SetAttribute(authRequestAttribute, principal)
+		return true
+	}
+	logger.Log(fmt.Sprintf("auth rejected (%v): %v", failure.status, failure.description), LogLevelDebug, "", "")
+	policy.writeChallenges(response, failure)
+	srv.setCorsHeaders(request.Request, response)
+	response.Header().Set("Content-Type", restful.MIME_JSON)
+	response.WriteHeader(failure.status)
+	errorCode := "unauthorized"
+	if failure.status == http.StatusForbidden {
+		errorCode = "forbidden"
+	}
+	bArrBody, _ := json.Marshal(map[string]string{"error": errorCode, "error_description": failure.description})
+	response.Write(bArrBody)
+
+	return false
+}
+
+// method to check the credentials of the request; the first scheme accepting them wins. The failure
+// reported is the one of the credentials given (if any), otherwise "credentials missing"
+func (p *authPolicy) authenticate(request *http.Request) (*AuthPrincipal, *authFailure) {
+	var failure *authFailure
+	authorization := request.Header.Get("Authorization")
+	if p.config.Basic != nil {
+		if user, password, ok := request.BasicAuth(); ok {
+			expectedPassword, isKnown := p.config.Basic.Users[user]
+			if isKnown && subtle.ConstantTimeCompare([]byte(expectedPassword), []byte(password)) == 1 {
+				return &AuthPrincipal{Scheme: "basic", Subject: user}, nil
+			}
+			failure = &authFailure{status: http.StatusUnauthorized, description: "invalid user name or password", scheme: "basic"}
+		}
+	}
+	if p.config.ApiKey != nil {
+		apiKey := ""
+		if p.config.ApiKey.Header != "" {
+			apiKey = request.Header.Get(p.config.ApiKey.Header)
+		}
+		if apiKey == "" && p.config.ApiKey.Query != "" {
+			apiKey = request.URL.Query().Get(p.config.ApiKey.Query)
+		}
+		if apiKey != "" {
+			for _, key := range p.config.ApiKey.Keys {
+				if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+					return &AuthPrincipal{Scheme: "apiKey", Subject: _maskSecret(apiKey)}, nil
+				}
+			}
+			failure = &authFailure{status: http.StatusUnauthorized, description: "invalid api key", scheme: "apiKey"}
+		}
+	}
+	if p.config.Jwt != nil && len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		claims, err := p.verifyJwt(strings.TrimSpace(authorization[7:]))
+		if err != nil {
+			return nil, &authFailure{status: http.StatusUnauthorized, error: "invalid_token", description: err.Error(), scheme: "bearer"}
+		}
+		if missingScopes := _missingScopes(p.config.RequiredScopes, claims); len(missingScopes) > 0 {
+			return nil, &authFailure{status: http.StatusForbidden, error: "insufficient_scope",
+				description: fmt.Sprintf("missing scope(s): %v", strings.Join(missingScopes, " ")), scheme: "bearer"}
+		}
+		subject, _ := claims["sub"].(string)
+		return &AuthPrincipal{Scheme: "bearer", Subject: subject, Claims: claims}, nil
+	}
+	if failure == nil {
+		failure = &authFailure{status: http.StatusUnauthorized, description: "credentials missing"}
+	}
+	return nil, failure
+}
+
+// method to add the WWW-Authenticate challenge of every configured scheme; the failing scheme's challenge
+// carries the error (RFC 6750 for bearer tokens)
+func (p *authPolicy) writeChallenges(response *restful.Response, failure *authFailure) {
+	realm := _quoteAuthParam(p.config.Realm)
+	if p.config.Jwt != nil {
+		challenge := fmt.Sprintf("Bearer realm=%v", realm)
+		if failure.scheme == "bearer" {
+			challenge += fmt.Sprintf(", error=%v, error_description=%v", _quoteAuthParam(failure.error), _quoteAuthParam(failure.description))
+			if failure.error == "insufficient_scope" {
+				challenge += fmt.Sprintf(", scope=%v", _quoteAuthParam(strings.Join(p.config.RequiredScopes, " ")))
+			}
+		}
+		response.Header().Add("WWW-Authenticate", challenge)
+	}
+	if p.config.Basic != nil {
+		response.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%v, charset="UTF-8"`, realm))
+	}
+	if p.config.ApiKey != nil {
+		// not a registered scheme; tells the client where the key goes
+		if p.config.ApiKey.Header != "" {
+			response.Header().Add("WWW-Authenticate", fmt.Sprintf(`ApiKey realm=%v, in="header", name=%v`, realm, _quoteAuthParam(p.config.ApiKey.Header)))
+		} else {
+			response.Header().Add("WWW-Authenticate", fmt.Sprintf(`ApiKey realm=%v, in="query", name=%v`, realm, _quoteAuthParam(p.config.ApiKey.Query)))
+		}
+	}
+}
+
+// method to verify a compact JWT (signature, exp, nbf, iss and aud); returns its claims
+func (p *authPolicy) verifyJwt(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := _decodeJwtSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	// the configured algorithm only; rejects "none" and HS256 tokens signed with the RS256 public key
+	if header.Algorithm != p.config.Jwt.Algorithm {
+		return nil, fmt.Errorf("unexpected algorithm %v", header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signingInput)
+	if p.rsaPublicKey != nil {
+		if rsa.VerifyPKCS1v15(p.rsaPublicKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errors.New("invalid signature")
+		}
+	} else {
+		mac := hmac.New(sha256.New, p.hmacSecret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, errors.New("invalid signature")
+		}
+	}
+	claims := make(map[string]interface{})
+	if err := _decodeJwtSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	now := time.Now().Unix()
+	leeway := int64(p.config.Jwt.LeewaySeconds)
+	if exp, ok := claims["exp"].(float64); ok && now > int64(exp)+leeway {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < int64(nbf)-leeway {
+		return nil, errors.New("token not valid yet")
+	}
+	if p.config.Jwt.Issuer != "" && claims["iss"] != p.config.Jwt.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if p.config.Jwt.Audience != "" && !_containsAudience(claims["aud"], p.config.Jwt.Audience) {
+		return nil, fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	return claims, nil
+}
+
+// method to decode a base64url json segment of a JWT
+func _decodeJwtSegment(segment string, target interface{}) error {
+	bArrSegment, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bArrSegment, target)
+}
+
+// method to check the aud claim (a string or a list of strings) contains the audience
+func _containsAudience(aud interface{}, audience string) bool {
+	switch aud.(type) {
+	case string:
+		return aud.(string) == audience
+	case []interface{}:
+		for _, element := range aud.([]interface{}) {
+			if element == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// method to get the required scopes missing from the scope (space separated) or scp (list) claim
+func _missingScopes(requiredScopes []string, claims map[string]interface{}) []string {
+	grantedScopes := make([]string, 0)
+	if scope, ok := claims["scope"].(string); ok {
+		grantedScopes = append(grantedScopes, strings.Fields(scope)...)
+	}
+	if scp, ok := claims["scp"].([]interface{}); ok {
+		for _, element := range scp {
+			if scope, ok := element.(string); ok {
+				grantedScopes = append(grantedScopes, scope)
+			}
+		}
+	}
+	missingScopes := make([]string, 0)
+	for _, requiredScope := range requiredScopes {
+		if !_containsString(grantedScopes, requiredScope) {
+			missingScopes = append(missingScopes, requiredScope)
+		}
+	}
+	return missingScopes
+}
+
+// method to read the HS256 secret
+func _loadHmacSecret(file string) ([]byte, error) {
+	bArrSecret, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	secret := []byte(strings.TrimSpace(string(bArrSecret)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("empty secret in %v", file)
+	}
+	return secret, nil
+}
+
+// method to read a RSA public key out of a PEM file (PUBLIC KEY, RSA PUBLIC KEY or CERTIFICATE)
+func LoadRsaPublicKey(file string) (*rsa.PublicKey, error) {
+	bArrPem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bArrPem)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %v", file)
+	}
+	var publicKey interface{}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var certificate *x509.Certificate
+		if certificate, err = x509.ParseCertificate(block.Bytes); err == nil {
+			publicKey = certificate.PublicKey
+		}
+	default:
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key in %v: %v", file, err)
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not a RSA public key in %v", file)
+	}
+	return rsaPublicKey, nil
+}
+
+// method to quote an auth-param value
+func _quoteAuthParam(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// method to mask a secret for logs and DoAction (first 4 characters kept)
+func _maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return secret[:4] + "****"
+}
@@ -0,0 +1,311 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/emicklei/go-restful"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the HS256 secret of the tests; surrounding whitespace of the secret file is trimmed
+const testHmacSecret = "s3cret-of-the-hs256-tokens"
+
+// method to sign the claims as a compact JWT; the key is the HS256 secret ([]byte) or the RS256 *rsa.PrivateKey
+func signTestJwt(t *testing.T, algorithm string, key interface{}, claims map[string]interface{}) string {
+	bArrHeader, _ := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	bArrClaims, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(bArrHeader) + "." + base64.RawURLEncoding.EncodeToString(bArrClaims)
+	var signature []byte
+	switch key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// method to create a module answering with the auth options given to its DoAction
+func newTestAuthModule(webservicePath string) *EchoModule {
+	getRestConfig := func() map[string]interface{} {
+		return map[string]interface{}{
+			"path":          webservicePath,
+			"consumeFormat": "json",
+			"produceFormat": "json",
+			"endPoints":     []string{"GET::/", "GET::/{id}"},
+		}
+	}
+	doAction := func(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+		return map[string]interface{}{"auth": options[0]["auth"]}
+	}
+	return NewEchoModule(nil, getRestConfig, doAction, strings.TrimPrefix(webservicePath, "/")+".so")
+}
+
+// method to create a server with the auth requirements of the tests; returns the container, the RS256 key
+// and the cleanup func
+//
+//	/orders          basic auth (alice) or an api key (header X-API-Key or query api_key), realm shop
+//	/secure          HS256 JWT of issuer https://issuer.test and audience echogogo
+//	/secure GET::/{id} the same plus the scope orders:read
+//	/signed          RS256 JWT
+func newTestAuthServer(t *testing.T) (*restful.Container, *rsa.PrivateKey, func()) {
+	dir, err := ioutil.TempDir("", "echogogo-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretFile := filepath.Join(dir, "hs256.secret")
+	if err := ioutil.WriteFile(secretFile, []byte("  "+testHmacSecret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bArrPublicKey, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyFile := filepath.Join(dir, "rs256.pem")
+	if err := ioutil.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bArrPublicKey}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	hs256Config := func() *JwtConfig {
+		return &JwtConfig{SecretFile: secretFile, Issuer: "https://issuer.test", Audience: "echogogo"}
+	}
+	srv.authPolicies, err = newAuthPolicies([]AuthConfig{
+		{Module: "/orders", Realm: "shop", Basic: &BasicAuthConfig{Users: map[string]string{"alice": "wonderland"}},
+			ApiKey: &ApiKeyConfig{Header: DefaultApiKeyHeader, Query: "api_key", Keys: []string{"key-1234567"}}},
+		{Module: "/secure", Jwt: hs256Config()},
+		{Module: "/secure", Endpoint: "GET::/{id}", Jwt: hs256Config(), RequiredScopes: []string{"orders:read"}},
+		{Module: "/signed", Jwt: &JwtConfig{Algorithm: JwtAlgorithmRS256, PublicKeyFile: publicKeyFile}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsContainerPtr := restful.NewContainer()
+	for _, webservicePath := range []string{"/orders", "/secure", "/signed"} {
+		modulePtr := newTestAuthModule(webservicePath)
+		if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+			t.Fatal(err)
+		}
+		srv.modules[modulePtr.ModulePath] = modulePtr
+	}
+	return wsContainerPtr, rsaKey, func() { os.RemoveAll(dir) }
+}
+
+func TestAuthThroughTheRouter(t *testing.T) {
+	wsContainerPtr, rsaKey, cleanup := newTestAuthServer(t)
+	defer cleanup()
+	otherRsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacSecret := []byte(testHmacSecret)
+	now := time.Now().Unix()
+	validClaims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"sub": "user-1", "iss": "https://issuer.test", "aud": "echogogo", "exp": now + 300}
+		for key, value := range overrides {
+			if value == nil {
+				delete(claims, key)
+				continue
+			}
+			claims[key] = value
+		}
+		return claims
+	}
+	bearer := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+	const ordersChallenges = `Basic realm="shop", charset="UTF-8" | ApiKey realm="shop", in="header", name="X-API-Key"`
+
+	testCases := []struct {
+		name        string
+		target      string
+		headers     map[string]string
+		status      int
+		subject     string // of the accepted request
+		description string // of the rejected request
+		challenges  string // WWW-Authenticate headers joined by " | "
+	}{
+		// basic auth and api keys
+		{"basic auth", "/orders/", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:wonderland"))},
+			http.StatusOK, "alice", "", ""},
+		{"basic auth with a wrong password", "/orders/", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:queen"))},
+			http.StatusUnauthorized, "", "invalid user name or password", ordersChallenges},
+		{"basic auth of an unknown user", "/orders/", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("bob:wonderland"))},
+			http.StatusUnauthorized, "", "invalid user name or password", ordersChallenges},
+		{"api key header", "/orders/42", map[string]string{DefaultApiKeyHeader: "key-1234567"}, http.StatusOK, "key-****", "", ""},
+		{"api key query parameter", "/orders/42?api_key=key-1234567", nil, http.StatusOK, "key-****", "", ""},
+		{"wrong api key", "/orders/42", map[string]string{DefaultApiKeyHeader: "key-7654321"},
+			http.StatusUnauthorized, "", "invalid api key", ordersChallenges},
+		{"no credentials", "/orders/", nil, http.StatusUnauthorized, "", "credentials missing", ordersChallenges},
+
+		// HS256 and RS256 tokens
+		{"HS256", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(nil))), http.StatusOK, "user-1", "", ""},
+		{"HS256 with an audience list", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"aud": []string{"other", "echogogo"}}))),
+			http.StatusOK, "user-1", "", ""},
+		{"RS256", "/signed/", bearer(signTestJwt(t, JwtAlgorithmRS256, rsaKey, validClaims(nil))), http.StatusOK, "user-1", "", ""},
+		{"RS256 signed by another key", "/signed/", bearer(signTestJwt(t, JwtAlgorithmRS256, otherRsaKey, validClaims(nil))),
+			http.StatusUnauthorized, "", "invalid signature", `Bearer realm="echogogo", error="invalid_token", error_description="invalid signature"`},
+		{"HS256 signed by another secret", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, []byte("guessed"), validClaims(nil))),
+			http.StatusUnauthorized, "", "invalid signature", `Bearer realm="echogogo", error="invalid_token", error_description="invalid signature"`},
+		{"malformed token", "/secure/", bearer("not-a-jwt"),
+			http.StatusUnauthorized, "", "malformed token", `Bearer realm="echogogo", error="invalid_token", error_description="malformed token"`},
+
+		// exp and nbf
+		{"expired", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"exp": now - 60}))),
+			http.StatusUnauthorized, "", "token expired", `Bearer realm="echogogo", error="invalid_token", error_description="token expired"`},
+		{"not valid yet", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"nbf": now + 60}))),
+			http.StatusUnauthorized, "", "token not valid yet", `Bearer realm="echogogo", error="invalid_token", error_description="token not valid yet"`},
+
+		// the configured algorithm only
+		{"RS256 token where HS256 is expected", "/secure/", bearer(signTestJwt(t, JwtAlgorithmRS256, rsaKey, validClaims(nil))),
+			http.StatusUnauthorized, "", "unexpected algorithm RS256", `Bearer realm="echogogo", error="invalid_token", error_description="unexpected algorithm RS256"`},
+		{"HS256 token where RS256 is expected", "/signed/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(nil))),
+			http.StatusUnauthorized, "", "unexpected algorithm HS256", `Bearer realm="echogogo", error="invalid_token", error_description="unexpected algorithm HS256"`},
+		{"unsigned token", "/secure/", bearer(signTestJwt(t, "none", nil, validClaims(nil))),
+			http.StatusUnauthorized, "", "unexpected algorithm none", `Bearer realm="echogogo", error="invalid_token", error_description="unexpected algorithm none"`},
+
+		// iss and aud
+		{"wrong issuer", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"iss": "https://other.test"}))),
+			http.StatusUnauthorized, "", "unexpected issuer https://other.test", `Bearer realm="echogogo", error="invalid_token", error_description="unexpected issuer https://other.test"`},
+		{"missing issuer", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"iss": nil}))),
+			http.StatusUnauthorized, "", "unexpected issuer <nil>", `Bearer realm="echogogo", error="invalid_token", error_description="unexpected issuer <nil>"`},
+		{"wrong audience", "/secure/", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"aud": "other"}))),
+			http.StatusUnauthorized, "", "unexpected audience other", `Bearer realm="echogogo", error="invalid_token", error_description="unexpected audience other"`},
+
+		// scopes required by the endpoint
+		{"required scope", "/secure/42", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"scope": "orders:write orders:read"}))),
+			http.StatusOK, "user-1", "", ""},
+		{"required scope in scp", "/secure/42", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"scp": []string{"orders:read"}}))),
+			http.StatusOK, "user-1", "", ""},
+		{"missing scope", "/secure/42", bearer(signTestJwt(t, JwtAlgorithmHS256, hmacSecret, validClaims(map[string]interface{}{"scope": "orders:write"}))),
+			http.StatusForbidden, "", "missing scope(s): orders:read",
+			`Bearer realm="echogogo", error="insufficient_scope", error_description="missing scope(s): orders:read", scope="orders:read"`},
+
+		// no token; the challenge without an error
+		{"no token", "/secure/", nil, http.StatusUnauthorized, "", "credentials missing", `Bearer realm="echogogo"`},
+		{"other scheme", "/secure/", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:wonderland"))},
+			http.StatusUnauthorized, "", "credentials missing", `Bearer realm="echogogo"`},
+	}
+	for _, testCase := range testCases {
+		request := httptest.NewRequest(http.MethodGet, testCase.target, nil)
+		for name, value := range testCase.headers {
+			request.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		wsContainerPtr.ServeHTTP(recorder, request)
+
+		if recorder.Code != testCase.status {
+			t.Errorf("%v: expected %v, got %v %v", testCase.name, testCase.status, recorder.Code, recorder.Body.String())
+			continue
+		}
+		body := decodeTestJson(t, recorder.Body.String()).(map[string]interface{})
+		challenges := strings.Join(recorder.Header()["Www-Authenticate"], " | ")
+		if testCase.status == http.StatusOK {
+			auth, _ := body["auth"].(map[string]interface{})
+			if auth == nil || auth["subject"] != testCase.subject {
+				t.Errorf("%v: expected DoAction to get the subject %v, got %v", testCase.name, testCase.subject, body)
+			}
+			if challenges != "" {
+				t.Errorf("%v: expected no challenge of an accepted request, got %v", testCase.name, challenges)
+			}
+			continue
+		}
+		expectedError := "unauthorized"
+		if testCase.status == http.StatusForbidden {
+			expectedError = "forbidden"
+		}
+		if body["error"] != expectedError || body["error_description"] != testCase.description {
+			t.Errorf("%v: expected %v (%v), got %v", testCase.name, expectedError, testCase.description, body)
+		}
+		if challenges != testCase.challenges {
+			t.Errorf("%v: expected the challenges\n\t%v\ngot\n\t%v", testCase.name, testCase.challenges, challenges)
+		}
+	}
+}
+
+// the claims of the token reach DoAction; the module never sees a rejected request
+func TestAuthClaimsReachDoAction(t *testing.T) {
+	wsContainerPtr, _, cleanup := newTestAuthServer(t)
+	defer cleanup()
+	token := signTestJwt(t, JwtAlgorithmHS256, []byte(testHmacSecret), map[string]interface{}{
+		"sub": "user-2", "iss": "https://issuer.test", "aud": "echogogo", "scope": "orders:read", "tenant": "t-1",
+	})
+	request := httptest.NewRequest(http.MethodGet, "/secure/42", nil)
+	request.Header.Set("Authorization", "bearer "+token)
+	recorder := httptest.NewRecorder()
+	wsContainerPtr.ServeHTTP(recorder, request)
+
+	body := decodeTestJson(t, recorder.Body.String()).(map[string]interface{})
+	auth, _ := body["auth"].(map[string]interface{})
+	if recorder.Code != http.StatusOK || auth == nil {
+		t.Fatalf("expected the token accepted (the scheme is case insensitive), got %v %v", recorder.Code, recorder.Body.String())
+	}
+	claims, _ := auth["claims"].(map[string]interface{})
+	if auth["scheme"] != "bearer" || auth["subject"] != "user-2" || claims["tenant"] != "t-1" {
+		t.Errorf("expected the scheme, subject and claims of the token, got %v", auth)
+	}
+}
+
+func TestAuthConfigValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  AuthConfig
+		message string
+	}{
+		{"no scheme", AuthConfig{Module: "/orders"}, "at least one of basic, apiKey or jwt is required"},
+		{"HS256 without secret", AuthConfig{Module: "/orders", Jwt: &JwtConfig{}}, "jwt.secretFile is required for HS256"},
+		{"RS256 without public key", AuthConfig{Module: "/orders", Jwt: &JwtConfig{Algorithm: JwtAlgorithmRS256}}, "jwt.publicKeyFile is required for RS256"},
+		{"unknown algorithm", AuthConfig{Module: "/orders", Jwt: &JwtConfig{Algorithm: "ES256", SecretFile: "x"}}, "jwt.algorithm must be HS256 or RS256"},
+		{"scopes without jwt", AuthConfig{Module: "/orders", Basic: &BasicAuthConfig{}, RequiredScopes: []string{"orders:read"}}, "requiredScopes need jwt"},
+		{"missing secret file", AuthConfig{Module: "/orders", Jwt: &JwtConfig{SecretFile: "/nonexistent/hs256.secret"}}, "no such file or directory"},
+	}
+	for _, testCase := range testCases {
+		_, err := newAuthPolicies([]AuthConfig{testCase.config})
+		if err == nil || !strings.Contains(err.Error(), testCase.message) {
+			t.Errorf("%v: expected an error containing %q, got %v", testCase.name, testCase.message, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+)
+
+// default webservice path of the echo module
+const EchoModuleDefaultPath = "/echo"
+
+// built-in echo module; answers every request with what it received (method, path, query, headers,
+// body) plus the verified client certificate, if any
+type BuiltinEchoModule struct {
+	path string
+}
+
+// ctor. Create the built-in echo module
+func NewBuiltinEchoModule(baseDir string) *BuiltinModule {
+	m := new(BuiltinEchoModule)
+	m.path = EchoModuleDefaultPath
+
+	return &BuiltinModule{
+		GetRestConfig: m.GetRestConfig,
+		DoAction:      m.DoAction,
+		Init:          m.Init,
+	}
+}
+
+// method to read the settings; path is the only one
+func (m *BuiltinEchoModule) Init(settings map[string]interface{}) error {
+	var err error
+	m.path, err = _getSettingString(settings, "path", EchoModuleDefaultPath)
+	return err
+}
+
+func (m *BuiltinEchoModule) GetRestConfig() map[string]interface{} {
+	endPoints := make([]string, 0)
+	for _, verb := range supportedEndPointVerbs {
+		endPoints = append(endPoints, verb+"::/", verb+"::/{subPath:*}")
+	}
+	return map[string]interface{}{
+		"path":          m.path,
+		"consumeFormat": FormatAny,
+		"produceFormat": "json",
+		"endPoints":     endPoints,
+	}
+}
+
+func (m *BuiltinEchoModule) DoAction(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+	echo := map[string]interface{}{
+		"method":     request.Method,
+		"path":       request.URL.Path,
+		"query":      request.URL.Query(),
+		"headers":    request.Header,
+		"host":       request.Host,
+		"remoteAddr": request.RemoteAddr,
+		"tls":        request.TLS != nil,
+	}
+	if request.Body != nil {
+		if bArrBody, err := ioutil.ReadAll(request.Body); err == nil && len(bArrBody) > 0 {
+			echo["body"] = string(bArrBody)
+		}
+	}
+	if len(options) > 0 {
+		echo["requestId"] = options[0]["requestId"]
+		if clientCertificate, ok := options[0]["clientCertificate"]; ok {
+			echo["clientCertificate"] = clientCertificate
+		}
+	}
+	return echo
+}
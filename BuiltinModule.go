@@ -0,0 +1,159 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// prefix of the module path of a built-in module e.g. builtin/oidc; its settings (and modules.required
+// entry) use the name alone e.g. oidc
+const BuiltinModulePathPrefix = "builtin/"
+
+// structure of a module compiled into the server; the same contract as the symbols of a ".so" module
+type BuiltinModule struct {
+	GetRestConfig func() map[string]interface{}
+	DoAction      func(http.Request, string, ...map[string]interface{}) interface{}
+	Init          func(map[string]interface{}) error // optional
+	Shutdown      func() error                       // optional
+	Health        func() error                       // optional
+}
+
+// built-in modules by name; baseDir is the directory of the config file (relative files in the settings
+// are resolved against it)
+var builtinModules = map[string]func(baseDir string) *BuiltinModule{
+	"echo": NewBuiltinEchoModule,
+	"oidc": NewOidcModule,
+}
+
+// method to list the names of the built-in modules
+func BuiltinModuleNames() []string {
+	names := make([]string, 0, len(builtinModules))
+	for name := range builtinModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// method to get the paths of the modules to load, in order; the module files then the enabled built-in modules
+func (srv *Server) _getModulePaths() ([]string, error) {
+	modulePaths, err := srv._getModuleFilesFromRepos()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range srv.configContentJson.Modules.Builtin {
+		modulePaths = append(modulePaths, BuiltinModulePathPrefix+name)
+	}
+	return modulePaths, nil
+}
+
+// method to create a built-in module; Init receives the module's settings like a ".so" module's Init
+func (srv *Server) _loadBuiltinModule(modulePath string) (*EchoModule, error) {
+	newBuiltinModule, ok := builtinModules[strings.TrimPrefix(modulePath, BuiltinModulePathPrefix)]
+	if !ok {
+		return nil, fmt.Errorf("unknown built-in module [%v]", modulePath)
+	}
+	baseDir := ""
+	if srv.configFile != "" {
+		baseDir = filepath.Dir(srv.configFile)
+	}
+	builtinModule := newBuiltinModule(baseDir)
+	echoModPtr := NewEchoModule(nil, builtinModule.GetRestConfig, builtinModule.DoAction, modulePath)
+	echoModPtr.Settings = srv.configContentJson.ModuleSettings(modulePath)
+
+	if builtinModule.Init != nil {
+		if err := builtinModule.Init(echoModPtr.Settings); err != nil {
+			return nil, fmt.Errorf("module [%v] failed to initialize: %v", modulePath, err)
+		}
+		echoModPtr.FxInit = builtinModule.Init
+	}
+	// only set if present; a nil func in the symbol would look like a hook
+	if builtinModule.Shutdown != nil {
+		echoModPtr.FxShutdown = builtinModule.Shutdown
+	}
+	if builtinModule.Health != nil {
+		echoModPtr.FxHealth = builtinModule.Health
+	}
+	return echoModPtr, nil
+}
+
+// method to get a string setting; the default if missing
+func _getSettingString(settings map[string]interface{}, key string, defaultValue string) (string, error) {
+	value, ok := settings[key]
+	if !ok || value == nil {
+		return defaultValue, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("setting %v must be a string, got %v", key, _jsonTypeOf(value))
+	}
+	return text, nil
+}
+
+// method to get a number setting; the default if missing
+func _getSettingNumber(settings map[string]interface{}, key string, defaultValue float64) (float64, error) {
+	value, ok := settings[key]
+	if !ok || value == nil {
+		return defaultValue, nil
+	}
+	number, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("setting %v must be a number, got %v", key, _jsonTypeOf(value))
+	}
+	return number, nil
+}
+
+// method to get a list of strings setting; nil if missing
+func _getSettingStrings(settings map[string]interface{}, key string) ([]string, error) {
+	value, ok := settings[key]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("setting %v must be a list, got %v", key, _jsonTypeOf(value))
+	}
+	texts := make([]string, 0, len(list))
+	for idx, element := range list {
+		text, ok := element.(string)
+		if !ok {
+			return nil, fmt.Errorf("setting %v[%v] must be a string, got %v", key, idx, _jsonTypeOf(element))
+		}
+		texts = append(texts, text)
+	}
+	return texts, nil
+}
+
+// method to get an object setting; nil if missing
+func _getSettingObject(settings map[string]interface{}, key string) (map[string]interface{}, error) {
+	value, ok := settings[key]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("setting %v must be an object, got %v", key, _jsonTypeOf(value))
+	}
+	return object, nil
+}
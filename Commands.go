@@ -0,0 +1,200 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// the config file flag; accepted globally and by every command
+var configFlag = cli.StringFlag{
+	Name:   "config, C",
+	EnvVar: "envVarEchogogoConfig",
+	Usage:  "provide a targeted configuration file to startup the server. Can also use the environment-variable: ",
+}
+
+// print the output of an inspecting command as json (for CI pipelines)
+var jsonFlag = cli.BoolFlag{
+	Name:  "json",
+	Usage: "print the output as json",
+}
+
+// command to start the server
+func serveCommand(ctx *cli.Context) error {
+	srvPtr := NewServer(_getConfigFile(ctx))
+	return srvPtr.StartServer()
+}
+
+// command to list the modules of the repository
+func listModulesCommand(ctx *cli.Context) error {
+	moduleInfos, err := _inspectModules(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("json") {
+		return _printJson(moduleInfos)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "FILE\tKIND\tPATH\tCONSUMES\tPRODUCES\tENDPOINTS")
+	for _, moduleInfo := range moduleInfos {
+		endPoints := strings.Join(moduleInfo.EndPoints, ", ")
+		if len(moduleInfo.Errors) > 0 {
+			endPoints = "INVALID (see modules validate)"
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\n", moduleInfo.File, moduleInfo.Kind, moduleInfo.Path,
+			moduleInfo.ConsumeFormat, moduleInfo.ProduceFormat, endPoints)
+	}
+	return writer.Flush()
+}
+
+// command to validate the modules of the repository; exits with 1 if any module is invalid
+func validateModulesCommand(ctx *cli.Context) error {
+	moduleInfos, err := _inspectModules(ctx)
+	if err != nil {
+		return err
+	}
+	invalidCount := 0
+	for _, moduleInfo := range moduleInfos {
+		if len(moduleInfo.Errors) > 0 {
+			invalidCount++
+		}
+	}
+	if ctx.Bool("json") {
+		if err := _printJson(moduleInfos); err != nil {
+			return err
+		}
+	} else {
+		for _, moduleInfo := range moduleInfos {
+			if len(moduleInfo.Errors) == 0 {
+				fmt.Printf("OK      %v (%v)\n", moduleInfo.File, moduleInfo.Path)
+				continue
+			}
+			fmt.Printf("INVALID %v\n", moduleInfo.File)
+			for _, message := range moduleInfo.Errors {
+				fmt.Printf("        - %v\n", message)
+			}
+		}
+	}
+	if invalidCount > 0 {
+		return cli.NewExitError(fmt.Sprintf("%v of %v module(s) invalid", invalidCount, len(moduleInfos)), 1)
+	}
+	if !ctx.Bool("json") {
+		fmt.Printf("%v module(s) valid\n", len(moduleInfos))
+	}
+	return nil
+}
+
+// command to print the route table
+func routesCommand(ctx *cli.Context) error {
+	srvPtr, err := _newInspectingServer(ctx)
+	if err != nil {
+		return err
+	}
+	routes, err := srvPtr.BuildRouteTable()
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("json") {
+		return _printJson(routes)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "METHOD\tPATH\tMODULE\tCONSUMES\tPRODUCES")
+	for _, route := range routes {
+		module := route.Module
+		if module == "" {
+			module = "(server)"
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\n", route.Method, route.Path, module,
+			strings.Join(route.Consumes, ","), strings.Join(route.Produces, ","))
+	}
+	return writer.Flush()
+}
+
+// command to generate a declarative module out of an OpenAPI specification and write it to the given file
+func generateModuleFile(specFile, outFile, modulePath string) error {
+	if specFile == "" {
+		return fmt.Errorf("missing --spec; the OpenAPI specification to generate the module from")
+	}
+	moduleConfig, skipped, err := GenerateModuleFromOpenApi(specFile, modulePath)
+	if err != nil {
+		return err
+	}
+	for _, endPoint := range skipped {
+		fmt.Printf("skipped %v; the http verb can't be routed by a module\n", endPoint)
+	}
+	if outFile == "" {
+		outFile = strings.TrimPrefix(moduleConfig.Path, "/") + DeclarativeModuleSuffix
+	}
+	bArrContent, err := json.MarshalIndent(moduleConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(outFile, bArrContent, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("generated module %v with %v stub(s) => %v\n", moduleConfig.Path, len(moduleConfig.Stubs), outFile)
+	return nil
+}
+
+// method to load the config and inspect the modules
+func _inspectModules(ctx *cli.Context) ([]ModuleInfo, error) {
+	srvPtr, err := _newInspectingServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return srvPtr.InspectModules()
+}
+
+// method to create a server (config loaded) for the inspecting commands; only warnings and errors are logged
+func _newInspectingServer(ctx *cli.Context) (*Server, error) {
+	srvPtr := NewServer(_getConfigFile(ctx))
+	if err := srvPtr.loadConfig(); err != nil {
+		return nil, err
+	}
+	srvPtr.logger.ThresholdLogLevel = LogLevelWarning
+	// the inspecting commands exit without stopping a server (no flush); log synchronously
+	if asyncSink, ok := srvPtr.logger.Sink.(*AsyncLogSink); ok {
+		srvPtr.logger.Sink = asyncSink.sink
+	}
+	return srvPtr, nil
+}
+
+// method to get the config file; given to the command or globally (echogogo -C x.json routes)
+func _getConfigFile(ctx *cli.Context) string {
+	if configFile := ctx.String("config"); configFile != "" {
+		return configFile
+	}
+	return ctx.GlobalString("config")
+}
+
+// method to print a value as indented json
+func _printJson(value interface{}) error {
+	bArrContent, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bArrContent))
+	return nil
+}
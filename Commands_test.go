@@ -0,0 +1,290 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// a valid and an invalid (nested path) declarative module
+const testCommandsOrdersModule = `{ "path": "/orders", "stubs": [
+  { "path": "/{id}", "response": { "body": "order" } },
+  { "method": "POST", "path": "/", "response": { "status": 201, "body": "created" } } ] }`
+const testCommandsBrokenModule = `{ "path": "/shop/carts", "stubs": [ { "path": "/", "response": { "body": "cart" } } ] }`
+
+// method to write a config file (and its module repository) into a temporary directory; returns the
+// config file and the cleanup func. A port of 0 keeps the default port
+func newTestCommandsConfig(t *testing.T, port int, isBrokenIncluded bool) (string, func()) {
+	dir, err := ioutil.TempDir("", "echogogo-commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := map[string]string{"orders" + DeclarativeModuleSuffix: testCommandsOrdersModule}
+	if isBrokenIncluded {
+		modules["broken"+DeclarativeModuleSuffix] = testCommandsBrokenModule
+	}
+	if err := os.Mkdir(filepath.Join(dir, "modules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range modules {
+		if err := ioutil.WriteFile(filepath.Join(dir, "modules", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configFile := filepath.Join(dir, "config.json")
+	config := `{ "modules": { "repository": "modules" }, "logging": { "accessLog": false } }`
+	if port > 0 {
+		config = fmt.Sprintf(`{ "server": { "port": %v }, "modules": { "repository": "modules" }, "logging": { "accessLog": false } }`, port)
+	}
+	if err := ioutil.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configFile, func() { os.RemoveAll(dir) }
+}
+
+// method to run the command line app like main does; returns stdout, stderr and the exit code
+// (an ExitCoder's code, 1 for any other error as main log.Fatal's)
+func runTestCli(t *testing.T, args ...string) (string, string, int) {
+	exitCode := 0
+	var stderr bytes.Buffer
+	defer func(osExiter func(int), errWriter io.Writer) {
+		cli.OsExiter = osExiter
+		cli.ErrWriter = errWriter
+	}(cli.OsExiter, cli.ErrWriter)
+	cli.OsExiter = func(code int) {
+		exitCode = code
+	}
+	cli.ErrWriter = &stderr
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		bArrOutput, _ := ioutil.ReadAll(reader)
+		output <- string(bArrOutput)
+	}()
+	err = newCliApp().Run(append([]string{"echogogo"}, args...))
+	os.Stdout = stdout
+	writer.Close()
+
+	if err != nil {
+		fmt.Fprintln(&stderr, err)
+		if exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	return <-output, stderr.String(), exitCode
+}
+
+// method to get a port nobody listens on
+func getTestFreePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestModulesListCommand(t *testing.T) {
+	configFile, cleanup := newTestCommandsConfig(t, 0, true)
+	defer cleanup()
+
+	output, stderr, exitCode := runTestCli(t, "modules", "list", "-C", configFile)
+	if exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %v: %v", exitCode, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "FILE") || !strings.Contains(lines[0], "ENDPOINTS") {
+		t.Fatalf("expected a header and 2 modules, got:\n%v", output)
+	}
+	// sorted by file name; the invalid module is listed too
+	if !strings.Contains(lines[1], "broken"+DeclarativeModuleSuffix) || !strings.Contains(lines[1], "INVALID (see modules validate)") {
+		t.Errorf("expected the broken module marked invalid, got %v", lines[1])
+	}
+	if !strings.Contains(lines[2], "orders"+DeclarativeModuleSuffix) || !strings.Contains(lines[2], "declarative") ||
+		!strings.Contains(lines[2], "/orders") || !strings.Contains(lines[2], "GET::/{id}, POST::/") {
+		t.Errorf("expected the orders module with its path and endpoints, got %v", lines[2])
+	}
+
+	// the global config flag works too
+	output, _, exitCode = runTestCli(t, "-C", configFile, "modules", "list", "--json")
+	var moduleInfos []ModuleInfo
+	if err := json.Unmarshal([]byte(output), &moduleInfos); err != nil || exitCode != 0 {
+		t.Fatalf("expected the modules as json (exit code 0), got %v (%v, exit code %v)", output, err, exitCode)
+	}
+	if len(moduleInfos) != 2 || len(moduleInfos[0].Errors) == 0 || moduleInfos[1].Path != "/orders" || len(moduleInfos[1].Errors) != 0 {
+		t.Errorf("expected the broken and the orders module, got %+v", moduleInfos)
+	}
+}
+
+func TestModulesValidateCommand(t *testing.T) {
+	validConfigFile, cleanupValid := newTestCommandsConfig(t, 0, false)
+	defer cleanupValid()
+	output, stderr, exitCode := runTestCli(t, "modules", "validate", "-C", validConfigFile)
+	if exitCode != 0 || !strings.Contains(output, "OK      ") || !strings.Contains(output, "1 module(s) valid") {
+		t.Errorf("expected the orders module valid (exit code 0), got exit code %v:\n%v%v", exitCode, output, stderr)
+	}
+
+	configFile, cleanup := newTestCommandsConfig(t, 0, true)
+	defer cleanup()
+	output, stderr, exitCode = runTestCli(t, "modules", "validate", "-C", configFile)
+	if exitCode != 1 {
+		t.Errorf("expected exit code 1 of an invalid module, got %v", exitCode)
+	}
+	if !strings.Contains(output, "INVALID ") || !strings.Contains(output, "        - invalid declarative module") || !strings.Contains(output, "path must be a single segment like /orders") {
+		t.Errorf("expected the broken module with its error, got:\n%v", output)
+	}
+	if strings.Contains(output, "module(s) valid") || !strings.Contains(stderr, "1 of 2 module(s) invalid") {
+		t.Errorf("expected the summary of the invalid modules on stderr, got:\n%v%v", output, stderr)
+	}
+
+	output, _, exitCode = runTestCli(t, "modules", "validate", "--json", "-C", configFile)
+	var moduleInfos []ModuleInfo
+	if err := json.Unmarshal([]byte(output), &moduleInfos); err != nil || len(moduleInfos) != 2 || exitCode != 1 {
+		t.Errorf("expected 2 modules as json and exit code 1, got %v (%v, exit code %v)", output, err, exitCode)
+	}
+
+	// a config which can't be loaded
+	if _, stderr, exitCode := runTestCli(t, "modules", "validate", "-C", configFile+".missing"); exitCode != 1 || stderr == "" {
+		t.Errorf("expected exit code 1 and the error of a missing config, got %v %v", exitCode, stderr)
+	}
+}
+
+func TestRoutesCommand(t *testing.T) {
+	configFile, cleanup := newTestCommandsConfig(t, 0, false)
+	defer cleanup()
+
+	output, stderr, exitCode := runTestCli(t, "routes", "-C", configFile)
+	if exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %v: %v", exitCode, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if !strings.HasPrefix(lines[0], "METHOD") {
+		t.Errorf("expected the header first, got %v", lines[0])
+	}
+	for _, expected := range [][]string{
+		{"GET", "/orders/{id}", "orders" + DeclarativeModuleSuffix},
+		{"POST", "/orders/", "orders" + DeclarativeModuleSuffix},
+		{"GET", LivenessWebservicePath + "/", "(server)"},
+		{"GET", OpenApiWebservicePath + "/", "(server)"},
+	} {
+		found := false
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) >= 3 && fields[0] == expected[0] && fields[1] == expected[1] && strings.HasSuffix(fields[2], expected[2]) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected the route %v, got:\n%v", expected, output)
+		}
+	}
+
+	output, _, exitCode = runTestCli(t, "routes", "--json", "-C", configFile)
+	var routes []RouteInfo
+	if err := json.Unmarshal([]byte(output), &routes); err != nil || exitCode != 0 || len(routes) != len(lines)-1 {
+		t.Errorf("expected the same %v routes as json, got %v (%v, exit code %v)", len(lines)-1, output, err, exitCode)
+	}
+
+	// a module which can't be served fails the command
+	brokenConfigFile, cleanupBroken := newTestCommandsConfig(t, 0, true)
+	defer cleanupBroken()
+	if _, stderr, exitCode := runTestCli(t, "routes", "-C", brokenConfigFile); exitCode != 1 || stderr == "" {
+		t.Errorf("expected exit code 1 and the error of the broken module, got %v %v", exitCode, stderr)
+	}
+}
+
+func TestServeCommand(t *testing.T) {
+	port := getTestFreePort(t)
+	configFile, cleanup := newTestCommandsConfig(t, port, false)
+	defer cleanup()
+
+	type cliResult struct {
+		output   string
+		stderr   string
+		exitCode int
+	}
+	result := make(chan cliResult, 1)
+	go func() {
+		output, stderr, exitCode := runTestCli(t, "serve", "-C", configFile)
+		result <- cliResult{output, stderr, exitCode}
+	}()
+
+	// the signal handler is in place once the server listens
+	baseUrl := fmt.Sprintf("http://127.0.0.1:%v", port)
+	var response *http.Response
+	var err error
+	for idx := 0; idx < 100; idx++ {
+		if response, err = http.Get(baseUrl + "/orders/42"); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("expected the server to serve the orders module, got %v", err)
+	}
+	bArrBody, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(bArrBody), "order") {
+		t.Errorf("expected the orders stub, got %v %v", response.StatusCode, string(bArrBody))
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case served := <-result:
+		if served.exitCode != 0 {
+			t.Errorf("expected exit code 0 after SIGTERM, got %v: %v", served.exitCode, served.stderr)
+		}
+		if !strings.Contains(served.output, fmt.Sprintf("SERVER started at :%v", port)) || !strings.Contains(served.output, "stopping SERVER") {
+			t.Errorf("expected the start and stop logged, got:\n%v", served.output)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the server to stop on SIGTERM")
+	}
+
+	// a port in use can't be served
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if _, stderr, exitCode := runTestCli(t, "serve", "-C", configFile); exitCode != 1 || !strings.Contains(stderr, "address already in use") {
+		t.Errorf("expected exit code 1 of a port in use, got %v %v", exitCode, stderr)
+	}
+}
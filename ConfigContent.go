@@ -20,35 +20,541 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// prefix of the environment variables overriding the config e.g. ECHOGOGO_SERVER_PORT=9000
+const ConfigEnvPrefix = "ECHOGOGO_"
+
 type ConfigContent struct {
-	ModuleRepositoryLocation string `json:"moduleRepositoryLocation" description:"location to find the module(s)"`
+	ModuleRepositoryLocation string `json:"moduleRepositoryLocation" description:"location to find the module(s); same as modules.repository (kept for older config files)"`
+	Server ServerConfig `json:"server"`
+	Logging LoggingConfig `json:"logging"`
+	Cors CorsConfig `json:"cors"`
+	Tracing TracingConfig `json:"tracing"`
+	Modules ModulesConfig `json:"modules"`
+	Faults []FaultConfig `json:"faults" description:"fault injection (latency, errors, resets...) per module or endpoint"`
+	Auth []AuthConfig `json:"auth" description:"credentials (basic auth, api keys, JWTs) required per module or endpoint"`
+	RateLimits []RateLimitConfig `json:"rateLimits" description:"token bucket rate limits per module or endpoint, keyed by client ip, header or api key"`
+
+	// problems found while loading that do not stop the server (e.g. unknown ECHOGOGO_* variables); logged on start
+	warnings []string
+}
+
+type ServerConfig struct {
+	Host string `json:"host" description:"interface to listen on; empty means all"`
+	Port int `json:"port" description:"port to listen on (default 8001)"`
+	ReadTimeoutMs int `json:"readTimeoutMs" description:"max duration to read a request; 0 means no timeout"`
+	WriteTimeoutMs int `json:"writeTimeoutMs" description:"max duration to write a response; 0 means no timeout"`
+	ShutdownTimeoutMs int `json:"shutdownTimeoutMs" description:"max duration for in-flight requests to finish when stopping (default 5000)"`
+	ShutdownDelayMs int `json:"shutdownDelayMs" description:"duration /readyz fails before the server stops accepting requests; 0 means none"`
+	Tls TlsConfig `json:"tls"`
+}
+
+type TlsConfig struct {
+	CertFile string `json:"certFile" description:"PEM certificate (chain) of the server; https is served when given"`
+	KeyFile string `json:"keyFile" description:"PEM private key of the server certificate"`
+	ClientCaFile string `json:"clientCaFile" description:"PEM bundle of the CAs client certificates are verified against"`
+	ClientAuth string `json:"clientAuth" description:"none (default), request (verified if presented) or require"`
+}
+
+type LoggingConfig struct {
+	Level string `json:"level" description:"trace, debug, info (default), warning or error"`
+	AccessLog bool `json:"accessLog" description:"log a line (method, uri, status, bytes, duration) per request (default true)"`
+	Caller bool `json:"caller" description:"derive the file, line and function of a log line from the caller (default true; false skips the small overhead per line)"`
+	Output string `json:"output" description:"stdout (default), syslog (RFC 5424) or journald (native protocol)"`
+	AppName string `json:"appName" description:"APP-NAME of syslog messages / SYSLOG_IDENTIFIER of journald entries (default echogogo)"`
+	Syslog SyslogConfig `json:"syslog"`
+	Journald JournaldConfig `json:"journald"`
+	Async AsyncLoggingConfig `json:"async"`
+}
+
+type AsyncLoggingConfig struct {
+	Enabled bool `json:"enabled" description:"write the log lines from a background writer instead of the request path"`
+	BufferSize int `json:"bufferSize" description:"log lines waiting to be written (default 1024)"`
+	Overflow string `json:"overflow" description:"block (default; wait for room) or drop (lose the line) when the buffer is full"`
 }
 
+type SyslogConfig struct {
+	Network string `json:"network" description:"udp (default) or unix"`
+	Address string `json:"address" description:"host:port for udp e.g. localhost:514, the socket path for unix e.g. /dev/log"`
+	Facility string `json:"facility" description:"user (default), daemon, local0..local7 etc"`
+}
+
+type JournaldConfig struct {
+	Socket string `json:"socket" description:"default /run/systemd/journal/socket"`
+}
+
+// span exporters
+const (
+	TracingExporterStdout = "stdout"
+	TracingExporterFile = "file"
+)
 
-// method to load config content based on the given configuration file location
+type TracingConfig struct {
+	Enabled bool `json:"enabled" description:"create spans per request and echo the trace context (W3C traceparent or B3) back"`
+	Exporter string `json:"exporter" description:"stdout (default) or file; spans are written as OTLP json lines"`
+	File string `json:"file" description:"file the spans are appended to (exporter file); relative to the config file's directory"`
+	ServiceName string `json:"serviceName" description:"service.name of the exported spans (default echogogo)"`
+}
+
+type CorsConfig struct {
+	Enabled bool `json:"enabled" description:"answer CORS preflight requests and add the CORS headers (default true)"`
+	AllowedDomains []string `json:"allowedDomains" description:"default *"`
+	AllowedHeaders []string `json:"allowedHeaders" description:"default Content-Type, Accept"`
+	AllowedMethods []string `json:"allowedMethods" description:"default PUT, POST, DELETE, GET"`
+	ExposeHeaders []string `json:"exposeHeaders"`
+	CookiesAllowed bool `json:"cookiesAllowed"`
+	MaxAge int `json:"maxAge" description:"seconds a preflight response can be cached; 0 means not sent"`
+}
+
+type ModulesConfig struct {
+	Repository string `json:"repository" description:"location to find the module(s) (default modules)"`
+	Repositories []string `json:"repositories" description:"locations to find the module(s), scanned in order (used instead of repository)"`
+	Recursive bool `json:"recursive" description:"scan the sub directories of the repositories too"`
+	Include []string `json:"include" description:"glob patterns (relative to the repository) a module file must match e.g. orders/*.so or **/*.echo.json"`
+	Exclude []string `json:"exclude" description:"glob patterns of module files to skip"`
+	List []ModuleEntry `json:"list" description:"explicit ordered list of module files; when given, repositories are not scanned"`
+	Builtin []string `json:"builtin" description:"built-in modules to load after the module files e.g. oidc"`
+	Required []string `json:"required" description:"module file names (e.g. orders.so) or built-in module names that must be loaded for /readyz to pass"`
+	Settings map[string]map[string]interface{} `json:"settings" description:"settings per module, keyed by module file name e.g. orders.so (or built-in module name e.g. oidc); given to the module's Init and DoAction"`
+}
+
+type ModuleEntry struct {
+	File string `json:"file" description:"module file (.so or .echo.json); relative to the config file's directory"`
+	Enabled *bool `json:"enabled" description:"default true"`
+}
+
+// method to check if the module entry should be loaded (enabled unless set to false)
+func (e ModuleEntry) IsEnabled() bool {
+	return e.Enabled == nil || *e.Enabled
+}
+
+// ctor. Create instance of *ConfigContent holding the defaults
+func NewConfigContent() *ConfigContent {
+	configContent := new(ConfigContent)
+	configContent.Server.Port = 8001
+	configContent.Server.ShutdownTimeoutMs = 5000
+	configContent.Server.Tls.ClientAuth = TlsClientAuthNone
+	configContent.Logging.Level = "info"
+	configContent.Logging.AccessLog = true
+	configContent.Logging.Caller = true
+	configContent.Logging.Output = LogOutputStdout
+	configContent.Logging.AppName = "echogogo"
+	configContent.Logging.Syslog.Network = "udp"
+	configContent.Logging.Syslog.Facility = "user"
+	configContent.Logging.Journald.Socket = DefaultJournaldSocket
+	configContent.Logging.Async.BufferSize = 1024
+	configContent.Logging.Async.Overflow = LogOverflowBlock
+	configContent.Tracing.Exporter = TracingExporterStdout
+	configContent.Tracing.ServiceName = "echogogo"
+	configContent.Cors.Enabled = true
+	configContent.Cors.AllowedDomains = []string{"*"}
+	configContent.Cors.AllowedHeaders = []string{"Content-Type", "Accept"}
+	configContent.Cors.AllowedMethods = []string{"PUT", "POST", "DELETE", "GET"}
+
+	return configContent
+}
+
+// method to load config content based on the given configuration file location; json, yaml (.yaml / .yml)
+// and toml (.toml) are accepted. Missing entries keep their defaults and ECHOGOGO_* environment
+// variables override the file. An empty location means defaults (and environment variables) only
 func LoadConfigContent(cfgFile string) (*ConfigContent, error) {
-	content, err := os.Open(cfgFile)
-	defer func() {
-		content.Close()
-	}()
-	if err != nil {
-		return nil, err
+	configContent := NewConfigContent()
+	if cfgFile != "" {
+		bArrContent, err := ioutil.ReadFile(cfgFile)
+		if err != nil {
+			return nil, err
+		}
+		var document interface{}
+		switch strings.ToLower(filepath.Ext(cfgFile)) {
+		case ".json":
+			err = json.Unmarshal(bArrContent, &document)
+		case ".yaml", ".yml":
+			document, err = ParseYaml(bArrContent)
+		case ".toml":
+			document, err = ParseToml(bArrContent)
+		default:
+			return nil, fmt.Errorf("invalid config file [%v]: unsupported format, use .json, .yaml, .yml or .toml", cfgFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file [%v]: %v", cfgFile, err)
+		}
+		if configErrors := _decodeConfigValue("", document, reflect.ValueOf(configContent).Elem()); len(configErrors) > 0 {
+			return nil, fmt.Errorf("invalid config file [%v]:\n  %v", cfgFile, strings.Join(configErrors, "\n  "))
+		}
 	}
-	bArrContent, err := ioutil.ReadAll(content)
-	if err != nil {
+	if err := configContent.applyEnvOverrides(os.Environ()); err != nil {
 		return nil, err
 	}
+	// modules.repository wins over the older moduleRepositoryLocation
+	if configContent.Modules.Repository == "" {
+		configContent.Modules.Repository = configContent.ModuleRepositoryLocation
+	}
+	if configContent.Modules.Repository == "" {
+		configContent.Modules.Repository = "modules"
+	}
+	// relative paths are relative to the config file (not to the directory the server is started from)
+	if cfgFile != "" {
+		configContent.resolvePaths(filepath.Dir(cfgFile))
+	}
+	if err := configContent.validate(); err != nil {
+		if cfgFile == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid config file [%v]: %v", cfgFile, err)
+	}
+	return configContent, nil
+}
 
-	var configContent ConfigContent
-	err = json.Unmarshal(bArrContent, &configContent)
-	if err != nil {
-		return nil, err
-	} else {
-		return &configContent, nil
+// method to override the config with ECHOGOGO_* environment variables; the name is the path of the
+// entry in upper case with "_" in between e.g. ECHOGOGO_SERVER_PORT or ECHOGOGO_CORS_ALLOWEDDOMAINS
+// (lists are comma separated). Only string, number, boolean and list of string entries can be set; unknown
+// ECHOGOGO_* variables are ignored with a warning (other tools might share the prefix)
+func (c *ConfigContent) applyEnvOverrides(environ []string) error {
+	entries := make(map[string]reflect.Value)
+	_collectConfigEnvEntries(strings.TrimSuffix(ConfigEnvPrefix, "_"), reflect.ValueOf(c).Elem(), entries)
+
+	configErrors := make([]string, 0)
+	for _, env := range environ {
+		parts := strings.SplitN(env, "=", 2)
+		if !strings.HasPrefix(parts[0], ConfigEnvPrefix) || len(parts) != 2 {
+			continue
+		}
+		field, ok := entries[parts[0]]
+		if !ok {
+			c.warnings = append(c.warnings, fmt.Sprintf("ignoring unknown environment variable %v", parts[0]))
+			continue
+		}
+		value := parts[1]
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				configErrors = append(configErrors, fmt.Sprintf("%v: expected an integer but was [%v]", parts[0], value))
+				continue
+			}
+			field.SetInt(int64(number))
+		case reflect.Float64:
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				configErrors = append(configErrors, fmt.Sprintf("%v: expected a number but was [%v]", parts[0], value))
+				continue
+			}
+			field.SetFloat(number)
+		case reflect.Bool:
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				configErrors = append(configErrors, fmt.Sprintf("%v: expected true or false but was [%v]", parts[0], value))
+				continue
+			}
+			field.SetBool(flag)
+		case reflect.Slice:
+			values := make([]string, 0)
+			for _, element := range strings.Split(value, ",") {
+				if element = strings.TrimSpace(element); element != "" {
+					values = append(values, element)
+				}
+			}
+			field.Set(reflect.ValueOf(values))
+		}
+	}
+	if len(configErrors) > 0 {
+		sort.Strings(configErrors)
+		return fmt.Errorf("invalid environment variable(s):\n  %v", strings.Join(configErrors, "\n  "))
 	}
+	sort.Strings(c.warnings)
+	return nil
 }
 
+// method to check the values of the config and resolve the module repository
+func (c *ConfigContent) validate() error {
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		return fmt.Errorf("server.port must be within 1..65535 => %v", c.Server.Port)
+	}
+	if c.Server.ReadTimeoutMs < 0 || c.Server.WriteTimeoutMs < 0 || c.Server.ShutdownTimeoutMs < 0 || c.Server.ShutdownDelayMs < 0 {
+		return fmt.Errorf("server.readTimeoutMs, server.writeTimeoutMs, server.shutdownTimeoutMs and server.shutdownDelayMs can't be negative")
+	}
+	if (c.Server.Tls.CertFile == "") != (c.Server.Tls.KeyFile == "") {
+		return fmt.Errorf("server.tls.certFile and server.tls.keyFile go together")
+	}
+	switch c.Server.Tls.ClientAuth {
+	case TlsClientAuthNone:
+	case TlsClientAuthRequest, TlsClientAuthRequire:
+		if c.Server.Tls.CertFile == "" || c.Server.Tls.ClientCaFile == "" {
+			return fmt.Errorf("server.tls.clientAuth %v needs server.tls.certFile, keyFile and clientCaFile", c.Server.Tls.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("server.tls.clientAuth must be none, request or require => %v", c.Server.Tls.ClientAuth)
+	}
+	if _, err := ParseLogLevel(c.Logging.Level); err != nil {
+		return fmt.Errorf("logging.level: %v", err)
+	}
+	switch c.Logging.Output {
+	case LogOutputStdout, LogOutputJournald:
+	case LogOutputSyslog:
+		if c.Logging.Syslog.Network != "udp" && c.Logging.Syslog.Network != "unix" {
+			return fmt.Errorf("logging.syslog.network must be udp or unix => %v", c.Logging.Syslog.Network)
+		}
+		if c.Logging.Syslog.Address == "" {
+			return fmt.Errorf("logging.syslog.address is required for the syslog output")
+		}
+		if _, ok := syslogFacilities[c.Logging.Syslog.Facility]; !ok {
+			return fmt.Errorf("logging.syslog.facility: unknown facility [%v]", c.Logging.Syslog.Facility)
+		}
+	default:
+		return fmt.Errorf("logging.output must be stdout, syslog or journald => %v", c.Logging.Output)
+	}
+	if c.Logging.Async.BufferSize < 1 {
+		return fmt.Errorf("logging.async.bufferSize must be positive => %v", c.Logging.Async.BufferSize)
+	}
+	if c.Logging.Async.Overflow != LogOverflowBlock && c.Logging.Async.Overflow != LogOverflowDrop {
+		return fmt.Errorf("logging.async.overflow must be block or drop => %v", c.Logging.Async.Overflow)
+	}
+	if c.Cors.MaxAge < 0 {
+		return fmt.Errorf("cors.maxAge can't be negative => %v", c.Cors.MaxAge)
+	}
+	switch c.Tracing.Exporter {
+	case TracingExporterStdout:
+	case TracingExporterFile:
+		if c.Tracing.File == "" {
+			return fmt.Errorf("tracing.file is required for the file exporter")
+		}
+	default:
+		return fmt.Errorf("tracing.exporter must be stdout or file => %v", c.Tracing.Exporter)
+	}
+	for idx, moduleFileName := range c.Modules.Required {
+		if moduleFileName == "" || strings.ContainsAny(moduleFileName, "/\\") {
+			return fmt.Errorf("modules.required[%v]: expected a module file name e.g. orders.so => [%v]", idx, moduleFileName)
+		}
+	}
+	for idx, name := range c.Modules.Builtin {
+		if _, ok := builtinModules[name]; !ok {
+			return fmt.Errorf("modules.builtin[%v]: unknown built-in module [%v], available are %v", idx, name, strings.Join(BuiltinModuleNames(), ", "))
+		}
+	}
+	for idx, entry := range c.Modules.List {
+		if entry.File == "" {
+			return fmt.Errorf("modules.list[%v].file is missing", idx)
+		}
+	}
+	for _, pattern := range append(append([]string{}, c.Modules.Include...), c.Modules.Exclude...) {
+		if _, err := path.Match(strings.Replace(pattern, "**", "*", -1), ""); err != nil {
+			return fmt.Errorf("modules.include / modules.exclude: invalid glob pattern [%v]", pattern)
+		}
+	}
+	if len(c.Modules.Repositories) == 0 {
+		c.Modules.Repositories = []string{c.Modules.Repository}
+	}
+	c.Modules.Repository = c.Modules.Repositories[0]
+	c.ModuleRepositoryLocation = c.Modules.Repository
+	return nil
+}
+
+// method to get the settings of the module (keyed by its file name); an empty map if none are configured
+func (c *ConfigContent) ModuleSettings(modulePath string) map[string]interface{} {
+	if settings, ok := c.Modules.Settings[filepath.Base(modulePath)]; ok && settings != nil {
+		return settings
+	}
+	return make(map[string]interface{})
+}
+
+// method to resolve the relative repositories and module files against the given directory
+func (c *ConfigContent) resolvePaths(baseDir string) {
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(baseDir, file)
+	}
+	c.Tracing.File = resolve(c.Tracing.File)
+	c.Server.Tls.CertFile = resolve(c.Server.Tls.CertFile)
+	c.Server.Tls.KeyFile = resolve(c.Server.Tls.KeyFile)
+	c.Server.Tls.ClientCaFile = resolve(c.Server.Tls.ClientCaFile)
+	for idx := range c.Auth {
+		if c.Auth[idx].Jwt != nil {
+			c.Auth[idx].Jwt.SecretFile = resolve(c.Auth[idx].Jwt.SecretFile)
+			c.Auth[idx].Jwt.PublicKeyFile = resolve(c.Auth[idx].Jwt.PublicKeyFile)
+		}
+	}
+	c.Modules.Repository = resolve(c.Modules.Repository)
+	for idx := range c.Modules.Repositories {
+		c.Modules.Repositories[idx] = resolve(c.Modules.Repositories[idx])
+	}
+	for idx := range c.Modules.List {
+		c.Modules.List[idx].File = resolve(c.Modules.List[idx].File)
+	}
+}
+
+// method to get the address the server listens on e.g. :8001
+func (c *ConfigContent) ListenAddress() string {
+	return fmt.Sprintf("%v:%v", c.Server.Host, c.Server.Port)
+}
+
+// method to decode a parsed (json, yaml or toml) value into the config structure; every unknown key
+// and every value of the wrong type is reported with its path e.g. "server.port"
+func _decodeConfigValue(path string, value interface{}, target reflect.Value) []string {
+	describe := func() string {
+		if path == "" {
+			return "config"
+		}
+		return path
+	}
+	switch target.Kind() {
+	case reflect.Ptr:
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		element := reflect.New(target.Type().Elem())
+		configErrors := _decodeConfigValue(path, value, element.Elem())
+		target.Set(element)
+		return configErrors
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected an object but was %v", describe(), _jsonTypeOf(value))}
+		}
+		fields := _getConfigFields(target.Type())
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		configErrors := make([]string, 0)
+		for _, key := range keys {
+			fieldIdx, ok := fields[key]
+			if !ok {
+				configErrors = append(configErrors, fmt.Sprintf("%v: unknown key", _joinConfigPath(path, key)))
+				continue
+			}
+			configErrors = append(configErrors, _decodeConfigValue(_joinConfigPath(path, key), object[key], target.Field(fieldIdx))...)
+		}
+		return configErrors
+	case reflect.Slice:
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected a list but was %v", describe(), _jsonTypeOf(value))}
+		}
+		slice := reflect.MakeSlice(target.Type(), len(array), len(array))
+		configErrors := make([]string, 0)
+		for idx, element := range array {
+			configErrors = append(configErrors, _decodeConfigValue(fmt.Sprintf("%v[%v]", describe(), idx), element, slice.Index(idx))...)
+		}
+		target.Set(slice)
+		return configErrors
+	case reflect.Map:
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected an object but was %v", describe(), _jsonTypeOf(value))}
+		}
+		mapping := reflect.MakeMap(target.Type())
+		configErrors := make([]string, 0)
+		for key, element := range object {
+			mapValue := reflect.New(target.Type().Elem()).Elem()
+			configErrors = append(configErrors, _decodeConfigValue(_joinConfigPath(path, key), element, mapValue)...)
+			mapping.SetMapIndex(reflect.ValueOf(key), mapValue)
+		}
+		target.Set(mapping)
+		return configErrors
+	case reflect.Interface:
+		if value != nil {
+			target.Set(reflect.ValueOf(value))
+		}
+		return nil
+	case reflect.String:
+		text, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected a string but was %v", describe(), _jsonTypeOf(value))}
+		}
+		target.SetString(text)
+	case reflect.Bool:
+		flag, ok := value.(bool)
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected true or false but was %v", describe(), _jsonTypeOf(value))}
+		}
+		target.SetBool(flag)
+	case reflect.Int, reflect.Int64:
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return []string{fmt.Sprintf("%v: expected an integer but was %v", describe(), JsonValueToString(value))}
+		}
+		target.SetInt(int64(number))
+	case reflect.Float64:
+		number, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected a number but was %v", describe(), _jsonTypeOf(value))}
+		}
+		target.SetFloat(number)
+	default:
+		return []string{fmt.Sprintf("%v: unsupported config type %v", describe(), target.Type())}
+	}
+	return nil
+}
+
+// method to map the json names of the exported fields to their index
+func _getConfigFields(structType reflect.Type) map[string]int {
+	fields := make(map[string]int)
+	for idx := 0; idx < structType.NumField(); idx++ {
+		field := structType.Field(idx)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = idx
+	}
+	return fields
+}
+
+// method to collect the entries settable through environment variables (prefix_SECTION_KEY => field)
+func _collectConfigEnvEntries(prefix string, target reflect.Value, entries map[string]reflect.Value) {
+	fields := _getConfigFields(target.Type())
+	for name, idx := range fields {
+		field := target.Field(idx)
+		envName := prefix + "_" + strings.ToUpper(name)
+		switch field.Kind() {
+		case reflect.Struct:
+			_collectConfigEnvEntries(envName, field, entries)
+		case reflect.String, reflect.Int, reflect.Float64, reflect.Bool:
+			entries[envName] = field
+		case reflect.Slice:
+			if field.Type().Elem().Kind() == reflect.String {
+				entries[envName] = field
+			}
+		}
+	}
+}
+
+// method to join the path of a config entry
+func _joinConfigPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,55 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvOverrides(t *testing.T) {
+	configContent := NewConfigContent()
+	err := configContent.applyEnvOverrides([]string{
+		"ECHOGOGO_SERVER_PORT=9000",
+		"ECHOGOGO_LOGGING_CALLER=false",
+		"ECHOGOGO_CORS_ALLOWEDDOMAINS=http://a.com, http://b.com,",
+		"ECHOGOGO_VERSION=1.2.3",
+		"ECHOGOGO_HOME=/opt/echogogo",
+		"PATH=/usr/bin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configContent.Server.Port != 9000 || configContent.Logging.Caller || !reflect.DeepEqual(configContent.Cors.AllowedDomains, []string{"http://a.com", "http://b.com"}) {
+		t.Errorf("expected the overrides applied, got %v %v %v", configContent.Server.Port, configContent.Logging.Caller, configContent.Cors.AllowedDomains)
+	}
+	// unknown ECHOGOGO_* variables do not stop the server
+	expectedWarnings := []string{"ignoring unknown environment variable ECHOGOGO_HOME", "ignoring unknown environment variable ECHOGOGO_VERSION"}
+	if !reflect.DeepEqual(configContent.warnings, expectedWarnings) {
+		t.Errorf("expected %v, got %v", expectedWarnings, configContent.warnings)
+	}
+}
+
+func TestApplyEnvOverridesInvalidValues(t *testing.T) {
+	err := NewConfigContent().applyEnvOverrides([]string{"ECHOGOGO_SERVER_PORT=http", "ECHOGOGO_CORS_ENABLED=maybe"})
+	if err == nil || !strings.Contains(err.Error(), "ECHOGOGO_SERVER_PORT: expected an integer") || !strings.Contains(err.Error(), "ECHOGOGO_CORS_ENABLED: expected true or false") {
+		t.Errorf("expected both invalid values reported, got %v", err)
+	}
+}
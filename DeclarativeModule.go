@@ -0,0 +1,360 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// file suffix of a declarative module (a module described in json instead of a compiled ".so")
+const DeclarativeModuleSuffix = ".echo.json"
+
+// priority of a stub without an explicit priority (1 is the highest priority)
+const DefaultStubPriority = 5
+
+// structure of a declarative module file
+type DeclarativeModuleConfig struct {
+	Path          string                 `json:"path" description:"webservice path of the module e.g. /orders"`
+	ConsumeFormat string                 `json:"consumeFormat" description:"json, xml or xml_json"`
+	ProduceFormat string                 `json:"produceFormat" description:"json, xml or xml_json"`
+	Scenarios     []ScenarioConfig       `json:"scenarios" description:"named scenarios (state machines) used by the stubs"`
+	Stubs         []StubConfig           `json:"stubs" description:"canned responses of the module"`
+	Proxy         *ProxyConfig           `json:"proxy" description:"forward unmatched requests upstream (record / passthrough) or serve recorded stubs (replay)"`
+	Schemas       map[string]interface{} `json:"schemas" description:"endpoint e.g. GET::/{id} => summary, requestSchema and responseSchema for the OpenAPI document"`
+}
+
+// structure of a stub; a canned response for a given http verb + path
+type StubConfig struct {
+	Name          string                 `json:"name,omitempty" description:"optional name, used in logs"`
+	Method        string                 `json:"method" description:"http verb (default GET)"`
+	Path          string                 `json:"path" description:"route path relative to the module path e.g. /{id}"`
+	Priority      int                    `json:"priority,omitempty" description:"stubs with a lower value are evaluated first (default 5)"`
+	Request       *RequestMatchConfig    `json:"request,omitempty" description:"optional rules on query parameters, headers, cookies and body"`
+	Scenario      string                 `json:"scenario,omitempty" description:"scenario this stub takes part in"`
+	RequiredState string                 `json:"requiredState,omitempty" description:"the stub only matches while the scenario is in this state"`
+	NewState      string                 `json:"newState,omitempty" description:"state the scenario moves to after this stub has matched"`
+	RequestSchema map[string]interface{} `json:"requestSchema,omitempty" description:"JSON Schema the (json) request body of the stub's endpoint must honour"`
+	RequestXsd    string                 `json:"requestXsd,omitempty" description:"xml schema (inline or a .xsd file relative to the module file) the (xml) request body must honour"`
+	Response      StubResponse           `json:"response"`
+}
+
+// structure of a stub's response; also returned from DoAction for the router to write out
+type StubResponse struct {
+	Status     int               `json:"status" description:"http status code (default 200)"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       interface{}       `json:"body,omitempty" description:"a string is written as-is, anything else is marshalled as json"`
+	BodyBase64 string            `json:"bodyBase64,omitempty" description:"binary body, base64 encoded (used instead of body)"`
+	Template   bool              `json:"template,omitempty" description:"render the headers and every string in the body as a response template"`
+}
+
+// method to load a declarative module file
+func LoadDeclarativeModuleConfig(modulePath string) (*DeclarativeModuleConfig, error) {
+	bArrContent, err := ioutil.ReadFile(modulePath)
+	if err != nil {
+		return nil, err
+	}
+	var moduleConfig DeclarativeModuleConfig
+	err = json.Unmarshal(bArrContent, &moduleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid declarative module [%v]: %v", modulePath, err)
+	}
+	if !strings.HasPrefix(moduleConfig.Path, "/") || strings.Count(moduleConfig.Path, "/") != 1 {
+		return nil, fmt.Errorf("invalid declarative module [%v]: path must be a single segment like /orders => %v", modulePath, moduleConfig.Path)
+	}
+	if moduleConfig.Proxy != nil {
+		if err := moduleConfig.Proxy.compile(modulePath); err != nil {
+			return nil, fmt.Errorf("invalid declarative module [%v]: %v", modulePath, err)
+		}
+		if moduleConfig.Proxy.Mode == ProxyModeReplay {
+			recordedStubs, err := moduleConfig.Proxy.loadRecordedStubs()
+			if err != nil {
+				return nil, fmt.Errorf("invalid declarative module [%v]: %v", modulePath, err)
+			}
+			moduleConfig.Stubs = append(moduleConfig.Stubs, recordedStubs...)
+		}
+	}
+	for idx := range moduleConfig.Stubs {
+		stub := &moduleConfig.Stubs[idx]
+		stub.Method = strings.ToUpper(stub.Method)
+		if stub.Method == "" {
+			stub.Method = http.MethodGet
+		}
+		if stub.Path == "" {
+			stub.Path = "/"
+		}
+		if stub.Response.Status == 0 {
+			stub.Response.Status = http.StatusOK
+		}
+		if stub.Priority == 0 {
+			stub.Priority = DefaultStubPriority
+		}
+		if stub.Name == "" {
+			stub.Name = fmt.Sprintf("#%v %v::%v", idx, stub.Method, stub.Path)
+		}
+		if stub.Request != nil {
+			if err := stub.Request.Compile(); err != nil {
+				return nil, fmt.Errorf("invalid declarative module [%v]: stub [%v]: %v", modulePath, stub.Name, err)
+			}
+		}
+		if stub.RequestSchema != nil || stub.RequestXsd != "" {
+			if err := moduleConfig.addStubSchemas(stub, filepath.Dir(modulePath)); err != nil {
+				return nil, fmt.Errorf("invalid declarative module [%v]: stub [%v]: %v", modulePath, stub.Name, err)
+			}
+		}
+		if stub.Response.BodyBase64 != "" {
+			bArrBody, err := base64.StdEncoding.DecodeString(stub.Response.BodyBase64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid declarative module [%v]: stub [%v]: invalid bodyBase64: %v", modulePath, stub.Name, err)
+			}
+			stub.Response.Body = bArrBody
+		}
+		if stub.Response.Template {
+			if err := stub.Response.parseTemplates(); err != nil {
+				return nil, fmt.Errorf("invalid declarative module [%v]: stub [%v]: invalid response template: %v", modulePath, stub.Name, err)
+			}
+		}
+	}
+	// evaluation order; by priority and then by declaration order
+	sort.SliceStable(moduleConfig.Stubs, func(i, j int) bool {
+		return moduleConfig.Stubs[i].Priority < moduleConfig.Stubs[j].Priority
+	})
+	return &moduleConfig, nil
+}
+
+// ctor. Create instance of *EchoModule backed by a declarative module;
+// GetRestConfig and DoAction are provided as closures with the same signatures a ".so" module exports
+func NewDeclarativeEchoModule(moduleConfig *DeclarativeModuleConfig, modulePath string) *EchoModule {
+	fxGetRestConfig := func() map[string]interface{} {
+		return moduleConfig.restConfig()
+	}
+	fxDoAction := func(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+		return moduleConfig.doAction(request, endPoint, options...)
+	}
+	return NewEchoModule(nil, fxGetRestConfig, fxDoAction, modulePath)
+}
+
+// method to build the same config map a ".so" module returns from GetRestConfig
+func (m *DeclarativeModuleConfig) restConfig() map[string]interface{} {
+	endPoints := make([]string, 0)
+	for _, stub := range m.Stubs {
+		endPoint := fmt.Sprintf("%v::%v", stub.Method, stub.Path)
+		if !_containsString(endPoints, endPoint) {
+			endPoints = append(endPoints, endPoint)
+		}
+	}
+	if m.Proxy != nil {
+		for _, endPoint := range m.Proxy.Routes {
+			if !_containsString(endPoints, endPoint) {
+				endPoints = append(endPoints, endPoint)
+			}
+		}
+	}
+	configMap := make(map[string]interface{})
+	configMap["path"] = m.Path
+	configMap["consumeFormat"] = m.ConsumeFormat
+	configMap["produceFormat"] = m.ProduceFormat
+	configMap["endPoints"] = endPoints
+	if m.Schemas != nil {
+		configMap["schemas"] = m.Schemas
+	}
+
+	return configMap
+}
+
+// method to attach the request schemas of a stub to its endpoint; the router validates the
+// request against them before DoAction is invoked
+func (m *DeclarativeModuleConfig) addStubSchemas(stub *StubConfig, moduleDir string) error {
+	if m.Schemas == nil {
+		m.Schemas = make(map[string]interface{})
+	}
+	endPoint := fmt.Sprintf("%v::/%v", stub.Method, strings.TrimLeft(stub.Path, "/"))
+	schemaInfo, ok := m.Schemas[endPoint].(map[string]interface{})
+	if !ok {
+		schemaInfo = make(map[string]interface{})
+		m.Schemas[endPoint] = schemaInfo
+	}
+	if stub.RequestSchema != nil {
+		schemaInfo["requestSchema"] = stub.RequestSchema
+	}
+	if stub.RequestXsd != "" {
+		requestXsd := stub.RequestXsd
+		if !strings.HasPrefix(strings.TrimSpace(requestXsd), "<") {
+			xsdFile := requestXsd
+			if !filepath.IsAbs(xsdFile) {
+				xsdFile = filepath.Join(moduleDir, xsdFile)
+			}
+			bArrXsd, err := ioutil.ReadFile(xsdFile)
+			if err != nil {
+				return err
+			}
+			requestXsd = string(bArrXsd)
+		}
+		schemaInfo["requestXsd"] = requestXsd
+	}
+	return nil
+}
+
+// method to pick the stub for the request; stubs are evaluated by priority (then declaration order)
+// and the first one whose verb, route, scenario state and request rules all agree wins.
+// If nothing matches, the request is forwarded upstream (proxy modules in record / passthrough mode)
+// or a 404 reporting the closest near-miss is returned
+func (m *DeclarativeModuleConfig) doAction(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+	var actionOptions map[string]interface{}
+	if len(options) > 0 && options[0] != nil {
+		actionOptions = options[0]
+	}
+	routePath, _ := actionOptions["routePath"].(string)
+	pathParameters, _ := actionOptions["pathParameters"].(map[string]string)
+	scenarioStates, _ := actionOptions["scenarios"].(map[string]string)
+	advanceScenario, _ := actionOptions["advanceScenario"].(func(string, string, string) bool)
+
+	requestData := NewRequestData(&request, pathParameters)
+	var nearMiss *StubConfig
+	var nearMissResult MatchResult
+
+	for idx := range m.Stubs {
+		stub := &m.Stubs[idx]
+		result := m.evaluateStub(stub, requestData, routePath, scenarioStates)
+		if result.IsMatch() {
+			// the scenario state is checked (and moved) atomically; another request might have won the race
+			if stub.Scenario == "" || (advanceScenario != nil && advanceScenario(stub.Scenario, stub.RequiredState, stub.NewState)) {
+				return stub.Response.render(requestData)
+			}
+			result.record(false, fmt.Sprintf("scenario [%v]: state changed while matching", stub.Scenario))
+		}
+		if nearMiss == nil || result.Score() > nearMissResult.Score() {
+			nearMiss = stub
+			nearMissResult = result
+		}
+	}
+	if m.Proxy != nil && m.Proxy.isForwarding() {
+		return m.forwardAndRecord(requestData, routePath)
+	}
+	notFound := new(StubResponse)
+	notFound.Status = http.StatusNotFound
+	body := map[string]interface{}{
+		"error": fmt.Sprintf("no stub matched %v %v", request.Method, request.URL.Path),
+	}
+	if nearMiss != nil {
+		body["nearMiss"] = map[string]interface{}{
+			"stub":       nearMiss.Name,
+			"priority":   nearMiss.Priority,
+			"matched":    nearMissResult.Matched,
+			"total":      nearMissResult.Total,
+			"mismatches": nearMissResult.Mismatches,
+		}
+	}
+	notFound.Body = body
+	return notFound
+}
+
+// method to forward the request upstream and (in record mode) record the exchange;
+// upstream failures are answered with a 502
+func (m *DeclarativeModuleConfig) forwardAndRecord(requestData *RequestData, routePath string) *StubResponse {
+	response, err := m.forward(requestData)
+	if err != nil {
+		badGateway := new(StubResponse)
+		badGateway.Status = http.StatusBadGateway
+		badGateway.Body = map[string]interface{}{
+			"error": fmt.Sprintf("proxy to %v failed: %v", m.Proxy.TargetBaseUrl, err),
+		}
+		return badGateway
+	}
+	if m.Proxy.Mode == ProxyModeRecord {
+		if err := m.record(requestData, routePath, response); err != nil {
+			// the client still gets the upstream response; flag the failed recording in a header
+			response.Headers["X-Echogogo-Record-Error"] = err.Error()
+		}
+	}
+	return response
+}
+
+// method to check the headers and body of a templated response parse
+func (r *StubResponse) parseTemplates() error {
+	for key, value := range r.Headers {
+		if err := ParseResponseTemplate(value); err != nil {
+			return fmt.Errorf("header [%v]: %v", key, err)
+		}
+	}
+	return ParseResponseTemplateValue(r.Body)
+}
+
+// method to produce the response for the request; templated responses are rendered
+// against the request, others are returned as a copy
+func (r *StubResponse) render(requestData *RequestData) *StubResponse {
+	response := *r
+	if !r.Template {
+		return &response
+	}
+	response.Headers = make(map[string]string)
+	for key, value := range r.Headers {
+		rendered, err := RenderResponseTemplate(value, requestData)
+		if err != nil {
+			return _newTemplateErrorResponse(err)
+		}
+		response.Headers[key] = rendered
+	}
+	body, err := RenderResponseTemplateValue(r.Body, requestData)
+	if err != nil {
+		return _newTemplateErrorResponse(err)
+	}
+	response.Body = body
+	return &response
+}
+
+// method to create the 500 response for a template that failed to render
+func _newTemplateErrorResponse(err error) *StubResponse {
+	response := new(StubResponse)
+	response.Status = http.StatusInternalServerError
+	response.Body = map[string]interface{}{
+		"error": fmt.Sprintf("failed to render response template: %v", err),
+	}
+	return response
+}
+
+// method to evaluate every criterion of the stub (verb, route, scenario state and request rules)
+func (m *DeclarativeModuleConfig) evaluateStub(stub *StubConfig, requestData *RequestData, routePath string, scenarioStates map[string]string) MatchResult {
+	var result MatchResult
+	if stub.Request != nil {
+		result = stub.Request.Evaluate(requestData)
+	}
+	result.record(stub.Method == requestData.Method,
+		fmt.Sprintf("method: expected [%v] but was [%v]", stub.Method, requestData.Method))
+	stubRoutePath := _concatRoutePath(m.Path, stub.Path)
+	result.record(stubRoutePath == routePath,
+		fmt.Sprintf("route: expected [%v] but was [%v]", stubRoutePath, routePath))
+	if stub.Scenario != "" && stub.RequiredState != "" {
+		currentState := scenarioStates[stub.Scenario]
+		result.record(currentState == stub.RequiredState,
+			fmt.Sprintf("scenario [%v]: expected state [%v] but was [%v]", stub.Scenario, stub.RequiredState, currentState))
+	}
+	return result
+}
+
+// method to join a webservice path and a route path the same way go-restful does
+func _concatRoutePath(path1 string, path2 string) string {
+	return strings.TrimRight(path1, "/") + "/" + strings.TrimLeft(path2, "/")
+}
@@ -0,0 +1,123 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubs of the orders module; the names tell which one answered
+const testOrdersModule = `{
+  "path": "/orders",
+  "stubs": [
+    { "name": "any order", "path": "/{id}", "response": { "body": "any order" } },
+    { "name": "full view", "path": "/{id}", "request": { "queryParameters": { "view": { "equalTo": "full" } } }, "response": { "body": "full view" } },
+    { "name": "full view of tenant 1", "path": "/{id}", "priority": 1,
+      "request": { "queryParameters": { "view": { "equalTo": "full" } }, "headers": { "X-Tenant": { "equalTo": "t-1" } } }, "response": { "body": "full view of tenant 1" } },
+    { "name": "created", "method": "POST", "path": "/", "priority": 1,
+      "request": { "headers": { "X-Tenant": { "matches": "^t-\\d+$" } }, "bodyPatterns": [ { "jsonPath": "$.sku", "equalTo": "B2" }, { "jsonPath": "$.qty", "equalTo": "1" } ] },
+      "response": { "status": 201, "body": "created" } },
+    { "name": "created by tenant 2", "method": "POST", "path": "/", "request": { "headers": { "X-Tenant": { "equalTo": "t-2" } } }, "response": { "status": 201, "body": "created by tenant 2" } }
+  ]
+}`
+
+// method to load the orders module out of a temporary module file
+func loadTestOrdersModule(t *testing.T) *DeclarativeModuleConfig {
+	moduleDir, err := ioutil.TempDir("", "echogogo-stubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(moduleDir)
+	modulePath := filepath.Join(moduleDir, "orders"+DeclarativeModuleSuffix)
+	if err := ioutil.WriteFile(modulePath, []byte(testOrdersModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	moduleConfig, err := LoadDeclarativeModuleConfig(modulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return moduleConfig
+}
+
+func TestDeclarativeModuleStubSelection(t *testing.T) {
+	moduleConfig := loadTestOrdersModule(t)
+	testCases := []struct {
+		name      string
+		method    string
+		target    string
+		routePath string
+		tenant    string
+		body      string
+		expected  string
+	}{
+		// priority first, then declaration order
+		{"highest priority", http.MethodGet, "/orders/42?view=full", "/orders/{id}", "t-1", "", "full view of tenant 1"},
+		{"declared first of the same priority", http.MethodGet, "/orders/42?view=full", "/orders/{id}", "t-2", "", "any order"},
+		{"fallback", http.MethodGet, "/orders/42", "/orders/{id}", "", "", "any order"},
+		{"priority 1 post", http.MethodPost, "/orders/", "/orders/", "t-2", `{"sku": "B2", "qty": 1}`, "created"},
+		{"priority 5 post", http.MethodPost, "/orders/", "/orders/", "t-2", `{"sku": "B2", "qty": 2}`, "created by tenant 2"},
+	}
+	for _, testCase := range testCases {
+		request := httptest.NewRequest(testCase.method, testCase.target, strings.NewReader(testCase.body))
+		if testCase.tenant != "" {
+			request.Header.Set("X-Tenant", testCase.tenant)
+		}
+		response := moduleConfig.doAction(*request, "", map[string]interface{}{"routePath": testCase.routePath}).(*StubResponse)
+		if response.Body != testCase.expected {
+			t.Errorf("%v: expected the stub [%v], got %v %v", testCase.name, testCase.expected, response.Status, response.Body)
+		}
+	}
+}
+
+func TestDeclarativeModuleNearMiss(t *testing.T) {
+	moduleConfig := loadTestOrdersModule(t)
+	testCases := []struct {
+		name       string
+		tenant     string
+		body       string
+		nearMiss   string
+		matched    int
+		mismatches []string
+	}{
+		// "created" fails 1 of 5 rules; "created by tenant 2" 1 of 3, the best score wins
+		{"closest by score", "t-1", `{"sku": "B2", "qty": 2}`, "created", 4, []string{"body jsonPath [$.qty]: expected equalTo [1] but was [2]"}},
+		// "created" fails 3 of 5 rules; a lower priority does not matter for the near-miss
+		{"closest regardless of priority", "", `{}`, "created by tenant 2", 2, []string{"header [X-Tenant]: expected equalTo [t-2] but was absent"}},
+	}
+	for _, testCase := range testCases {
+		request := httptest.NewRequest(http.MethodPost, "/orders/", strings.NewReader(testCase.body))
+		if testCase.tenant != "" {
+			request.Header.Set("X-Tenant", testCase.tenant)
+		}
+		response := moduleConfig.doAction(*request, "", map[string]interface{}{"routePath": "/orders/"}).(*StubResponse)
+		if response.Status != http.StatusNotFound {
+			t.Fatalf("%v: expected 404, got %v %v", testCase.name, response.Status, response.Body)
+		}
+		nearMiss, _ := response.Body.(map[string]interface{})["nearMiss"].(map[string]interface{})
+		if nearMiss["stub"] != testCase.nearMiss || nearMiss["matched"] != testCase.matched || strings.Join(nearMiss["mismatches"].([]string), "\n") != strings.Join(testCase.mismatches, "\n") {
+			t.Errorf("%v: expected the near-miss %v (%v matched) %v, got %v", testCase.name, testCase.nearMiss, testCase.matched, testCase.mismatches, nearMiss)
+		}
+	}
+}
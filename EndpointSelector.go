@@ -0,0 +1,175 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// structure selecting what a fault, rate limit or auth requirement applies to; a whole module
+// or a single endpoint of it (in the GetRestConfig format e.g. GET::/{id})
+type EndpointSelector struct {
+	Module   string
+	Endpoint string
+}
+
+// structure of an entry of an idRegistry (faults, rate limits)
+type registryEntry interface {
+	getId() string
+	setId(id string)
+	selector() EndpointSelector
+	isDisabled() bool
+	Validate() error
+}
+
+// registry of entries identified by an id (generated if missing); the owner holds the lock
+type idRegistry struct {
+	kind     string // e.g. "rate limit"; used in the error messages
+	idPrefix string // e.g. "ratelimit-"; generated ids are prefix + sequence
+	entries  []registryEntry
+	nextId   int
+}
+
+// method to validate the module path and the endpoint format
+func (s EndpointSelector) validate() error {
+	if !strings.HasPrefix(s.Module, "/") {
+		return fmt.Errorf("module must be a webservice path like /orders => %v", s.Module)
+	}
+	if s.Endpoint == "" {
+		return nil
+	}
+	parts := strings.Split(s.Endpoint, "::")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid endpoint, format is [http_verb]::[target_path] => %v", s.Endpoint)
+	}
+	if !_containsString(supportedEndPointVerbs, strings.ToUpper(parts[0])) {
+		return fmt.Errorf("unknown http verb [%v] in endpoint => %v", parts[0], s.Endpoint)
+	}
+	return nil
+}
+
+// method to check if the selector applies to the given module path, http verb and (full) route path
+func (s EndpointSelector) appliesTo(modulePath string, method string, routePath string) bool {
+	if s.Module != modulePath {
+		return false
+	}
+	if s.Endpoint == "" {
+		return true
+	}
+	parts := strings.Split(s.Endpoint, "::")
+	return strings.EqualFold(parts[0], method) && _concatRoutePath(s.Module, parts[1]) == routePath
+}
+
+// method to pick the candidate applying to the request; an endpoint selector wins over a module wide one,
+// otherwise the first one wins. selectorAt returns nil for a candidate to skip (e.g. disabled). -1 if none applies
+func _findEndpointSelector(count int, selectorAt func(idx int) *EndpointSelector, modulePath string, method string, routePath string) int {
+	moduleIdx := -1
+	for idx := 0; idx < count; idx++ {
+		selector := selectorAt(idx)
+		if selector == nil || !selector.appliesTo(modulePath, method, routePath) {
+			continue
+		}
+		if selector.Endpoint != "" {
+			return idx
+		}
+		if moduleIdx < 0 {
+			moduleIdx = idx
+		}
+	}
+	return moduleIdx
+}
+
+// method to remove every entry
+func (r *idRegistry) reset() {
+	r.entries = make([]registryEntry, 0)
+}
+
+// method to add an entry; a missing id is generated (skipping the ids already taken), duplicated ids are refused
+func (r *idRegistry) add(entry registryEntry) error {
+	if entry.getId() == "" {
+		for {
+			r.nextId++
+			if r.get(r.idPrefix+strconv.Itoa(r.nextId)) == nil {
+				break
+			}
+		}
+		entry.setId(r.idPrefix + strconv.Itoa(r.nextId))
+	}
+	if r.get(entry.getId()) != nil {
+		return fmt.Errorf("duplicated %v id [%v]", r.kind, entry.getId())
+	}
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+// method to replace the entry with the given id
+func (r *idRegistry) replace(id string, entry registryEntry) error {
+	entry.setId(id)
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	for idx, existing := range r.entries {
+		if existing.getId() == id {
+			r.entries[idx] = entry
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %v [%v]", r.kind, id)
+}
+
+// method to remove the entry with the given id
+func (r *idRegistry) remove(id string) error {
+	for idx, existing := range r.entries {
+		if existing.getId() == id {
+			r.entries = append(r.entries[:idx], r.entries[idx+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %v [%v]", r.kind, id)
+}
+
+// method to get the entry with the given id; nil if unknown
+func (r *idRegistry) get(id string) registryEntry {
+	for _, existing := range r.entries {
+		if existing.getId() == id {
+			return existing
+		}
+	}
+	return nil
+}
+
+// method to find the (enabled) entry for the request; nil if none applies
+func (r *idRegistry) find(modulePath string, method string, routePath string) registryEntry {
+	idx := _findEndpointSelector(len(r.entries), func(idx int) *EndpointSelector {
+		if r.entries[idx].isDisabled() {
+			return nil
+		}
+		selector := r.entries[idx].selector()
+		return &selector
+	}, modulePath, method, routePath)
+	if idx < 0 {
+		return nil
+	}
+	return r.entries[idx]
+}
@@ -0,0 +1,121 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEndpointSelectorValidate(t *testing.T) {
+	testCases := []struct {
+		selector EndpointSelector
+		err      string
+	}{
+		{EndpointSelector{Module: "/orders"}, ""},
+		{EndpointSelector{Module: "/orders", Endpoint: "GET::/{id}"}, ""},
+		{EndpointSelector{Module: "orders"}, "module must be a webservice path like /orders => orders"},
+		{EndpointSelector{Module: "/orders", Endpoint: "GET /{id}"}, "invalid endpoint, format is [http_verb]::[target_path] => GET /{id}"},
+		{EndpointSelector{Module: "/orders", Endpoint: "post::/"}, ""},
+		{EndpointSelector{Module: "/orders", Endpoint: "GETS::/{id}"}, "unknown http verb [GETS] in endpoint => GETS::/{id}"},
+	}
+	for _, testCase := range testCases {
+		err := testCase.selector.validate()
+		if (err == nil && testCase.err != "") || (err != nil && err.Error() != testCase.err) {
+			t.Errorf("%v: expected %q, got %v", testCase.selector, testCase.err, err)
+		}
+	}
+}
+
+func TestFindEndpointSelector(t *testing.T) {
+	selectors := []EndpointSelector{
+		{Module: "/users"},
+		{Module: "/orders"},
+		{Module: "/orders", Endpoint: "post::/"},
+		{Module: "/orders", Endpoint: "GET::/{id}"},
+		{Module: "/orders"},
+	}
+	testCases := []struct {
+		name      string
+		method    string
+		routePath string
+		skipped   int // index returning nil (e.g. disabled); -1 for none
+		expected  int
+	}{
+		{"endpoint wins over the module", "GET", "/orders/{id}", -1, 3},
+		{"verbs ignore the case", "POST", "/orders/", -1, 2},
+		{"first module wide one", "DELETE", "/orders/{id}", -1, 1},
+		{"skipped endpoint", "GET", "/orders/{id}", 3, 1},
+		{"skipped module wide one", "DELETE", "/orders/{id}", 1, 4},
+		{"other module", "GET", "/users/", -1, 0},
+		{"nothing applies", "GET", "/carts/", -1, -1},
+	}
+	for _, testCase := range testCases {
+		modulePath := "/" + strings.Split(testCase.routePath, "/")[1]
+		idx := _findEndpointSelector(len(selectors), func(idx int) *EndpointSelector {
+			if idx == testCase.skipped {
+				return nil
+			}
+			return &selectors[idx]
+		}, modulePath, testCase.method, testCase.routePath)
+		if idx != testCase.expected {
+			t.Errorf("%v: expected #%v, got #%v", testCase.name, testCase.expected, idx)
+		}
+	}
+}
+
+func TestIdRegistry(t *testing.T) {
+	registry := NewFaultRegistry()
+	added, err := registry.Add(FaultConfig{Module: "/orders"})
+	if err != nil || added.Id != "fault-1" {
+		t.Fatalf("expected a generated id, got %v (%v)", added.Id, err)
+	}
+	if _, err := registry.Add(FaultConfig{Id: "fault-1", Module: "/users"}); err == nil || err.Error() != "duplicated fault id [fault-1]" {
+		t.Errorf("expected the duplicated id refused, got %v", err)
+	}
+	if _, err := registry.Add(FaultConfig{Id: "slow", Module: "users"}); err == nil || !strings.HasPrefix(err.Error(), "fault [slow]: module must be") {
+		t.Errorf("expected the fault validated, got %v", err)
+	}
+	if _, err := registry.Replace("fault-1", FaultConfig{Module: "/orders", Endpoint: "GET::/{id}"}); err != nil {
+		t.Fatal(err)
+	}
+	if fault := registry.Find("/orders", "GET", "/orders/{id}"); fault == nil || fault.Id != "fault-1" || fault.Endpoint != "GET::/{id}" {
+		t.Errorf("expected the replaced fault, got %v", fault)
+	}
+	if _, err := registry.Replace("other", FaultConfig{Module: "/orders"}); err == nil || err.Error() != "unknown fault [other]" {
+		t.Errorf("expected an unknown fault, got %v", err)
+	}
+	if err := registry.Remove("fault-1"); err != nil || len(registry.List()) != 0 {
+		t.Errorf("expected the fault removed, got %v (%v)", registry.List(), err)
+	}
+	if err := registry.Remove("fault-1"); err == nil {
+		t.Error("expected an unknown fault")
+	}
+	// ids keep counting (skipping the ones set by the user); the rate limits have their own
+	if added, _ := registry.Add(FaultConfig{Module: "/orders"}); added.Id != "fault-2" {
+		t.Errorf("expected fault-2, got %v", added.Id)
+	}
+	registry.Add(FaultConfig{Id: "fault-3", Module: "/users"})
+	if added, err := registry.Add(FaultConfig{Module: "/orders"}); err != nil || added.Id != "fault-4" {
+		t.Errorf("expected fault-4, got %v (%v)", added.Id, err)
+	}
+	if added, _ := NewRateLimitRegistry().Add(RateLimitConfig{Module: "/orders", Limit: 1}); added.Id != "ratelimit-1" {
+		t.Errorf("expected ratelimit-1, got %v", added.Id)
+	}
+}
@@ -0,0 +1,380 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const LatencyDistributionFixed = "fixed"
+const LatencyDistributionUniform = "uniform"
+const LatencyDistributionNormal = "normal"
+const LatencyDistributionLogNormal = "lognormal"
+
+// structure of a fault; applies to a whole module or to a single endpoint of it
+type FaultConfig struct {
+	Id                  string            `json:"id" description:"unique id (generated if missing)"`
+	Module              string            `json:"module" description:"webservice path of the module e.g. /orders"`
+	Endpoint            string            `json:"endpoint" description:"optional endpoint in the GetRestConfig format e.g. GET::/{id}; empty means every endpoint"`
+	Disabled            bool              `json:"disabled" description:"keep the fault but don't apply it"`
+	Latency             *LatencyConfig    `json:"latency" description:"delay before DoAction is invoked"`
+	ErrorRate           float64           `json:"errorRate" description:"probability [0..1] of answering with errorStatus instead of invoking DoAction"`
+	ErrorStatus         int               `json:"errorStatus" description:"5xx status for errorRate (default 500)"`
+	ConnectionResetRate float64           `json:"connectionResetRate" description:"probability [0..1] of resetting the connection instead of answering"`
+	TruncateRate        float64           `json:"truncateRate" description:"probability [0..1] of cutting the body short and closing the connection"`
+	TruncateAfterBytes  int               `json:"truncateAfterBytes" description:"bytes of the body sent before cutting (default half of the body)"`
+	SlowStream          *SlowStreamConfig `json:"slowStream" description:"send the body in small chunks with a delay in between"`
+}
+
+// structure of a latency distribution; all values in milliseconds
+type LatencyConfig struct {
+	Distribution string  `json:"distribution" description:"fixed (default), uniform, normal or lognormal"`
+	FixedMs      int     `json:"fixedMs" description:"delay for the fixed distribution"`
+	MinMs        int     `json:"minMs" description:"lower bound for uniform (also clamps normal / lognormal)"`
+	MaxMs        int     `json:"maxMs" description:"upper bound for uniform (also clamps normal / lognormal when > 0)"`
+	MeanMs       float64 `json:"meanMs" description:"mean for normal; median for lognormal"`
+	StdDevMs     float64 `json:"stdDevMs" description:"standard deviation for normal; sigma (unitless) for lognormal"`
+}
+
+// structure of a slow (byte by byte) body stream
+type SlowStreamConfig struct {
+	ChunkBytes int `json:"chunkBytes" description:"bytes per chunk (default 1)"`
+	DelayMs    int `json:"delayMs" description:"delay between chunks"`
+}
+
+// registry of the faults; changed at runtime through the admin api
+type FaultRegistry struct {
+	lock      sync.RWMutex
+	faults    idRegistry
+	isEnabled bool
+}
+
+// ctor. Create instance of *FaultRegistry
+func NewFaultRegistry() *FaultRegistry {
+	registry := new(FaultRegistry)
+	registry.faults = idRegistry{kind: "fault", idPrefix: "fault-"}
+	registry.faults.reset()
+	registry.isEnabled = true
+
+	return registry
+}
+
+// method to validate and fill in the defaults of the fault
+func (f *FaultConfig) Validate() error {
+	if err := f.selector().validate(); err != nil {
+		return fmt.Errorf("fault [%v]: %v", f.Id, err)
+	}
+	for name, rate := range map[string]float64{"errorRate": f.ErrorRate, "connectionResetRate": f.ConnectionResetRate, "truncateRate": f.TruncateRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("fault [%v]: %v must be within [0..1] => %v", f.Id, name, rate)
+		}
+	}
+	if f.ErrorStatus == 0 {
+		f.ErrorStatus = http.StatusInternalServerError
+	}
+	if f.ErrorStatus < 500 || f.ErrorStatus > 599 {
+		return fmt.Errorf("fault [%v]: errorStatus must be a 5xx status => %v", f.Id, f.ErrorStatus)
+	}
+	if f.Latency != nil {
+		switch f.Latency.Distribution {
+		case "":
+			f.Latency.Distribution = LatencyDistributionFixed
+		case LatencyDistributionFixed, LatencyDistributionUniform, LatencyDistributionNormal, LatencyDistributionLogNormal:
+		default:
+			return fmt.Errorf("fault [%v]: unknown latency distribution => %v", f.Id, f.Latency.Distribution)
+		}
+		if f.Latency.Distribution == LatencyDistributionUniform && f.Latency.MaxMs < f.Latency.MinMs {
+			return fmt.Errorf("fault [%v]: latency maxMs [%v] is smaller than minMs [%v]", f.Id, f.Latency.MaxMs, f.Latency.MinMs)
+		}
+	}
+	if f.SlowStream != nil && f.SlowStream.ChunkBytes <= 0 {
+		f.SlowStream.ChunkBytes = 1
+	}
+	return nil
+}
+
+// method to get the id of the fault (idRegistry entry)
+func (f *FaultConfig) getId() string {
+	return f.Id
+}
+
+// method to set the id of the fault (idRegistry entry)
+func (f *FaultConfig) setId(id string) {
+	f.Id = id
+}
+
+// method to get what the fault applies to
+func (f *FaultConfig) selector() EndpointSelector {
+	return EndpointSelector{Module: f.Module, Endpoint: f.Endpoint}
+}
+
+// method to check if the fault is kept but not applied
+func (f *FaultConfig) isDisabled() bool {
+	return f.Disabled
+}
+
+// method to pick a delay out of the latency distribution
+func (l *LatencyConfig) nextDelay() time.Duration {
+	var delayMs float64
+	switch l.Distribution {
+	case LatencyDistributionUniform:
+		delayMs = float64(l.MinMs) + rand.Float64()*float64(l.MaxMs-l.MinMs)
+	case LatencyDistributionNormal:
+		delayMs = l.MeanMs + rand.NormFloat64()*l.StdDevMs
+	case LatencyDistributionLogNormal:
+		delayMs = l.MeanMs * math.Exp(rand.NormFloat64()*l.StdDevMs)
+	default:
+		delayMs = float64(l.FixedMs)
+	}
+	if delayMs < float64(l.MinMs) {
+		delayMs = float64(l.MinMs)
+	}
+	if l.MaxMs > 0 && delayMs > float64(l.MaxMs) {
+		delayMs = float64(l.MaxMs)
+	}
+	return time.Duration(delayMs * float64(time.Millisecond))
+}
+
+// method to replace all faults (e.g. from the config file)
+func (r *FaultRegistry) Load(faults []FaultConfig) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.faults.reset()
+	for idx := range faults {
+		fault := faults[idx]
+		if err := r.faults.add(&fault); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// method to add a fault; returns the fault with its id
+func (r *FaultRegistry) Add(fault FaultConfig) (FaultConfig, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.faults.add(&fault)
+	return fault, err
+}
+
+// method to replace the fault with the given id
+func (r *FaultRegistry) Replace(id string, fault FaultConfig) (FaultConfig, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.faults.replace(id, &fault)
+	return fault, err
+}
+
+// method to remove the fault with the given id
+func (r *FaultRegistry) Remove(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.faults.remove(id)
+}
+
+// method to enable / disable a single fault
+func (r *FaultRegistry) SetFaultEnabled(id string, isEnabled bool) (FaultConfig, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	existing, ok := r.faults.get(id).(*FaultConfig)
+	if !ok {
+		return FaultConfig{}, fmt.Errorf("unknown fault [%v]", id)
+	}
+	existing.Disabled = !isEnabled
+	return *existing, nil
+}
+
+// method to switch fault injection on / off as a whole
+func (r *FaultRegistry) SetEnabled(isEnabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.isEnabled = isEnabled
+}
+
+// method to check if fault injection is switched on
+func (r *FaultRegistry) IsEnabled() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.isEnabled
+}
+
+// method to return a copy of all faults
+func (r *FaultRegistry) List() []FaultConfig {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	faults := make([]FaultConfig, 0, len(r.faults.entries))
+	for _, entry := range r.faults.entries {
+		faults = append(faults, *entry.(*FaultConfig))
+	}
+	return faults
+}
+
+// method to find the fault for the request; an endpoint fault wins over a module wide fault
+func (r *FaultRegistry) Find(modulePath string, method string, routePath string) *FaultConfig {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if !r.isEnabled {
+		return nil
+	}
+	fault, ok := r.faults.find(modulePath, method, routePath).(*FaultConfig)
+	if !ok {
+		return nil
+	}
+	matched := *fault
+	return &matched
+}
+
+// method to apply the faults that happen before DoAction (latency, connection reset, 5xx);
+// returns true if the request has been answered (or dropped) already
+func (srv *Server) _applyFaultBeforeAction(fault *FaultConfig, response *restful.Response, logger Logger) bool {
+	if fault.Latency != nil {
+		time.Sleep(fault.Latency.nextDelay())
+	}
+	if fault.ConnectionResetRate > 0 && rand.Float64() < fault.ConnectionResetRate {
+		// hijacked through the current writer; writers wrapped by the filters (e.g. metrics) see it
+		hijacker, ok := response.ResponseWriter.(http.Hijacker)
+		if !ok {
+			logger.Log(fmt.Sprintf("fault [%v]: unable to reset connection: the response writer can't be hijacked", fault.Id), LogLevelError, "", "")
+			return false
+		}
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			logger.Log(fmt.Sprintf("fault [%v]: unable to reset connection: %v", fault.Id, err), LogLevelError, "", "")
+			return false
+		}
+		// linger 0 => RST instead of FIN
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.SetLinger(0)
+		}
+		conn.Close()
+		return true
+	}
+	if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+		response.Header().Set("Content-Type", "application/json")
+		response.WriteHeader(fault.ErrorStatus)
+		response.Write([]byte(fmt.Sprintf(`{"error":"injected fault [%v]"}`, fault.Id)))
+		return true
+	}
+	return false
+}
+
+// structure of a http.ResponseWriter buffering the body, so it can be delivered truncated or slowly
+type faultResponseWriter struct {
+	writer     http.ResponseWriter
+	fault      *FaultConfig
+	status     int
+	body       bytes.Buffer
+	isTruncate bool
+}
+
+// ctor. Create instance of *faultResponseWriter; nil if the fault doesn't touch the body
+func newFaultResponseWriter(writer http.ResponseWriter, fault *FaultConfig) *faultResponseWriter {
+	isTruncate := fault.TruncateRate > 0 && rand.Float64() < fault.TruncateRate
+	if !isTruncate && fault.SlowStream == nil {
+		return nil
+	}
+	faultWriter := new(faultResponseWriter)
+	faultWriter.writer = writer
+	faultWriter.fault = fault
+	faultWriter.status = http.StatusOK
+	faultWriter.isTruncate = isTruncate
+
+	return faultWriter
+}
+
+func (w *faultResponseWriter) Header() http.Header {
+	return w.writer.Header()
+}
+
+func (w *faultResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *faultResponseWriter) Write(bArr []byte) (int, error) {
+	return w.body.Write(bArr)
+}
+
+// method to deliver the buffered response (truncated and / or slowly)
+func (w *faultResponseWriter) finish() error {
+	body := w.body.Bytes()
+	w.writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if w.isTruncate {
+		cutAt := w.fault.TruncateAfterBytes
+		if cutAt <= 0 || cutAt >= len(body) {
+			cutAt = len(body) / 2
+		}
+		body = body[:cutAt]
+	}
+	w.writer.WriteHeader(w.status)
+	if w.fault.SlowStream == nil {
+		if _, err := w.writer.Write(body); err != nil {
+			return err
+		}
+	} else {
+		flusher, _ := w.writer.(http.Flusher)
+		delay := time.Duration(w.fault.SlowStream.DelayMs) * time.Millisecond
+		for start := 0; start < len(body); start += w.fault.SlowStream.ChunkBytes {
+			end := start + w.fault.SlowStream.ChunkBytes
+			if end > len(body) {
+				end = len(body)
+			}
+			if _, err := w.writer.Write(body[start:end]); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if end < len(body) {
+				time.Sleep(delay)
+			}
+		}
+	}
+	if w.isTruncate {
+		// the promised Content-Length is never reached; close the connection underneath the client
+		if flusher, ok := w.writer.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		if hijacker, ok := w.writer.(http.Hijacker); ok {
+			conn, _, err := hijacker.Hijack()
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"github.com/emicklei/go-restful"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// body of GET /orders/ (pretty printed by go-restful)
+const testOrdersBody = "{\n \"path\": \"/orders\"\n}"
+
+// method to start a server with the admin api and an orders module answering GET /orders/
+func newTestFaultServer(t *testing.T) (*Server, *httptest.Server) {
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	wsContainerPtr := restful.NewContainer()
+	srv.setupAdmin(wsContainerPtr)
+	modulePtr := newTestEchoModule("orders.so", "/orders")
+	if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+		t.Fatal(err)
+	}
+	srv.modules[modulePtr.ModulePath] = modulePtr
+	return srv, httptest.NewServer(wsContainerPtr)
+}
+
+// method to send a request without reusing connections (faults close them); the body is read fully
+func doTestFaultRequest(t *testing.T, method string, url string, body string) (*http.Response, string, error) {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", restful.MIME_JSON)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	bArrBody, err := ioutil.ReadAll(response.Body)
+	return response, string(bArrBody), err
+}
+
+func TestFaultStatusAndDelay(t *testing.T) {
+	testCases := []struct {
+		name     string
+		faults   []FaultConfig
+		status   int
+		body     string
+		minDelay time.Duration
+	}{
+		{"no fault", nil, http.StatusOK, testOrdersBody, 0},
+		{"status", []FaultConfig{{Id: "down", Module: "/orders", ErrorRate: 1, ErrorStatus: http.StatusServiceUnavailable}},
+			http.StatusServiceUnavailable, `{"error":"injected fault [down]"}`, 0},
+		{"delay", []FaultConfig{{Module: "/orders", Latency: &LatencyConfig{FixedMs: 100}}}, http.StatusOK, testOrdersBody, 100 * time.Millisecond},
+		{"delay and status", []FaultConfig{{Id: "slow-down", Module: "/orders", ErrorRate: 1, Latency: &LatencyConfig{Distribution: LatencyDistributionUniform, MinMs: 50, MaxMs: 60}}},
+			http.StatusInternalServerError, `{"error":"injected fault [slow-down]"}`, 50 * time.Millisecond},
+		{"endpoint wins over module", []FaultConfig{{Id: "module", Module: "/orders", ErrorRate: 1}, {Id: "endpoint", Module: "/orders", Endpoint: "GET::/", ErrorRate: 1, ErrorStatus: 502}},
+			http.StatusBadGateway, `{"error":"injected fault [endpoint]"}`, 0},
+		{"other endpoint", []FaultConfig{{Module: "/orders", Endpoint: "POST::/", ErrorRate: 1}}, http.StatusOK, testOrdersBody, 0},
+		{"disabled", []FaultConfig{{Module: "/orders", ErrorRate: 1, Disabled: true}}, http.StatusOK, testOrdersBody, 0},
+	}
+	for _, testCase := range testCases {
+		srv, server := newTestFaultServer(t)
+		if err := srv.faults.Load(testCase.faults); err != nil {
+			t.Fatalf("%v: %v", testCase.name, err)
+		}
+		startTime := time.Now()
+		response, body, err := doTestFaultRequest(t, http.MethodGet, server.URL+"/orders/", "")
+		elapsed := time.Since(startTime)
+		server.Close()
+		if err != nil {
+			t.Errorf("%v: %v", testCase.name, err)
+			continue
+		}
+		if response.StatusCode != testCase.status || body != testCase.body {
+			t.Errorf("%v: expected %v %v, got %v %v", testCase.name, testCase.status, testCase.body, response.StatusCode, body)
+		}
+		if elapsed < testCase.minDelay {
+			t.Errorf("%v: expected a delay of at least %v, got %v", testCase.name, testCase.minDelay, elapsed)
+		}
+	}
+}
+
+func TestFaultAdminEnableDisable(t *testing.T) {
+	_, server := newTestFaultServer(t)
+	defer server.Close()
+	steps := []struct {
+		method string
+		path   string
+		body   string
+		status int // of the admin call
+		orders int // status of GET /orders/ afterwards
+	}{
+		{http.MethodPost, "/_admin/faults", `{"module": "/orders", "errorRate": 1, "errorStatus": 503}`, http.StatusCreated, http.StatusServiceUnavailable},
+		{http.MethodPost, "/_admin/faults/fault-1/disable", "", http.StatusOK, http.StatusOK},
+		{http.MethodPost, "/_admin/faults/fault-1/enable", "", http.StatusOK, http.StatusServiceUnavailable},
+		{http.MethodPost, "/_admin/faults/disable", "", http.StatusOK, http.StatusOK},
+		{http.MethodPost, "/_admin/faults/enable", "", http.StatusOK, http.StatusServiceUnavailable},
+		{http.MethodPut, "/_admin/faults/fault-1", `{"module": "/orders", "errorRate": 1, "errorStatus": 504}`, http.StatusOK, http.StatusGatewayTimeout},
+		{http.MethodPut, "/_admin/faults/fault-1", `{"module": "/orders", "errorRate": 2}`, http.StatusBadRequest, http.StatusGatewayTimeout},
+		{http.MethodDelete, "/_admin/faults/fault-1", "", http.StatusNoContent, http.StatusOK},
+		{http.MethodPost, "/_admin/faults/fault-1/enable", "", http.StatusNotFound, http.StatusOK},
+	}
+	for _, step := range steps {
+		response, body, err := doTestFaultRequest(t, step.method, server.URL+step.path, step.body)
+		if err != nil || response.StatusCode != step.status {
+			t.Fatalf("%v %v: expected %v, got %v %v (%v)", step.method, step.path, step.status, response, body, err)
+		}
+		response, _, err = doTestFaultRequest(t, http.MethodGet, server.URL+"/orders/", "")
+		if err != nil || response.StatusCode != step.orders {
+			t.Errorf("after %v %v: expected GET /orders/ to answer %v, got %v (%v)", step.method, step.path, step.orders, response, err)
+		}
+	}
+	// the listing reflects the switch
+	_, body, _ := doTestFaultRequest(t, http.MethodPost, server.URL+"/_admin/faults/disable", "")
+	var listing struct {
+		Enabled bool          `json:"enabled"`
+		Faults  []FaultConfig `json:"faults"`
+	}
+	if err := json.Unmarshal([]byte(body), &listing); err != nil || listing.Enabled || len(listing.Faults) != 0 {
+		t.Errorf("expected fault injection switched off without faults, got %v (%v)", body, err)
+	}
+}
+
+func TestFaultTruncateClosesTheConnection(t *testing.T) {
+	srv, server := newTestFaultServer(t)
+	defer server.Close()
+	srv.faults.Load([]FaultConfig{{Module: "/orders", TruncateRate: 1, TruncateAfterBytes: 5}})
+
+	response, body, err := doTestFaultRequest(t, http.MethodGet, server.URL+"/orders/", "")
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected the connection closed before the promised Content-Length, got %v", err)
+	}
+	if response.StatusCode != http.StatusOK || response.ContentLength != int64(len(testOrdersBody)) || body != testOrdersBody[:5] {
+		t.Errorf("expected the status, the full Content-Length and 5 bytes, got %v %v %q", response.StatusCode, response.ContentLength, body)
+	}
+	// the default cut is half of the body
+	srv.faults.Load([]FaultConfig{{Module: "/orders", TruncateRate: 1}})
+	if _, body, err := doTestFaultRequest(t, http.MethodGet, server.URL+"/orders/", ""); err != io.ErrUnexpectedEOF || body != testOrdersBody[:len(testOrdersBody)/2] {
+		t.Errorf("expected half of the body, got %q (%v)", body, err)
+	}
+}
+
+func TestFaultSlowStreamAndReset(t *testing.T) {
+	srv, server := newTestFaultServer(t)
+	defer server.Close()
+	// 22 bytes => 6 chunks, 5 delays
+	srv.faults.Load([]FaultConfig{{Module: "/orders", SlowStream: &SlowStreamConfig{ChunkBytes: 4, DelayMs: 20}}})
+	startTime := time.Now()
+	response, body, err := doTestFaultRequest(t, http.MethodGet, server.URL+"/orders/", "")
+	if err != nil || response.StatusCode != http.StatusOK || body != testOrdersBody {
+		t.Fatalf("expected the whole body, got %v %q (%v)", response, body, err)
+	}
+	if elapsed := time.Since(startTime); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the body to take at least 100ms, got %v", elapsed)
+	}
+
+	srv.faults.Load([]FaultConfig{{Module: "/orders", ConnectionResetRate: 1}})
+	if _, _, err := doTestFaultRequest(t, http.MethodGet, server.URL+"/orders/", ""); err == nil {
+		t.Error("expected the connection to be reset")
+	}
+}
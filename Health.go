@@ -0,0 +1,233 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+)
+
+// reserved webservice paths for the aggregated health of the modules and the liveness / readiness
+// probes (e.g. for container orchestrators); modules can't use them
+const (
+	HealthWebservicePath    = "/health"
+	LivenessWebservicePath  = "/healthz"
+	ReadinessWebservicePath = "/readyz"
+)
+
+const (
+	HealthStatusUp   = "UP"
+	HealthStatusDown = "DOWN"
+)
+
+// lifecycle states of the server; only a READY server passes the readiness probe
+const (
+	ServerStateStarting int32 = iota
+	ServerStateReady
+	ServerStateStopping
+)
+
+var serverStateNames = map[int32]string{
+	ServerStateStarting: "STARTING",
+	ServerStateReady:    "READY",
+	ServerStateStopping: "STOPPING",
+}
+
+// structure describing a module for the liveness / readiness probes
+type ModuleProbe struct {
+	File       string `json:"file"`
+	Path       string `json:"path,omitempty"`
+	IsLoaded   bool   `json:"loaded"`
+	IsRequired bool   `json:"required"`
+}
+
+// structure describing the health of a module
+type ModuleHealth struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	// false if the module has no Health hook (a loaded module is considered UP)
+	IsChecked bool   `json:"checked"`
+	Error     string `json:"error,omitempty"`
+}
+
+// setup the health endpoint; UP (200) if every module reports healthy, otherwise DOWN (503)
+func (srv *Server) setupHealth(wsContainer *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path(HealthWebservicePath).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").To(func(request *restful.Request, response *restful.Response) {
+		status, moduleHealths := srv.CheckModulesHealth()
+		httpStatus := http.StatusOK
+		if status != HealthStatusUp {
+			httpStatus = http.StatusServiceUnavailable
+		}
+		if err := response.WriteHeaderAndJson(httpStatus, map[string]interface{}{
+			"status":  status,
+			"modules": moduleHealths,
+		}, restful.MIME_JSON); err != nil {
+			logger := srv._requestLogger(request)
+			logger.Log(err.Error(), LogLevelError, "", "")
+		}
+	}))
+	wsContainer.Add(ws)
+
+	srv.logger.LogWithFuncName(fmt.Sprintf("health endpoint available at %v", HealthWebservicePath), "setupHealth", srv.logConfig)
+}
+
+// setup the liveness (/healthz) and readiness (/readyz) probes
+func (srv *Server) setupProbes(wsContainer *restful.Container) {
+	// alive as long as the server answers; 200 even while starting or stopping
+	liveness := new(restful.WebService)
+	liveness.Path(LivenessWebservicePath).Produces(restful.MIME_JSON)
+	liveness.Route(liveness.GET("").To(func(request *restful.Request, response *restful.Response) {
+		srv._writeProbeResponse(request, response, http.StatusOK, HealthStatusUp)
+	}))
+	wsContainer.Add(liveness)
+
+	// ready once the modules are loaded (including the required ones) and until the server stops
+	readiness := new(restful.WebService)
+	readiness.Path(ReadinessWebservicePath).Produces(restful.MIME_JSON)
+	readiness.Route(readiness.GET("").To(func(request *restful.Request, response *restful.Response) {
+		if srv.IsReady() {
+			srv._writeProbeResponse(request, response, http.StatusOK, HealthStatusUp)
+		} else {
+			srv._writeProbeResponse(request, response, http.StatusServiceUnavailable, HealthStatusDown)
+		}
+	}))
+	wsContainer.Add(readiness)
+
+	srv.logger.LogWithFuncName(fmt.Sprintf("probes available at %v and %v", LivenessWebservicePath, ReadinessWebservicePath), "setupProbes", srv.logConfig)
+}
+
+// method to check if the server is ready to serve the modules; the modules are loaded, every
+// required module is amongst them and the server is not stopping
+func (srv *Server) IsReady() bool {
+	if atomic.LoadInt32(&srv.state) != ServerStateReady {
+		return false
+	}
+	for _, moduleProbe := range srv.ProbeModules() {
+		if moduleProbe.IsRequired && !moduleProbe.IsLoaded {
+			return false
+		}
+	}
+	return true
+}
+
+// method to describe the loaded modules and the required ones (loaded or not), sorted by file
+func (srv *Server) ProbeModules() []ModuleProbe {
+	moduleProbes := make([]ModuleProbe, 0, len(srv.modules))
+	loadedFileNames := make(map[string]bool)
+	for modulePath, modulePtr := range srv.modules {
+		loadedFileNames[filepath.Base(modulePath)] = true
+		moduleProbes = append(moduleProbes, ModuleProbe{
+			File:       modulePath,
+			Path:       modulePtr.WebservicePath,
+			IsLoaded:   true,
+			IsRequired: _containsString(srv.configContentJson.Modules.Required, filepath.Base(modulePath)),
+		})
+	}
+	for _, moduleFileName := range srv.configContentJson.Modules.Required {
+		if !loadedFileNames[moduleFileName] {
+			moduleProbes = append(moduleProbes, ModuleProbe{File: moduleFileName, IsRequired: true})
+		}
+	}
+	sort.Slice(moduleProbes, func(i, j int) bool {
+		return moduleProbes[i].File < moduleProbes[j].File
+	})
+	return moduleProbes
+}
+
+// method to write the response of a probe
+func (srv *Server) _writeProbeResponse(request *restful.Request, response *restful.Response, httpStatus int, status string) {
+	if err := response.WriteHeaderAndJson(httpStatus, map[string]interface{}{
+		"status":  status,
+		"state":   serverStateNames[atomic.LoadInt32(&srv.state)],
+		"modules": srv.ProbeModules(),
+	}, restful.MIME_JSON); err != nil {
+		logger := srv._requestLogger(request)
+		logger.Log(err.Error(), LogLevelError, "", "")
+	}
+}
+
+// method to run the Health hook of every loaded module; keyed by the module's webservice path
+func (srv *Server) CheckModulesHealth() (string, map[string]ModuleHealth) {
+	status := HealthStatusUp
+	moduleHealths := make(map[string]ModuleHealth)
+	for _, modulePtr := range srv.modules {
+		moduleHealth := ModuleHealth{File: modulePtr.ModulePath, Status: HealthStatusUp}
+		if modulePtr.FxHealth != nil {
+			moduleHealth.IsChecked = true
+			if err := modulePtr.checkHealth(); err != nil {
+				moduleHealth.Status = HealthStatusDown
+				moduleHealth.Error = err.Error()
+				status = HealthStatusDown
+			}
+		}
+		moduleHealths[modulePtr.WebservicePath] = moduleHealth
+	}
+	return status, moduleHealths
+}
+
+// method to run the module's Health hook; a panic counts as unhealthy
+func (m *EchoModule) checkHealth() (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("Health panicked: %v", recovered)
+		}
+	}()
+	return m.FxHealth.(func() error)()
+}
+
+// method to run the Shutdown hook of every module initialized so far, in reverse of the load order;
+// a failing hook doesn't stop the others from running
+func (srv *Server) shutdownModules() error {
+	loadOrder := srv.loadOrder
+	srv.loadOrder = nil
+
+	failedCount := 0
+	for idx := len(loadOrder) - 1; idx >= 0; idx-- {
+		modulePtr := loadOrder[idx]
+		if modulePtr.FxShutdown == nil {
+			continue
+		}
+		if err := modulePtr.shutdown(); err != nil {
+			failedCount++
+			srv.logger.Log(fmt.Sprintf("module %v failed to shutdown: %v", modulePtr.ModulePath, err), LogLevelError, "", "")
+			continue
+		}
+		srv.logger.LogWithFuncName(fmt.Sprintf("module %v shutdown", modulePtr.ModulePath), "shutdownModules", srv.logConfig)
+	}
+	if failedCount > 0 {
+		return fmt.Errorf("%v module(s) failed to shutdown", failedCount)
+	}
+	return nil
+}
+
+// method to run the module's Shutdown hook; a panic is reported as an error
+func (m *EchoModule) shutdown() (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("Shutdown panicked: %v", recovered)
+		}
+	}()
+	return m.FxShutdown.(func() error)()
+}
@@ -0,0 +1,222 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// method to register a built-in module recording its Shutdown (into shutdowns); Init fails with initErr if given.
+// Returns the func unregistering it
+func registerTestBuiltinModule(name string, webservicePath string, initErr error, shutdowns *[]string) func() {
+	builtinModules[name] = func(baseDir string) *BuiltinModule {
+		return &BuiltinModule{
+			GetRestConfig: func() map[string]interface{} {
+				return map[string]interface{}{"path": webservicePath, "consumeFormat": "json", "produceFormat": "json", "endPoints": []string{"GET::/"}}
+			},
+			DoAction: func(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+				return map[string]interface{}{"module": name}
+			},
+			Init: func(settings map[string]interface{}) error {
+				return initErr
+			},
+			Shutdown: func() error {
+				*shutdowns = append(*shutdowns, name)
+				return nil
+			},
+		}
+	}
+	return func() {
+		delete(builtinModules, name)
+	}
+}
+
+func TestShutdownModulesInReverseLoadOrder(t *testing.T) {
+	shutdowns := make([]string, 0)
+	defer registerTestBuiltinModule("test-b", "/b", nil, &shutdowns)()
+	defer registerTestBuiltinModule("test-a", "/a", nil, &shutdowns)()
+	srv := NewServer("")
+	srv.configContentJson.Modules.Builtin = []string{"test-b", "test-a"}
+	if err, _ := srv.loadModulesFromRepos(); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.shutdownModules(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"test-a", "test-b"}; !reflect.DeepEqual(shutdowns, expected) {
+		t.Errorf("expected %v, got %v", expected, shutdowns)
+	}
+	// only once
+	srv.shutdownModules()
+	if len(shutdowns) != 2 {
+		t.Errorf("expected the modules shutdown once, got %v", shutdowns)
+	}
+}
+
+func TestFailedLoadShutsDownTheInitializedModules(t *testing.T) {
+	testCases := []struct {
+		name      string
+		builtin   []string
+		shutdowns []string
+	}{
+		{"init failed", []string{"test-b", "test-a", "test-broken"}, []string{"test-a", "test-b"}},
+		// the clashing module was initialized already
+		{"path clash", []string{"test-b", "test-a", "test-clash"}, []string{"test-clash", "test-a", "test-b"}},
+	}
+	shutdowns := make([]string, 0)
+	defer registerTestBuiltinModule("test-b", "/b", nil, &shutdowns)()
+	defer registerTestBuiltinModule("test-a", "/a", nil, &shutdowns)()
+	defer registerTestBuiltinModule("test-broken", "/broken", errors.New("no database"), &shutdowns)()
+	defer registerTestBuiltinModule("test-clash", "/a", nil, &shutdowns)()
+	for _, testCase := range testCases {
+		shutdowns = shutdowns[:0]
+		srv := NewServer("")
+		srv.configContentJson.Modules.Builtin = testCase.builtin
+		if err, _ := srv.loadModulesFromRepos(); err == nil {
+			t.Fatalf("%v: expected the load to fail", testCase.name)
+		}
+		if !reflect.DeepEqual(shutdowns, testCase.shutdowns) {
+			t.Errorf("%v: expected %v, got %v", testCase.name, testCase.shutdowns, shutdowns)
+		}
+	}
+}
+
+// structure of a probe response
+type testProbeResponse struct {
+	Status  string        `json:"status"`
+	State   string        `json:"state"`
+	Modules []ModuleProbe `json:"modules"`
+}
+
+func TestProbes(t *testing.T) {
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	wsContainerPtr := restful.NewContainer()
+	srv.setupProbes(wsContainerPtr)
+	for _, modulePtr := range []*EchoModule{newTestEchoModule("repo/orders.so", "/orders"), newTestEchoModule("repo/users.so", "/users")} {
+		if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+			t.Fatal(err)
+		}
+		srv.modules[modulePtr.ModulePath] = modulePtr
+	}
+	srv.configContentJson.Modules.Required = []string{"orders.so", "billing.so"}
+
+	testCases := []struct {
+		name     string
+		state    int32
+		required []string
+		path     string
+		status   int
+		expected testProbeResponse
+	}{
+		{"alive while starting", ServerStateStarting, nil, LivenessWebservicePath, http.StatusOK, testProbeResponse{Status: HealthStatusUp, State: "STARTING"}},
+		{"not ready while starting", ServerStateStarting, nil, ReadinessWebservicePath, http.StatusServiceUnavailable, testProbeResponse{Status: HealthStatusDown, State: "STARTING"}},
+		{"ready", ServerStateReady, nil, ReadinessWebservicePath, http.StatusOK, testProbeResponse{Status: HealthStatusUp, State: "READY"}},
+		{"required module missing", ServerStateReady, []string{"orders.so", "billing.so"}, ReadinessWebservicePath, http.StatusServiceUnavailable, testProbeResponse{Status: HealthStatusDown, State: "READY",
+			Modules: []ModuleProbe{{File: "billing.so", IsRequired: true}, {File: "repo/orders.so", Path: "/orders", IsLoaded: true, IsRequired: true}, {File: "repo/users.so", Path: "/users", IsLoaded: true}}}},
+		{"required module loaded", ServerStateReady, []string{"orders.so"}, ReadinessWebservicePath, http.StatusOK, testProbeResponse{Status: HealthStatusUp, State: "READY"}},
+		{"not ready while stopping", ServerStateStopping, nil, ReadinessWebservicePath, http.StatusServiceUnavailable, testProbeResponse{Status: HealthStatusDown, State: "STOPPING"}},
+		{"alive while stopping", ServerStateStopping, nil, LivenessWebservicePath, http.StatusOK, testProbeResponse{Status: HealthStatusUp, State: "STOPPING"}},
+	}
+	for _, testCase := range testCases {
+		atomic.StoreInt32(&srv.state, testCase.state)
+		srv.configContentJson.Modules.Required = testCase.required
+		recorder := serveTestRequest(wsContainerPtr, http.MethodGet, testCase.path, nil, "")
+		var probe testProbeResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &probe); err != nil {
+			t.Fatalf("%v: %v", testCase.name, err)
+		}
+		if recorder.Code != testCase.status || probe.Status != testCase.expected.Status || probe.State != testCase.expected.State {
+			t.Errorf("%v: expected %v %v (%v), got %v %v (%v)", testCase.name, testCase.status, testCase.expected.Status, testCase.expected.State,
+				recorder.Code, probe.Status, probe.State)
+		}
+		if testCase.expected.Modules != nil && !reflect.DeepEqual(probe.Modules, testCase.expected.Modules) {
+			t.Errorf("%v: expected the modules %+v, got %+v", testCase.name, testCase.expected.Modules, probe.Modules)
+		}
+	}
+	// StopServer fails the readiness probe first
+	atomic.StoreInt32(&srv.state, ServerStateReady)
+	if err := srv.StopServer(); err != nil {
+		t.Fatal(err)
+	}
+	if recorder := serveTestRequest(wsContainerPtr, http.MethodGet, ReadinessWebservicePath, nil, ""); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the stopped server not ready, got %v", recorder.Code)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	wsContainerPtr := restful.NewContainer()
+	srv.setupHealth(wsContainerPtr)
+	var usersErr error
+	ordersModulePtr := newTestEchoModule("orders.so", "/orders")
+	ordersModulePtr.FxHealth = func() error { return nil }
+	usersModulePtr := newTestEchoModule("users.so", "/users")
+	usersModulePtr.FxHealth = func() error { return usersErr }
+	panickingModulePtr := newTestEchoModule("billing.so", "/billing")
+	panickingModulePtr.FxHealth = func() error { panic("no connection pool") }
+	// without a Health hook; UP once loaded
+	stockModulePtr := newTestEchoModule("stock.so", "/stock")
+	for _, modulePtr := range []*EchoModule{ordersModulePtr, usersModulePtr, panickingModulePtr, stockModulePtr} {
+		if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, modulePtr := range []*EchoModule{ordersModulePtr, usersModulePtr, stockModulePtr} {
+		srv.modules[modulePtr.ModulePath] = modulePtr
+	}
+
+	checkHealth := func(status int, expected map[string]ModuleHealth) {
+		recorder := serveTestRequest(wsContainerPtr, http.MethodGet, HealthWebservicePath, nil, "")
+		var health struct {
+			Status  string                  `json:"status"`
+			Modules map[string]ModuleHealth `json:"modules"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil {
+			t.Fatal(err)
+		}
+		expectedStatus := HealthStatusUp
+		if status != http.StatusOK {
+			expectedStatus = HealthStatusDown
+		}
+		if recorder.Code != status || health.Status != expectedStatus || !reflect.DeepEqual(health.Modules, expected) {
+			t.Errorf("expected %v %+v, got %v %v %+v", status, expected, recorder.Code, health.Status, health.Modules)
+		}
+	}
+	checkHealth(http.StatusOK, map[string]ModuleHealth{
+		"/orders": {File: "orders.so", Status: HealthStatusUp, IsChecked: true},
+		"/users":  {File: "users.so", Status: HealthStatusUp, IsChecked: true},
+		"/stock":  {File: "stock.so", Status: HealthStatusUp},
+	})
+	usersErr = errors.New("database unavailable")
+	srv.modules[panickingModulePtr.ModulePath] = panickingModulePtr
+	checkHealth(http.StatusServiceUnavailable, map[string]ModuleHealth{
+		"/orders":  {File: "orders.so", Status: HealthStatusUp, IsChecked: true},
+		"/users":   {File: "users.so", Status: HealthStatusDown, IsChecked: true, Error: "database unavailable"},
+		"/billing": {File: "billing.so", Status: HealthStatusDown, IsChecked: true, Error: "Health panicked: no connection pool"},
+		"/stock":   {File: "stock.so", Status: HealthStatusUp},
+	})
+}
@@ -0,0 +1,211 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// structure for a single step of a (simplified) JSONPath expression
+type jsonPathStep struct {
+	key       string // object key; "*" for any key / element
+	index     int    // array index (only when isIndex is true)
+	isIndex   bool
+	recursive bool // ".." recursive descent
+}
+
+// method to evaluate a JSONPath expression against a decoded json document.
+// Supported syntax: $ . .. * ['key'] [n] [*] (e.g. $.orders[0].id, $..id, $['x-key']); filter expressions
+// ([?(...)]), slices ([0:2]) and unions ([0,1]) are not and are reported as errors
+func EvaluateJsonPath(document interface{}, expression string) ([]interface{}, error) {
+	steps, err := _parseJsonPath(expression)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []interface{}{document}
+	for _, step := range steps {
+		nextNodes := make([]interface{}, 0)
+		for _, node := range nodes {
+			if step.recursive {
+				for _, descendant := range _jsonPathDescendants(node) {
+					nextNodes = append(nextNodes, _jsonPathApplyStep(descendant, step)...)
+				}
+			} else {
+				nextNodes = append(nextNodes, _jsonPathApplyStep(node, step)...)
+			}
+		}
+		nodes = nextNodes
+	}
+	return nodes, nil
+}
+
+// method to turn a json value found by EvaluateJsonPath into a string for comparison
+func JsonValueToString(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return value.(string)
+	case float64:
+		return strconv.FormatFloat(value.(float64), 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value.(bool))
+	default:
+		bArr, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return string(bArr)
+	}
+}
+
+// method to parse the JSONPath expression into steps
+func _parseJsonPath(expression string) ([]jsonPathStep, error) {
+	expression = strings.TrimSpace(expression)
+	if !strings.HasPrefix(expression, "$") {
+		return nil, fmt.Errorf("invalid json path, must start with $ => %v", expression)
+	}
+	steps := make([]jsonPathStep, 0)
+	remaining := expression[1:]
+	isRecursive := false
+	for len(remaining) > 0 {
+		var step jsonPathStep
+		step.recursive = isRecursive
+		isRecursive = false
+		switch {
+		case strings.HasPrefix(remaining, "..["):
+			// e.g. $..[0] ; the bracket applies to every descendant
+			isRecursive = true
+			remaining = remaining[2:]
+			continue
+		case strings.HasPrefix(remaining, ".."):
+			step.recursive = true
+			remaining = remaining[2:]
+			step.key, remaining = _readJsonPathName(remaining)
+		case strings.HasPrefix(remaining, "."):
+			remaining = remaining[1:]
+			step.key, remaining = _readJsonPathName(remaining)
+		case strings.HasPrefix(remaining, "["):
+			end := strings.Index(remaining, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path, missing ] => %v", expression)
+			}
+			content := strings.TrimSpace(remaining[1:end])
+			remaining = remaining[end+1:]
+			if strings.HasPrefix(content, "?") || strings.HasPrefix(content, "(") {
+				return nil, fmt.Errorf("json path filter / script expressions are not supported [%v] => %v", content, expression)
+			}
+			if content == "*" {
+				step.key = "*"
+			} else if len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0] {
+				step.key = content[1 : len(content)-1]
+			} else {
+				if strings.ContainsAny(content, ":,") {
+					return nil, fmt.Errorf("json path slices and unions are not supported [%v] => %v", content, expression)
+				}
+				index, err := strconv.Atoi(content)
+				if err != nil {
+					return nil, fmt.Errorf("invalid json path index [%v] => %v", content, expression)
+				}
+				step.index = index
+				step.isIndex = true
+			}
+		default:
+			return nil, fmt.Errorf("invalid json path near [%v] => %v", remaining, expression)
+		}
+		if step.key == "" && !step.isIndex {
+			return nil, fmt.Errorf("invalid json path, empty name => %v", expression)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// method to read a dotted name up to the next "." or "["
+func _readJsonPathName(remaining string) (name string, rest string) {
+	end := strings.IndexAny(remaining, ".[")
+	if end < 0 {
+		return remaining, ""
+	}
+	return remaining[:end], remaining[end:]
+}
+
+// method to apply a single (non recursive) step on a node
+func _jsonPathApplyStep(node interface{}, step jsonPathStep) []interface{} {
+	results := make([]interface{}, 0)
+	switch node.(type) {
+	case map[string]interface{}:
+		object := node.(map[string]interface{})
+		if step.isIndex {
+			return results
+		}
+		if step.key == "*" {
+			for _, key := range _sortedJsonKeys(object) {
+				results = append(results, object[key])
+			}
+		} else if value, ok := object[step.key]; ok {
+			results = append(results, value)
+		}
+	case []interface{}:
+		array := node.([]interface{})
+		if step.isIndex {
+			index := step.index
+			if index < 0 {
+				index = len(array) + index
+			}
+			if index >= 0 && index < len(array) {
+				results = append(results, array[index])
+			}
+		} else if step.key == "*" {
+			results = append(results, array...)
+		}
+	}
+	return results
+}
+
+// method to list the node itself and all its descendants (depth first)
+func _jsonPathDescendants(node interface{}) []interface{} {
+	results := []interface{}{node}
+	switch node.(type) {
+	case map[string]interface{}:
+		object := node.(map[string]interface{})
+		for _, key := range _sortedJsonKeys(object) {
+			results = append(results, _jsonPathDescendants(object[key])...)
+		}
+	case []interface{}:
+		for _, element := range node.([]interface{}) {
+			results = append(results, _jsonPathDescendants(element)...)
+		}
+	}
+	return results
+}
+
+// method to get the keys of a json object in a stable order
+func _sortedJsonKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,433 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// log outputs
+const (
+	LogOutputStdout   = "stdout"
+	LogOutputSyslog   = "syslog"
+	LogOutputJournald = "journald"
+)
+
+// overflow policies of the async logging
+const (
+	LogOverflowBlock = "block"
+	LogOverflowDrop  = "drop"
+)
+
+// default socket of the journald native protocol
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// syslog facilities by name (RFC 5424 section 6.2.1)
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// structure of a log line handed to a LogSink
+type LogEntry struct {
+	Time      time.Time
+	Level     int
+	Filename  string
+	FuncName  string
+	Line      int // 0 if unknown
+	RequestId string
+	Message   string
+	Fields    []LogField
+}
+
+type LogField struct {
+	Key   string
+	Value string
+}
+
+// interface of a log output
+type LogSink interface {
+	Write(entry LogEntry) (int, error)
+	Close() error
+}
+
+// ctor. Create the LogSink of the logging config; nil for synchronous stdout (the Logger's default)
+func NewLogSink(loggingConfig LoggingConfig) (LogSink, error) {
+	var sink LogSink
+	var err error
+	switch loggingConfig.Output {
+	case LogOutputSyslog:
+		sink, err = NewSyslogSink(loggingConfig.Syslog.Network, loggingConfig.Syslog.Address, loggingConfig.Syslog.Facility, loggingConfig.AppName)
+	case LogOutputJournald:
+		sink, err = NewJournaldSink(loggingConfig.Journald.Socket, loggingConfig.AppName)
+	}
+	if err != nil || !loggingConfig.Async.Enabled {
+		return sink, err
+	}
+	if sink == nil {
+		sink = new(StdoutSink)
+	}
+	return NewAsyncLogSink(sink, loggingConfig.Async.BufferSize, loggingConfig.Async.Overflow), nil
+}
+
+// sink writing text lines to stdout (what a Logger without sink does)
+type StdoutSink struct{}
+
+func (s *StdoutSink) Write(entry LogEntry) (int, error) {
+	return fmt.Printf("%v\n", FormatTextLogLine(entry))
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
+
+// sink handing the entries to a background writer through a bounded buffer; the caller doesn't wait
+// for the (slow) output. A full buffer blocks the caller or drops the entry, depending on the overflow policy
+type AsyncLogSink struct {
+	lock         sync.RWMutex
+	sink         LogSink
+	entries      chan LogEntry
+	isDropping   bool
+	isClosed     bool
+	droppedCount uint64
+	done         chan struct{}
+}
+
+// ctor. Create instance of *AsyncLogSink writing to the given sink; overflow is block or drop
+func NewAsyncLogSink(sink LogSink, bufferSize int, overflow string) *AsyncLogSink {
+	asyncSink := &AsyncLogSink{
+		sink:       sink,
+		entries:    make(chan LogEntry, bufferSize),
+		isDropping: overflow == LogOverflowDrop,
+		done:       make(chan struct{}),
+	}
+	go asyncSink._writeEntries()
+	return asyncSink
+}
+
+// method to queue the entry; the count returned is 0 as nothing is written yet
+func (s *AsyncLogSink) Write(entry LogEntry) (int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.isClosed {
+		// logged while stopping; write it synchronously instead of losing it
+		return s.sink.Write(entry)
+	}
+	if !s.isDropping {
+		s.entries <- entry
+		return 0, nil
+	}
+	select {
+	case s.entries <- entry:
+	default:
+		atomic.AddUint64(&s.droppedCount, 1)
+	}
+	return 0, nil
+}
+
+// method to get the number of entries dropped because the buffer was full
+func (s *AsyncLogSink) DroppedCount() uint64 {
+	return atomic.LoadUint64(&s.droppedCount)
+}
+
+// method to flush the queued entries and close the underlying sink; the dropped entries (if any) are reported
+func (s *AsyncLogSink) Close() error {
+	s.lock.Lock()
+	if s.isClosed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.isClosed = true
+	close(s.entries)
+	s.lock.Unlock()
+
+	<-s.done
+	if droppedCount := s.DroppedCount(); droppedCount > 0 {
+		s.sink.Write(LogEntry{Time: _getTimeNow(), Level: LogLevelWarning, Filename: "LogSink", FuncName: "Close",
+			Message: fmt.Sprintf("%v log line(s) dropped; the async logging buffer was full", droppedCount)})
+	}
+	return s.sink.Close()
+}
+
+// background writer
+func (s *AsyncLogSink) _writeEntries() {
+	defer close(s.done)
+	for entry := range s.entries {
+		if _, err := s.sink.Write(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "%v (log sink failed: %v)\n", FormatTextLogLine(entry), err)
+		}
+	}
+}
+
+// method to map a log level to the syslog severity (also used by journald's PRIORITY)
+func SyslogSeverity(logLevel int) int {
+	switch logLevel {
+	case LogLevelError:
+		return 3 // err
+	case LogLevelWarning:
+		return 4 // warning
+	case LogLevelInfo:
+		return 6 // informational
+	default:
+		return 7 // debug (trace and debug)
+	}
+}
+
+// structure of a datagram / stream connection reconnecting (once per write) after a failure
+type logConnection struct {
+	lock     sync.Mutex
+	network  string
+	address  string
+	conn     net.Conn
+	isStream bool // messages on a stream are newline terminated (RFC 6587 non-transparent framing)
+}
+
+// method to write the message; reconnects and retries once if the connection is broken
+func (c *logConnection) write(message []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if c.conn, err = c.dial(); err != nil {
+				return 0, err
+			}
+		}
+		framedMessage := message
+		if c.isStream && !bytes.HasSuffix(message, []byte("\n")) {
+			framedMessage = append(message[:len(message):len(message)], '\n')
+		}
+		var count int
+		if count, err = c.conn.Write(framedMessage); err == nil {
+			return count, nil
+		}
+		c.conn.Close()
+		c.conn = nil
+	}
+	return 0, err
+}
+
+// method to connect; "unix" tries a datagram socket first then a stream socket (like /dev/log)
+func (c *logConnection) dial() (net.Conn, error) {
+	c.isStream = false
+	if c.network != "unix" {
+		return net.Dial(c.network, c.address)
+	}
+	conn, err := net.Dial("unixgram", c.address)
+	if err == nil {
+		return conn, nil
+	}
+	c.isStream = true
+	return net.Dial("unix", c.address)
+}
+
+func (c *logConnection) close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// sink writing RFC 5424 syslog messages to a unix socket (e.g. /dev/log) or an udp address
+type SyslogSink struct {
+	connection *logConnection
+	facility   int
+	appName    string
+	hostname   string
+	procId     string
+}
+
+// ctor. Create instance of *SyslogSink; network is unix or udp, facility a name e.g. user or local0
+func NewSyslogSink(network, address, facility, appName string) (*SyslogSink, error) {
+	facilityCode, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility [%v]", facility)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	sink := &SyslogSink{
+		connection: &logConnection{network: network, address: address},
+		facility:   facilityCode,
+		appName:    _toSyslogName(appName, 48),
+		hostname:   _toSyslogName(hostname, 255),
+		procId:     strconv.Itoa(os.Getpid()),
+	}
+	return sink, nil
+}
+
+// method to send the entry as a RFC 5424 message e.g.
+// <14>1 2026-10-19T04:03:03.966961Z host echogogo 42 Server.AccessLog [echogogo@32473 requestId="abc"] GET /orders 200
+func (s *SyslogSink) Write(entry LogEntry) (int, error) {
+	return s.connection.write([]byte(s.Format(entry)))
+}
+
+// method to format the entry as a RFC 5424 message
+func (s *SyslogSink) Format(entry LogEntry) string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "<%v>1 %v %v %v %v ", s.facility*8+SyslogSeverity(entry.Level),
+		entry.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.appName, s.procId)
+	// MSGID; where the line comes from
+	msgId := "-"
+	if entry.Filename != "" && entry.Filename != "-" {
+		msgId = _toSyslogName(entry.Filename+"."+entry.FuncName, 32)
+	}
+	buffer.WriteString(msgId)
+	buffer.WriteString(" ")
+	// STRUCTURED-DATA; request id, caller line and fields (private enterprise number 32473 is reserved for examples)
+	params := make([]LogField, 0, len(entry.Fields)+2)
+	if entry.RequestId != "" {
+		params = append(params, LogField{Key: "requestId", Value: entry.RequestId})
+	}
+	if entry.Line > 0 {
+		params = append(params, LogField{Key: "line", Value: strconv.Itoa(entry.Line)})
+	}
+	params = append(params, entry.Fields...)
+	if len(params) == 0 {
+		buffer.WriteString("-")
+	} else {
+		buffer.WriteString("[echogogo@32473")
+		for _, param := range params {
+			value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(param.Value)
+			fmt.Fprintf(&buffer, ` %v="%v"`, _toSyslogName(param.Key, 32), value)
+		}
+		buffer.WriteString("]")
+	}
+	buffer.WriteString(" ")
+	buffer.WriteString(entry.Message)
+	return buffer.String()
+}
+
+func (s *SyslogSink) Close() error {
+	return s.connection.close()
+}
+
+// method to make the value a syslog name; printable ascii without spaces, "=", "]" or quotes, max length
+func _toSyslogName(value string, maxLength int) string {
+	name := strings.Map(func(char rune) rune {
+		if char <= ' ' || char > '~' || char == '=' || char == ']' || char == '"' {
+			return '_'
+		}
+		return char
+	}, value)
+	if len(name) > maxLength {
+		name = name[:maxLength]
+	}
+	if name == "" {
+		return "-"
+	}
+	return name
+}
+
+// sink writing to journald through its native protocol (datagrams of KEY=VALUE lines)
+type JournaldSink struct {
+	connection *logConnection
+	identifier string
+}
+
+// ctor. Create instance of *JournaldSink; socket defaults to /run/systemd/journal/socket
+func NewJournaldSink(socket string, identifier string) (*JournaldSink, error) {
+	if socket == "" {
+		socket = DefaultJournaldSocket
+	}
+	return &JournaldSink{connection: &logConnection{network: "unixgram", address: socket}, identifier: identifier}, nil
+}
+
+// method to send the entry as a journald native message
+func (s *JournaldSink) Write(entry LogEntry) (int, error) {
+	return s.connection.write(s.Format(entry))
+}
+
+// method to format the entry as a journald native message; MESSAGE, PRIORITY, SYSLOG_IDENTIFIER, CODE_FILE,
+// CODE_FUNC, CODE_LINE, REQUEST_ID plus the fields (names in upper case)
+func (s *JournaldSink) Format(entry LogEntry) []byte {
+	var buffer bytes.Buffer
+	_writeJournaldField(&buffer, "MESSAGE", entry.Message)
+	_writeJournaldField(&buffer, "PRIORITY", strconv.Itoa(SyslogSeverity(entry.Level)))
+	_writeJournaldField(&buffer, "SYSLOG_IDENTIFIER", s.identifier)
+	if entry.Filename != "" && entry.Filename != "-" {
+		_writeJournaldField(&buffer, "CODE_FILE", entry.Filename)
+	}
+	if entry.FuncName != "" && entry.FuncName != "-" {
+		_writeJournaldField(&buffer, "CODE_FUNC", entry.FuncName)
+	}
+	if entry.Line > 0 {
+		_writeJournaldField(&buffer, "CODE_LINE", strconv.Itoa(entry.Line))
+	}
+	if entry.RequestId != "" {
+		_writeJournaldField(&buffer, "REQUEST_ID", entry.RequestId)
+	}
+	for _, field := range entry.Fields {
+		if name := _toJournaldFieldName(field.Key); name != "" {
+			_writeJournaldField(&buffer, name, field.Value)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func (s *JournaldSink) Close() error {
+	return s.connection.close()
+}
+
+// method to write a field; values with a newline use the binary form (name, 64 bit little endian length, value)
+func _writeJournaldField(buffer *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buffer, "%v=%v\n", name, value)
+		return
+	}
+	buffer.WriteString(name)
+	buffer.WriteString("\n")
+	binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	buffer.WriteString(value)
+	buffer.WriteString("\n")
+}
+
+// method to make the key a journald field name; upper case letters, digits and "_", not starting with "_"
+func _toJournaldFieldName(key string) string {
+	name := strings.Map(func(char rune) rune {
+		switch {
+		case char >= 'a' && char <= 'z':
+			return char - 'a' + 'A'
+		case char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+			return char
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,370 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sink keeping the entries written; if gated, every Write waits for the gate to open (a slow output)
+type recordingSink struct {
+	lock     sync.Mutex
+	entries  []LogEntry
+	isClosed bool
+	gate     chan struct{}
+	started  chan struct{} // receives once per Write entered
+}
+
+func newGatedRecordingSink() *recordingSink {
+	return &recordingSink{gate: make(chan struct{}), started: make(chan struct{}, 64)}
+}
+
+func (s *recordingSink) Write(entry LogEntry) (int, error) {
+	if s.gate != nil {
+		s.started <- struct{}{}
+		<-s.gate
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = append(s.entries, entry)
+	return len(entry.Message), nil
+}
+
+func (s *recordingSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.isClosed = true
+	return nil
+}
+
+func (s *recordingSink) messages() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	messages := make([]string, 0, len(s.entries))
+	for _, entry := range s.entries {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+// method to fill the async sink: the first entry is held by the (blocked) background writer, the next
+// bufferSize entries fill the buffer
+func fillAsyncLogSink(t *testing.T, asyncSink *AsyncLogSink, sink *recordingSink, bufferSize int) {
+	asyncSink.Write(LogEntry{Message: "line-0"})
+	select {
+	case <-sink.started:
+	case <-time.After(time.Second):
+		t.Fatal("the background writer did not pick the first entry")
+	}
+	for idx := 1; idx <= bufferSize; idx++ {
+		asyncSink.Write(LogEntry{Message: fmt.Sprintf("line-%v", idx)})
+	}
+}
+
+func TestAsyncLogSinkDropsWhenFull(t *testing.T) {
+	sink := newGatedRecordingSink()
+	asyncSink := NewAsyncLogSink(sink, 2, LogOverflowDrop)
+	fillAsyncLogSink(t, asyncSink, sink, 2)
+
+	for idx := 0; idx < 3; idx++ {
+		done := make(chan struct{})
+		go func() {
+			asyncSink.Write(LogEntry{Message: "dropped"})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Write blocked although the overflow policy is drop")
+		}
+	}
+	if asyncSink.DroppedCount() != 3 {
+		t.Errorf("expected 3 dropped entries, got %v", asyncSink.DroppedCount())
+	}
+	close(sink.gate)
+	if err := asyncSink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := sink.messages()
+	expected := []string{"line-0", "line-1", "line-2", "3 log line(s) dropped; the async logging buffer was full"}
+	if strings.Join(messages, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, messages)
+	}
+}
+
+func TestAsyncLogSinkBlocksWhenFull(t *testing.T) {
+	sink := newGatedRecordingSink()
+	asyncSink := NewAsyncLogSink(sink, 2, LogOverflowBlock)
+	fillAsyncLogSink(t, asyncSink, sink, 2)
+
+	done := make(chan struct{})
+	go func() {
+		asyncSink.Write(LogEntry{Message: "line-3"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Write returned although the buffer is full and the overflow policy is block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// the writer catches up; the blocked Write gets through
+	close(sink.gate)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Write still blocked after the buffer drained")
+	}
+	if err := asyncSink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if asyncSink.DroppedCount() != 0 {
+		t.Errorf("expected no dropped entry, got %v", asyncSink.DroppedCount())
+	}
+	if messages := sink.messages(); strings.Join(messages, "|") != "line-0|line-1|line-2|line-3" {
+		t.Errorf("expected every line in order, got %v", messages)
+	}
+}
+
+func TestAsyncLogSinkCloseFlushes(t *testing.T) {
+	sink := new(recordingSink)
+	asyncSink := NewAsyncLogSink(sink, 1024, LogOverflowBlock)
+	for idx := 0; idx < 500; idx++ {
+		asyncSink.Write(LogEntry{Message: fmt.Sprintf("line-%v", idx)})
+	}
+	if err := asyncSink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := sink.messages()
+	if len(messages) != 500 || messages[0] != "line-0" || messages[499] != "line-499" {
+		t.Fatalf("expected the 500 queued lines in order after Close, got %v line(s)", len(messages))
+	}
+	if !sink.isClosed {
+		t.Error("Close must close the underlying sink")
+	}
+	// logged while stopping; written synchronously instead of lost
+	asyncSink.Write(LogEntry{Message: "after close"})
+	if messages := sink.messages(); messages[len(messages)-1] != "after close" {
+		t.Errorf("expected the line written after Close, got %v", messages[len(messages)-1])
+	}
+	if err := asyncSink.Close(); err != nil {
+		t.Errorf("a second Close must be a no-op, got %v", err)
+	}
+}
+
+// sink writing text lines to a writer e.g. a file (what the stdout output does)
+type writerSink struct {
+	writer io.Writer
+}
+
+func (s *writerSink) Write(entry LogEntry) (int, error) {
+	return fmt.Fprintf(s.writer, "%v\n", FormatTextLogLine(entry))
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// method to log b.N lines through the logger to a temp file; unbuffered like stdout
+func benchmarkLogSink(b *testing.B, wrap func(LogSink) LogSink) {
+	file, err := ioutil.TempFile("", "echogogo-log-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	logger := NewLogger(LogLevelInfo)
+	logger.Sink = wrap(&writerSink{writer: file})
+	logger = logger.WithRequestId("0af7651916cd43dd8448eb211c80319c").Named("Server", "AccessLog")
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		logger.With("status", 200, "durationMs", 3).Info("GET /orders/42")
+	}
+	// the time of the callers only; with the block policy they still wait once the buffer is full
+	b.StopTimer()
+	logger.Sink.Close()
+}
+
+// today's path; every line is written before the caller continues
+func BenchmarkSyncLogSink(b *testing.B) {
+	benchmarkLogSink(b, func(sink LogSink) LogSink {
+		return sink
+	})
+}
+
+func BenchmarkAsyncLogSink(b *testing.B) {
+	benchmarkLogSink(b, func(sink LogSink) LogSink {
+		// the default logging.async.bufferSize
+		return NewAsyncLogSink(sink, 1024, LogOverflowBlock)
+	})
+}
+
+// entry with a request id, a caller line and a field
+var testSyslogEntry = LogEntry{Time: time.Date(2026, 10, 19, 4, 3, 3, 966961000, time.UTC), Level: LogLevelWarning,
+	Filename: "Server", FuncName: "AccessLog", Line: 42, RequestId: "abc", Message: "GET /orders 200",
+	Fields: []LogField{{Key: "durationMs", Value: "3"}}}
+
+// method to check a syslog message of testSyslogEntry (facility local0)
+func checkTestSyslogMessage(t *testing.T, message string) {
+	hostname, _ := os.Hostname()
+	expected := fmt.Sprintf(`<132>1 2026-10-19T04:03:03.966961Z %v echogogo %v Server.AccessLog [echogogo@32473 requestId="abc" line="42" durationMs="3"] GET /orders 200`,
+		_toSyslogName(hostname, 255), os.Getpid())
+	if message != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, message)
+	}
+}
+
+// method to create a unix socket path in a new temp dir (removed by the returned func)
+func newTestSocketPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "eg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "log.sock"), func() { os.RemoveAll(dir) }
+}
+
+// method to read a datagram from the listener
+func readTestDatagram(t *testing.T, listener net.PacketConn) string {
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	bArrMessage := make([]byte, 4096)
+	count, _, err := listener.ReadFrom(bArrMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bArrMessage[:count])
+}
+
+func TestSyslogSinkUdp(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	sink, err := NewSyslogSink("udp", listener.LocalAddr().String(), "local0", "echogogo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if _, err := sink.Write(testSyslogEntry); err != nil {
+		t.Fatal(err)
+	}
+	checkTestSyslogMessage(t, readTestDatagram(t, listener))
+}
+
+func TestSyslogSinkUnixgram(t *testing.T) {
+	socketPath, cleanup := newTestSocketPath(t)
+	defer cleanup()
+	listener, err := net.ListenPacket("unixgram", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	sink, _ := NewSyslogSink("unix", socketPath, "local0", "echogogo")
+	defer sink.Close()
+
+	for idx := 0; idx < 2; idx++ {
+		if _, err := sink.Write(testSyslogEntry); err != nil {
+			t.Fatal(err)
+		}
+		// one datagram per message; no framing
+		checkTestSyslogMessage(t, readTestDatagram(t, listener))
+	}
+}
+
+// on a unix stream socket the messages must not run together
+func TestSyslogSinkUnixStreamIsNewlineFramed(t *testing.T) {
+	socketPath, cleanup := newTestSocketPath(t)
+	defer cleanup()
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	sink, _ := NewSyslogSink("unix", socketPath, "local0", "echogogo")
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		bArrMessages, _ := ioutil.ReadAll(conn)
+		received <- string(bArrMessages)
+	}()
+	for idx := 0; idx < 2; idx++ {
+		if _, err := sink.Write(testSyslogEntry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+
+	select {
+	case messages := <-received:
+		lines := strings.Split(messages, "\n")
+		if len(lines) != 3 || lines[2] != "" {
+			t.Fatalf("expected 2 newline terminated messages, got %q", messages)
+		}
+		checkTestSyslogMessage(t, lines[0])
+		checkTestSyslogMessage(t, lines[1])
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing received on the stream socket")
+	}
+}
+
+func TestJournaldSinkUnixgram(t *testing.T) {
+	socketPath, cleanup := newTestSocketPath(t)
+	defer cleanup()
+	listener, err := net.ListenPacket("unixgram", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	sink, _ := NewJournaldSink(socketPath, "echogogo")
+	defer sink.Close()
+
+	entry := testSyslogEntry
+	entry.Message = "line 1\nline 2"
+	entry.Fields = []LogField{{Key: "order-id", Value: "42"}}
+	if _, err := sink.Write(entry); err != nil {
+		t.Fatal(err)
+	}
+	var expected bytes.Buffer
+	// a value with a newline: name, 64 bit little endian length, value
+	expected.WriteString("MESSAGE\n")
+	binary.Write(&expected, binary.LittleEndian, uint64(len(entry.Message)))
+	expected.WriteString(entry.Message + "\n")
+	expected.WriteString("PRIORITY=4\nSYSLOG_IDENTIFIER=echogogo\nCODE_FILE=Server\nCODE_FUNC=AccessLog\nCODE_LINE=42\nREQUEST_ID=abc\nORDER_ID=42\n")
+	if message := readTestDatagram(t, listener); message != expected.String() {
+		t.Errorf("expected %q, got %q", expected.String(), message)
+	}
+}
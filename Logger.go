@@ -20,7 +20,13 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -32,16 +38,27 @@ const LogLevelError = 4
 
 type LogConfig struct {
 	DefaultLevel    int
-	Filename        string	// e.g. Server.go or Main.go etc (should remove the suffix ".go" though)
-	DefaultFuncName string // if func name is not provided, will use this value to build the log line
+	Filename        string	// e.g. Server.go or Main.go etc (should remove the suffix ".go" though); used if the caller is not derived
+	DefaultFuncName string // if func name is not provided (and the caller is not derived), will use this value to build the log line
 }
 
 type Logger struct {
 	ThresholdLogLevel int	// the threshold for logging (e.g. info; which means all logs lower than INFO would be skipped)
+	RequestId string	// id of the request being handled (if any); added to every log line
+	IsCallerEnabled bool	// derive the file, line and function from runtime.Caller when they are not provided
+	Sink LogSink	// where the log lines go; stdout (text) if nil
+
+	filename string	// filename.funcName of the log lines written through Trace / Debug / Info / Warning / Error
+	funcName string
+	fields []interface{}	// key, value pairs added to every log line (see With)
 }
 
+// key of the request's Logger in a context.Context
+type loggerContextKey struct{}
+
 func NewLogger(thresholdLogLevel int) Logger {
 	ptr := new(Logger)
+	ptr.IsCallerEnabled = true
 	if thresholdLogLevel >= 0 && thresholdLogLevel <= 4 {
 		ptr.ThresholdLogLevel = thresholdLogLevel
 	} else {
@@ -50,79 +67,251 @@ func NewLogger(thresholdLogLevel int) Logger {
 	return *ptr
 }
 
-// logging method with all parameters required
+// method to get a copy of the logger adding the request id to every log line
+func (l Logger) WithRequestId(requestId string) Logger {
+	l.RequestId = requestId
+	return l
+}
+
+// method to get a copy of the logger adding the key, value pairs to every log line
+// e.g. logger.With("module", "/orders", "endPoint", "GET::/{id}").Info("stub matched")
+func (l Logger) With(keyValues ...interface{}) Logger {
+	l.fields = append(append(make([]interface{}, 0, len(l.fields)+len(keyValues)), l.fields...), keyValues...)
+	return l
+}
+
+// method to get a copy of the logger writing the given filename.funcName
+func (l Logger) Named(filename string, funcName string) Logger {
+	l.filename = filename
+	l.funcName = funcName
+	return l
+}
+
+func (l Logger) Trace(message string) {
+	l._logAtLevel(LogLevelTrace, message)
+}
+
+func (l Logger) Debug(message string) {
+	l._logAtLevel(LogLevelDebug, message)
+}
+
+func (l Logger) Info(message string) {
+	l._logAtLevel(LogLevelInfo, message)
+}
+
+func (l Logger) Warning(message string) {
+	l._logAtLevel(LogLevelWarning, message)
+}
+
+func (l Logger) Error(message string) {
+	l._logAtLevel(LogLevelError, message)
+}
+
+// method to log at the level given by name (trace, debug, info, warning or error) with extra key, value
+// pairs; handy for callers not sharing the Logger type e.g. plugins (see the DoAction option "log")
+func (l Logger) LogFields(level string, message string, keyValues ...interface{}) {
+	logLevel, err := ParseLogLevel(level)
+	if err != nil {
+		logLevel = LogLevelInfo
+	}
+	l.With(keyValues...)._logAtLevel(logLevel, message)
+}
+
+// method to log the message if the level reaches the threshold; called by the Trace / Debug / Info /
+// Warning / Error / LogFields methods (the caller of those is the one reported)
+func (l Logger) _logAtLevel(logLevel int, message string) {
+	if logLevel < l.ThresholdLogLevel {
+		return
+	}
+	filename, funcName, line := l._getCaller(3, l.filename, l.funcName)
+	l._writeLine(logLevel, _orDash(filename, "-"), _orDash(funcName, "-"), line, message)
+}
+
+// method to get a context carrying the logger
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// method to get the logger of the context (e.g. of a request); false if there is none
+func LoggerFromContext(ctx context.Context) (Logger, bool) {
+	logger, ok := ctx.Value(loggerContextKey{}).(Logger)
+	return logger, ok
+}
+
+// logging method with all parameters required; kept for the existing callers (see With / Info etc)
 func (l *Logger) Log(message string, logLevel int, filename string, funcName string) (charsLogged int, err error)  {
 	if logLevel < l.ThresholdLogLevel {
 		return 0, nil
 	}
-	var buffer bytes.Buffer
+	filename, funcName, line := l._getCaller(2, filename, funcName)
+	return l._writeLine(logLevel, _orDash(filename, "-"), _orDash(funcName, "-"), line, message)
+}
 
-	buffer.WriteString("[")
-	buffer.WriteString(_getTimeNow().String())
-	buffer.WriteString("][")
-	// log level
-	buffer.WriteString(_translateLogLevelString(logLevel))
-	buffer.WriteString("][")
-	// filename.Funcname
-	if len(filename) > 0 {
-		buffer.WriteString(filename)
-	} else {
-		buffer.WriteString("-")
+// simple log method; kept for the existing callers (see With / Info etc). The level is the config's
+// DefaultLevel (trace without a config) and, like every other log method, lines below the threshold are
+// skipped; the inspecting commands rely on it to keep their (json) output clean
+func (l *Logger) LogWithFuncName(message string, funcName string, logConfig ...LogConfig) (charsLogged int, err error)  {
+	isConfigValid := len(logConfig) > 0
+	// log level; trace without a config
+	level := LogLevelTrace
+	if isConfigValid {
+		level = logConfig[0].DefaultLevel
 	}
-	buffer.WriteString(".")
-	if len(funcName) >0 {
-		buffer.WriteString(funcName)
-	} else {
-		buffer.WriteString("-")
+	if level < l.ThresholdLogLevel {
+		return 0, nil
 	}
-	buffer.WriteString("] ")
-	buffer.WriteString(message)
+	// like Log, the given funcName wins; the caller fills it in if empty. The config's filename (shared by
+	// every caller) and funcName are only fallbacks
+	filename, funcName, line := l._getCaller(2, "", funcName)
+	if len(filename) == 0 && isConfigValid {
+		filename = logConfig[0].Filename
+	}
+	if len(funcName) == 0 && isConfigValid {
+		funcName = logConfig[0].DefaultFuncName
+	}
+	return l._writeLine(level, _orDash(filename, " - "), _orDash(funcName, " - "), line, message)
+}
 
-	charsLogged, err = fmt.Printf("%v\n", buffer.String())
+// method to fill the missing filename / funcName (and the line) from the caller, skip frames above
+// _getCaller's caller; nothing is derived unless IsCallerEnabled
+func (l *Logger) _getCaller(skip int, filename string, funcName string) (string, string, int) {
+	if !l.IsCallerEnabled {
+		return filename, funcName, 0
+	}
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return filename, funcName, 0
+	}
+	if len(filename) == 0 {
+		filename = strings.TrimSuffix(filepath.Base(file), ".go")
+	}
+	if len(funcName) == 0 {
+		funcName = _getShortFuncName(runtime.FuncForPC(pc))
+	}
+	return filename, funcName, line
+}
+
+// method to get the short name of the function e.g. main.(*Server).setupOpenApi.func1 => setupOpenApi
+func _getShortFuncName(fx *runtime.Func) string {
+	if fx == nil {
+		return ""
+	}
+	parts := strings.Split(fx.Name(), ".")
+	// closures are reported as their enclosing function
+	for len(parts) > 1 && (strings.HasPrefix(parts[len(parts)-1], "func") || _isDigits(parts[len(parts)-1])) {
+		parts = parts[:len(parts)-1]
+	}
+	return parts[len(parts)-1]
+}
 
+// method to check the value is made of digits only
+func _isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, char := range value {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// method to write a log line through the sink (stdout if none); the line is written to stderr if the sink fails
+func (l *Logger) _writeLine(logLevel int, filename string, funcName string, line int, message string) (charsLogged int, err error) {
+	entry := LogEntry{
+		Time:      _getTimeNow(),
+		Level:     logLevel,
+		Filename:  filename,
+		FuncName:  funcName,
+		Line:      line,
+		RequestId: l.RequestId,
+		Message:   message,
+		Fields:    make([]LogField, 0, (len(l.fields)+1)/2),
+	}
+	for idx := 0; idx < len(l.fields); idx += 2 {
+		field := LogField{Key: fmt.Sprintf("%v", l.fields[idx]), Value: "(missing)"}
+		if idx+1 < len(l.fields) {
+			field.Value = fmt.Sprintf("%v", l.fields[idx+1])
+		}
+		entry.Fields = append(entry.Fields, field)
+	}
+	if l.Sink == nil {
+		return fmt.Printf("%v\n", FormatTextLogLine(entry))
+	}
+	charsLogged, err = l.Sink.Write(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v (log sink failed: %v)\n", FormatTextLogLine(entry), err)
+	}
 	return
 }
 
-// simple log method
-func (l *Logger) LogWithFuncName(message string, funcName string, logConfig ...LogConfig) (charsLogged int, err error)  {
-	isConfigValid := logConfig != nil && len(logConfig) >= 0
+// method to format the entry as a text line => [time][level][filename.funcName(:line)] [requestId=x] message key=value...
+func FormatTextLogLine(entry LogEntry) string {
 	var buffer bytes.Buffer
 
 	buffer.WriteString("[")
-	buffer.WriteString(time.Now().UTC().String())
+	buffer.WriteString(entry.Time.String())
 	buffer.WriteString("][")
-	// log level
-	if isConfigValid {
-		buffer.WriteString(_translateLogLevelString(logConfig[0].DefaultLevel))
-	} else {
-		buffer.WriteString("trace")
-	}
+	buffer.WriteString(_translateLogLevelString(entry.Level))
 	buffer.WriteString("][")
-	// filename.Funcname
-	if isConfigValid {
-		buffer.WriteString(logConfig[0].Filename)
-	} else {
-		buffer.WriteString(" - ")
-	}
+	buffer.WriteString(entry.Filename)
 	buffer.WriteString(".")
-
-	if len(funcName) > 0 {
-		buffer.WriteString(funcName)
-	} else {
-		if isConfigValid && len(logConfig[0].DefaultFuncName) > 0 {
-			buffer.WriteString(logConfig[0].DefaultFuncName)
-		} else {
-			buffer.WriteString(" - ")
-		}
+	buffer.WriteString(entry.FuncName)
+	if entry.Line > 0 {
+		buffer.WriteString(":")
+		buffer.WriteString(strconv.Itoa(entry.Line))
 	}
 	buffer.WriteString("] ")
-	buffer.WriteString(message)
+	if len(entry.RequestId) > 0 {
+		buffer.WriteString("[requestId=")
+		buffer.WriteString(entry.RequestId)
+		buffer.WriteString("] ")
+	}
+	buffer.WriteString(entry.Message)
+	for _, field := range entry.Fields {
+		buffer.WriteString(" ")
+		buffer.WriteString(field.Key)
+		buffer.WriteString("=")
+		buffer.WriteString(_formatLogFieldValue(field.Value))
+	}
+	return buffer.String()
+}
 
-	charsLogged, err = fmt.Printf("%v\n", buffer.String())
+// method to format a field value; quoted if empty or containing spaces, quotes or "="
+func _formatLogFieldValue(value interface{}) string {
+	text := fmt.Sprintf("%v", value)
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		return strconv.Quote(text)
+	}
+	return text
+}
 
-	return
+// method to get the value or the placeholder if it is empty
+func _orDash(value string, placeholder string) string {
+	if len(value) == 0 {
+		return placeholder
+	}
+	return value
 }
 
+// method to translate a log level name (e.g. from the config file) to the logLevel (int)
+func ParseLogLevel(level string) (int, error) {
+	switch strings.ToLower(level) {
+	case "trace":
+		return LogLevelTrace, nil
+	case "debug":
+		return LogLevelDebug, nil
+	case "info", "":
+		return LogLevelInfo, nil
+	case "warning", "warn":
+		return LogLevelWarning, nil
+	case "error":
+		return LogLevelError, nil
+	default:
+		return LogLevelInfo, fmt.Errorf("unknown log level [%v]; use trace, debug, info, warning or error", level)
+	}
+}
 
 // method to get the current time (implementation varies)
 func _getTimeNow() time.Time {
@@ -0,0 +1,114 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"testing"
+)
+
+// method to create a logger (info) keeping its entries
+func newRecordingLogger() (Logger, *recordingSink) {
+	sink := new(recordingSink)
+	logger := NewLogger(LogLevelInfo)
+	logger.Sink = sink
+	return logger, sink
+}
+
+// method to get the last entry written to the sink
+func lastLogEntry(t *testing.T, sink *recordingSink) LogEntry {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if len(sink.entries) == 0 {
+		t.Fatal("nothing logged")
+	}
+	return sink.entries[len(sink.entries)-1]
+}
+
+// a caller whose hard-coded names are wrong; the server's default log config
+func logThroughLegacyApi(logger Logger) {
+	logger.LogWithFuncName("bootstrapping", "StartServer", NewServer("").logConfig)
+}
+
+func TestLoggerReportsCallerByDefault(t *testing.T) {
+	logger, sink := newRecordingLogger()
+
+	logThroughLegacyApi(logger)
+	entry := lastLogEntry(t, sink)
+	// the given name wins (like Log), the file and line are the caller's
+	if entry.Filename != "Logger_test" || entry.FuncName != "StartServer" || entry.Line == 0 {
+		t.Errorf("expected the caller's file with the given name, got %v.%v:%v", entry.Filename, entry.FuncName, entry.Line)
+	}
+	// without a name at all; NewServer's log config used to fill in StartServer
+	logger.LogWithFuncName("no name", "", NewServer("").logConfig)
+	if entry := lastLogEntry(t, sink); entry.FuncName != "TestLoggerReportsCallerByDefault" {
+		t.Errorf("expected the test function, got %v", entry.FuncName)
+	}
+	// closures are reported as their enclosing function
+	func() {
+		logger.Info("from a closure")
+	}()
+	if entry := lastLogEntry(t, sink); entry.FuncName != "TestLoggerReportsCallerByDefault" {
+		t.Errorf("expected the enclosing function of the closure, got %v", entry.FuncName)
+	}
+	// explicitly named lines (e.g. the access log) keep their names
+	logger.Log("GET /orders 200", LogLevelInfo, "Server", "AccessLog")
+	if entry := lastLogEntry(t, sink); entry.Filename != "Server" || entry.FuncName != "AccessLog" {
+		t.Errorf("expected Server.AccessLog, got %v.%v", entry.Filename, entry.FuncName)
+	}
+}
+
+func TestLoggerCallerDisabledUsesGivenNames(t *testing.T) {
+	logger, sink := newRecordingLogger()
+	logger.IsCallerEnabled = false
+
+	logThroughLegacyApi(logger)
+	if entry := lastLogEntry(t, sink); entry.Filename != "Server" || entry.FuncName != "StartServer" || entry.Line != 0 {
+		t.Errorf("expected the given names without a line, got %v.%v:%v", entry.Filename, entry.FuncName, entry.Line)
+	}
+	logger.Info("unnamed")
+	if entry := lastLogEntry(t, sink); entry.Filename != "-" || entry.FuncName != "-" {
+		t.Errorf("expected placeholders, got %v.%v", entry.Filename, entry.FuncName)
+	}
+}
+
+func TestLoadConfigContentDerivesCallerByDefault(t *testing.T) {
+	configContent, err := LoadConfigContent("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !configContent.Logging.Caller {
+		t.Error("expected logging.caller to default to true")
+	}
+}
+
+// LogWithFuncName honours the threshold like every other log method (the inspecting commands rely on it)
+func TestLogWithFuncNameHonoursTheThreshold(t *testing.T) {
+	logger, sink := newRecordingLogger()
+	logger.ThresholdLogLevel = LogLevelWarning
+
+	logger.LogWithFuncName("startup line", "StartServer", LogConfig{DefaultLevel: LogLevelInfo, Filename: "Server"})
+	logger.LogWithFuncName("no config; trace", "StartServer")
+	if messages := sink.messages(); len(messages) != 0 {
+		t.Errorf("expected the lines below warning to be skipped, got %v", messages)
+	}
+	logger.LogWithFuncName("shutdown failed", "StopServer", LogConfig{DefaultLevel: LogLevelError, Filename: "Server"})
+	if entry := lastLogEntry(t, sink); entry.Message != "shutdown failed" || entry.Level != LogLevelError {
+		t.Errorf("expected the error line, got %q (level %v)", entry.Message, entry.Level)
+	}
+}
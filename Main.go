@@ -28,34 +28,79 @@ import (
  *	main method to kick start the echogogo server
  */
 func main()  {
+	err := newCliApp().Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+ *	method to build the command line app (the commands and their flags)
+ */
+func newCliApp() *cli.App {
 	echoSrv := cli.NewApp()
 	echoSrv.Name = "echogogo server"
 	echoSrv.Usage = "main entry point of echogogo server"
 	echoSrv.Author = "Jason.Wong"
 	echoSrv.Version = "1.0.0"
-	echoSrv.Flags = []cli.Flag {
-		cli.StringFlag{
-			Name: "config, C",
-			EnvVar: "envVarEchogogoConfig",
-			Usage: "provide a targeted configuration file to startup the server. Can also use the environment-variable: ",
-		},
-	}
+	echoSrv.Flags = []cli.Flag { configFlag }
 
-	echoSrv.Action = func(ctx *cli.Context) error {
-		srvPtr := NewServer(ctx.String("C"))
-		/*
-		srvPtr := new(Server)
-		srvPtr.configFile = ctx.String("C")
-		*/
-		err := srvPtr.StartServer()
+	// no sub command => serve (backward compatible)
+	echoSrv.Action = serveCommand
 
-		return err
-	}
-
-	err := echoSrv.Run(os.Args)
-	if err != nil {
-		log.Fatal(err)
+	echoSrv.Commands = []cli.Command {
+		{
+			Name: "serve",
+			Usage: "start the echogogo server (default when no command is given)",
+			Flags: []cli.Flag { configFlag },
+			Action: serveCommand,
+		},
+		{
+			Name: "modules",
+			Usage: "inspect the module(s) of the repository without serving them",
+			Subcommands: []cli.Command {
+				{
+					Name: "list",
+					Usage: "list the plugin (.so), declarative (.echo.json) and built-in modules with their path and endpoints",
+					Flags: []cli.Flag { configFlag, jsonFlag },
+					Action: listModulesCommand,
+				},
+				{
+					Name: "validate",
+					Usage: "check the modules' symbols and GetRestConfig contract; exits with 1 if any module is invalid",
+					Flags: []cli.Flag { configFlag, jsonFlag },
+					Action: validateModulesCommand,
+				},
+			},
+		},
+		{
+			Name: "routes",
+			Usage: "print the route table the server would serve",
+			Flags: []cli.Flag { configFlag, jsonFlag },
+			Action: routesCommand,
+		},
+		{
+			Name: "generate",
+			Usage: "generate a declarative module (.echo.json) out of an OpenAPI 3 specification",
+			Flags: []cli.Flag {
+				cli.StringFlag{
+					Name: "spec, s",
+					Usage: "the OpenAPI 3 specification (json)",
+				},
+				cli.StringFlag{
+					Name: "out, o",
+					Usage: "the declarative module file to write; default is [module name].echo.json",
+				},
+				cli.StringFlag{
+					Name: "path, p",
+					Usage: "the webservice path of the module; default is derived from the specification's title",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				return generateModuleFile(ctx.String("spec"), ctx.String("out"), ctx.String("path"))
+			},
+		},
 	}
+	return echoSrv
 }
 
-
@@ -0,0 +1,326 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reserved webservice path for the prometheus metrics; modules can't use it
+const MetricsWebservicePath = "/metrics"
+
+// content type of the prometheus text exposition format
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// code label of the requests whose connection was reset (hijacked) before any response was written
+const metricCodeReset = "reset"
+
+const (
+	metricKindCounter   = "counter"
+	metricKindGauge     = "gauge"
+	metricKindHistogram = "histogram"
+)
+
+// upper bounds (seconds) of the DoAction latency histogram
+var doActionDurationBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// structure holding the metrics of the server; safe for concurrent use
+type MetricsRegistry struct {
+	lock     sync.Mutex
+	families map[string]*metricFamily
+
+	requestsTotal      *metricFamily
+	doActionDuration   *metricFamily
+	modulesLoaded      *metricFamily
+	moduleLoadFailures *metricFamily
+	logLinesDropped    *metricFamily
+}
+
+// structure of a metric and its series (one per combination of label values)
+type metricFamily struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+	series     map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues  []string
+	value        float64
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+// ctor. Create instance of *MetricsRegistry with the server's metrics
+func NewMetricsRegistry() *MetricsRegistry {
+	r := new(MetricsRegistry)
+	r.families = make(map[string]*metricFamily)
+
+	r.requestsTotal = r.register("echogogo_http_requests_total", "Requests served, per module, route, method and status code.",
+		metricKindCounter, nil, "module", "route", "method", "code")
+	r.doActionDuration = r.register("echogogo_doaction_duration_seconds", "Latency of the modules' DoAction, per module, route and method.",
+		metricKindHistogram, doActionDurationBuckets, "module", "route", "method")
+	r.modulesLoaded = r.register("echogogo_modules_loaded", "Modules currently loaded.",
+		metricKindGauge, nil)
+	r.moduleLoadFailures = r.register("echogogo_module_load_failures_total", "Modules that failed to load, per module file.",
+		metricKindCounter, nil, "file")
+	r.logLinesDropped = r.register("echogogo_log_lines_dropped_total", "Log lines dropped because the async logging buffer was full.",
+		metricKindCounter, nil)
+
+	return r
+}
+
+// method to add a metric family
+func (r *MetricsRegistry) register(name, help, kind string, buckets []float64, labelNames ...string) *metricFamily {
+	family := &metricFamily{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*metricSeries),
+	}
+	r.families[name] = family
+	return family
+}
+
+// method to count a served request; code is the status code or metricCodeReset
+func (r *MetricsRegistry) IncRequest(module, route, method string, code string) {
+	r.add(r.requestsTotal, 1, module, route, method, code)
+}
+
+// method to record the latency of a DoAction
+func (r *MetricsRegistry) ObserveDoAction(module, route, method string, duration time.Duration) {
+	r.observe(r.doActionDuration, duration.Seconds(), module, route, method)
+}
+
+// method to set the number of loaded modules
+func (r *MetricsRegistry) SetModulesLoaded(count int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.getSeries(r.modulesLoaded, nil).value = float64(count)
+}
+
+// method to count a module failing to load
+func (r *MetricsRegistry) IncModuleLoadFailure(file string) {
+	r.add(r.moduleLoadFailures, 1, file)
+}
+
+// method to set the number of log lines dropped by the async logging
+func (r *MetricsRegistry) SetLogLinesDropped(count uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.getSeries(r.logLinesDropped, nil).value = float64(count)
+}
+
+// method to add to a counter / gauge
+func (r *MetricsRegistry) add(family *metricFamily, delta float64, labelValues ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.getSeries(family, labelValues).value += delta
+}
+
+// method to add an observation to a histogram
+func (r *MetricsRegistry) observe(family *metricFamily, value float64, labelValues ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	series := r.getSeries(family, labelValues)
+	for idx, upperBound := range family.buckets {
+		if value <= upperBound {
+			series.bucketCounts[idx]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+// method to get (or create) the series of the label values; the lock must be held
+func (r *MetricsRegistry) getSeries(family *metricFamily, labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\x00")
+	series, ok := family.series[key]
+	if !ok {
+		series = &metricSeries{labelValues: labelValues}
+		if family.kind == metricKindHistogram {
+			series.bucketCounts = make([]uint64, len(family.buckets))
+		}
+		family.series[key] = series
+	}
+	return series
+}
+
+// method to write every metric in the prometheus text exposition format, sorted by name and labels
+func (r *MetricsRegistry) WriteText(writer io.Writer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	for _, name := range names {
+		family := r.families[name]
+		fmt.Fprintf(&buffer, "# HELP %v %v\n", family.name, family.help)
+		fmt.Fprintf(&buffer, "# TYPE %v %v\n", family.name, family.kind)
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := family.series[key]
+			if family.kind != metricKindHistogram {
+				fmt.Fprintf(&buffer, "%v%v %v\n", family.name, _formatMetricLabels(family.labelNames, series.labelValues), _formatMetricValue(series.value))
+				continue
+			}
+			labelNames := append(append([]string{}, family.labelNames...), "le")
+			for idx, upperBound := range family.buckets {
+				labelValues := append(append([]string{}, series.labelValues...), _formatMetricValue(upperBound))
+				fmt.Fprintf(&buffer, "%v_bucket%v %v\n", family.name, _formatMetricLabels(labelNames, labelValues), series.bucketCounts[idx])
+			}
+			labelValues := append(append([]string{}, series.labelValues...), "+Inf")
+			fmt.Fprintf(&buffer, "%v_bucket%v %v\n", family.name, _formatMetricLabels(labelNames, labelValues), series.count)
+			fmt.Fprintf(&buffer, "%v_sum%v %v\n", family.name, _formatMetricLabels(family.labelNames, series.labelValues), _formatMetricValue(series.sum))
+			fmt.Fprintf(&buffer, "%v_count%v %v\n", family.name, _formatMetricLabels(family.labelNames, series.labelValues), series.count)
+		}
+	}
+	_, err := writer.Write(buffer.Bytes())
+	return err
+}
+
+// method to format the labels e.g. {module="/orders",code="200"}; empty if there are no labels
+func _formatMetricLabels(labelNames []string, labelValues []string) string {
+	if len(labelNames) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labelNames))
+	for idx, labelName := range labelNames {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labelValues[idx])
+		pairs[idx] = fmt.Sprintf(`%v="%v"`, labelName, value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// method to format a sample value
+func _formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// setup the metrics endpoint and the filter counting every request; the filter goes first so
+// requests answered by other filters (e.g. CORS preflight) are counted too
+func (srv *Server) setupMetrics(wsContainer *restful.Container) {
+	wsContainer.Filter(srv._metricsFilter)
+
+	ws := new(restful.WebService)
+	ws.Path(MetricsWebservicePath)
+	ws.Route(ws.GET("").To(func(request *restful.Request, response *restful.Response) {
+		response.AddHeader("Content-Type", MetricsContentType)
+		if asyncSink, ok := srv.logger.Sink.(*AsyncLogSink); ok {
+			srv.metrics.SetLogLinesDropped(asyncSink.DroppedCount())
+		}
+		if err := srv.metrics.WriteText(response); err != nil {
+			logger := srv._requestLogger(request)
+			logger.Log(err.Error(), LogLevelError, "", "")
+		}
+	}))
+	wsContainer.Add(ws)
+
+	srv.logger.LogWithFuncName(fmt.Sprintf("metrics available at %v", MetricsWebservicePath), "setupMetrics", srv.logConfig)
+}
+
+// container filter counting the requests per module, route, method and status code
+func (srv *Server) _metricsFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	writer := &metricsResponseWriter{ResponseWriter: response.ResponseWriter}
+	response.ResponseWriter = writer
+	chain.ProcessFilter(request, response)
+
+	code := strconv.Itoa(response.StatusCode())
+	if writer.isHijacked && !writer.isHeaderWritten {
+		code = metricCodeReset
+	}
+	routePath := request.SelectedRoutePath()
+	srv.metrics.IncRequest(srv._metricsModuleLabel(routePath), routePath, request.Request.Method, code)
+}
+
+// structure of a http.ResponseWriter noting whether the connection was hijacked (e.g. reset by a fault)
+// before any response was written; such requests have no status code
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	isHeaderWritten bool
+	isHijacked      bool
+}
+
+func (w *metricsResponseWriter) WriteHeader(statusCode int) {
+	w.isHeaderWritten = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *metricsResponseWriter) Write(bArr []byte) (int, error) {
+	w.isHeaderWritten = true
+	return w.ResponseWriter.Write(bArr)
+}
+
+func (w *metricsResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *metricsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer can't be hijacked")
+	}
+	w.isHijacked = true
+	return hijacker.Hijack()
+}
+
+// method to get the module label of the route; the module's webservice path or "" for the server's own routes
+func (srv *Server) _metricsModuleLabel(routePath string) string {
+	parts := strings.Split(routePath, "/")
+	if len(parts) > 1 {
+		if modulePtr := srv._findModuleByWebservicePath("/" + parts[1]); modulePtr != nil {
+			return modulePtr.WebservicePath
+		}
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"github.com/emicklei/go-restful"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// method to scrape the metrics; the status code and the exposition
+func scrapeTestMetrics(t *testing.T, url string) (*http.Response, string) {
+	response, err := http.Get(url + MetricsWebservicePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	bArrBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, string(bArrBody)
+}
+
+func TestMetricsScrape(t *testing.T) {
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	wsContainerPtr := restful.NewContainer()
+	srv.setupMetrics(wsContainerPtr)
+	modulePtr := newTestEchoModule("orders.so", "/orders")
+	if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+		t.Fatal(err)
+	}
+	srv.modules[modulePtr.ModulePath] = modulePtr
+	server := httptest.NewServer(wsContainerPtr)
+	defer server.Close()
+
+	requests := []struct {
+		faults []FaultConfig
+		path   string
+		status int // 0 if the connection is reset
+	}{
+		{nil, "/orders/", http.StatusOK},
+		{nil, "/orders/", http.StatusOK},
+		{[]FaultConfig{{Module: "/orders", ErrorRate: 1, ErrorStatus: http.StatusServiceUnavailable}}, "/orders/", http.StatusServiceUnavailable},
+		{[]FaultConfig{{Module: "/orders", ConnectionResetRate: 1}}, "/orders/", 0},
+		{nil, "/orders/missing", http.StatusNotFound},
+	}
+	for _, request := range requests {
+		if err := srv.faults.Load(request.faults); err != nil {
+			t.Fatal(err)
+		}
+		response, _, err := doTestFaultRequest(t, http.MethodGet, server.URL+request.path, "")
+		if request.status == 0 {
+			if err == nil {
+				t.Fatalf("%v: expected the connection reset, got %v", request.path, response.Status)
+			}
+			continue
+		}
+		if err != nil || response.StatusCode != request.status {
+			t.Fatalf("%v: expected %v, got %v (%v)", request.path, request.status, response, err)
+		}
+	}
+	expectedLines := []string{
+		"# TYPE echogogo_http_requests_total counter",
+		`echogogo_http_requests_total{module="/orders",route="/orders/",method="GET",code="200"} 2`,
+		`echogogo_http_requests_total{module="/orders",route="/orders/",method="GET",code="503"} 1`,
+		`echogogo_http_requests_total{module="/orders",route="/orders/",method="GET",code="reset"} 1`,
+		`echogogo_http_requests_total{module="",route="",method="GET",code="404"} 1`,
+		"# TYPE echogogo_doaction_duration_seconds histogram",
+		// the faults answered without invoking DoAction
+		`echogogo_doaction_duration_seconds_bucket{module="/orders",route="/orders/",method="GET",le="10"} 2`,
+		`echogogo_doaction_duration_seconds_bucket{module="/orders",route="/orders/",method="GET",le="+Inf"} 2`,
+		`echogogo_doaction_duration_seconds_count{module="/orders",route="/orders/",method="GET"} 2`,
+		"# TYPE echogogo_modules_loaded gauge",
+	}
+	// the reset request is counted once its handler returns, which the client doesn't wait for
+	var exposition string
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		response, body := scrapeTestMetrics(t, server.URL)
+		if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != MetricsContentType {
+			t.Fatalf("expected 200 in the text format, got %v %v", response.StatusCode, response.Header.Get("Content-Type"))
+		}
+		exposition = body
+		if strings.Contains(exposition, `code="reset"`) || time.Now().After(deadline) {
+			break
+		}
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(exposition, "\n") {
+		lines[line] = true
+	}
+	for _, expectedLine := range expectedLines {
+		if !lines[expectedLine] {
+			t.Errorf("expected the line %v in\n%v", expectedLine, exposition)
+		}
+	}
+	if !strings.Contains(exposition, `echogogo_doaction_duration_seconds_sum{module="/orders",route="/orders/",method="GET"} `) {
+		t.Errorf("expected the DoAction latency sum in\n%v", exposition)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/quoeamaster/echogogo_plugin"
+	"sort"
+	"strings"
+)
+
+// http verbs a module can route
+var supportedEndPointVerbs = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
+
+// webservice paths reserved by the server itself
+var reservedWebservicePaths = []string{AdminWebservicePath, OpenApiWebservicePath, HealthWebservicePath, LivenessWebservicePath, ReadinessWebservicePath, MetricsWebservicePath}
+
+// structure describing a module file found in the repository
+type ModuleInfo struct {
+	File          string   `json:"file"`
+	Kind          string   `json:"kind" description:"plugin (.so), declarative (.echo.json) or builtin"`
+	Path          string   `json:"path,omitempty" description:"webservice path"`
+	ConsumeFormat string   `json:"consumeFormat,omitempty"`
+	ProduceFormat string   `json:"produceFormat,omitempty"`
+	EndPoints     []string `json:"endPoints,omitempty"`
+	Errors        []string `json:"errors,omitempty" description:"symbol and GetRestConfig contract violations"`
+}
+
+// structure of a route served by the server
+type RouteInfo struct {
+	Method   string   `json:"method"`
+	Path     string   `json:"path"`
+	Module   string   `json:"module" description:"module file serving the route; empty for the server's own routes"`
+	Consumes []string `json:"consumes,omitempty"`
+	Produces []string `json:"produces,omitempty"`
+}
+
+// method to call the module's GetRestConfig; a panicking module is reported as an error
+func (m *EchoModule) getRestConfig() (configMap map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("GetRestConfig of module %v panicked: %v", m.ModulePath, r)
+		}
+	}()
+	fxGetRestConfig, ok := m.FxGetRestConfig.(func() map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("GetRestConfig of module %v must be a func() map[string]interface{}, got %T", m.ModulePath, m.FxGetRestConfig)
+	}
+	configMap = fxGetRestConfig()
+	if err := _checkRestConfigTypes(configMap); err != nil {
+		return nil, fmt.Errorf("GetRestConfig of module %v: %v", m.ModulePath, err)
+	}
+	return configMap, nil
+}
+
+// method to check the entries of the config map have the types the server relies on
+func _checkRestConfigTypes(configMap map[string]interface{}) error {
+	if configMap == nil {
+		return fmt.Errorf("config is nil")
+	}
+	if _, ok := configMap["path"].(string); !ok {
+		return fmt.Errorf("path must be a string, got %T", configMap["path"])
+	}
+	for _, key := range []string{"consumeFormat", "produceFormat"} {
+		if _, ok := configMap[key].(string); !ok {
+			return fmt.Errorf("%v must be a string, got %T", key, configMap[key])
+		}
+	}
+	if _, ok := configMap["endPoints"].([]string); !ok {
+		return fmt.Errorf("endPoints must be a []string, got %T", configMap["endPoints"])
+	}
+	if schemas, ok := configMap["schemas"]; ok {
+		if _, ok := schemas.(map[string]interface{}); !ok {
+			return fmt.Errorf("schemas must be a map[string]interface{}, got %T", schemas)
+		}
+	}
+	return nil
+}
+
+// method to check the config map returned by a module's GetRestConfig honours the contract:
+// path (a single segment e.g. /orders), consumeFormat / produceFormat (json, xml, xml_json or form;
+// empty means both; consumeFormat can also be any) and endPoints ([http_verb]::[target_path] e.g. GET::/{id})
+func ValidateRestConfig(configMap map[string]interface{}) error {
+	if err := _checkRestConfigTypes(configMap); err != nil {
+		return err
+	}
+	path := configMap["path"].(string)
+	if !strings.HasPrefix(path, "/") || strings.Count(path, "/") != 1 || len(path) == 1 {
+		return fmt.Errorf("path must be a single segment like /orders => %v", path)
+	}
+	if _containsString(reservedWebservicePaths, path) {
+		return fmt.Errorf("path %v is reserved by the server", path)
+	}
+	for _, key := range []string{"consumeFormat", "produceFormat"} {
+		format := configMap[key].(string)
+		if key == "consumeFormat" && format == FormatAny {
+			continue
+		}
+		if format != "" && format != echogogo.FORMAT_JSON && format != echogogo.FORMAT_XML && format != echogogo.FORMAT_XML_JSON && format != FormatForm {
+			return fmt.Errorf("%v must be one of %v, %v, %v or %v => %v", key, echogogo.FORMAT_JSON, echogogo.FORMAT_XML, echogogo.FORMAT_XML_JSON, FormatForm, format)
+		}
+	}
+	endPoints := configMap["endPoints"].([]string)
+	if len(endPoints) == 0 {
+		return fmt.Errorf("endPoints missing")
+	}
+	seen := make(map[string]bool)
+	for _, endPoint := range endPoints {
+		parts := strings.Split(endPoint, "::")
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "/") {
+			return fmt.Errorf("invalid endpoint, format for a valid endpoint is [http_verb]::[target_path] (e.g. GET::/hobby ) => %v", endPoint)
+		}
+		if !_containsString(supportedEndPointVerbs, parts[0]) {
+			return fmt.Errorf("invalid endpoint, http verb must be one of %v => %v", supportedEndPointVerbs, endPoint)
+		}
+		if seen[endPoint] {
+			return fmt.Errorf("duplicated endpoint => %v", endPoint)
+		}
+		seen[endPoint] = true
+	}
+	return nil
+}
+
+// method to inspect the module files of the repository without serving them; every module is
+// loaded (symbols checked) and its GetRestConfig checked against the contract. Problems are
+// reported per module instead of stopping at the first one
+func (srv *Server) InspectModules() ([]ModuleInfo, error) {
+	moduleFiles, err := srv._getModulePaths()
+	if err != nil {
+		return nil, err
+	}
+	moduleInfos := make([]ModuleInfo, 0)
+	// webservice path => module file; two modules can't share a path
+	paths := make(map[string]string)
+	for _, moduleFile := range moduleFiles {
+		moduleInfo := ModuleInfo{File: moduleFile, Kind: "plugin"}
+		var modulePtr *EchoModule
+		if strings.HasSuffix(moduleFile, DeclarativeModuleSuffix) {
+			moduleInfo.Kind = "declarative"
+			modulePtr, err = srv._loadDeclarativeModule(moduleInfo.File)
+		} else if strings.HasPrefix(moduleFile, BuiltinModulePathPrefix) {
+			moduleInfo.Kind = "builtin"
+			modulePtr, err = srv._loadBuiltinModule(moduleInfo.File)
+		} else {
+			modulePtr, err = srv._loadModule(moduleInfo.File)
+		}
+		if err == nil {
+			var configMap map[string]interface{}
+			configMap, err = modulePtr.getRestConfig()
+			if err == nil {
+				err = ValidateRestConfig(configMap)
+			}
+			if err == nil {
+				moduleInfo.Path = configMap["path"].(string)
+				moduleInfo.ConsumeFormat = configMap["consumeFormat"].(string)
+				moduleInfo.ProduceFormat = configMap["produceFormat"].(string)
+				moduleInfo.EndPoints = configMap["endPoints"].([]string)
+				if schemas, ok := configMap["schemas"].(map[string]interface{}); ok {
+					err = CompileRequestSchemas(schemas)
+				}
+				if other, ok := paths[moduleInfo.Path]; ok {
+					moduleInfo.Errors = append(moduleInfo.Errors, fmt.Sprintf("path %v is already served by %v", moduleInfo.Path, other))
+				}
+				paths[moduleInfo.Path] = moduleInfo.File
+			}
+		}
+		if err != nil {
+			moduleInfo.Errors = append(moduleInfo.Errors, err.Error())
+		}
+		moduleInfos = append(moduleInfos, moduleInfo)
+	}
+	return moduleInfos, nil
+}
+
+// method to build the route table of the server; the routes of every module plus the server's own
+func (srv *Server) BuildRouteTable() ([]RouteInfo, error) {
+	wsContainerPtr, err := srv.setupContainer()
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]RouteInfo, 0)
+	for _, ws := range wsContainerPtr.RegisteredWebServices() {
+		moduleFile := ""
+		if modulePtr := srv._findModuleByWebservicePath(ws.RootPath()); modulePtr != nil {
+			moduleFile = modulePtr.ModulePath
+		}
+		for _, route := range ws.Routes() {
+			routes = append(routes, RouteInfo{
+				Method:   route.Method,
+				Path:     route.Path,
+				Module:   moduleFile,
+				Consumes: route.Consumes,
+				Produces: route.Produces,
+			})
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// file suffix of a plugin module
+const PluginModuleSuffix = ".so"
+
+// method to get the module files to load, in order; either the enabled entries of the explicit
+// module list or the module files (suffix of .so or .echo.json) found in the repositories,
+// filtered by the include / exclude patterns
+func (srv *Server) _getModuleFilesFromRepos() ([]string, error) {
+	modulesConfig := srv.configContentJson.Modules
+	moduleFiles := make([]string, 0)
+	if len(modulesConfig.List) > 0 {
+		for _, entry := range modulesConfig.List {
+			if !entry.IsEnabled() {
+				srv.logger.LogWithFuncName(fmt.Sprintf("module disabled - %v", entry.File), "_getModuleFilesFromRepos", srv.logConfig)
+				continue
+			}
+			if !_isModuleFile(entry.File) {
+				return nil, fmt.Errorf("invalid module list entry [%v]: a module file has a suffix of %v or %v", entry.File, PluginModuleSuffix, DeclarativeModuleSuffix)
+			}
+			if _, err := os.Stat(entry.File); err != nil {
+				return nil, fmt.Errorf("invalid module list entry [%v]: %v", entry.File, err)
+			}
+			moduleFiles = append(moduleFiles, entry.File)
+		}
+		return moduleFiles, nil
+	}
+	for _, repository := range modulesConfig.Repositories {
+		repositoryFiles, err := _scanModuleRepository(repository, modulesConfig.Recursive)
+		if err != nil {
+			return nil, err
+		}
+		for _, moduleFile := range repositoryFiles {
+			relativePath, _ := filepath.Rel(repository, moduleFile)
+			relativePath = filepath.ToSlash(relativePath)
+			if len(modulesConfig.Include) > 0 && !_matchesAnyGlob(modulesConfig.Include, relativePath) {
+				continue
+			}
+			if _matchesAnyGlob(modulesConfig.Exclude, relativePath) {
+				continue
+			}
+			if !_containsString(moduleFiles, moduleFile) {
+				moduleFiles = append(moduleFiles, moduleFile)
+			}
+		}
+	}
+	return moduleFiles, nil
+}
+
+// method to list the module files of a repository (sorted by path); sub directories are scanned if recursive
+func _scanModuleRepository(repository string, isRecursive bool) ([]string, error) {
+	moduleFiles := make([]string, 0)
+	if !isRecursive {
+		fileInfos, err := ioutil.ReadDir(repository)
+		if err != nil {
+			return nil, err
+		}
+		for _, fileInfo := range fileInfos {
+			if !fileInfo.IsDir() && _isModuleFile(fileInfo.Name()) {
+				moduleFiles = append(moduleFiles, filepath.Join(repository, fileInfo.Name()))
+			}
+		}
+		return moduleFiles, nil
+	}
+	err := filepath.Walk(repository, func(file string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fileInfo.IsDir() && _isModuleFile(fileInfo.Name()) {
+			moduleFiles = append(moduleFiles, file)
+		}
+		return nil
+	})
+	return moduleFiles, err
+}
+
+// method to check the file has the suffix of a module (.so or .echo.json)
+func _isModuleFile(name string) bool {
+	return strings.HasSuffix(name, PluginModuleSuffix) || strings.HasSuffix(name, DeclarativeModuleSuffix)
+}
+
+// method to check if the (slash separated, repository relative) path matches any of the glob patterns;
+// a pattern without "/" is matched against the file name, "**" matches any number of directories
+func _matchesAnyGlob(patterns []string, relativePath string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if isMatched, _ := path.Match(pattern, path.Base(relativePath)); isMatched {
+				return true
+			}
+			continue
+		}
+		if _matchGlobSegments(strings.Split(pattern, "/"), strings.Split(relativePath, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// method to match the path segments against the pattern segments ("**" matches zero or more segments)
+func _matchGlobSegments(patternSegments []string, pathSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(pathSegments) == 0
+	}
+	if patternSegments[0] == "**" {
+		for idx := 0; idx <= len(pathSegments); idx++ {
+			if _matchGlobSegments(patternSegments[1:], pathSegments[idx:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(pathSegments) == 0 {
+		return false
+	}
+	if isMatched, _ := path.Match(patternSegments[0], pathSegments[0]); !isMatched {
+		return false
+	}
+	return _matchGlobSegments(patternSegments[1:], pathSegments[1:])
+}
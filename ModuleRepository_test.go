@@ -0,0 +1,165 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// method to create two module repositories; returns the directory holding them and the cleanup func
+//
+//	a/draft.echo.json, a/notes.txt, a/orders.echo.json, a/v1/customers.echo.json, a/v1/deep/items.echo.json
+//	b/orders.echo.json (the same path as a/orders.echo.json), b/users.echo.json
+func newTestModuleRepositories(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "echogogo-repositories")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a/draft.echo.json":         "/drafts",
+		"a/notes.txt":               "",
+		"a/orders.echo.json":        "/orders",
+		"a/v1/customers.echo.json":  "/customers",
+		"a/v1/deep/items.echo.json": "/items",
+		"b/orders.echo.json":        "/orders",
+		"b/users.echo.json":         "/users",
+	}
+	for file, path := range files {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf(`{ "path": "%v", "stubs": [ { "path": "/", "response": { "body": "%v" } } ] }`, path, path)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// method to create a server whose modules config is the given one
+func newTestRepositoryServer(modulesConfig ModulesConfig) *Server {
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	srv.configContentJson.Modules = modulesConfig
+
+	return srv
+}
+
+func TestModuleFilesFromRepositories(t *testing.T) {
+	dir, cleanup := newTestModuleRepositories(t)
+	defer cleanup()
+	repoA := filepath.Join(dir, "a")
+	repoB := filepath.Join(dir, "b")
+	disabled := false
+
+	testCases := []struct {
+		name          string
+		modulesConfig ModulesConfig
+		expected      []string
+	}{
+		{"single repository", ModulesConfig{Repositories: []string{repoA}},
+			[]string{"a/draft.echo.json", "a/orders.echo.json"}},
+		{"recursive", ModulesConfig{Repositories: []string{repoA}, Recursive: true},
+			[]string{"a/draft.echo.json", "a/orders.echo.json", "a/v1/customers.echo.json", "a/v1/deep/items.echo.json"}},
+		{"repositories in order", ModulesConfig{Repositories: []string{repoB, repoA}},
+			[]string{"b/orders.echo.json", "b/users.echo.json", "a/draft.echo.json", "a/orders.echo.json"}},
+		{"include with **", ModulesConfig{Repositories: []string{repoA}, Recursive: true, Include: []string{"v1/**/*.echo.json"}},
+			[]string{"a/v1/customers.echo.json", "a/v1/deep/items.echo.json"}},
+		{"include a file name", ModulesConfig{Repositories: []string{repoA, repoB}, Recursive: true, Include: []string{"orders.echo.json"}},
+			[]string{"a/orders.echo.json", "b/orders.echo.json"}},
+		{"exclude", ModulesConfig{Repositories: []string{repoA}, Recursive: true, Include: []string{"**/*.echo.json"}, Exclude: []string{"draft*", "v1/deep/*"}},
+			[]string{"a/orders.echo.json", "a/v1/customers.echo.json"}},
+		{"overlapping repositories", ModulesConfig{Repositories: []string{repoA, filepath.Join(repoA, "v1"), repoA}, Recursive: true},
+			[]string{"a/draft.echo.json", "a/orders.echo.json", "a/v1/customers.echo.json", "a/v1/deep/items.echo.json"}},
+		{"explicit list", ModulesConfig{Repositories: []string{repoA}, List: []ModuleEntry{
+			{File: filepath.Join(repoB, "users.echo.json")},
+			{File: filepath.Join(repoA, "orders.echo.json"), Enabled: &disabled},
+			{File: filepath.Join(repoA, "v1", "deep", "items.echo.json")},
+		}}, []string{"b/users.echo.json", "a/v1/deep/items.echo.json"}},
+	}
+	for _, testCase := range testCases {
+		srv := newTestRepositoryServer(testCase.modulesConfig)
+		moduleFiles, err := srv._getModuleFilesFromRepos()
+		if err != nil {
+			t.Errorf("%v: %v", testCase.name, err)
+			continue
+		}
+		relativeFiles := make([]string, 0, len(moduleFiles))
+		for _, moduleFile := range moduleFiles {
+			relativeFile, _ := filepath.Rel(dir, moduleFile)
+			relativeFiles = append(relativeFiles, filepath.ToSlash(relativeFile))
+		}
+		if !reflect.DeepEqual(relativeFiles, testCase.expected) {
+			t.Errorf("%v: expected %v, got %v", testCase.name, testCase.expected, relativeFiles)
+		}
+	}
+}
+
+func TestModuleFilesFromRepositoriesErrors(t *testing.T) {
+	dir, cleanup := newTestModuleRepositories(t)
+	defer cleanup()
+
+	testCases := []struct {
+		name          string
+		modulesConfig ModulesConfig
+		message       string
+	}{
+		{"missing repository", ModulesConfig{Repositories: []string{filepath.Join(dir, "missing")}}, "no such file or directory"},
+		{"missing recursive repository", ModulesConfig{Repositories: []string{filepath.Join(dir, "missing")}, Recursive: true}, "no such file or directory"},
+		{"not a module file", ModulesConfig{List: []ModuleEntry{{File: filepath.Join(dir, "a", "notes.txt")}}}, "a module file has a suffix of .so or .echo.json"},
+		{"missing module file", ModulesConfig{List: []ModuleEntry{{File: filepath.Join(dir, "a", "missing.echo.json")}}}, "invalid module list entry"},
+	}
+	for _, testCase := range testCases {
+		srv := newTestRepositoryServer(testCase.modulesConfig)
+		if _, err := srv._getModuleFilesFromRepos(); err == nil || !strings.Contains(err.Error(), testCase.message) {
+			t.Errorf("%v: expected an error containing %q, got %v", testCase.name, testCase.message, err)
+		}
+	}
+}
+
+// the same file is loaded once; two files serving the same path fail the load
+func TestDuplicatedModules(t *testing.T) {
+	dir, cleanup := newTestModuleRepositories(t)
+	defer cleanup()
+	repoA := filepath.Join(dir, "a")
+
+	srv := newTestRepositoryServer(ModulesConfig{Repositories: []string{repoA, repoA}})
+	if err, _ := srv.loadModulesFromRepos(); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.modules) != 2 || len(srv.loadOrder) != 2 {
+		t.Errorf("expected the modules of the repository loaded once, got %v", srv.modules)
+	}
+
+	srv = newTestRepositoryServer(ModulesConfig{Repositories: []string{repoA, filepath.Join(dir, "b")}})
+	err, _ := srv.loadModulesFromRepos()
+	if err == nil || !strings.Contains(err.Error(), "path /orders is already served by module "+filepath.Join(repoA, "orders.echo.json")) {
+		t.Errorf("expected the second orders module rejected, got %v", err)
+	}
+	if len(srv.loadOrder) != 0 {
+		t.Errorf("expected the loaded modules shutdown after the failed load, got %v", srv.loadOrder)
+	}
+}
@@ -0,0 +1,671 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default webservice path of the oidc module
+const OidcModuleDefaultPath = "/oidc"
+
+// lifetime of an authorization code
+const oidcCodeTtl = 5 * time.Minute
+
+// structure of a registered client; a client without secret is public (authorization_code with PKCE only)
+type oidcClient struct {
+	secret       string
+	redirectUris []string // empty means any
+	scopes       []string // empty means any
+}
+
+// structure of a user of the password and authorization_code grants
+type oidcUser struct {
+	password string
+	claims   map[string]interface{} // added to the id token and the userinfo e.g. email, name
+}
+
+// structure of an issued authorization code waiting to be exchanged
+type oidcAuthorizationCode struct {
+	clientId            string
+	redirectUri         string
+	subject             string
+	scope               string
+	nonce               string
+	codeChallenge       string
+	codeChallengeMethod string
+	expiresAt           time.Time
+}
+
+// built-in mock OAuth2 / OIDC issuer: discovery, JWKS, authorize, token (client_credentials, password and
+// authorization_code with PKCE) and userinfo. Tokens are RS256 JWTs signed with a local key
+type OidcModule struct {
+	baseDir string
+
+	path           string
+	issuer         string // "" means derived from the request e.g. http://localhost:8001/oidc
+	audience       string // "" means the client id
+	tokenTtl       time.Duration
+	defaultSubject string
+	clients        map[string]oidcClient // empty means any client is accepted
+	users          map[string]oidcUser   // empty means any user is accepted
+
+	privateKey *rsa.PrivateKey
+	keyId      string
+
+	lock  sync.Mutex
+	codes map[string]*oidcAuthorizationCode
+}
+
+// ctor. Create the built-in oidc module
+func NewOidcModule(baseDir string) *BuiltinModule {
+	m := new(OidcModule)
+	m.baseDir = baseDir
+	m.path = OidcModuleDefaultPath
+	m.codes = make(map[string]*oidcAuthorizationCode)
+
+	return &BuiltinModule{
+		GetRestConfig: m.GetRestConfig,
+		DoAction:      m.DoAction,
+		Init:          m.Init,
+		Health:        m.Health,
+	}
+}
+
+// method to read the settings and load (or generate) the signing key; settings are path, issuer,
+// audience, tokenTtlSeconds, defaultSubject, privateKeyFile, publicKeyFile, clients and users
+func (m *OidcModule) Init(settings map[string]interface{}) error {
+	var err error
+	if m.path, err = _getSettingString(settings, "path", OidcModuleDefaultPath); err != nil {
+		return err
+	}
+	if m.issuer, err = _getSettingString(settings, "issuer", ""); err != nil {
+		return err
+	}
+	m.issuer = strings.TrimSuffix(m.issuer, "/")
+	if m.audience, err = _getSettingString(settings, "audience", ""); err != nil {
+		return err
+	}
+	if m.defaultSubject, err = _getSettingString(settings, "defaultSubject", "user"); err != nil {
+		return err
+	}
+	tokenTtlSeconds, err := _getSettingNumber(settings, "tokenTtlSeconds", 3600)
+	if err != nil {
+		return err
+	}
+	if tokenTtlSeconds <= 0 {
+		return fmt.Errorf("setting tokenTtlSeconds must be positive => %v", tokenTtlSeconds)
+	}
+	m.tokenTtl = time.Duration(tokenTtlSeconds) * time.Second
+	if m.clients, err = _parseOidcClients(settings); err != nil {
+		return err
+	}
+	if m.users, err = _parseOidcUsers(settings); err != nil {
+		return err
+	}
+	privateKeyFile, err := _getSettingString(settings, "privateKeyFile", "")
+	if err != nil {
+		return err
+	}
+	publicKeyFile, err := _getSettingString(settings, "publicKeyFile", "")
+	if err != nil {
+		return err
+	}
+	if m.privateKey, err = m._loadOrGenerateKey(m._resolveFile(privateKeyFile)); err != nil {
+		return err
+	}
+	bArrPublicKey, err := x509.MarshalPKIXPublicKey(&m.privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	keyDigest := sha256.Sum256(bArrPublicKey)
+	m.keyId = base64.RawURLEncoding.EncodeToString(keyDigest[:8])
+	// the public key for verifiers not reading the JWKS e.g. the server's own auth (jwt.publicKeyFile)
+	if publicKeyFile != "" {
+		bArrPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bArrPublicKey})
+		if err := ioutil.WriteFile(m._resolveFile(publicKeyFile), bArrPem, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *OidcModule) GetRestConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"path":          m.path,
+		"consumeFormat": FormatForm,
+		"produceFormat": "json",
+		"endPoints": []string{
+			"GET::/.well-known/openid-configuration",
+			"GET::/jwks",
+			"GET::/authorize",
+			"POST::/token",
+			"GET::/userinfo",
+		},
+	}
+}
+
+func (m *OidcModule) Health() error {
+	if m.privateKey == nil {
+		return errors.New("no signing key")
+	}
+	return nil
+}
+
+func (m *OidcModule) DoAction(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+	routePath := ""
+	if len(options) > 0 {
+		routePath, _ = options[0]["routePath"].(string)
+	}
+	switch strings.TrimPrefix(routePath, m.path) {
+	case "/.well-known/openid-configuration":
+		return m._discovery(&request)
+	case "/jwks":
+		return m._jwks()
+	case "/authorize":
+		return m._authorize(&request)
+	case "/token":
+		return m._token(&request)
+	case "/userinfo":
+		return m._userinfo(&request)
+	}
+	return &StubResponse{Status: http.StatusNotFound, Body: map[string]string{"error": "not_found"}}
+}
+
+// method to build the discovery document; the endpoints are on this server even if the issuer is configured
+func (m *OidcModule) _discovery(request *http.Request) interface{} {
+	baseUrl := _requestBaseUrl(request) + m.path
+	return &StubResponse{Status: http.StatusOK, Body: map[string]interface{}{
+		"issuer":                                m._issuer(request),
+		"authorization_endpoint":                baseUrl + "/authorize",
+		"token_endpoint":                        baseUrl + "/token",
+		"jwks_uri":                              baseUrl + "/jwks",
+		"userinfo_endpoint":                     baseUrl + "/userinfo",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials", "password"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{JwtAlgorithmRS256},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+	}}
+}
+
+// method to build the JWKS with the signing key
+func (m *OidcModule) _jwks() interface{} {
+	publicKey := m.privateKey.PublicKey
+	return &StubResponse{Status: http.StatusOK, Body: map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": JwtAlgorithmRS256,
+			"kid": m.keyId,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	}}
+}
+
+// method to issue an authorization code; there is no login page, the user (login_hint or the default
+// subject) is approved right away and redirected back with the code
+func (m *OidcModule) _authorize(request *http.Request) interface{} {
+	query := request.URL.Query()
+	clientId := query.Get("client_id")
+	redirectUri := query.Get("redirect_uri")
+	client, isKnown := m.clients[clientId]
+	if clientId == "" || (len(m.clients) > 0 && !isKnown) {
+		return _oidcError(http.StatusBadRequest, "invalid_client", "unknown client_id")
+	}
+	if redirectUri == "" || (len(client.redirectUris) > 0 && !_containsString(client.redirectUris, redirectUri)) {
+		return _oidcError(http.StatusBadRequest, "invalid_request", "redirect_uri missing or not registered")
+	}
+	// from here on errors go back to the client
+	state := query.Get("state")
+	if query.Get("response_type") != "code" {
+		return _oidcRedirect(redirectUri, map[string]string{"error": "unsupported_response_type", "state": state})
+	}
+	scope := query.Get("scope")
+	if !_isOidcScopeAllowed(client, scope) {
+		return _oidcRedirect(redirectUri, map[string]string{"error": "invalid_scope", "state": state})
+	}
+	codeChallenge := query.Get("code_challenge")
+	codeChallengeMethod := query.Get("code_challenge_method")
+	if codeChallenge != "" && codeChallengeMethod == "" {
+		codeChallengeMethod = "plain"
+	}
+	if codeChallengeMethod != "" && codeChallengeMethod != "S256" && codeChallengeMethod != "plain" {
+		return _oidcRedirect(redirectUri, map[string]string{"error": "invalid_request", "error_description": "unsupported code_challenge_method", "state": state})
+	}
+	subject := query.Get("login_hint")
+	if subject == "" {
+		subject = m.defaultSubject
+	}
+	if _, ok := m.users[subject]; len(m.users) > 0 && !ok {
+		return _oidcRedirect(redirectUri, map[string]string{"error": "access_denied", "error_description": "unknown user", "state": state})
+	}
+	code := _newOidcRandomString()
+	m.lock.Lock()
+	now := time.Now()
+	for existingCode, authorizationCode := range m.codes {
+		if now.After(authorizationCode.expiresAt) {
+			delete(m.codes, existingCode)
+		}
+	}
+	m.codes[code] = &oidcAuthorizationCode{
+		clientId:            clientId,
+		redirectUri:         redirectUri,
+		subject:             subject,
+		scope:               scope,
+		nonce:               query.Get("nonce"),
+		codeChallenge:       codeChallenge,
+		codeChallengeMethod: codeChallengeMethod,
+		expiresAt:           now.Add(oidcCodeTtl),
+	}
+	m.lock.Unlock()
+
+	return _oidcRedirect(redirectUri, map[string]string{"code": code, "state": state})
+}
+
+// method to issue the tokens of the grant
+func (m *OidcModule) _token(request *http.Request) interface{} {
+	if err := request.ParseForm(); err != nil {
+		return _oidcError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	clientId, clientSecret, hasBasicAuth := request.BasicAuth()
+	if !hasBasicAuth {
+		clientId = request.PostForm.Get("client_id")
+		clientSecret = request.PostForm.Get("client_secret")
+	}
+	client, isPublicClient, err := m._authenticateClient(clientId, clientSecret)
+	if err != nil {
+		response := _oidcError(http.StatusUnauthorized, "invalid_client", err.Error())
+		response.Headers["WWW-Authenticate"] = `Basic realm="oidc"`
+		return response
+	}
+
+	var subject, scope, nonce string
+	switch grantType := request.PostForm.Get("grant_type"); grantType {
+	case "client_credentials":
+		if isPublicClient {
+			return _oidcError(http.StatusBadRequest, "unauthorized_client", "client_credentials needs a client secret")
+		}
+		subject = clientId
+		scope = request.PostForm.Get("scope")
+		if scope == "" {
+			scope = strings.Join(client.scopes, " ")
+		}
+	case "password":
+		subject = request.PostForm.Get("username")
+		user, isKnown := m.users[subject]
+		if subject == "" || (len(m.users) > 0 && (!isKnown || subtle.ConstantTimeCompare([]byte(user.password), []byte(request.PostForm.Get("password"))) != 1)) {
+			return _oidcError(http.StatusBadRequest, "invalid_grant", "invalid user name or password")
+		}
+		scope = request.PostForm.Get("scope")
+	case "authorization_code":
+		m.lock.Lock()
+		authorizationCode, ok := m.codes[request.PostForm.Get("code")]
+		// single use
+		delete(m.codes, request.PostForm.Get("code"))
+		m.lock.Unlock()
+		if !ok || time.Now().After(authorizationCode.expiresAt) {
+			return _oidcError(http.StatusBadRequest, "invalid_grant", "unknown or expired code")
+		}
+		if authorizationCode.clientId != clientId || authorizationCode.redirectUri != request.PostForm.Get("redirect_uri") {
+			return _oidcError(http.StatusBadRequest, "invalid_grant", "code issued to another client or redirect_uri")
+		}
+		if err := _verifyPkce(authorizationCode, request.PostForm.Get("code_verifier"), isPublicClient); err != nil {
+			return _oidcError(http.StatusBadRequest, "invalid_grant", err.Error())
+		}
+		subject = authorizationCode.subject
+		scope = authorizationCode.scope
+		nonce = authorizationCode.nonce
+	default:
+		return _oidcError(http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("unsupported grant_type [%v]", grantType))
+	}
+	if !_isOidcScopeAllowed(client, scope) {
+		return _oidcError(http.StatusBadRequest, "invalid_scope", "scope not allowed for the client")
+	}
+	body, err := m._issueTokens(request, clientId, subject, scope, nonce, request.PostForm.Get("grant_type") != "client_credentials")
+	if err != nil {
+		return _oidcError(http.StatusInternalServerError, "server_error", err.Error())
+	}
+	return &StubResponse{Status: http.StatusOK, Headers: map[string]string{"Cache-Control": "no-store", "Pragma": "no-cache"}, Body: body}
+}
+
+// method to sign the access token (and the id token for the openid scope of a user)
+func (m *OidcModule) _issueTokens(request *http.Request, clientId, subject, scope, nonce string, isUser bool) (map[string]interface{}, error) {
+	now := time.Now().Unix()
+	audience := m.audience
+	if audience == "" {
+		audience = clientId
+	}
+	accessClaims := map[string]interface{}{
+		"iss":       m._issuer(request),
+		"sub":       subject,
+		"aud":       audience,
+		"client_id": clientId,
+		"iat":       now,
+		"exp":       now + int64(m.tokenTtl.Seconds()),
+		"jti":       _newOidcRandomString(),
+	}
+	if scope != "" {
+		accessClaims["scope"] = scope
+	}
+	accessToken, err := m._signJwt(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(m.tokenTtl.Seconds()),
+	}
+	if scope != "" {
+		body["scope"] = scope
+	}
+	if isUser && _containsString(strings.Fields(scope), "openid") {
+		idClaims := map[string]interface{}{
+			"iss":       m._issuer(request),
+			"sub":       subject,
+			"aud":       clientId,
+			"iat":       now,
+			"exp":       now + int64(m.tokenTtl.Seconds()),
+			"auth_time": now,
+		}
+		if nonce != "" {
+			idClaims["nonce"] = nonce
+		}
+		for key, value := range m.users[subject].claims {
+			idClaims[key] = value
+		}
+		if body["id_token"], err = m._signJwt(idClaims); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// method to answer the claims of the access token's user
+func (m *OidcModule) _userinfo(request *http.Request) interface{} {
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) <= 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return &StubResponse{Status: http.StatusUnauthorized, Headers: map[string]string{"WWW-Authenticate": `Bearer realm="oidc"`}}
+	}
+	verifier := &authPolicy{config: AuthConfig{Jwt: &JwtConfig{Algorithm: JwtAlgorithmRS256}}, rsaPublicKey: &m.privateKey.PublicKey}
+	claims, err := verifier.verifyJwt(strings.TrimSpace(authorization[7:]))
+	if err != nil {
+		return &StubResponse{Status: http.StatusUnauthorized, Headers: map[string]string{
+			"WWW-Authenticate": fmt.Sprintf(`Bearer realm="oidc", error="invalid_token", error_description=%v`, _quoteAuthParam(err.Error())),
+		}}
+	}
+	subject, _ := claims["sub"].(string)
+	userinfo := map[string]interface{}{"sub": subject}
+	for key, value := range m.users[subject].claims {
+		userinfo[key] = value
+	}
+	return &StubResponse{Status: http.StatusOK, Body: userinfo}
+}
+
+// method to check the client's credentials and whether the client is public. A registered client is public
+// if it has no secret (and must not send one); without registered clients any client is accepted and those
+// sending no secret are public
+func (m *OidcModule) _authenticateClient(clientId string, clientSecret string) (oidcClient, bool, error) {
+	if clientId == "" {
+		return oidcClient{}, false, errors.New("client authentication missing")
+	}
+	if len(m.clients) == 0 {
+		return oidcClient{}, clientSecret == "", nil
+	}
+	client, ok := m.clients[clientId]
+	if !ok {
+		return client, false, errors.New("unknown client")
+	}
+	if client.secret == "" {
+		if clientSecret != "" {
+			return client, true, errors.New("public client must not send a client secret")
+		}
+		return client, true, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(client.secret), []byte(clientSecret)) != 1 {
+		return client, false, errors.New("invalid client secret")
+	}
+	return client, false, nil
+}
+
+// method to sign the claims as a RS256 JWT
+func (m *OidcModule) _signJwt(claims map[string]interface{}) (string, error) {
+	bArrHeader, err := json.Marshal(map[string]string{"alg": JwtAlgorithmRS256, "typ": "JWT", "kid": m.keyId})
+	if err != nil {
+		return "", err
+	}
+	bArrClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(bArrHeader) + "." + base64.RawURLEncoding.EncodeToString(bArrClaims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// method to get the issuer; the configured one or the url of the module on this server
+func (m *OidcModule) _issuer(request *http.Request) string {
+	if m.issuer != "" {
+		return m.issuer
+	}
+	return _requestBaseUrl(request) + m.path
+}
+
+// method to load the signing key from the file; generated (and written to the file, if given) when missing
+func (m *OidcModule) _loadOrGenerateKey(file string) (*rsa.PrivateKey, error) {
+	if file != "" {
+		if bArrPem, err := ioutil.ReadFile(file); err == nil {
+			return _parseRsaPrivateKey(bArrPem, file)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		bArrPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+		if err := ioutil.WriteFile(file, bArrPem, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return privateKey, nil
+}
+
+// method to resolve a file of the settings against the config file's directory
+func (m *OidcModule) _resolveFile(file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(m.baseDir, file)
+}
+
+// method to parse a RSA private key PEM (RSA PRIVATE KEY or PRIVATE KEY)
+func _parseRsaPrivateKey(bArrPem []byte, file string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(bArrPem)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %v", file)
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %v: %v", file, err)
+	}
+	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not a RSA private key in %v", file)
+	}
+	return rsaPrivateKey, nil
+}
+
+// method to check the code_verifier against the code_challenge; public clients must use PKCE
+func _verifyPkce(authorizationCode *oidcAuthorizationCode, codeVerifier string, isPublicClient bool) error {
+	if authorizationCode.codeChallenge == "" {
+		if isPublicClient {
+			return errors.New("public clients must use PKCE")
+		}
+		return nil
+	}
+	if codeVerifier == "" {
+		return errors.New("code_verifier missing")
+	}
+	expectedChallenge := codeVerifier
+	if authorizationCode.codeChallengeMethod == "S256" {
+		digest := sha256.Sum256([]byte(codeVerifier))
+		expectedChallenge = base64.RawURLEncoding.EncodeToString(digest[:])
+	}
+	if subtle.ConstantTimeCompare([]byte(expectedChallenge), []byte(authorizationCode.codeChallenge)) != 1 {
+		return errors.New("code_verifier doesn't match the code_challenge")
+	}
+	return nil
+}
+
+// method to check every requested scope is allowed for the client
+func _isOidcScopeAllowed(client oidcClient, scope string) bool {
+	if len(client.scopes) == 0 {
+		return true
+	}
+	for _, requestedScope := range strings.Fields(scope) {
+		if !_containsString(client.scopes, requestedScope) {
+			return false
+		}
+	}
+	return true
+}
+
+// method to parse the clients setting; client id => { secret, redirectUris, scopes }
+func _parseOidcClients(settings map[string]interface{}) (map[string]oidcClient, error) {
+	clientSettings, err := _getSettingObject(settings, "clients")
+	if err != nil {
+		return nil, err
+	}
+	clients := make(map[string]oidcClient)
+	for clientId, value := range clientSettings {
+		clientSetting, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("setting clients.%v must be an object, got %v", clientId, _jsonTypeOf(value))
+		}
+		var client oidcClient
+		if client.secret, err = _getSettingString(clientSetting, "secret", ""); err != nil {
+			return nil, fmt.Errorf("clients.%v: %v", clientId, err)
+		}
+		if client.redirectUris, err = _getSettingStrings(clientSetting, "redirectUris"); err != nil {
+			return nil, fmt.Errorf("clients.%v: %v", clientId, err)
+		}
+		if client.scopes, err = _getSettingStrings(clientSetting, "scopes"); err != nil {
+			return nil, fmt.Errorf("clients.%v: %v", clientId, err)
+		}
+		clients[clientId] = client
+	}
+	return clients, nil
+}
+
+// method to parse the users setting; user name => { password, claims }
+func _parseOidcUsers(settings map[string]interface{}) (map[string]oidcUser, error) {
+	userSettings, err := _getSettingObject(settings, "users")
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]oidcUser)
+	for name, value := range userSettings {
+		userSetting, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("setting users.%v must be an object, got %v", name, _jsonTypeOf(value))
+		}
+		var user oidcUser
+		if user.password, err = _getSettingString(userSetting, "password", ""); err != nil {
+			return nil, fmt.Errorf("users.%v: %v", name, err)
+		}
+		if user.claims, err = _getSettingObject(userSetting, "claims"); err != nil {
+			return nil, fmt.Errorf("users.%v: %v", name, err)
+		}
+		users[name] = user
+	}
+	return users, nil
+}
+
+// method to build an OAuth2 error response
+func _oidcError(status int, errorCode string, description string) *StubResponse {
+	return &StubResponse{
+		Status:  status,
+		Headers: map[string]string{"Cache-Control": "no-store"},
+		Body:    map[string]string{"error": errorCode, "error_description": description},
+	}
+}
+
+// method to redirect back to the client with the given (non empty) query parameters
+func _oidcRedirect(redirectUri string, parameters map[string]string) *StubResponse {
+	query := url.Values{}
+	for key, value := range parameters {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	separator := "?"
+	if strings.Contains(redirectUri, "?") {
+		separator = "&"
+	}
+	return &StubResponse{Status: http.StatusFound, Headers: map[string]string{"Location": redirectUri + separator + query.Encode()}}
+}
+
+// method to get the base url (scheme and host) the request was sent to
+func _requestBaseUrl(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil || strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host
+}
+
+// method to generate an opaque random value (codes, token ids)
+func _newOidcRandomString() string {
+	bArrRandom := make([]byte, 32)
+	rand.Read(bArrRandom)
+	return base64.RawURLEncoding.EncodeToString(bArrRandom)
+}
@@ -0,0 +1,257 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/emicklei/go-restful"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// method to create an oidc module with a confidential (orders-service) and a public (web-app) client
+func newTestOidcModule(t *testing.T) *OidcModule {
+	m := new(OidcModule)
+	m.path = OidcModuleDefaultPath
+	m.codes = make(map[string]*oidcAuthorizationCode)
+	err := m.Init(map[string]interface{}{
+		"clients": map[string]interface{}{
+			"orders-service": map[string]interface{}{"secret": "s3cret"},
+			"web-app":        map[string]interface{}{"redirectUris": []interface{}{"http://localhost:3000/callback"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// method to post the form to the token endpoint
+func postOidcToken(m *OidcModule, form url.Values) *StubResponse {
+	request := httptest.NewRequest(http.MethodPost, "/oidc/token", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return m._token(request).(*StubResponse)
+}
+
+// method to get the oauth2 error code of the response; "" if none
+func oidcErrorCode(response *StubResponse) string {
+	body, _ := response.Body.(map[string]string)
+	return body["error"]
+}
+
+func TestOidcTokenClientAuthentication(t *testing.T) {
+	m := newTestOidcModule(t)
+	testCases := []struct {
+		name      string
+		form      url.Values
+		status    int
+		errorCode string
+	}{
+		{"confidential client", url.Values{"grant_type": {"client_credentials"}, "client_id": {"orders-service"}, "client_secret": {"s3cret"}}, http.StatusOK, ""},
+		{"confidential client, wrong secret", url.Values{"grant_type": {"client_credentials"}, "client_id": {"orders-service"}, "client_secret": {"nope"}}, http.StatusUnauthorized, "invalid_client"},
+		{"confidential client, no secret", url.Values{"grant_type": {"client_credentials"}, "client_id": {"orders-service"}}, http.StatusUnauthorized, "invalid_client"},
+		{"public client", url.Values{"grant_type": {"client_credentials"}, "client_id": {"web-app"}}, http.StatusBadRequest, "unauthorized_client"},
+		// a dummy secret must not turn a public client into a confidential one
+		{"public client, dummy secret", url.Values{"grant_type": {"client_credentials"}, "client_id": {"web-app"}, "client_secret": {"dummy"}}, http.StatusUnauthorized, "invalid_client"},
+		{"unknown client", url.Values{"grant_type": {"client_credentials"}, "client_id": {"other"}, "client_secret": {"s3cret"}}, http.StatusUnauthorized, "invalid_client"},
+	}
+	for _, testCase := range testCases {
+		response := postOidcToken(m, testCase.form)
+		if response.Status != testCase.status || oidcErrorCode(response) != testCase.errorCode {
+			t.Errorf("%v: expected %v %q, got %v %q", testCase.name, testCase.status, testCase.errorCode, response.Status, oidcErrorCode(response))
+		}
+	}
+}
+
+func TestOidcTokenPublicClientNeedsPkce(t *testing.T) {
+	m := newTestOidcModule(t)
+	redirectUri := "http://localhost:3000/callback"
+	issueCode := func(codeChallenge string) string {
+		code := _newOidcRandomString()
+		m.codes[code] = &oidcAuthorizationCode{clientId: "web-app", redirectUri: redirectUri, subject: "alice",
+			codeChallenge: codeChallenge, codeChallengeMethod: "plain", expiresAt: time.Now().Add(oidcCodeTtl)}
+		return code
+	}
+	exchange := func(code string, clientSecret string, codeVerifier string) *StubResponse {
+		form := url.Values{"grant_type": {"authorization_code"}, "client_id": {"web-app"}, "code": {code}, "redirect_uri": {redirectUri}}
+		if clientSecret != "" {
+			form.Set("client_secret", clientSecret)
+		}
+		if codeVerifier != "" {
+			form.Set("code_verifier", codeVerifier)
+		}
+		return postOidcToken(m, form)
+	}
+	if response := exchange(issueCode(""), "", ""); oidcErrorCode(response) != "invalid_grant" {
+		t.Errorf("a code without PKCE must be refused for a public client, got %v %q", response.Status, oidcErrorCode(response))
+	}
+	if response := exchange(issueCode(""), "dummy", ""); oidcErrorCode(response) != "invalid_client" {
+		t.Errorf("a dummy secret must not skip PKCE, got %v %q", response.Status, oidcErrorCode(response))
+	}
+	if response := exchange(issueCode("verifier-1234"), "", "verifier-1234"); response.Status != http.StatusOK {
+		t.Errorf("expected the tokens with a matching code_verifier, got %v %q", response.Status, oidcErrorCode(response))
+	}
+}
+
+// method to verify the RS256 JWT against the JWKS; returns the header and the claims
+func verifyTestJwtWithJwks(t *testing.T, token string, jwks map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected a JWT, got %v", token)
+	}
+	var header, claims map[string]interface{}
+	for idx, target := range []*map[string]interface{}{&header, &claims} {
+		bArrPart, err := base64.RawURLEncoding.DecodeString(parts[idx])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(bArrPart, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, value := range jwks["keys"].([]interface{}) {
+		key := value.(map[string]interface{})
+		if key["kid"] != header["kid"] {
+			continue
+		}
+		bArrN, _ := base64.RawURLEncoding.DecodeString(key["n"].(string))
+		bArrE, _ := base64.RawURLEncoding.DecodeString(key["e"].(string))
+		publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(bArrN), E: int(new(big.Int).SetBytes(bArrE).Int64())}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Fatalf("signature not verified by the JWKS: %v", err)
+		}
+		return header, claims
+	}
+	t.Fatalf("no key [%v] in the JWKS", header["kid"])
+	return nil, nil
+}
+
+func TestOidcAgainstItsDiscoveryAndJwks(t *testing.T) {
+	builtinModule := NewOidcModule("")
+	err := builtinModule.Init(map[string]interface{}{
+		"tokenTtlSeconds": float64(600),
+		"clients":         map[string]interface{}{"orders-service": map[string]interface{}{"secret": "s3cret"}},
+		"users": map[string]interface{}{
+			"alice": map[string]interface{}{"password": "wonderland", "claims": map[string]interface{}{"email": "alice@example.org"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	wsContainerPtr := restful.NewContainer()
+	modulePtr := NewEchoModule(nil, builtinModule.GetRestConfig, builtinModule.DoAction, BuiltinModulePathPrefix+"oidc")
+	if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+		t.Fatal(err)
+	}
+	srv.modules[modulePtr.ModulePath] = modulePtr
+	server := httptest.NewServer(wsContainerPtr)
+	defer server.Close()
+	getJson := func(url string, authorization string) (*http.Response, map[string]interface{}) {
+		request, _ := http.NewRequest(http.MethodGet, url, nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body := make(map[string]interface{})
+		json.NewDecoder(response.Body).Decode(&body)
+		return response, body
+	}
+
+	// discovery points at this server
+	issuer := server.URL + "/oidc"
+	_, discovery := getJson(issuer+"/.well-known/openid-configuration", "")
+	if discovery["issuer"] != issuer || discovery["token_endpoint"] != issuer+"/token" || discovery["jwks_uri"] != issuer+"/jwks" || discovery["userinfo_endpoint"] != issuer+"/userinfo" {
+		t.Fatalf("unexpected discovery document %v", discovery)
+	}
+	_, jwks := getJson(discovery["jwks_uri"].(string), "")
+
+	// password grant; the tokens are verified with the served JWKS only
+	response, err := http.PostForm(discovery["token_endpoint"].(string), url.Values{"grant_type": {"password"}, "client_id": {"orders-service"},
+		"client_secret": {"s3cret"}, "username": {"alice"}, "password": {"wonderland"}, "scope": {"openid profile"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&tokens)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || tokens["token_type"] != "Bearer" || tokens["expires_in"] != float64(600) || response.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected the tokens, got %v %v", response.StatusCode, tokens)
+	}
+	header, accessClaims := verifyTestJwtWithJwks(t, tokens["access_token"].(string), jwks)
+	if header["alg"] != JwtAlgorithmRS256 || accessClaims["iss"] != issuer || accessClaims["sub"] != "alice" || accessClaims["aud"] != "orders-service" ||
+		accessClaims["scope"] != "openid profile" || accessClaims["exp"].(float64)-accessClaims["iat"].(float64) != 600 {
+		t.Errorf("unexpected access token %v %v", header, accessClaims)
+	}
+	if expiresAt := int64(accessClaims["exp"].(float64)); expiresAt < time.Now().Unix() {
+		t.Errorf("expected a valid token, expired at %v", expiresAt)
+	}
+	_, idClaims := verifyTestJwtWithJwks(t, tokens["id_token"].(string), jwks)
+	if idClaims["iss"] != issuer || idClaims["sub"] != "alice" || idClaims["aud"] != "orders-service" || idClaims["email"] != "alice@example.org" {
+		t.Errorf("unexpected id token %v", idClaims)
+	}
+
+	// userinfo
+	response, userinfo := getJson(discovery["userinfo_endpoint"].(string), "Bearer "+tokens["access_token"].(string))
+	if response.StatusCode != http.StatusOK || userinfo["sub"] != "alice" || userinfo["email"] != "alice@example.org" {
+		t.Errorf("expected alice's claims, got %v %v", response.StatusCode, userinfo)
+	}
+	if response, _ := getJson(discovery["userinfo_endpoint"].(string), ""); response.StatusCode != http.StatusUnauthorized || response.Header.Get("WWW-Authenticate") != `Bearer realm="oidc"` {
+		t.Errorf("expected a bearer challenge, got %v %v", response.StatusCode, response.Header.Get("WWW-Authenticate"))
+	}
+	tampered := tokens["access_token"].(string)
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	if response, _ := getJson(discovery["userinfo_endpoint"].(string), "Bearer "+tampered); response.StatusCode != http.StatusUnauthorized ||
+		!strings.Contains(response.Header.Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Errorf("expected the tampered token refused, got %v %v", response.StatusCode, response.Header.Get("WWW-Authenticate"))
+	}
+
+	// wrong password / unknown user
+	for _, form := range []url.Values{
+		{"grant_type": {"password"}, "client_id": {"orders-service"}, "client_secret": {"s3cret"}, "username": {"alice"}, "password": {"nope"}},
+		{"grant_type": {"password"}, "client_id": {"orders-service"}, "client_secret": {"s3cret"}, "username": {"bob"}, "password": {"wonderland"}},
+	} {
+		response, err := http.PostForm(discovery["token_endpoint"].(string), form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var oauthError map[string]interface{}
+		json.NewDecoder(response.Body).Decode(&oauthError)
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest || oauthError["error"] != "invalid_grant" {
+			t.Errorf("%v: expected invalid_grant, got %v %v", form.Get("username"), response.StatusCode, oauthError)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// reserved webservice path serving the OpenAPI document of the loaded modules
+const OpenApiWebservicePath = "/_openapi"
+
+// version of the OpenAPI specification generated
+const OpenApiVersion = "3.0.3"
+
+// matches a path parameter of a go-restful route e.g. {id} or {subpath:*}
+var routePathParameterPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// setup the endpoint serving the OpenAPI document on the webservice container
+func (srv *Server) setupOpenApi(wsContainer *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path(OpenApiWebservicePath).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").To(func(request *restful.Request, response *restful.Response) {
+		if err := response.WriteHeaderAndJson(http.StatusOK, srv.BuildOpenApiDocument(wsContainer), restful.MIME_JSON); err != nil {
+			logger := srv._requestLogger(request)
+			logger.Log(err.Error(), LogLevelError, "", "")
+		}
+	}))
+	wsContainer.Add(ws)
+
+	srv.logger.LogWithFuncName(fmt.Sprintf("openapi document available at %v", OpenApiWebservicePath), "setupOpenApi", srv.logConfig)
+}
+
+// method to build an OpenAPI 3 document out of the routes registered by the modules;
+// schemas come from the optional "schemas" entry of a module's GetRestConfig, keyed by endpoint
+// e.g. "GET::/{id}" => { "summary": "...", "requestSchema": {...}, "responseSchema": {...} }
+func (srv *Server) BuildOpenApiDocument(wsContainer *restful.Container) map[string]interface{} {
+	paths := make(map[string]interface{})
+	tags := make([]interface{}, 0)
+
+	webServices := wsContainer.RegisteredWebServices()
+	sort.Slice(webServices, func(i, j int) bool {
+		return webServices[i].RootPath() < webServices[j].RootPath()
+	})
+	for _, ws := range webServices {
+		modulePtr := srv._findModuleByWebservicePath(ws.RootPath())
+		if modulePtr == nil {
+			// reserved webservices (admin, openapi...) are not part of the mocked api
+			continue
+		}
+		tag := strings.TrimPrefix(ws.RootPath(), "/")
+		tags = append(tags, map[string]interface{}{
+			"name":        tag,
+			"description": fmt.Sprintf("module %v", modulePtr.ModulePath),
+		})
+		for _, route := range ws.Routes() {
+			openApiPath := routePathParameterPattern.ReplaceAllString(route.Path, "{$1}")
+			pathItem, ok := paths[openApiPath].(map[string]interface{})
+			if !ok {
+				pathItem = make(map[string]interface{})
+				paths[openApiPath] = pathItem
+			}
+			pathItem[strings.ToLower(route.Method)] = srv._buildOpenApiOperation(modulePtr, tag, route)
+		}
+	}
+	document := map[string]interface{}{
+		"openapi": OpenApiVersion,
+		"info": map[string]interface{}{
+			"title":       "echogogo",
+			"description": "api offered by the modules loaded on this echogogo server",
+			"version":     "1.0.0",
+		},
+		"tags":  tags,
+		"paths": paths,
+	}
+	return document
+}
+
+// method to build the OpenAPI operation of a route
+func (srv *Server) _buildOpenApiOperation(modulePtr *EchoModule, tag string, route restful.Route) map[string]interface{} {
+	endPoint := fmt.Sprintf("%v::%v", route.Method, "/"+strings.TrimLeft(strings.TrimPrefix(route.Path, modulePtr.WebservicePath), "/"))
+	schemaInfo, _ := modulePtr.Schemas[endPoint].(map[string]interface{})
+
+	operation := make(map[string]interface{})
+	operation["tags"] = []string{tag}
+	operation["operationId"] = _buildOpenApiOperationId(route.Method, route.Path)
+	if summary, ok := schemaInfo["summary"].(string); ok {
+		operation["summary"] = summary
+	}
+	if description, ok := schemaInfo["description"].(string); ok {
+		operation["description"] = description
+	}
+	// path parameters out of the route template
+	parameters := make([]interface{}, 0)
+	for _, match := range routePathParameterPattern.FindAllStringSubmatch(route.Path, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	// request body (only for the verbs carrying one)
+	if route.Method == http.MethodPost || route.Method == http.MethodPut || route.Method == http.MethodPatch {
+		requestSchema, ok := schemaInfo["requestSchema"]
+		if !ok {
+			requestSchema = map[string]interface{}{}
+		}
+		operation["requestBody"] = map[string]interface{}{
+			"content": _buildOpenApiContent(route.Consumes, requestSchema),
+		}
+	}
+	responseSchema, ok := schemaInfo["responseSchema"]
+	if !ok {
+		responseSchema = map[string]interface{}{}
+	}
+	operation["responses"] = map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "response of the module's DoAction",
+			"content":     _buildOpenApiContent(route.Produces, responseSchema),
+		},
+	}
+	return operation
+}
+
+// method to build an OpenAPI content map (mime type => schema)
+func _buildOpenApiContent(mimeTypes []string, schema interface{}) map[string]interface{} {
+	content := make(map[string]interface{})
+	for _, mimeType := range mimeTypes {
+		content[mimeType] = map[string]interface{}{"schema": schema}
+	}
+	if len(content) == 0 {
+		content[restful.MIME_JSON] = map[string]interface{}{"schema": schema}
+	}
+	return content
+}
+
+// method to build a readable operation id e.g. GET /orders/{id} => get_orders_id
+func _buildOpenApiOperationId(method string, routePath string) string {
+	parts := []string{strings.ToLower(method)}
+	for _, part := range strings.Split(routePath, "/") {
+		part = routePathParameterPattern.ReplaceAllString(part, "$1")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// method to find the module serving the given webservice path
+func (srv *Server) _findModuleByWebservicePath(webservicePath string) *EchoModule {
+	for _, modulePtr := range srv.modules {
+		if modulePtr.WebservicePath == webservicePath {
+			return modulePtr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"github.com/quoeamaster/echogogo_plugin"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// max depth when resolving $ref(s); guards against recursive schemas
+const openApiMaxRefDepth = 8
+
+// http verbs of an OpenAPI path item that become stubs (see supportedEndPointVerbs); trace operations are
+// skipped and reported
+var openApiVerbs = []string{"get", "post", "put", "delete", "patch", "head", "options"}
+
+// characters not allowed in a module path derived from the spec title
+var openApiModuleNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// method to read an OpenAPI 3 specification (json, or yaml for .yaml / .yml) and turn it into a declarative
+// module; every path / verb becomes a stub answering with the example (or a schema generated) response, and
+// the parameters and request body of every operation end up in "schemas" for request validation. The
+// operations that can't become a stub (trace) are returned as skipped e.g. TRACE::/orders
+func GenerateModuleFromOpenApi(specFile string, modulePath string) (*DeclarativeModuleConfig, []string, error) {
+	bArrContent, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var document interface{}
+	switch strings.ToLower(filepath.Ext(specFile)) {
+	case ".yaml", ".yml":
+		document, err = ParseYaml(bArrContent)
+	default:
+		err = json.Unmarshal(bArrContent, &document)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid OpenAPI specification [%v]: %v", specFile, err)
+	}
+	spec, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid OpenAPI specification [%v]: not an object", specFile)
+	}
+	version, _ := spec["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, nil, fmt.Errorf("invalid OpenAPI specification [%v]: only OpenAPI 3.x is supported, got [%v]", specFile, version)
+	}
+	paths, ok := spec["paths"].(map[string]interface{})
+	if !ok || len(paths) == 0 {
+		return nil, nil, fmt.Errorf("invalid OpenAPI specification [%v]: no paths", specFile)
+	}
+	if modulePath == "" {
+		info, _ := spec["info"].(map[string]interface{})
+		title, _ := info["title"].(string)
+		modulePath = "/" + strings.Trim(openApiModuleNamePattern.ReplaceAllString(strings.ToLower(title), "-"), "-")
+		if modulePath == "/" {
+			modulePath = "/api"
+		}
+	}
+	moduleConfig := new(DeclarativeModuleConfig)
+	moduleConfig.Path = modulePath
+	moduleConfig.Stubs = make([]StubConfig, 0)
+	moduleConfig.Schemas = make(map[string]interface{})
+
+	isXml := false
+	skipped := make([]string, 0)
+	pathNames := make([]string, 0, len(paths))
+	for pathName := range paths {
+		pathNames = append(pathNames, pathName)
+	}
+	sort.Strings(pathNames)
+	for _, pathName := range pathNames {
+		pathItem, _ := _resolveOpenApiRefs(paths[pathName], spec, 0).(map[string]interface{})
+		if _, ok := pathItem["trace"]; ok {
+			skipped = append(skipped, fmt.Sprintf("TRACE::%v", pathName))
+		}
+		for _, verb := range openApiVerbs {
+			operation, ok := pathItem[verb].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			stub, schemaInfo, usesXml := _buildStubFromOpenApiOperation(strings.ToUpper(verb), pathName, pathItem, operation)
+			isXml = isXml || usesXml
+			moduleConfig.Stubs = append(moduleConfig.Stubs, stub)
+			moduleConfig.Schemas[fmt.Sprintf("%v::%v", stub.Method, stub.Path)] = schemaInfo
+		}
+	}
+	if len(moduleConfig.Stubs) == 0 {
+		return nil, nil, fmt.Errorf("invalid OpenAPI specification [%v]: no %v operations", specFile, strings.Join(supportedEndPointVerbs, ", "))
+	}
+	moduleConfig.ConsumeFormat = echogogo.FORMAT_JSON
+	moduleConfig.ProduceFormat = echogogo.FORMAT_JSON
+	if isXml {
+		moduleConfig.ConsumeFormat = echogogo.FORMAT_XML_JSON
+		moduleConfig.ProduceFormat = echogogo.FORMAT_XML_JSON
+	}
+	return moduleConfig, skipped, nil
+}
+
+// method to build the stub and the schema description (for validation and the OpenAPI document) of an operation
+func _buildStubFromOpenApiOperation(method string, pathName string, pathItem map[string]interface{}, operation map[string]interface{}) (StubConfig, map[string]interface{}, bool) {
+	var stub StubConfig
+	stub.Method = method
+	stub.Path = pathName
+	if operationId, ok := operation["operationId"].(string); ok {
+		stub.Name = operationId
+	}
+	schemaInfo := make(map[string]interface{})
+	if summary, ok := operation["summary"].(string); ok {
+		schemaInfo["summary"] = summary
+	}
+	if description, ok := operation["description"].(string); ok {
+		schemaInfo["description"] = description
+	}
+	// parameters of the path item apply to every operation below it
+	requiredQueryParameters := make([]string, 0)
+	requiredHeaders := make([]string, 0)
+	parameters := make([]interface{}, 0)
+	if pathParameters, ok := pathItem["parameters"].([]interface{}); ok {
+		parameters = append(parameters, pathParameters...)
+	}
+	if operationParameters, ok := operation["parameters"].([]interface{}); ok {
+		parameters = append(parameters, operationParameters...)
+	}
+	for _, element := range parameters {
+		parameter, _ := element.(map[string]interface{})
+		name, _ := parameter["name"].(string)
+		isRequired, _ := parameter["required"].(bool)
+		if !isRequired || name == "" {
+			continue
+		}
+		switch parameter["in"] {
+		case "query":
+			requiredQueryParameters = append(requiredQueryParameters, name)
+		case "header":
+			requiredHeaders = append(requiredHeaders, name)
+		}
+	}
+	if len(requiredQueryParameters) > 0 {
+		schemaInfo["requiredQueryParameters"] = requiredQueryParameters
+	}
+	if len(requiredHeaders) > 0 {
+		schemaInfo["requiredHeaders"] = requiredHeaders
+	}
+	usesXml := false
+	if requestBody, ok := operation["requestBody"].(map[string]interface{}); ok {
+		if isRequired, _ := requestBody["required"].(bool); isRequired {
+			schemaInfo["requestBodyRequired"] = true
+		}
+		content, _ := requestBody["content"].(map[string]interface{})
+		if mediaType, ok := content[restful.MIME_JSON].(map[string]interface{}); ok {
+			if schema, ok := mediaType["schema"].(map[string]interface{}); ok {
+				schemaInfo["requestSchema"] = schema
+			}
+		}
+		_, usesXml = content[restful.MIME_XML]
+	}
+	// the response; the first 2xx (or default) with its example or a generated body
+	status, response := _pickOpenApiResponse(operation)
+	stub.Response.Status = status
+	if response != nil {
+		content, _ := response["content"].(map[string]interface{})
+		if _, ok := content[restful.MIME_XML]; ok {
+			usesXml = true
+		}
+		if mediaType, ok := content[restful.MIME_JSON].(map[string]interface{}); ok {
+			stub.Response.Body = _pickOpenApiExample(mediaType)
+			stub.Response.Headers = map[string]string{"Content-Type": restful.MIME_JSON}
+			if schema, ok := mediaType["schema"].(map[string]interface{}); ok {
+				schemaInfo["responseSchema"] = schema
+			}
+		} else {
+			for mimeType, element := range content {
+				mediaType, _ := element.(map[string]interface{})
+				if example, ok := mediaType["example"].(string); ok {
+					stub.Response.Body = example
+					stub.Response.Headers = map[string]string{"Content-Type": mimeType}
+					break
+				}
+			}
+		}
+	}
+	return stub, schemaInfo, usesXml
+}
+
+// method to pick the response the stub answers with; lowest 2xx first, then default
+func _pickOpenApiResponse(operation map[string]interface{}) (int, map[string]interface{}) {
+	responses, _ := operation["responses"].(map[string]interface{})
+	codes := make([]string, 0)
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			// e.g. "2XX"
+			status = http.StatusOK
+		}
+		response, _ := responses[code].(map[string]interface{})
+		return status, response
+	}
+	if response, ok := responses["default"].(map[string]interface{}); ok {
+		return http.StatusOK, response
+	}
+	return http.StatusOK, nil
+}
+
+// method to pick an example out of a media type; example, examples, schema example or a generated one
+func _pickOpenApiExample(mediaType map[string]interface{}) interface{} {
+	if example, ok := mediaType["example"]; ok {
+		return example
+	}
+	if examples, ok := mediaType["examples"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(examples))
+		for name := range examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if example, ok := examples[name].(map[string]interface{}); ok {
+				if value, ok := example["value"]; ok {
+					return value
+				}
+			}
+		}
+	}
+	schema, _ := mediaType["schema"].(map[string]interface{})
+	return GenerateExampleFromSchema(schema, 0)
+}
+
+// method to generate an example value out of a (json) schema
+func GenerateExampleFromSchema(schema map[string]interface{}, depth int) interface{} {
+	if schema == nil || depth > openApiMaxRefDepth {
+		return nil
+	}
+	if example, ok := schema["example"]; ok {
+		return example
+	}
+	if value, ok := schema["default"]; ok {
+		return value
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	for _, combiner := range []string{"allOf", "oneOf", "anyOf"} {
+		if schemas, ok := schema[combiner].([]interface{}); ok && len(schemas) > 0 {
+			if combiner != "allOf" {
+				subSchema, _ := schemas[0].(map[string]interface{})
+				return GenerateExampleFromSchema(subSchema, depth+1)
+			}
+			// allOf; merge the objects generated by every sub schema
+			merged := make(map[string]interface{})
+			for _, element := range schemas {
+				subSchema, _ := element.(map[string]interface{})
+				if object, ok := GenerateExampleFromSchema(subSchema, depth+1).(map[string]interface{}); ok {
+					for key, value := range object {
+						merged[key] = value
+					}
+				}
+			}
+			return merged
+		}
+	}
+	schemaType, _ := schema["type"].(string)
+	if schemaType == "" {
+		if _, ok := schema["properties"]; ok {
+			schemaType = "object"
+		}
+	}
+	switch schemaType {
+	case "object":
+		object := make(map[string]interface{})
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, element := range properties {
+			propertySchema, _ := element.(map[string]interface{})
+			object[name] = GenerateExampleFromSchema(propertySchema, depth+1)
+		}
+		return object
+	case "array":
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		return []interface{}{GenerateExampleFromSchema(itemSchema, depth+1)}
+	case "integer":
+		return 0
+	case "number":
+		return 0.0
+	case "boolean":
+		return true
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "date":
+			return "2006-01-02"
+		case "uuid":
+			return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+		case "email":
+			return "user@example.com"
+		case "uri":
+			return "https://example.com"
+		default:
+			return "string"
+		}
+	default:
+		return nil
+	}
+}
+
+// method to replace every {"$ref": "#/..."} with a copy of the referenced node
+func _resolveOpenApiRefs(node interface{}, spec map[string]interface{}, depth int) interface{} {
+	switch node.(type) {
+	case map[string]interface{}:
+		object := node.(map[string]interface{})
+		if ref, ok := object["$ref"].(string); ok {
+			if depth >= openApiMaxRefDepth {
+				// recursive schema; stop here
+				return map[string]interface{}{}
+			}
+			return _resolveOpenApiRefs(_lookupOpenApiRef(ref, spec), spec, depth+1)
+		}
+		resolved := make(map[string]interface{})
+		for key, value := range object {
+			resolved[key] = _resolveOpenApiRefs(value, spec, depth)
+		}
+		return resolved
+	case []interface{}:
+		resolved := make([]interface{}, 0, len(node.([]interface{})))
+		for _, element := range node.([]interface{}) {
+			resolved = append(resolved, _resolveOpenApiRefs(element, spec, depth))
+		}
+		return resolved
+	default:
+		return node
+	}
+}
+
+// method to look up a local reference e.g. #/components/schemas/Pet
+func _lookupOpenApiRef(ref string, spec map[string]interface{}) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		// external references are not supported
+		return map[string]interface{}{}
+	}
+	var node interface{} = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return map[string]interface{}{}
+		}
+		node = object[part]
+	}
+	if node == nil {
+		return map[string]interface{}{}
+	}
+	return node
+}
@@ -0,0 +1,133 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// a spec using every verb of an OpenAPI path item
+const testOpenApiYamlSpec = `
+openapi: 3.0.3
+info:
+  title: Order Service
+paths:
+  /orders/{id}:
+    get:
+      operationId: getOrder
+      responses:
+        '200':
+          content:
+            application/json:
+              example: { id: '42', status: open }
+    patch:
+      operationId: patchOrder
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                status: { type: string }
+      responses:
+        '200':
+          description: patched
+    head:
+      responses:
+        '204':
+          description: exists
+    options:
+      responses:
+        '204':
+          description: allowed verbs
+    trace:
+      responses:
+        '200':
+          description: echoed
+`
+
+// method to write the spec to a temp file with the given name
+func writeTestOpenApiSpec(t *testing.T, name string, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "echogogo-openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	specFile := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(specFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return specFile, func() { os.RemoveAll(dir) }
+}
+
+func TestGenerateModuleFromYamlOpenApi(t *testing.T) {
+	specFile, cleanup := writeTestOpenApiSpec(t, "orders.yaml", testOpenApiYamlSpec)
+	defer cleanup()
+
+	moduleConfig, skipped, err := GenerateModuleFromOpenApi(specFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moduleConfig.Path != "/order-service" {
+		t.Errorf("expected the path derived from the title, got %v", moduleConfig.Path)
+	}
+	endPoints := make([]string, 0)
+	for _, stub := range moduleConfig.Stubs {
+		endPoints = append(endPoints, stub.Method+"::"+stub.Path)
+	}
+	sort.Strings(endPoints)
+	expected := []string{"GET::/orders/{id}", "HEAD::/orders/{id}", "OPTIONS::/orders/{id}", "PATCH::/orders/{id}"}
+	if !reflect.DeepEqual(endPoints, expected) {
+		t.Errorf("expected the stubs %v, got %v", expected, endPoints)
+	}
+	if !reflect.DeepEqual(skipped, []string{"TRACE::/orders/{id}"}) {
+		t.Errorf("expected the trace operation reported as skipped, got %v", skipped)
+	}
+	patchSchema, _ := moduleConfig.Schemas["PATCH::/orders/{id}"].(map[string]interface{})
+	if patchSchema["requestBodyRequired"] != true || patchSchema["requestSchema"] == nil {
+		t.Errorf("expected the request body of the PATCH operation in schemas, got %v", patchSchema)
+	}
+	for _, stub := range moduleConfig.Stubs {
+		if stub.Method == "GET" && !reflect.DeepEqual(stub.Response.Body, map[string]interface{}{"id": "42", "status": "open"}) {
+			t.Errorf("expected the yaml example as body, got %v", stub.Response.Body)
+		}
+	}
+}
+
+func TestGenerateModuleFromJsonOpenApi(t *testing.T) {
+	specFile, cleanup := writeTestOpenApiSpec(t, "orders.json", `{"openapi": "3.0.0", "info": {"title": "orders"},
+		"paths": {"/orders": {"post": {"responses": {"201": {"content": {"application/json": {"example": {"id": "1"}}}}}}}}}`)
+	defer cleanup()
+
+	moduleConfig, skipped, err := GenerateModuleFromOpenApi(specFile, "/shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moduleConfig.Path != "/shop" || len(moduleConfig.Stubs) != 1 || len(skipped) != 0 {
+		t.Fatalf("expected a single stub at /shop, got %v %v (skipped %v)", moduleConfig.Path, len(moduleConfig.Stubs), skipped)
+	}
+	if stub := moduleConfig.Stubs[0]; stub.Method != "POST" || stub.Response.Status != 201 {
+		t.Errorf("expected POST answering 201, got %v %v", stub.Method, stub.Response.Status)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// method to build an orders module describing some of its endpoints with schemas
+func newTestOpenApiModule() *EchoModule {
+	getRestConfig := func() map[string]interface{} {
+		return map[string]interface{}{
+			"path":          "/orders",
+			"consumeFormat": "json",
+			"produceFormat": "json",
+			"endPoints":     []string{"GET::/", "GET::/{id}", "POST::/", "PUT::/{id}", "DELETE::/{id}", "GET::/{id}/lines/{lineId}"},
+			"schemas": map[string]interface{}{
+				"GET::/{id}": map[string]interface{}{
+					"summary":        "get an order",
+					"description":    "the order with its lines",
+					"responseSchema": map[string]interface{}{"type": "object", "required": []interface{}{"id"}},
+				},
+				"POST::/": map[string]interface{}{
+					"summary":       "create an order",
+					"requestSchema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"sku": map[string]interface{}{"type": "string"}}},
+				},
+			},
+		}
+	}
+	doAction := func(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+		return map[string]interface{}{"endPoint": endPoint}
+	}
+	return NewEchoModule(nil, getRestConfig, doAction, "orders.so")
+}
+
+func TestOpenApiDocument(t *testing.T) {
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	wsContainerPtr := restful.NewContainer()
+	srv.setupAdmin(wsContainerPtr)
+	for _, modulePtr := range []*EchoModule{newTestOpenApiModule(), newTestEchoModule("customers.so", "/customers")} {
+		if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+			t.Fatal(err)
+		}
+		srv.modules[modulePtr.ModulePath] = modulePtr
+	}
+	srv.setupOpenApi(wsContainerPtr)
+
+	recorder := serveTestRequest(wsContainerPtr, http.MethodGet, OpenApiWebservicePath, nil, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200 out of the openapi endpoint, got %v %v", recorder.Code, recorder.Body.String())
+	}
+	document := decodeTestJson(t, recorder.Body.String()).(map[string]interface{})
+	if document["openapi"] != OpenApiVersion {
+		t.Errorf("expected openapi version %v, got %v", OpenApiVersion, document["openapi"])
+	}
+
+	// one tag per module (sorted by path); the reserved webservices are left out
+	tags := document["tags"].([]interface{})
+	if len(tags) != 2 || tags[0].(map[string]interface{})["name"] != "customers" || tags[1].(map[string]interface{})["name"] != "orders" {
+		t.Errorf("expected the tags [customers orders], got %v", tags)
+	}
+
+	// every route under its path with the verbs in lowercase
+	paths := document["paths"].(map[string]interface{})
+	expectedVerbs := map[string][]string{
+		"/customers/":                 {"get"},
+		"/orders/":                    {"get", "post"},
+		"/orders/{id}":                {"delete", "get", "put"},
+		"/orders/{id}/lines/{lineId}": {"get"},
+	}
+	if len(paths) != len(expectedVerbs) {
+		t.Errorf("expected the paths %v, got %v", expectedVerbs, paths)
+	}
+	for path, verbs := range expectedVerbs {
+		pathItem, ok := paths[path].(map[string]interface{})
+		if !ok {
+			t.Errorf("expected the path %v, got %v", path, paths)
+			continue
+		}
+		if len(pathItem) != len(verbs) {
+			t.Errorf("%v: expected the verbs %v, got %v", path, verbs, pathItem)
+		}
+		for _, verb := range verbs {
+			if _, ok := pathItem[verb]; !ok {
+				t.Errorf("%v: expected the verb %v, got %v", path, verb, pathItem)
+			}
+		}
+	}
+	if _, ok := paths[AdminWebservicePath+"/scenarios"]; ok {
+		t.Errorf("expected the admin api not to be documented")
+	}
+
+	// operation with a summary, the path parameter and the response schema
+	getOrder := paths["/orders/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+	if getOrder["operationId"] != "get_orders_id" || getOrder["summary"] != "get an order" || getOrder["description"] != "the order with its lines" {
+		t.Errorf("expected the id, summary and description of the operation, got %v", getOrder)
+	}
+	expectedParameters := []interface{}{
+		map[string]interface{}{"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+	}
+	if !reflect.DeepEqual(getOrder["parameters"], expectedParameters) {
+		t.Errorf("expected the path parameter id, got %v", getOrder["parameters"])
+	}
+	if _, ok := getOrder["requestBody"]; ok {
+		t.Errorf("expected no request body of a GET, got %v", getOrder["requestBody"])
+	}
+	responseSchema := getOrder["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"].(map[string]interface{})[restful.MIME_JSON]
+	expectedResponseSchema := map[string]interface{}{"schema": map[string]interface{}{"type": "object", "required": []interface{}{"id"}}}
+	if !reflect.DeepEqual(responseSchema, expectedResponseSchema) {
+		t.Errorf("expected the response schema %v, got %v", expectedResponseSchema, responseSchema)
+	}
+
+	// operation with a request schema; no path parameters
+	createOrder := paths["/orders/"].(map[string]interface{})["post"].(map[string]interface{})
+	requestSchema := createOrder["requestBody"].(map[string]interface{})["content"].(map[string]interface{})[restful.MIME_JSON].(map[string]interface{})["schema"]
+	expectedRequestSchema := map[string]interface{}{"type": "object", "properties": map[string]interface{}{"sku": map[string]interface{}{"type": "string"}}}
+	if !reflect.DeepEqual(requestSchema, expectedRequestSchema) {
+		t.Errorf("expected the request schema %v, got %v", expectedRequestSchema, requestSchema)
+	}
+	if _, ok := createOrder["parameters"]; ok {
+		t.Errorf("expected no parameters without a path parameter, got %v", createOrder["parameters"])
+	}
+
+	// undescribed endpoints get an empty schema; a PUT has a request body too
+	updateOrder := paths["/orders/{id}"].(map[string]interface{})["put"].(map[string]interface{})
+	if updateOrder["summary"] != nil || updateOrder["requestBody"] == nil {
+		t.Errorf("expected an undescribed PUT with a request body, got %v", updateOrder)
+	}
+	lineParameters := paths["/orders/{id}/lines/{lineId}"].(map[string]interface{})["get"].(map[string]interface{})["parameters"].([]interface{})
+	if len(lineParameters) != 2 || lineParameters[0].(map[string]interface{})["name"] != "id" || lineParameters[1].(map[string]interface{})["name"] != "lineId" {
+		t.Errorf("expected the path parameters [id lineId], got %v", lineParameters)
+	}
+}
+
+func TestOpenApiOperationId(t *testing.T) {
+	testCases := []struct {
+		method    string
+		routePath string
+		expected  string
+	}{
+		{http.MethodGet, "/orders/", "get_orders"},
+		{http.MethodDelete, "/orders/{id}", "delete_orders_id"},
+		{http.MethodGet, "/files/{subpath:*}", "get_files_subpath"},
+	}
+	for _, testCase := range testCases {
+		if operationId := _buildOpenApiOperationId(testCase.method, testCase.routePath); operationId != testCase.expected {
+			t.Errorf("%v %v: expected %v, got %v", testCase.method, testCase.routePath, testCase.expected, operationId)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// requests are forwarded to the target and every exchange is recorded as a stub file
+const ProxyModeRecord = "record"
+
+// recorded stub files are served; nothing is forwarded
+const ProxyModeReplay = "replay"
+
+// requests are forwarded to the target without recording
+const ProxyModePassthrough = "passthrough"
+
+// file suffix of a recorded stub (a single StubConfig in json)
+const RecordedStubSuffix = ".stub.json"
+
+// headers that only make sense for a single hop and are never forwarded or recorded
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length"}
+
+// characters not allowed in a recorded stub's file name
+var recordedStubFilenamePattern = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// structure of the proxy settings of a declarative module
+type ProxyConfig struct {
+	TargetBaseUrl   string   `json:"targetBaseUrl" description:"upstream base url e.g. https://api.example.com/v1"`
+	Mode            string   `json:"mode" description:"record (default), replay or passthrough"`
+	Routes          []string `json:"routes" description:"routes forwarded upstream (default every GET, POST, PUT and DELETE of the module)"`
+	RecordDirectory string   `json:"recordDirectory" description:"directory of the recorded stubs, relative to the module repository (default recordings/[module file name])"`
+	TimeoutMs       int      `json:"timeoutMs" description:"timeout of an upstream call (default 30000)"`
+
+	targetUrl  *url.URL
+	httpClient *http.Client
+}
+
+// method to validate the proxy settings and fill in the defaults
+func (p *ProxyConfig) compile(modulePath string) error {
+	if p.Mode == "" {
+		p.Mode = ProxyModeRecord
+	}
+	if p.Mode != ProxyModeRecord && p.Mode != ProxyModeReplay && p.Mode != ProxyModePassthrough {
+		return fmt.Errorf("unknown proxy mode => %v", p.Mode)
+	}
+	if p.Mode != ProxyModeReplay || p.TargetBaseUrl != "" {
+		targetUrl, err := url.Parse(p.TargetBaseUrl)
+		if err != nil || targetUrl.Scheme == "" || targetUrl.Host == "" {
+			return fmt.Errorf("invalid proxy targetBaseUrl => %v", p.TargetBaseUrl)
+		}
+		p.targetUrl = targetUrl
+	}
+	if len(p.Routes) == 0 {
+		p.Routes = []string{"GET::/{subpath:*}", "POST::/{subpath:*}", "PUT::/{subpath:*}", "DELETE::/{subpath:*}"}
+	}
+	moduleDir := filepath.Dir(modulePath)
+	if p.RecordDirectory == "" {
+		p.RecordDirectory = filepath.Join("recordings", strings.TrimSuffix(filepath.Base(modulePath), DeclarativeModuleSuffix))
+	}
+	if !filepath.IsAbs(p.RecordDirectory) {
+		p.RecordDirectory = filepath.Join(moduleDir, p.RecordDirectory)
+	}
+	if p.TimeoutMs <= 0 {
+		p.TimeoutMs = 30000
+	}
+	p.httpClient = &http.Client{
+		Timeout: time.Duration(p.TimeoutMs) * time.Millisecond,
+		// redirects are part of the recording; hand them back to the client as-is
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return nil
+}
+
+// method to check if the request should be forwarded upstream (instead of answering 404)
+func (p *ProxyConfig) isForwarding() bool {
+	return p.Mode == ProxyModeRecord || p.Mode == ProxyModePassthrough
+}
+
+// method to load the recorded stubs of the module (sorted by file name i.e. recording time)
+func (p *ProxyConfig) loadRecordedStubs() ([]StubConfig, error) {
+	stubs := make([]StubConfig, 0)
+	fileInfos, err := ioutil.ReadDir(p.RecordDirectory)
+	if os.IsNotExist(err) {
+		return stubs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() && strings.HasSuffix(fileInfo.Name(), RecordedStubSuffix) {
+			names = append(names, fileInfo.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		bArrContent, err := ioutil.ReadFile(filepath.Join(p.RecordDirectory, name))
+		if err != nil {
+			return nil, err
+		}
+		var stub StubConfig
+		if err := json.Unmarshal(bArrContent, &stub); err != nil {
+			return nil, fmt.Errorf("invalid recorded stub [%v]: %v", name, err)
+		}
+		if stub.Name == "" {
+			stub.Name = name
+		}
+		stubs = append(stubs, stub)
+	}
+	return stubs, nil
+}
+
+// method to forward the request upstream; the response is returned as a stub response
+func (m *DeclarativeModuleConfig) forward(requestData *RequestData) (*StubResponse, error) {
+	proxy := m.Proxy
+	targetUrl := *proxy.targetUrl
+	targetUrl.Path = strings.TrimRight(targetUrl.Path, "/") + "/" + strings.TrimLeft(strings.TrimPrefix(requestData.Path, m.Path), "/")
+	targetUrl.RawQuery = requestData.Query.Encode()
+
+	upstreamRequest, err := http.NewRequest(requestData.Method, targetUrl.String(), bytes.NewReader(requestData.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range requestData.Headers {
+		if !_isHopByHopHeader(key) {
+			upstreamRequest.Header[key] = values
+		}
+	}
+	upstreamResponse, err := proxy.httpClient.Do(upstreamRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer upstreamResponse.Body.Close()
+
+	bArrBody, err := ioutil.ReadAll(upstreamResponse.Body)
+	if err != nil {
+		return nil, err
+	}
+	response := new(StubResponse)
+	response.Status = upstreamResponse.StatusCode
+	response.Headers = make(map[string]string)
+	for key, values := range upstreamResponse.Header {
+		if !_isHopByHopHeader(key) && len(values) > 0 {
+			response.Headers[key] = strings.Join(values, ", ")
+		}
+	}
+	response.Body = bArrBody
+
+	return response, nil
+}
+
+// method to record the exchange as a stub file in the record directory
+func (m *DeclarativeModuleConfig) record(requestData *RequestData, routePath string, response *StubResponse) error {
+	stub := new(StubConfig)
+	stub.Method = requestData.Method
+	stub.Path = "/" + strings.TrimLeft(strings.TrimPrefix(routePath, m.Path), "/")
+	stub.Priority = DefaultStubPriority
+
+	stub.Request = new(RequestMatchConfig)
+	urlPath := requestData.Path
+	stub.Request.UrlPath = &ValueMatcher{EqualTo: &urlPath}
+	if len(requestData.Query) > 0 {
+		stub.Request.QueryParameters = make(map[string]*ValueMatcher)
+		for name, values := range requestData.Query {
+			// every value of a multi-valued parameter, in order
+			if len(values) != 1 {
+				stub.Request.QueryParameters[name] = &ValueMatcher{EqualToAll: values}
+				continue
+			}
+			value := values[0]
+			stub.Request.QueryParameters[name] = &ValueMatcher{EqualTo: &value}
+		}
+	}
+	if len(requestData.Body) > 0 {
+		body := string(requestData.Body)
+		stub.Request.BodyPatterns = []*BodyPattern{{ValueMatcher: ValueMatcher{EqualTo: &body}}}
+	}
+	// keep the recorded body readable; json stays json, text stays text, anything else is base64
+	stub.Response.Status = response.Status
+	stub.Response.Headers = make(map[string]string)
+	for key, value := range response.Headers {
+		// a replayed Date would be stale
+		if key != "Date" {
+			stub.Response.Headers[key] = value
+		}
+	}
+	bArrBody, _ := response.Body.([]byte)
+	var jsonBody interface{}
+	switch {
+	case len(bArrBody) == 0:
+	case strings.Contains(response.Headers["Content-Type"], "json") && json.Unmarshal(bArrBody, &jsonBody) == nil:
+		stub.Response.Body = jsonBody
+	case utf8.Valid(bArrBody):
+		stub.Response.Body = string(bArrBody)
+	default:
+		stub.Response.BodyBase64 = base64.StdEncoding.EncodeToString(bArrBody)
+	}
+	if err := os.MkdirAll(m.Proxy.RecordDirectory, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%v-%v%v", _getTimeNow().Format("20060102T150405.000000000"), stub.Method,
+		recordedStubFilenamePattern.ReplaceAllString(requestData.Path, "_"))
+	if len(name) > 120 {
+		name = name[:120]
+	}
+	stub.Name = name + RecordedStubSuffix
+	bArrStub, err := json.MarshalIndent(stub, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(m.Proxy.RecordDirectory, stub.Name), bArrStub, 0644)
+}
+
+// method to check if the header is a hop-by-hop header
+func _isHopByHopHeader(name string) bool {
+	for _, header := range hopByHopHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
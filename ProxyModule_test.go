@@ -0,0 +1,191 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// route path of the default proxy routes of a module at /upstream
+const testProxyRoutePath = "/upstream/{subpath:*}"
+
+// binary body served by the test upstream (not valid utf-8)
+var testProxyBinaryBody = []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, 0x10}
+
+// method to start an upstream answering /v1/orders with json (echoing what it received) and /v1/image with binary
+func newTestProxyUpstream(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/v1/orders":
+			writer.Header().Set("Content-Type", "application/json")
+			writer.Header().Set("X-Upstream", "orders")
+			json.NewEncoder(writer).Encode(map[string]interface{}{
+				"query":  request.URL.RawQuery,
+				"tenant": request.Header.Get("X-Tenant"),
+			})
+		case "/v1/image":
+			writer.Header().Set("Content-Type", "application/octet-stream")
+			writer.Write(testProxyBinaryBody)
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+}
+
+// method to write a proxy module file and load it, like the server does on start
+func loadTestProxyModule(t *testing.T, moduleDir string, proxy map[string]interface{}) *DeclarativeModuleConfig {
+	bArrModule, _ := json.Marshal(map[string]interface{}{"path": "/upstream", "proxy": proxy})
+	modulePath := filepath.Join(moduleDir, "upstream"+DeclarativeModuleSuffix)
+	if err := ioutil.WriteFile(modulePath, bArrModule, 0644); err != nil {
+		t.Fatal(err)
+	}
+	moduleConfig, err := LoadDeclarativeModuleConfig(modulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return moduleConfig
+}
+
+// method to send the request to the module; the route path is the one of the default proxy routes
+func doTestProxyAction(moduleConfig *DeclarativeModuleConfig, method string, target string, header http.Header) *StubResponse {
+	request := httptest.NewRequest(method, target, nil)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	return moduleConfig.doAction(*request, method+"::/{subpath:*}", map[string]interface{}{"routePath": testProxyRoutePath}).(*StubResponse)
+}
+
+// method to get the body as json (a recorded json body) or bytes (a forwarded one)
+func decodeTestProxyBody(t *testing.T, body interface{}) interface{} {
+	bArrBody, ok := body.([]byte)
+	if !ok {
+		return body
+	}
+	var jsonBody interface{}
+	if err := json.Unmarshal(bArrBody, &jsonBody); err != nil {
+		t.Fatalf("invalid json body %q: %v", bArrBody, err)
+	}
+	return jsonBody
+}
+
+func TestProxyRecordThenReplayOffline(t *testing.T) {
+	moduleDir, err := ioutil.TempDir("", "echogogo-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(moduleDir)
+	upstream := newTestProxyUpstream(t)
+
+	// record; every exchange goes upstream and is written as a stub file
+	recorder := loadTestProxyModule(t, moduleDir, map[string]interface{}{"targetBaseUrl": upstream.URL + "/v1", "mode": ProxyModeRecord})
+	recordedOrders := doTestProxyAction(recorder, http.MethodGet, "/upstream/orders?tag=a&tag=b&view=full", http.Header{"X-Tenant": {"t-1"}})
+	recordedImage := doTestProxyAction(recorder, http.MethodGet, "/upstream/image", nil)
+	for _, response := range []*StubResponse{recordedOrders, recordedImage} {
+		if response.Status != http.StatusOK || response.Headers["X-Echogogo-Record-Error"] != "" {
+			t.Fatalf("expected the upstream response to be recorded, got %v %v", response.Status, response.Headers)
+		}
+	}
+	expectedOrders := map[string]interface{}{"query": "tag=a&tag=b&view=full", "tenant": "t-1"}
+	if body := decodeTestProxyBody(t, recordedOrders.Body); !reflect.DeepEqual(body, expectedOrders) {
+		t.Errorf("expected the headers and the query forwarded upstream, got %v", body)
+	}
+	if recordedOrders.Headers["X-Upstream"] != "orders" {
+		t.Errorf("expected the upstream headers, got %v", recordedOrders.Headers)
+	}
+	recordings, _ := filepath.Glob(filepath.Join(moduleDir, "recordings", "upstream", "*"+RecordedStubSuffix))
+	if len(recordings) != 2 {
+		t.Fatalf("expected 2 recorded stubs, got %v", recordings)
+	}
+
+	// restart in replay; the upstream is gone
+	upstream.Close()
+	replayer := loadTestProxyModule(t, moduleDir, map[string]interface{}{"mode": ProxyModeReplay})
+	replayedOrders := doTestProxyAction(replayer, http.MethodGet, "/upstream/orders?tag=a&tag=b&view=full", nil)
+	if replayedOrders.Status != http.StatusOK || replayedOrders.Headers["X-Upstream"] != "orders" || replayedOrders.Headers["Content-Type"] != "application/json" {
+		t.Errorf("expected the recorded status and headers, got %v %v", replayedOrders.Status, replayedOrders.Headers)
+	}
+	if body := decodeTestProxyBody(t, replayedOrders.Body); !reflect.DeepEqual(body, expectedOrders) {
+		t.Errorf("expected the recorded json body, got %v", body)
+	}
+	replayedImage := doTestProxyAction(replayer, http.MethodGet, "/upstream/image", nil)
+	if bArrBody, _ := replayedImage.Body.([]byte); !bytes.Equal(bArrBody, testProxyBinaryBody) {
+		t.Errorf("expected the recorded binary body, got %v", replayedImage.Body)
+	}
+	// every value of a multi-valued query parameter was recorded
+	for _, target := range []string{"/upstream/orders?tag=a&view=full", "/upstream/orders?tag=b&tag=a&view=full", "/upstream/orders?tag=a&tag=b"} {
+		if response := doTestProxyAction(replayer, http.MethodGet, target, nil); response.Status != http.StatusNotFound {
+			t.Errorf("%v: expected no recorded stub to match, got %v", target, response.Status)
+		}
+	}
+}
+
+func TestProxyRecordedBinaryBodyIsBase64(t *testing.T) {
+	moduleDir, err := ioutil.TempDir("", "echogogo-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(moduleDir)
+	upstream := newTestProxyUpstream(t)
+	defer upstream.Close()
+
+	recorder := loadTestProxyModule(t, moduleDir, map[string]interface{}{"targetBaseUrl": upstream.URL + "/v1", "mode": ProxyModeRecord})
+	doTestProxyAction(recorder, http.MethodGet, "/upstream/image", nil)
+	stubs, err := recorder.Proxy.loadRecordedStubs()
+	if err != nil || len(stubs) != 1 {
+		t.Fatalf("expected 1 recorded stub, got %v (%v)", len(stubs), err)
+	}
+	if stubs[0].Response.Body != nil || stubs[0].Response.BodyBase64 == "" {
+		t.Errorf("expected the binary body recorded as bodyBase64, got body %v", stubs[0].Response.Body)
+	}
+}
+
+func TestProxyUpstreamFailureIs502(t *testing.T) {
+	moduleDir, err := ioutil.TempDir("", "echogogo-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(moduleDir)
+	// nothing listens any more
+	upstream := newTestProxyUpstream(t)
+	upstream.Close()
+
+	for _, mode := range []string{ProxyModeRecord, ProxyModePassthrough} {
+		moduleConfig := loadTestProxyModule(t, moduleDir, map[string]interface{}{"targetBaseUrl": upstream.URL, "mode": mode, "timeoutMs": 2000})
+		response := doTestProxyAction(moduleConfig, http.MethodGet, "/upstream/orders", nil)
+		if response.Status != http.StatusBadGateway {
+			t.Errorf("%v: expected 502, got %v", mode, response.Status)
+		}
+		if body, _ := response.Body.(map[string]interface{}); body == nil || fmt.Sprint(body["error"]) == "" {
+			t.Errorf("%v: expected the error in the body, got %v", mode, response.Body)
+		}
+	}
+	recordings, _ := filepath.Glob(filepath.Join(moduleDir, "recordings", "upstream", "*"))
+	if len(recordings) != 0 {
+		t.Errorf("a failed exchange must not be recorded, got %v", recordings)
+	}
+}
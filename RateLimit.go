@@ -0,0 +1,338 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// what the buckets of a rate limit are keyed by
+const (
+	RateLimitKeyIp     = "ip"
+	RateLimitKeyHeader = "header"
+	RateLimitKeyApiKey = "apiKey"
+)
+
+// buckets kept per rate limit before the least recently used ones are dropped
+const maxRateLimitBuckets = 10000
+
+// structure of a rate limit (token bucket); applies to a whole module or to a single endpoint of it
+type RateLimitConfig struct {
+	Id            string  `json:"id" description:"unique id (generated if missing)"`
+	Module        string  `json:"module" description:"webservice path of the module e.g. /orders"`
+	Endpoint      string  `json:"endpoint" description:"optional endpoint in the GetRestConfig format e.g. GET::/{id}; empty means every endpoint"`
+	Disabled      bool    `json:"disabled" description:"keep the rate limit but don't apply it"`
+	Limit         int     `json:"limit" description:"requests allowed per period"`
+	PeriodSeconds float64 `json:"periodSeconds" description:"period the limit refills over (default 1)"`
+	Burst         int     `json:"burst" description:"bucket capacity i.e. requests allowed at once (default limit)"`
+	KeyBy         string  `json:"keyBy" description:"ip (default), header or apiKey; each client gets its own bucket"`
+	Header        string  `json:"header" description:"header naming the client for keyBy header e.g. X-Tenant"`
+}
+
+// structure of a client's bucket
+type tokenBucket struct {
+	clientKey string
+	tokens    float64
+	updatedAt time.Time
+}
+
+// structure of the buckets of a rate limit; the least recently used one is dropped once maxRateLimitBuckets are kept
+type tokenBuckets struct {
+	byClientKey  map[string]*list.Element // client key => element of recentlyUsed holding the *tokenBucket
+	recentlyUsed *list.List               // most recently used first
+}
+
+// structure of the outcome of taking a token
+type rateLimitDecision struct {
+	isAllowed  bool
+	limit      int
+	remaining  int
+	retryAfter time.Duration // until the next token (rejected requests only)
+	resetAfter time.Duration // until the bucket is full again
+}
+
+// registry of the rate limits and their buckets; changed at runtime through the admin api
+type RateLimitRegistry struct {
+	lock       sync.Mutex
+	rateLimits idRegistry
+	buckets    map[string]*tokenBuckets // rate limit id => buckets of its clients
+}
+
+// ctor. Create instance of *RateLimitRegistry
+func NewRateLimitRegistry() *RateLimitRegistry {
+	registry := new(RateLimitRegistry)
+	registry.rateLimits = idRegistry{kind: "rate limit", idPrefix: "ratelimit-"}
+	registry.rateLimits.reset()
+	registry.buckets = make(map[string]*tokenBuckets)
+
+	return registry
+}
+
+// method to validate and fill in the defaults of the rate limit
+func (l *RateLimitConfig) Validate() error {
+	if err := l.selector().validate(); err != nil {
+		return fmt.Errorf("rate limit [%v]: %v", l.Id, err)
+	}
+	if l.Limit < 1 {
+		return fmt.Errorf("rate limit [%v]: limit must be positive => %v", l.Id, l.Limit)
+	}
+	if l.PeriodSeconds == 0 {
+		l.PeriodSeconds = 1
+	}
+	if l.PeriodSeconds < 0 {
+		return fmt.Errorf("rate limit [%v]: periodSeconds must be positive => %v", l.Id, l.PeriodSeconds)
+	}
+	if l.Burst == 0 {
+		l.Burst = l.Limit
+	}
+	if l.Burst < 1 {
+		return fmt.Errorf("rate limit [%v]: burst must be positive => %v", l.Id, l.Burst)
+	}
+	switch l.KeyBy {
+	case "":
+		l.KeyBy = RateLimitKeyIp
+	case RateLimitKeyIp, RateLimitKeyApiKey:
+	case RateLimitKeyHeader:
+		if l.Header == "" {
+			return fmt.Errorf("rate limit [%v]: header is required for keyBy header", l.Id)
+		}
+	default:
+		return fmt.Errorf("rate limit [%v]: keyBy must be ip, header or apiKey => %v", l.Id, l.KeyBy)
+	}
+	return nil
+}
+
+// method to get the id of the rate limit (idRegistry entry)
+func (l *RateLimitConfig) getId() string {
+	return l.Id
+}
+
+// method to set the id of the rate limit (idRegistry entry)
+func (l *RateLimitConfig) setId(id string) {
+	l.Id = id
+}
+
+// method to get what the rate limit applies to
+func (l *RateLimitConfig) selector() EndpointSelector {
+	return EndpointSelector{Module: l.Module, Endpoint: l.Endpoint}
+}
+
+// method to check if the rate limit is kept but not applied
+func (l *RateLimitConfig) isDisabled() bool {
+	return l.Disabled
+}
+
+// method to replace all rate limits (e.g. from the config file)
+func (r *RateLimitRegistry) Load(rateLimits []RateLimitConfig) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.rateLimits.reset()
+	r.buckets = make(map[string]*tokenBuckets)
+	for idx := range rateLimits {
+		rateLimit := rateLimits[idx]
+		if err := r.rateLimits.add(&rateLimit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// method to add a rate limit; returns the rate limit with its id
+func (r *RateLimitRegistry) Add(rateLimit RateLimitConfig) (RateLimitConfig, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.rateLimits.add(&rateLimit)
+	return rateLimit, err
+}
+
+// method to replace the rate limit with the given id; its clients start with full buckets
+func (r *RateLimitRegistry) Replace(id string, rateLimit RateLimitConfig) (RateLimitConfig, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.rateLimits.replace(id, &rateLimit); err != nil {
+		return rateLimit, err
+	}
+	delete(r.buckets, id)
+	return rateLimit, nil
+}
+
+// method to remove the rate limit with the given id
+func (r *RateLimitRegistry) Remove(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.rateLimits.remove(id); err != nil {
+		return err
+	}
+	delete(r.buckets, id)
+	return nil
+}
+
+// method to refill every bucket (e.g. between test cases)
+func (r *RateLimitRegistry) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.buckets = make(map[string]*tokenBuckets)
+}
+
+// method to return a copy of all rate limits
+func (r *RateLimitRegistry) List() []RateLimitConfig {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rateLimits := make([]RateLimitConfig, 0, len(r.rateLimits.entries))
+	for _, entry := range r.rateLimits.entries {
+		rateLimits = append(rateLimits, *entry.(*RateLimitConfig))
+	}
+	return rateLimits
+}
+
+// method to find the rate limit for the request (an endpoint rate limit wins over a module wide one) and take
+// a token out of the client's bucket; clientKeyOf names the client for the found rate limit. The bucket refills
+// continuously at limit / period. Returns a copy of the rate limit, nil if none applies
+func (r *RateLimitRegistry) Take(modulePath string, method string, routePath string, clientKeyOf func(rateLimit *RateLimitConfig) string, now time.Time) (*RateLimitConfig, rateLimitDecision) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rateLimit, ok := r.rateLimits.find(modulePath, method, routePath).(*RateLimitConfig)
+	if !ok {
+		return nil, rateLimitDecision{}
+	}
+	matched := *rateLimit
+	bucket := r._bucketOf(&matched, clientKeyOf(&matched), now)
+
+	capacity := float64(matched.Burst)
+	tokensPerSecond := float64(matched.Limit) / matched.PeriodSeconds
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*tokensPerSecond)
+	bucket.updatedAt = now
+
+	decision := rateLimitDecision{limit: matched.Limit}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		decision.isAllowed = true
+	} else {
+		decision.retryAfter = _secondsToDuration((1 - bucket.tokens) / tokensPerSecond)
+	}
+	decision.remaining = int(math.Floor(bucket.tokens))
+	decision.resetAfter = _secondsToDuration((capacity - bucket.tokens) / tokensPerSecond)
+
+	return &matched, decision
+}
+
+// method to get the client's bucket (marked as the most recently used one); a new client starts with a full
+// bucket, dropping the least recently used one if maxRateLimitBuckets are kept already. The lock is held
+func (r *RateLimitRegistry) _bucketOf(rateLimit *RateLimitConfig, clientKey string, now time.Time) *tokenBucket {
+	buckets, ok := r.buckets[rateLimit.Id]
+	if !ok {
+		buckets = &tokenBuckets{byClientKey: make(map[string]*list.Element), recentlyUsed: list.New()}
+		r.buckets[rateLimit.Id] = buckets
+	}
+	if element, ok := buckets.byClientKey[clientKey]; ok {
+		buckets.recentlyUsed.MoveToFront(element)
+		return element.Value.(*tokenBucket)
+	}
+	if buckets.recentlyUsed.Len() >= maxRateLimitBuckets {
+		leastRecentlyUsed := buckets.recentlyUsed.Back()
+		buckets.recentlyUsed.Remove(leastRecentlyUsed)
+		delete(buckets.byClientKey, leastRecentlyUsed.Value.(*tokenBucket).clientKey)
+	}
+	bucket := &tokenBucket{clientKey: clientKey, tokens: float64(rateLimit.Burst), updatedAt: now}
+	buckets.byClientKey[clientKey] = buckets.recentlyUsed.PushFront(bucket)
+	return bucket
+}
+
+// method to apply the module's (or endpoint's) rate limit; the X-RateLimit-* headers are set on every
+// limited response, requests over the limit are answered with 429 and Retry-After. Returns false if rejected
+func (srv *Server) _applyRateLimit(modulePtr *EchoModule, request *restful.Request, response *restful.Response, logger Logger) bool {
+	routePath := request.SelectedRoutePath()
+	clientKey := ""
+	rateLimit, decision := srv.rateLimits.Take(modulePtr.WebservicePath, request.Request.Method, routePath, func(rateLimit *RateLimitConfig) string {
+		clientKey = srv._rateLimitClientKey(rateLimit, modulePtr, request)
+		return clientKey
+	}, time.Now())
+	if rateLimit == nil {
+		return true
+	}
+
+	response.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.limit))
+	response.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.remaining))
+	response.Header().Set("X-RateLimit-Reset", strconv.Itoa(_ceilSeconds(decision.resetAfter)))
+	if decision.isAllowed {
+		return true
+	}
+	logger.Log(fmt.Sprintf("rate limit [%v] exceeded by %v", rateLimit.Id, clientKey), LogLevelDebug, "", "")
+	response.Header().Set("Retry-After", strconv.Itoa(_ceilSeconds(decision.retryAfter)))
+	srv.setCorsHeaders(request.Request, response)
+	response.Header().Set("Content-Type", restful.MIME_JSON)
+	response.WriteHeader(http.StatusTooManyRequests)
+	bArrBody, _ := json.Marshal(map[string]string{"error": "too_many_requests", "error_description": fmt.Sprintf("rate limit [%v] exceeded", rateLimit.Id)})
+	response.Write(bArrBody)
+
+	return false
+}
+
+// method to get the key of the client's bucket; requests without the header / api key share one bucket
+func (srv *Server) _rateLimitClientKey(rateLimit *RateLimitConfig, modulePtr *EchoModule, request *restful.Request) string {
+	switch rateLimit.KeyBy {
+	case RateLimitKeyHeader:
+		return request.Request.Header.Get(rateLimit.Header)
+	case RateLimitKeyApiKey:
+		// where the module's auth expects the api key; X-API-Key otherwise
+		apiKeyConfig := &ApiKeyConfig{Header: DefaultApiKeyHeader}
+		if policy := srv._findAuthPolicy(modulePtr.WebservicePath, request.Request.Method, request.SelectedRoutePath()); policy != nil && policy.config.ApiKey != nil {
+			apiKeyConfig = policy.config.ApiKey
+		}
+		apiKey := ""
+		if apiKeyConfig.Header != "" {
+			apiKey = request.Request.Header.Get(apiKeyConfig.Header)
+		}
+		if apiKey == "" && apiKeyConfig.Query != "" {
+			apiKey = request.Request.URL.Query().Get(apiKeyConfig.Query)
+		}
+		return apiKey
+	}
+	host, _, err := net.SplitHostPort(request.Request.RemoteAddr)
+	if err != nil {
+		return request.Request.RemoteAddr
+	}
+	return host
+}
+
+// method to convert (non negative) seconds into a duration
+func _secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Max(0, seconds) * float64(time.Second))
+}
+
+// method to round a duration up to whole seconds (Retry-After and X-RateLimit-Reset are in seconds)
+func _ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,132 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitBurstAndRefill(t *testing.T) {
+	registry := NewRateLimitRegistry()
+	// 2 requests per second, up to 4 at once
+	if _, err := registry.Add(RateLimitConfig{Id: "orders", Module: "/orders", Limit: 2, Burst: 4}); err != nil {
+		t.Fatal(err)
+	}
+	take := func(client string, now time.Time) (*RateLimitConfig, rateLimitDecision) {
+		return registry.Take("/orders", "GET", "/orders/{id}", func(*RateLimitConfig) string { return client }, now)
+	}
+	start := time.Now()
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+	testCases := []struct {
+		name       string
+		client     string
+		now        time.Time
+		isAllowed  bool
+		remaining  int
+		retryAfter time.Duration
+		resetAfter time.Duration
+	}{
+		{"burst 1", "a", at(0), true, 3, 0, 500 * time.Millisecond},
+		{"burst 2", "a", at(0), true, 2, 0, time.Second},
+		{"burst 3", "a", at(0), true, 1, 0, 1500 * time.Millisecond},
+		{"burst 4", "a", at(0), true, 0, 0, 2 * time.Second},
+		{"bucket empty", "a", at(0), false, 0, 500 * time.Millisecond, 2 * time.Second},
+		{"half a token later", "a", at(250), false, 0, 250 * time.Millisecond, 1750 * time.Millisecond},
+		{"a token later", "a", at(500), true, 0, 0, 2 * time.Second},
+		{"other clients have their own bucket", "b", at(500), true, 3, 0, 500 * time.Millisecond},
+		// refilled up to the burst, not beyond
+		{"idle for a minute", "a", at(60500), true, 3, 0, 500 * time.Millisecond},
+	}
+	for _, testCase := range testCases {
+		rateLimit, decision := take(testCase.client, testCase.now)
+		if rateLimit == nil || rateLimit.Id != "orders" {
+			t.Fatalf("%v: expected the orders rate limit, got %v", testCase.name, rateLimit)
+		}
+		if decision.isAllowed != testCase.isAllowed || decision.remaining != testCase.remaining || decision.limit != 2 ||
+			decision.retryAfter != testCase.retryAfter || decision.resetAfter != testCase.resetAfter {
+			t.Errorf("%v: expected allowed=%v remaining=%v retryAfter=%v resetAfter=%v, got %+v", testCase.name,
+				testCase.isAllowed, testCase.remaining, testCase.retryAfter, testCase.resetAfter, decision)
+		}
+	}
+	// Reset refills every bucket; Replace the buckets of the rate limit
+	registry.Reset()
+	if _, decision := take("a", at(60500)); decision.remaining != 3 {
+		t.Errorf("expected a full bucket after reset, got %+v", decision)
+	}
+	registry.Replace("orders", RateLimitConfig{Module: "/orders", Limit: 1, PeriodSeconds: 60})
+	if _, decision := take("a", at(60500)); !decision.isAllowed || decision.remaining != 0 || decision.resetAfter != time.Minute {
+		t.Errorf("expected a new bucket of 1 per minute, got %+v", decision)
+	}
+}
+
+func TestRateLimitDropsTheLeastRecentlyUsedBucket(t *testing.T) {
+	registry := NewRateLimitRegistry()
+	if _, err := registry.Add(RateLimitConfig{Id: "orders", Module: "/orders", Limit: 1, PeriodSeconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	take := func(client string) rateLimitDecision {
+		_, decision := registry.Take("/orders", "GET", "/orders", func(*RateLimitConfig) string { return client }, now)
+		return decision
+	}
+	for idx := 0; idx < maxRateLimitBuckets; idx++ {
+		take(strconv.Itoa(idx))
+	}
+	// client 0 is used again, so client 1 is the least recently used one once a new client comes in
+	if decision := take("0"); decision.isAllowed {
+		t.Fatalf("expected the bucket of client 0 empty, got %+v", decision)
+	}
+	take("new")
+	if count := len(registry.buckets["orders"].byClientKey); count != maxRateLimitBuckets {
+		t.Errorf("expected %v buckets kept, got %v", maxRateLimitBuckets, count)
+	}
+	if decision := take("0"); decision.isAllowed {
+		t.Errorf("expected the bucket of client 0 kept, got %+v", decision)
+	}
+	if decision := take("1"); !decision.isAllowed {
+		t.Errorf("expected the bucket of client 1 dropped (a full one again), got %+v", decision)
+	}
+}
+
+func TestRateLimitValidate(t *testing.T) {
+	testCases := []struct {
+		rateLimit RateLimitConfig
+		err       string
+	}{
+		{RateLimitConfig{Id: "a", Module: "/orders", Limit: 0}, "rate limit [a]: limit must be positive => 0"},
+		{RateLimitConfig{Id: "a", Module: "/orders", Limit: 1, PeriodSeconds: -1}, "rate limit [a]: periodSeconds must be positive => -1"},
+		{RateLimitConfig{Id: "a", Module: "/orders", Limit: 1, KeyBy: RateLimitKeyHeader}, "rate limit [a]: header is required for keyBy header"},
+		{RateLimitConfig{Id: "a", Module: "/orders", Limit: 1, KeyBy: "cookie"}, "rate limit [a]: keyBy must be ip, header or apiKey => cookie"},
+		{RateLimitConfig{Id: "a", Module: "/orders", Endpoint: "GET", Limit: 1}, "rate limit [a]: invalid endpoint, format is [http_verb]::[target_path] => GET"},
+		{RateLimitConfig{Id: "a", Module: "/orders", Endpoint: "FETCH::/{id}", Limit: 1}, "rate limit [a]: unknown http verb [FETCH] in endpoint => FETCH::/{id}"},
+	}
+	for _, testCase := range testCases {
+		if err := testCase.rateLimit.Validate(); err == nil || err.Error() != testCase.err {
+			t.Errorf("expected %q, got %v", testCase.err, err)
+		}
+	}
+	rateLimit := RateLimitConfig{Id: "a", Module: "/orders", Limit: 10}
+	if err := rateLimit.Validate(); err != nil || rateLimit.Burst != 10 || rateLimit.PeriodSeconds != 1 || rateLimit.KeyBy != RateLimitKeyIp {
+		t.Errorf("expected the defaults filled in, got %+v (%v)", rateLimit, err)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"time"
+)
+
+// header carrying the id of a request; accepted from the caller or generated
+const HeaderRequestId = "X-Request-ID"
+
+// request attribute holding the request id
+const requestIdRequestAttribute = "echogogo.requestId"
+
+// max length of an accepted X-Request-ID; longer (or non printable) ids are replaced
+const maxRequestIdLength = 128
+
+// setup the request id filter; goes first so every other filter (and the access log) sees the id
+func (srv *Server) setupRequestId(wsContainer *restful.Container) {
+	wsContainer.Filter(srv._requestIdFilter)
+}
+
+// container filter accepting (or generating) the X-Request-ID, setting it on the response and
+// writing the access log line of the request
+func (srv *Server) _requestIdFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	startTime := time.Now()
+	requestId := request.Request.Header.Get(HeaderRequestId)
+	if !_isValidRequestId(requestId) {
+		requestId = NewRequestId()
+	}
+	request.SetAttribute(requestIdRequestAttribute, requestId)
+	response.Header().Set(HeaderRequestId, requestId)
+	// the request's logger travels with its context (see LoggerFromContext)
+	request.Request = request.Request.WithContext(ContextWithLogger(request.Request.Context(), srv.logger.WithRequestId(requestId)))
+
+	chain.ProcessFilter(request, response)
+
+	if srv.configContentJson.Logging.AccessLog {
+		logger := srv._requestLogger(request)
+		logger.Log(fmt.Sprintf("%v %v %v %vB %vms", request.Request.Method, request.Request.URL.RequestURI(),
+			response.StatusCode(), response.ContentLength(), time.Since(startTime).Nanoseconds()/int64(time.Millisecond)),
+			LogLevelInfo, "Server", "AccessLog")
+	}
+}
+
+// method to get the logger of the request; every line carries the request id
+func (srv *Server) _requestLogger(request *restful.Request) Logger {
+	if logger, ok := LoggerFromContext(request.Request.Context()); ok {
+		return logger
+	}
+	return srv.logger
+}
+
+// method to generate a request id (a random uuid v4)
+func NewRequestId() string {
+	bArrId := make([]byte, 16)
+	if _, err := rand.Read(bArrId); err != nil {
+		return _newTraceId(16)
+	}
+	bArrId[6] = bArrId[6]&0x0f | 0x40
+	bArrId[8] = bArrId[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bArrId[0:4], bArrId[4:6], bArrId[6:8], bArrId[8:10], bArrId[10:])
+}
+
+// method to check the request id given by the caller can be used (and logged) as is
+func _isValidRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+	for _, char := range requestId {
+		// visible ascii only; no spaces or control characters
+		if char <= ' ' || char > '~' {
+			return false
+		}
+	}
+	return true
+}
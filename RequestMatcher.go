@@ -0,0 +1,384 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// structure of a value matcher; every operator given must hold (e.g. contains + matches)
+type ValueMatcher struct {
+	EqualTo         *string  `json:"equalTo,omitempty" description:"value must be equal to"`
+	EqualToAll      []string `json:"equalToAll,omitempty" description:"the values (of a multi-valued parameter) must be exactly these, in order"`
+	Contains        string   `json:"contains,omitempty" description:"value must contain"`
+	Matches         string   `json:"matches,omitempty" description:"value must match the regular expression"`
+	Absent          bool     `json:"absent,omitempty" description:"value must NOT be present"`
+	CaseInsensitive bool     `json:"caseInsensitive,omitempty" description:"equalTo, equalToAll and contains ignore the case"`
+
+	pattern *regexp.Regexp
+}
+
+// structure of a body pattern; the value matcher applies to the value(s) found by jsonPath / xPath
+// or to the whole body if neither is given
+type BodyPattern struct {
+	JsonPath string `json:"jsonPath,omitempty" description:"json path into a json body e.g. $.customer.id"`
+	XPath    string `json:"xPath,omitempty" description:"xpath into a xml body e.g. /order/id"`
+	ValueMatcher
+}
+
+// structure of the request matching rules of a stub
+type RequestMatchConfig struct {
+	UrlPath         *ValueMatcher            `json:"urlPath,omitempty" description:"rule on the actual path e.g. /orders/42"`
+	QueryParameters map[string]*ValueMatcher `json:"queryParameters,omitempty"`
+	Headers         map[string]*ValueMatcher `json:"headers,omitempty"`
+	Cookies         map[string]*ValueMatcher `json:"cookies,omitempty"`
+	BodyPatterns    []*BodyPattern           `json:"bodyPatterns,omitempty"`
+}
+
+// structure holding the outcome of evaluating a stub against a request
+type MatchResult struct {
+	Matched    int      `json:"matched"`
+	Total      int      `json:"total"`
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// structure wrapping the parts of a request that the matchers (and templates) look at;
+// the body is read once and put back on the request
+type RequestData struct {
+	Method         string
+	Path           string
+	PathParameters map[string]string
+	Query          url.Values
+	Headers        http.Header
+	Cookies        map[string]string
+	Body           []byte
+
+	jsonBody   interface{}
+	jsonErr    error
+	jsonParsed bool
+	xmlBody    *XmlNode
+	xmlErr     error
+	xmlParsed  bool
+}
+
+// ctor. Create instance of *RequestData
+func NewRequestData(request *http.Request, pathParameters map[string]string) *RequestData {
+	data := new(RequestData)
+	data.Method = request.Method
+	data.Path = request.URL.Path
+	data.PathParameters = pathParameters
+	if data.PathParameters == nil {
+		data.PathParameters = make(map[string]string)
+	}
+	data.Query = request.URL.Query()
+	data.Headers = request.Header
+	data.Cookies = make(map[string]string)
+	for _, cookie := range request.Cookies() {
+		data.Cookies[cookie.Name] = cookie.Value
+	}
+	if request.Body != nil {
+		bArrBody, err := ioutil.ReadAll(request.Body)
+		if err == nil {
+			data.Body = bArrBody
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(data.Body))
+	}
+	return data
+}
+
+// method to get the body decoded as json (decoded once, on demand)
+func (d *RequestData) JsonBody() (interface{}, error) {
+	if !d.jsonParsed {
+		d.jsonParsed = true
+		d.jsonErr = json.Unmarshal(d.Body, &d.jsonBody)
+	}
+	return d.jsonBody, d.jsonErr
+}
+
+// method to get the body parsed as xml (parsed once, on demand)
+func (d *RequestData) XmlBody() (*XmlNode, error) {
+	if !d.xmlParsed {
+		d.xmlParsed = true
+		d.xmlBody, d.xmlErr = ParseXmlDocument(d.Body)
+	}
+	return d.xmlBody, d.xmlErr
+}
+
+// method to validate the matching rules and pre-compile the regular expressions
+func (c *RequestMatchConfig) Compile() error {
+	if c.UrlPath != nil {
+		if err := c.UrlPath.compile(); err != nil {
+			return fmt.Errorf("url path: %v", err)
+		}
+	}
+	for name, matcher := range c.QueryParameters {
+		if err := matcher.compile(); err != nil {
+			return fmt.Errorf("query parameter [%v]: %v", name, err)
+		}
+	}
+	for name, matcher := range c.Headers {
+		if err := matcher.compile(); err != nil {
+			return fmt.Errorf("header [%v]: %v", name, err)
+		}
+	}
+	for name, matcher := range c.Cookies {
+		if err := matcher.compile(); err != nil {
+			return fmt.Errorf("cookie [%v]: %v", name, err)
+		}
+	}
+	for idx, pattern := range c.BodyPatterns {
+		if pattern.JsonPath != "" && pattern.XPath != "" {
+			return fmt.Errorf("body pattern #%v: only one of jsonPath or xPath can be given", idx)
+		}
+		if pattern.JsonPath != "" {
+			if _, err := _parseJsonPath(pattern.JsonPath); err != nil {
+				return fmt.Errorf("body pattern #%v: %v", idx, err)
+			}
+		}
+		if pattern.XPath != "" {
+			if _, err := _parseXPath(pattern.XPath); err != nil {
+				return fmt.Errorf("body pattern #%v: %v", idx, err)
+			}
+		}
+		if err := pattern.ValueMatcher.compile(); err != nil {
+			return fmt.Errorf("body pattern #%v: %v", idx, err)
+		}
+	}
+	return nil
+}
+
+// method to evaluate every rule against the request; each rule counts as one criterion
+func (c *RequestMatchConfig) Evaluate(data *RequestData) MatchResult {
+	var result MatchResult
+	if c.UrlPath != nil {
+		values := []string{data.Path}
+		result.record(c.UrlPath.matchValues(values, true), fmt.Sprintf("url path: expected %v but was %v", c.UrlPath, _describeValues(values, true)))
+	}
+	for name, matcher := range c.QueryParameters {
+		values, present := data.Query[name]
+		result.record(matcher.matchValues(values, present), fmt.Sprintf("query parameter [%v]: expected %v but was %v", name, matcher, _describeValues(values, present)))
+	}
+	for name, matcher := range c.Headers {
+		values, present := data.Headers[http.CanonicalHeaderKey(name)]
+		result.record(matcher.matchValues(values, present), fmt.Sprintf("header [%v]: expected %v but was %v", name, matcher, _describeValues(values, present)))
+	}
+	for name, matcher := range c.Cookies {
+		value, present := data.Cookies[name]
+		values := []string{}
+		if present {
+			values = append(values, value)
+		}
+		result.record(matcher.matchValues(values, present), fmt.Sprintf("cookie [%v]: expected %v but was %v", name, matcher, _describeValues(values, present)))
+	}
+	for _, pattern := range c.BodyPatterns {
+		values, present, err := pattern.extract(data)
+		if err != nil {
+			result.record(false, fmt.Sprintf("body %v: %v", pattern.describeTarget(), err))
+			continue
+		}
+		result.record(pattern.ValueMatcher.matchValues(values, present), fmt.Sprintf("body %v: expected %v but was %v", pattern.describeTarget(), &pattern.ValueMatcher, _describeValues(values, present)))
+	}
+	return result
+}
+
+// method to count a criterion and remember the reason if it failed
+func (r *MatchResult) record(isMatched bool, mismatch string) {
+	r.Total++
+	if isMatched {
+		r.Matched++
+	} else {
+		r.Mismatches = append(r.Mismatches, mismatch)
+	}
+}
+
+// method to check if every criterion matched
+func (r *MatchResult) IsMatch() bool {
+	return r.Matched == r.Total
+}
+
+// method to get the share of matched criteria; used to find the closest near-miss
+func (r *MatchResult) Score() float64 {
+	if r.Total == 0 {
+		return 1
+	}
+	return float64(r.Matched) / float64(r.Total)
+}
+
+// method to pick the value(s) the body pattern looks at
+func (p *BodyPattern) extract(data *RequestData) (values []string, present bool, err error) {
+	switch {
+	case p.JsonPath != "":
+		document, err := data.JsonBody()
+		if err != nil {
+			return nil, false, fmt.Errorf("body is not valid json (%v)", err)
+		}
+		nodes, err := EvaluateJsonPath(document, p.JsonPath)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, node := range nodes {
+			values = append(values, JsonValueToString(node))
+		}
+		return values, len(values) > 0, nil
+	case p.XPath != "":
+		document, err := data.XmlBody()
+		if err != nil {
+			return nil, false, fmt.Errorf("body is not valid xml (%v)", err)
+		}
+		values, err = EvaluateXPath(document, p.XPath)
+		if err != nil {
+			return nil, false, err
+		}
+		return values, len(values) > 0, nil
+	default:
+		return []string{string(data.Body)}, len(data.Body) > 0, nil
+	}
+}
+
+// method to describe what part of the body the pattern looks at
+func (p *BodyPattern) describeTarget() string {
+	switch {
+	case p.JsonPath != "":
+		return fmt.Sprintf("jsonPath [%v]", p.JsonPath)
+	case p.XPath != "":
+		return fmt.Sprintf("xPath [%v]", p.XPath)
+	default:
+		return "content"
+	}
+}
+
+// method to pre-compile the regular expression
+func (m *ValueMatcher) compile() error {
+	if m.Matches != "" {
+		pattern, err := regexp.Compile(m.Matches)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression [%v]: %v", m.Matches, err)
+		}
+		m.pattern = pattern
+	}
+	return nil
+}
+
+// method to match the value(s); a multi-valued parameter matches if any of its values matches.
+// A matcher without any operator only checks the value is present.
+func (m *ValueMatcher) matchValues(values []string, present bool) bool {
+	if m.Absent {
+		return !present
+	}
+	if !present {
+		return false
+	}
+	if m.EqualToAll != nil {
+		if len(values) != len(m.EqualToAll) {
+			return false
+		}
+		for idx, value := range values {
+			if !m._isEqual(value, m.EqualToAll[idx]) || !m.matchValue(value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		if m.matchValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// method to match a single value against every operator given
+func (m *ValueMatcher) matchValue(value string) bool {
+	if m.EqualTo != nil && !m._isEqual(value, *m.EqualTo) {
+		return false
+	}
+	if m.Contains != "" {
+		if m.CaseInsensitive && !strings.Contains(strings.ToLower(value), strings.ToLower(m.Contains)) {
+			return false
+		}
+		if !m.CaseInsensitive && !strings.Contains(value, m.Contains) {
+			return false
+		}
+	}
+	if m.Matches != "" {
+		if m.pattern == nil {
+			// not compiled through RequestMatchConfig.Compile (e.g. built in code)
+			if err := m.compile(); err != nil {
+				return false
+			}
+		}
+		if !m.pattern.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// method to compare the values; ignoring the case if caseInsensitive
+func (m *ValueMatcher) _isEqual(value string, expected string) bool {
+	if m.CaseInsensitive {
+		return strings.EqualFold(value, expected)
+	}
+	return value == expected
+}
+
+// method to describe the matcher in a near-miss report
+func (m *ValueMatcher) String() string {
+	parts := make([]string, 0)
+	if m.Absent {
+		parts = append(parts, "absent")
+	}
+	if m.EqualTo != nil {
+		parts = append(parts, fmt.Sprintf("equalTo [%v]", *m.EqualTo))
+	}
+	if m.EqualToAll != nil {
+		parts = append(parts, fmt.Sprintf("equalToAll %v", m.EqualToAll))
+	}
+	if m.Contains != "" {
+		parts = append(parts, fmt.Sprintf("contains [%v]", m.Contains))
+	}
+	if m.Matches != "" {
+		parts = append(parts, fmt.Sprintf("matches [%v]", m.Matches))
+	}
+	if len(parts) == 0 {
+		return "present"
+	}
+	if m.CaseInsensitive {
+		parts = append(parts, "(case insensitive)")
+	}
+	return strings.Join(parts, " ")
+}
+
+// method to describe the actual value(s) in a near-miss report
+func _describeValues(values []string, present bool) string {
+	if !present {
+		return "absent"
+	}
+	if len(values) == 1 {
+		return fmt.Sprintf("[%v]", values[0])
+	}
+	return fmt.Sprintf("%v", values)
+}
@@ -0,0 +1,185 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// json document of the path tests
+const testJsonPathDocument = `{"id": 7, "customer": {"id": "c-1", "x-key": true}, "items": [{"sku": "A1", "qty": 1}, {"sku": "B2", "qty": 2}]}`
+
+// xml document of the path tests
+const testXPathDocument = `<order id="7"><customer>alice</customer><item type="book"><title>Go</title></item><item type="pen"><title>Blue</title></item></order>`
+
+func TestEvaluateJsonPath(t *testing.T) {
+	document := decodeTestJson(t, testJsonPathDocument)
+	testCases := []struct {
+		expression string
+		expected   []string
+		err        string
+	}{
+		{"$.id", []string{"7"}, ""},
+		{"$.customer.id", []string{"c-1"}, ""},
+		{"$['customer']['x-key']", []string{"true"}, ""},
+		{"$.items[1].sku", []string{"B2"}, ""},
+		{"$.items[-1].qty", []string{"2"}, ""},
+		{"$.items[*].sku", []string{"A1", "B2"}, ""},
+		{"$..id", []string{"7", "c-1"}, ""},
+		{"$.items[5]", []string{}, ""},
+		{"$.missing", []string{}, ""},
+		{"$.items[?(@.sku=='B2')]", nil, "filter / script expressions are not supported"},
+		{"$.items[0:1]", nil, "slices and unions are not supported"},
+		{"$.items[0,1]", nil, "slices and unions are not supported"},
+		{"items[0]", nil, "must start with $"},
+		{"$.items[0", nil, "missing ]"},
+	}
+	for _, testCase := range testCases {
+		nodes, err := EvaluateJsonPath(document, testCase.expression)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v: expected an error containing %q, got %v", testCase.expression, testCase.err, err)
+			}
+			continue
+		}
+		values := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			values = append(values, JsonValueToString(node))
+		}
+		if err != nil || !reflect.DeepEqual(values, testCase.expected) {
+			t.Errorf("%v: expected %v, got %v (%v)", testCase.expression, testCase.expected, values, err)
+		}
+	}
+}
+
+func TestEvaluateXPath(t *testing.T) {
+	document, err := ParseXmlDocument([]byte(testXPathDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		expression string
+		expected   []string
+		err        string
+	}{
+		{"/order/customer", []string{"alice"}, ""},
+		{"/order/@id", []string{"7"}, ""},
+		{"//title", []string{"Go", "Blue"}, ""},
+		{"/order/item[2]/title/text()", []string{"Blue"}, ""},
+		{"//item[@type='book']/title", []string{"Go"}, ""},
+		{"/order/*/title", []string{"Go", "Blue"}, ""},
+		{"/order/item[3]", []string{}, ""},
+		{"count(//item)", nil, "xpath functions are not supported"},
+		{"//item[contains(title, 'G')]", nil, "xpath functions and axes are not supported"},
+		{"/order/child::item", nil, "xpath functions and axes are not supported"},
+		{"/order/@id/text()", nil, "must be the last step"},
+		{"order", nil, "must start with / or //"},
+	}
+	for _, testCase := range testCases {
+		values, err := EvaluateXPath(document, testCase.expression)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v: expected an error containing %q, got %v", testCase.expression, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(values, testCase.expected) {
+			t.Errorf("%v: expected %v, got %v (%v)", testCase.expression, testCase.expected, values, err)
+		}
+	}
+}
+
+func TestRequestMatchConfigEvaluate(t *testing.T) {
+	equalTo := func(value string) *string {
+		return &value
+	}
+	matchConfig := &RequestMatchConfig{
+		UrlPath:         &ValueMatcher{Matches: `^/orders/\d+$`},
+		QueryParameters: map[string]*ValueMatcher{"view": {EqualTo: equalTo("FULL"), CaseInsensitive: true}, "debug": {Absent: true}},
+		Headers:         map[string]*ValueMatcher{"x-tenant": {Contains: "t-"}},
+		Cookies:         map[string]*ValueMatcher{"sid": {}},
+		BodyPatterns:    []*BodyPattern{{JsonPath: "$.items[*].sku", ValueMatcher: ValueMatcher{EqualTo: equalTo("B2")}}},
+	}
+	if err := matchConfig.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		target     string
+		header     http.Header
+		body       string
+		matched    int
+		mismatches []string
+	}{
+		{"everything matches", "/orders/42?view=full", http.Header{"X-Tenant": {"t-1"}, "Cookie": {"sid=abc"}}, testJsonPathDocument, 6, nil},
+		{"any value of a multi-valued parameter", "/orders/42?view=short&view=full", http.Header{"X-Tenant": {"t-1"}, "Cookie": {"sid=abc"}}, testJsonPathDocument, 6, nil},
+		{"absent rule", "/orders/42?view=full&debug=1", http.Header{"X-Tenant": {"t-1"}, "Cookie": {"sid=abc"}}, testJsonPathDocument, 5,
+			[]string{"query parameter [debug]: expected absent but was [1]"}},
+		{"url path and cookie", "/orders/abc?view=full", http.Header{"X-Tenant": {"t-1"}}, testJsonPathDocument, 4,
+			[]string{"cookie [sid]: expected present but was absent", `url path: expected matches [^/orders/\d+$] but was [/orders/abc]`}},
+		{"body not json", "/orders/42?view=full", http.Header{"X-Tenant": {"t-1"}, "Cookie": {"sid=abc"}}, "<order/>", 5,
+			[]string{"body jsonPath [$.items[*].sku]: body is not valid json (invalid character '<' looking for beginning of value)"}},
+		{"nothing matches", "/users", nil, `{}`, 1,
+			[]string{"body jsonPath [$.items[*].sku]: expected equalTo [B2] but was absent", "cookie [sid]: expected present but was absent",
+				"header [x-tenant]: expected contains [t-] but was absent", "query parameter [view]: expected equalTo [FULL] (case insensitive) but was absent",
+				`url path: expected matches [^/orders/\d+$] but was [/users]`}},
+	}
+	for _, testCase := range testCases {
+		request := httptest.NewRequest(http.MethodPost, testCase.target, strings.NewReader(testCase.body))
+		for key, values := range testCase.header {
+			request.Header[key] = values
+		}
+		result := matchConfig.Evaluate(NewRequestData(request, nil))
+		sort.Strings(result.Mismatches)
+		if result.Total != 6 || result.Matched != testCase.matched || !reflect.DeepEqual(result.Mismatches, testCase.mismatches) {
+			t.Errorf("%v: expected %v/6 %v, got %v/%v %v", testCase.name, testCase.matched, testCase.mismatches, result.Matched, result.Total, result.Mismatches)
+		}
+		if expectedScore := float64(testCase.matched) / 6; result.Score() != expectedScore || result.IsMatch() != (testCase.matched == 6) {
+			t.Errorf("%v: expected score %v, got %v", testCase.name, expectedScore, result.Score())
+		}
+	}
+	// nothing to evaluate is a full match
+	var empty MatchResult
+	if !empty.IsMatch() || empty.Score() != 1 {
+		t.Errorf("expected an empty result to match, got %v", empty.Score())
+	}
+}
+
+func TestRequestMatchConfigCompileErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		matchConfig RequestMatchConfig
+		err         string
+	}{
+		{"regular expression", RequestMatchConfig{Headers: map[string]*ValueMatcher{"x-tenant": {Matches: "(["}}}, "header [x-tenant]: invalid regular expression"},
+		{"json path filter", RequestMatchConfig{BodyPatterns: []*BodyPattern{{JsonPath: "$.items[?(@.id=='2')]"}}}, "body pattern #0: json path filter / script expressions are not supported"},
+		{"xpath function", RequestMatchConfig{BodyPatterns: []*BodyPattern{{XPath: "count(//id)"}}}, "body pattern #0: xpath functions are not supported"},
+		{"json path and xpath", RequestMatchConfig{BodyPatterns: []*BodyPattern{{JsonPath: "$.id", XPath: "/id"}}}, "body pattern #0: only one of jsonPath or xPath"},
+	}
+	for _, testCase := range testCases {
+		if err := testCase.matchConfig.Compile(); err == nil || !strings.HasPrefix(err.Error(), testCase.err) {
+			t.Errorf("%v: expected an error starting with %q, got %v", testCase.name, testCase.err, err)
+		}
+	}
+}
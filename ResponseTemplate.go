@@ -0,0 +1,248 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// parsed templates keyed by their text; the helpers are re-bound to the request on every render
+var responseTemplateCache sync.Map
+
+// characters used by the randomString helper
+const randomStringAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// method to check a template parses (e.g. while loading a module) without rendering it
+func ParseResponseTemplate(text string) error {
+	_, err := _getResponseTemplate(text)
+	return err
+}
+
+// method to render a response template against the request. Available helpers:
+//
+//	pathParam "id", query "name", header "name", cookie "name",
+//	jsonBody "$.path", xmlBody "/x/path", body,
+//	uuid, randomInt min max, randomString length, now "layout" (or "unix", "unixMillis")
+//
+// the request itself is the template data e.g. {{.Method}} {{.Path}}
+func RenderResponseTemplate(text string, data *RequestData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := _getResponseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err = tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(_requestTemplateFuncs(data))
+
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// method to render every string inside a (json like) value; maps and slices are walked recursively
+func RenderResponseTemplateValue(value interface{}, data *RequestData) (interface{}, error) {
+	switch value.(type) {
+	case string:
+		return RenderResponseTemplate(value.(string), data)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{})
+		for key, element := range value.(map[string]interface{}) {
+			renderedElement, err := RenderResponseTemplateValue(element, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = renderedElement
+		}
+		return rendered, nil
+	case map[string]string:
+		rendered := make(map[string]string)
+		for key, element := range value.(map[string]string) {
+			renderedElement, err := RenderResponseTemplate(element, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = renderedElement
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, 0, len(value.([]interface{})))
+		for _, element := range value.([]interface{}) {
+			renderedElement, err := RenderResponseTemplateValue(element, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered = append(rendered, renderedElement)
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
+
+// method to check every string inside a (json like) value parses as a template
+func ParseResponseTemplateValue(value interface{}) error {
+	switch value.(type) {
+	case string:
+		return ParseResponseTemplate(value.(string))
+	case map[string]interface{}:
+		for key, element := range value.(map[string]interface{}) {
+			if err := ParseResponseTemplateValue(element); err != nil {
+				return fmt.Errorf("%v: %v", key, err)
+			}
+		}
+	case []interface{}:
+		for idx, element := range value.([]interface{}) {
+			if err := ParseResponseTemplateValue(element); err != nil {
+				return fmt.Errorf("#%v: %v", idx, err)
+			}
+		}
+	}
+	return nil
+}
+
+// method to get the parsed template from the cache (parse on first use)
+func _getResponseTemplate(text string) (*template.Template, error) {
+	if cached, ok := responseTemplateCache.Load(text); ok {
+		return cached.(*template.Template), nil
+	}
+	// parse with placeholder helpers; the real ones are bound per request in RenderResponseTemplate
+	tmpl, err := template.New("response").Option("missingkey=zero").Funcs(_requestTemplateFuncs(nil)).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	responseTemplateCache.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// method to build the template helpers bound to the given request
+func _requestTemplateFuncs(data *RequestData) template.FuncMap {
+	if data == nil {
+		data = new(RequestData)
+	}
+	return template.FuncMap{
+		"pathParam": func(name string) string {
+			return data.PathParameters[name]
+		},
+		"query": func(name string) string {
+			return data.Query.Get(name)
+		},
+		"header": func(name string) string {
+			return data.Headers.Get(name)
+		},
+		"cookie": func(name string) string {
+			return data.Cookies[name]
+		},
+		"body": func() string {
+			return string(data.Body)
+		},
+		"jsonBody": func(expression string) (string, error) {
+			document, err := data.JsonBody()
+			if err != nil {
+				return "", fmt.Errorf("body is not valid json (%v)", err)
+			}
+			values, err := EvaluateJsonPath(document, expression)
+			if err != nil || len(values) == 0 {
+				return "", err
+			}
+			return JsonValueToString(values[0]), nil
+		},
+		"xmlBody": func(expression string) (string, error) {
+			document, err := data.XmlBody()
+			if err != nil {
+				return "", fmt.Errorf("body is not valid xml (%v)", err)
+			}
+			values, err := EvaluateXPath(document, expression)
+			if err != nil || len(values) == 0 {
+				return "", err
+			}
+			return values[0], nil
+		},
+		"uuid":         _templateUuid,
+		"randomInt":    _templateRandomInt,
+		"randomString": _templateRandomString,
+		"now":          _templateNow,
+	}
+}
+
+// method to generate a random (version 4) uuid
+func _templateUuid() (string, error) {
+	bArr := make([]byte, 16)
+	if _, err := rand.Read(bArr); err != nil {
+		return "", err
+	}
+	bArr[6] = (bArr[6] & 0x0f) | 0x40
+	bArr[8] = (bArr[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bArr[0:4], bArr[4:6], bArr[6:8], bArr[8:10], bArr[10:16]), nil
+}
+
+// method to generate a random int within [min, max]
+func _templateRandomInt(min int, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("randomInt: max [%v] is smaller than min [%v]", max, min)
+	}
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(max-min+1)))
+	if err != nil {
+		return 0, err
+	}
+	return min + int(value.Int64()), nil
+}
+
+// method to generate a random alphanumeric string of the given length
+func _templateRandomString(length int) (string, error) {
+	var buffer bytes.Buffer
+	for idx := 0; idx < length; idx++ {
+		charIdx, err := rand.Int(rand.Reader, big.NewInt(int64(len(randomStringAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		buffer.WriteByte(randomStringAlphabet[charIdx.Int64()])
+	}
+	return buffer.String(), nil
+}
+
+// method to format the current time; layout is a go time layout or one of "unix", "unixMillis" (default RFC3339)
+func _templateNow(layout ...string) string {
+	now := _getTimeNow()
+	if len(layout) == 0 || layout[0] == "" {
+		return now.Format(time.RFC3339)
+	}
+	switch layout[0] {
+	case "unix":
+		return fmt.Sprintf("%v", now.Unix())
+	case "unixMillis":
+		return fmt.Sprintf("%v", now.UnixNano()/int64(time.Millisecond))
+	default:
+		return now.Format(layout[0])
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// method to build the request data of a json order posted by tenant t-1
+func newTestTemplateRequestData(body string, contentType string) *RequestData {
+	request := httptest.NewRequest(http.MethodPost, "/orders/42?view=full", strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("X-Tenant", "t-1")
+	request.AddCookie(&http.Cookie{Name: "session", Value: "s-1"})
+
+	return NewRequestData(request, map[string]string{"id": "42"})
+}
+
+func TestResponseTemplateRendering(t *testing.T) {
+	data := newTestTemplateRequestData(`{"sku": "B2", "items": [{"qty": 3}]}`, "application/json")
+	testCases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"no template", "plain text", "plain text"},
+		{"request data", "{{.Method}} {{.Path}}", "POST /orders/42"},
+		{"path parameter", `order {{pathParam "id"}}`, "order 42"},
+		{"query", `{{query "view"}}`, "full"},
+		{"header", `{{header "X-Tenant"}}`, "t-1"},
+		{"cookie", `{{cookie "session"}}`, "s-1"},
+		{"json body", `{{jsonBody "$.sku"}} x {{jsonBody "$.items[0].qty"}}`, "B2 x 3"},
+		{"json body without match", `[{{jsonBody "$.missing"}}]`, "[]"},
+		{"body", "{{body}}", `{"sku": "B2", "items": [{"qty": 3}]}`},
+		{"missing values", `[{{pathParam "nope"}}{{query "nope"}}{{header "nope"}}{{cookie "nope"}}]`, "[]"},
+		{"template actions", `{{if eq (query "view") "full"}}full{{else}}short{{end}}`, "full"},
+	}
+	for _, testCase := range testCases {
+		rendered, err := RenderResponseTemplate(testCase.text, data)
+		if err != nil {
+			t.Errorf("%v: %v", testCase.name, err)
+			continue
+		}
+		if rendered != testCase.expected {
+			t.Errorf("%v: expected [%v], got [%v]", testCase.name, testCase.expected, rendered)
+		}
+	}
+
+	xmlData := newTestTemplateRequestData(`<order><sku>C3</sku></order>`, "application/xml")
+	if rendered, err := RenderResponseTemplate(`{{xmlBody "/order/sku"}}`, xmlData); err != nil || rendered != "C3" {
+		t.Errorf("expected the xml value [C3], got [%v] (%v)", rendered, err)
+	}
+
+	// the same (cached) template is bound to each request
+	otherData := NewRequestData(httptest.NewRequest(http.MethodGet, "/orders/7", nil), map[string]string{"id": "7"})
+	if rendered, _ := RenderResponseTemplate(`order {{pathParam "id"}}`, otherData); rendered != "order 7" {
+		t.Errorf("expected the cached template to render the other request, got [%v]", rendered)
+	}
+}
+
+func TestResponseTemplateHelpers(t *testing.T) {
+	data := newTestTemplateRequestData("", "text/plain")
+
+	rendered, err := RenderResponseTemplate("{{uuid}}", data)
+	if err != nil || !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(rendered) {
+		t.Errorf("expected a version 4 uuid, got [%v] (%v)", rendered, err)
+	}
+	if other, _ := RenderResponseTemplate("{{uuid}}", data); other == rendered {
+		t.Errorf("expected a new uuid per render, got [%v] twice", rendered)
+	}
+
+	for idx := 0; idx < 20; idx++ {
+		rendered, err := RenderResponseTemplate("{{randomInt 5 7}}", data)
+		value, convErr := strconv.Atoi(rendered)
+		if err != nil || convErr != nil || value < 5 || value > 7 {
+			t.Fatalf("expected a random int within [5, 7], got [%v] (%v)", rendered, err)
+		}
+	}
+	if rendered, err := RenderResponseTemplate("{{randomInt 3 3}}", data); err != nil || rendered != "3" {
+		t.Errorf("expected [3] out of [3, 3], got [%v] (%v)", rendered, err)
+	}
+
+	rendered, err = RenderResponseTemplate("{{randomString 12}}", data)
+	if err != nil || !regexp.MustCompile(`^[a-zA-Z0-9]{12}$`).MatchString(rendered) {
+		t.Errorf("expected 12 alphanumeric characters, got [%v] (%v)", rendered, err)
+	}
+
+	before := time.Now().Unix()
+	rendered, err = RenderResponseTemplate(`{{now "unix"}}`, data)
+	seconds, _ := strconv.ParseInt(rendered, 10, 64)
+	if err != nil || seconds < before || seconds > time.Now().Unix() {
+		t.Errorf("expected the current unix time, got [%v] (%v)", rendered, err)
+	}
+	rendered, _ = RenderResponseTemplate(`{{now "unixMillis"}}`, data)
+	if millis, _ := strconv.ParseInt(rendered, 10, 64); millis/1000 < before {
+		t.Errorf("expected the current unix time in millis, got [%v]", rendered)
+	}
+	rendered, _ = RenderResponseTemplate("{{now}}", data)
+	if _, err := time.Parse(time.RFC3339, rendered); err != nil {
+		t.Errorf("expected an RFC3339 time by default, got [%v] (%v)", rendered, err)
+	}
+	rendered, _ = RenderResponseTemplate(`{{now "2006"}}`, data)
+	if rendered != strconv.Itoa(time.Now().Year()) {
+		t.Errorf("expected the go layout to give the year, got [%v]", rendered)
+	}
+}
+
+func TestResponseTemplateErrors(t *testing.T) {
+	data := newTestTemplateRequestData("not json", "text/plain")
+
+	// errors found while loading a module
+	if err := ParseResponseTemplate("{{.Method"); err == nil {
+		t.Errorf("expected an unclosed action to be rejected")
+	}
+	if err := ParseResponseTemplate("{{unknownHelper}}"); err == nil {
+		t.Errorf("expected an unknown helper to be rejected")
+	}
+	err := ParseResponseTemplateValue(map[string]interface{}{"items": []interface{}{"ok", "{{if}}"}})
+	if err == nil || !strings.HasPrefix(err.Error(), "items: #1: ") {
+		t.Errorf("expected the error to point at items #1, got %v", err)
+	}
+
+	// errors found while rendering
+	if _, err := RenderResponseTemplate(`{{jsonBody "$.sku"}}`, data); err == nil || !strings.Contains(err.Error(), "body is not valid json") {
+		t.Errorf("expected the json body error, got %v", err)
+	}
+	if _, err := RenderResponseTemplate(`{{xmlBody "/order"}}`, data); err == nil || !strings.Contains(err.Error(), "body is not valid xml") {
+		t.Errorf("expected the xml body error, got %v", err)
+	}
+	if _, err := RenderResponseTemplate("{{randomInt 7 5}}", data); err == nil || !strings.Contains(err.Error(), "max [5] is smaller than min [7]") {
+		t.Errorf("expected the randomInt range error, got %v", err)
+	}
+	if _, err := RenderResponseTemplateValue(map[string]interface{}{"id": "{{randomInt 7 5}}"}, data); err == nil {
+		t.Errorf("expected the error of a nested value")
+	}
+}
+
+func TestResponseTemplateValue(t *testing.T) {
+	data := newTestTemplateRequestData(`{"sku": "B2"}`, "application/json")
+	value := map[string]interface{}{
+		"id":    `{{pathParam "id"}}`,
+		"qty":   float64(3),
+		"lines": []interface{}{`{{jsonBody "$.sku"}}`, true},
+		"meta":  map[string]interface{}{"tenant": `{{header "X-Tenant"}}`},
+	}
+	rendered, err := RenderResponseTemplateValue(value, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderedMap := rendered.(map[string]interface{})
+	lines := renderedMap["lines"].([]interface{})
+	if renderedMap["id"] != "42" || renderedMap["qty"] != float64(3) || lines[0] != "B2" || lines[1] != true ||
+		renderedMap["meta"].(map[string]interface{})["tenant"] != "t-1" {
+		t.Errorf("expected every nested string rendered and the rest untouched, got %v", renderedMap)
+	}
+	if value["id"] != `{{pathParam "id"}}` {
+		t.Errorf("expected the configured value untouched, got %v", value["id"])
+	}
+
+	headers, err := RenderResponseTemplateValue(map[string]string{"Location": `/orders/{{pathParam "id"}}`}, data)
+	if err != nil || headers.(map[string]string)["Location"] != "/orders/42" {
+		t.Errorf("expected the rendered header [/orders/42], got %v (%v)", headers, err)
+	}
+}
@@ -0,0 +1,221 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// the state every scenario starts with unless an initialState is configured
+const ScenarioStateStarted = "Started"
+
+// structure describing a named scenario (declared in a declarative module file)
+type ScenarioConfig struct {
+	Name         string   `json:"name" description:"unique name of the scenario"`
+	States       []string `json:"states" description:"optional list of valid states; empty means any state is accepted"`
+	InitialState string   `json:"initialState" description:"state on startup and after a reset (default Started)"`
+}
+
+// structure for a running scenario (a tiny state machine)
+type Scenario struct {
+	Name         string   `json:"name"`
+	States       []string `json:"states,omitempty"`
+	InitialState string   `json:"initialState"`
+	CurrentState string   `json:"currentState"`
+	Transitions  int      `json:"transitions"`
+}
+
+// registry of all scenarios known to the Server; shared by every module
+type ScenarioRegistry struct {
+	lock      sync.RWMutex
+	scenarios map[string]*Scenario
+}
+
+// ctor. Create instance of *ScenarioRegistry
+func NewScenarioRegistry() *ScenarioRegistry {
+	registry := new(ScenarioRegistry)
+	registry.scenarios = make(map[string]*Scenario)
+
+	return registry
+}
+
+// method to register a scenario; registering the same name twice merges the states
+// as long as the initial states agree
+func (r *ScenarioRegistry) Register(config ScenarioConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("scenario name missing")
+	}
+	initialState := config.InitialState
+	if initialState == "" {
+		initialState = ScenarioStateStarted
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if existing, ok := r.scenarios[config.Name]; ok {
+		if existing.InitialState != initialState {
+			return fmt.Errorf("scenario [%v] already registered with initial state [%v], got [%v]", config.Name, existing.InitialState, initialState)
+		}
+		for _, state := range config.States {
+			if !_containsString(existing.States, state) {
+				existing.States = append(existing.States, state)
+			}
+		}
+		return nil
+	}
+	scenario := new(Scenario)
+	scenario.Name = config.Name
+	scenario.InitialState = initialState
+	scenario.CurrentState = initialState
+	scenario.States = append([]string{}, config.States...)
+	if len(scenario.States) > 0 && !_containsString(scenario.States, initialState) {
+		scenario.States = append([]string{initialState}, scenario.States...)
+	}
+	r.scenarios[config.Name] = scenario
+
+	return nil
+}
+
+// method to return the current state of the named scenario
+func (r *ScenarioRegistry) State(name string) (state string, found bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if scenario, ok := r.scenarios[name]; ok {
+		return scenario.CurrentState, true
+	}
+	return "", false
+}
+
+// method to move the named scenario to newState, but only when it is currently in
+// requiredState (an empty requiredState matches any state, an empty newState keeps
+// the current state). The check and the transition happen atomically.
+func (r *ScenarioRegistry) Advance(name string, requiredState string, newState string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	scenario, ok := r.scenarios[name]
+	if !ok {
+		return false
+	}
+	if requiredState != "" && scenario.CurrentState != requiredState {
+		return false
+	}
+	if newState != "" && newState != scenario.CurrentState {
+		scenario.CurrentState = newState
+		scenario.Transitions++
+	}
+	return true
+}
+
+// method to force the named scenario into the given state
+func (r *ScenarioRegistry) SetState(name string, state string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	scenario, ok := r.scenarios[name]
+	if !ok {
+		return fmt.Errorf("unknown scenario [%v]", name)
+	}
+	if len(scenario.States) > 0 && !_containsString(scenario.States, state) {
+		return fmt.Errorf("state [%v] is not valid for scenario [%v]; valid states are %v", state, name, scenario.States)
+	}
+	if scenario.CurrentState != state {
+		scenario.CurrentState = state
+		scenario.Transitions++
+	}
+	return nil
+}
+
+// method to reset the named scenario back to its initial state
+func (r *ScenarioRegistry) Reset(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	scenario, ok := r.scenarios[name]
+	if !ok {
+		return fmt.Errorf("unknown scenario [%v]", name)
+	}
+	scenario.CurrentState = scenario.InitialState
+	scenario.Transitions = 0
+
+	return nil
+}
+
+// method to reset every scenario back to its initial state
+func (r *ScenarioRegistry) ResetAll() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, scenario := range r.scenarios {
+		scenario.CurrentState = scenario.InitialState
+		scenario.Transitions = 0
+	}
+}
+
+// method to return a copy of the named scenario
+func (r *ScenarioRegistry) Get(name string) (Scenario, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if scenario, ok := r.scenarios[name]; ok {
+		return *scenario, true
+	}
+	return Scenario{}, false
+}
+
+// method to return a copy of all scenarios (sorted by name)
+func (r *ScenarioRegistry) List() []Scenario {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	scenarios := make([]Scenario, 0, len(r.scenarios))
+	for _, scenario := range r.scenarios {
+		scenarios = append(scenarios, *scenario)
+	}
+	sort.Slice(scenarios, func(i, j int) bool {
+		return scenarios[i].Name < scenarios[j].Name
+	})
+	return scenarios
+}
+
+// method to return scenario name => current state; handed to the modules' DoAction
+func (r *ScenarioRegistry) Snapshot() map[string]string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	states := make(map[string]string)
+	for name, scenario := range r.scenarios {
+		states[name] = scenario.CurrentState
+	}
+	return states
+}
+
+// method to check if the given value is within the slice
+/* TODO: move to a util package later... */
+func _containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a checkout flow: the cart is empty until an item was added, then paid once
+const testCheckoutModule = `{
+  "path": "/cart",
+  "scenarios": [ { "name": "checkout", "states": [ "Filled", "Paid" ], "initialState": "Empty" } ],
+  "stubs": [
+    { "name": "empty cart", "path": "/", "scenario": "checkout", "requiredState": "Empty", "response": { "body": "empty" } },
+    { "name": "add item", "method": "POST", "path": "/", "scenario": "checkout", "newState": "Filled", "response": { "status": 201, "body": "added" } },
+    { "name": "filled cart", "path": "/", "scenario": "checkout", "requiredState": "Filled", "response": { "body": "filled" } },
+    { "name": "pay", "method": "POST", "path": "/pay", "scenario": "checkout", "requiredState": "Filled", "newState": "Paid", "response": { "body": "paid" } }
+  ]
+}`
+
+func TestScenarioRegistration(t *testing.T) {
+	registry := NewScenarioRegistry()
+	if err := registry.Register(ScenarioConfig{}); err == nil {
+		t.Errorf("expected a scenario without name to be rejected")
+	}
+	if err := registry.Register(ScenarioConfig{Name: "login"}); err != nil {
+		t.Fatal(err)
+	}
+	if state, found := registry.State("login"); !found || state != ScenarioStateStarted {
+		t.Errorf("expected the default state [%v], got [%v] (found: %v)", ScenarioStateStarted, state, found)
+	}
+	if _, found := registry.State("unknown"); found {
+		t.Errorf("expected an unknown scenario not to be found")
+	}
+
+	// the initial state is added to the valid states; a second registration merges the states
+	if err := registry.Register(ScenarioConfig{Name: "order", States: []string{"Shipped"}, InitialState: "Open"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(ScenarioConfig{Name: "order", States: []string{"Shipped", "Delivered"}, InitialState: "Open"}); err != nil {
+		t.Fatal(err)
+	}
+	scenario, _ := registry.Get("order")
+	if len(scenario.States) != 3 || scenario.States[0] != "Open" || scenario.States[1] != "Shipped" || scenario.States[2] != "Delivered" {
+		t.Errorf("expected the states [Open Shipped Delivered], got %v", scenario.States)
+	}
+	if err := registry.Register(ScenarioConfig{Name: "order", InitialState: "Closed"}); err == nil {
+		t.Errorf("expected a second registration with another initial state to be rejected")
+	}
+
+	list := registry.List()
+	if len(list) != 2 || list[0].Name != "login" || list[1].Name != "order" {
+		t.Errorf("expected the scenarios sorted by name, got %v", list)
+	}
+}
+
+func TestScenarioStateChangesAndResets(t *testing.T) {
+	registry := NewScenarioRegistry()
+	if err := registry.Register(ScenarioConfig{Name: "order", States: []string{"Shipped", "Delivered"}, InitialState: "Open"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(ScenarioConfig{Name: "login"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// advance only moves from the required state; an empty new state keeps the current one
+	if registry.Advance("order", "Shipped", "Delivered") {
+		t.Errorf("expected no transition out of a state the scenario is not in")
+	}
+	if !registry.Advance("order", "Open", "") {
+		t.Errorf("expected an empty new state to match without a transition")
+	}
+	if !registry.Advance("order", "Open", "Shipped") || !registry.Advance("order", "", "Delivered") {
+		t.Errorf("expected the transitions Open => Shipped => Delivered")
+	}
+	if registry.Advance("unknown", "", "Shipped") {
+		t.Errorf("expected no transition of an unknown scenario")
+	}
+	scenario, _ := registry.Get("order")
+	if scenario.CurrentState != "Delivered" || scenario.Transitions != 2 {
+		t.Errorf("expected state [Delivered] after 2 transitions, got [%v] after %v", scenario.CurrentState, scenario.Transitions)
+	}
+
+	// only declared states can be forced; any state is fine when none were declared
+	if err := registry.SetState("order", "Lost"); err == nil {
+		t.Errorf("expected an undeclared state to be rejected")
+	}
+	if err := registry.SetState("order", "Shipped"); err != nil {
+		t.Error(err)
+	}
+	if err := registry.SetState("login", "LoggedIn"); err != nil {
+		t.Error(err)
+	}
+	if err := registry.SetState("unknown", "Shipped"); err == nil {
+		t.Errorf("expected an unknown scenario to be rejected")
+	}
+	snapshot := registry.Snapshot()
+	if snapshot["order"] != "Shipped" || snapshot["login"] != "LoggedIn" {
+		t.Errorf("expected the snapshot order=Shipped login=LoggedIn, got %v", snapshot)
+	}
+
+	// reset a single scenario, then all of them
+	if err := registry.Reset("order"); err != nil {
+		t.Fatal(err)
+	}
+	if scenario, _ := registry.Get("order"); scenario.CurrentState != "Open" || scenario.Transitions != 0 {
+		t.Errorf("expected the reset scenario in state [Open] without transitions, got [%v] after %v", scenario.CurrentState, scenario.Transitions)
+	}
+	if state, _ := registry.State("login"); state != "LoggedIn" {
+		t.Errorf("expected the other scenario untouched by the reset, got [%v]", state)
+	}
+	if err := registry.Reset("unknown"); err == nil {
+		t.Errorf("expected the reset of an unknown scenario to fail")
+	}
+	registry.ResetAll()
+	if state, _ := registry.State("login"); state != ScenarioStateStarted {
+		t.Errorf("expected every scenario reset to its initial state, got [%v]", state)
+	}
+}
+
+func TestScenarioStubMatching(t *testing.T) {
+	moduleDir, err := ioutil.TempDir("", "echogogo-scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(moduleDir)
+	modulePath := filepath.Join(moduleDir, "cart"+DeclarativeModuleSuffix)
+	if err := ioutil.WriteFile(modulePath, []byte(testCheckoutModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	moduleConfig, err := LoadDeclarativeModuleConfig(modulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewScenarioRegistry()
+	for _, scenarioConfig := range moduleConfig.Scenarios {
+		if err := registry.Register(scenarioConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doCartAction := func(method string, target string, routePath string) *StubResponse {
+		request := httptest.NewRequest(method, target, nil)
+		options := map[string]interface{}{
+			"routePath":       routePath,
+			"scenarios":       registry.Snapshot(),
+			"advanceScenario": registry.Advance,
+		}
+		return moduleConfig.doAction(*request, "", options).(*StubResponse)
+	}
+
+	steps := []struct {
+		name      string
+		method    string
+		target    string
+		routePath string
+		status    int
+		expected  string
+		state     string
+	}{
+		{"empty cart", http.MethodGet, "/cart/", "/cart/", http.StatusOK, "empty", "Empty"},
+		{"pay an empty cart", http.MethodPost, "/cart/pay", "/cart/pay", http.StatusNotFound, "", "Empty"},
+		{"add item", http.MethodPost, "/cart/", "/cart/", http.StatusCreated, "added", "Filled"},
+		{"filled cart", http.MethodGet, "/cart/", "/cart/", http.StatusOK, "filled", "Filled"},
+		{"pay", http.MethodPost, "/cart/pay", "/cart/pay", http.StatusOK, "paid", "Paid"},
+		{"pay twice", http.MethodPost, "/cart/pay", "/cart/pay", http.StatusNotFound, "", "Paid"},
+		{"nothing matches a paid cart", http.MethodGet, "/cart/", "/cart/", http.StatusNotFound, "", "Paid"},
+	}
+	for _, step := range steps {
+		response := doCartAction(step.method, step.target, step.routePath)
+		if response.Status != step.status || (step.expected != "" && response.Body != step.expected) {
+			t.Errorf("%v: expected %v [%v], got %v %v", step.name, step.status, step.expected, response.Status, response.Body)
+		}
+		if state, _ := registry.State("checkout"); state != step.state {
+			t.Errorf("%v: expected the scenario in state [%v], got [%v]", step.name, step.state, state)
+		}
+	}
+
+	// after a reset the flow starts over
+	registry.ResetAll()
+	if response := doCartAction(http.MethodGet, "/cart/", "/cart/"); response.Body != "empty" {
+		t.Errorf("expected the empty cart after the reset, got %v %v", response.Status, response.Body)
+	}
+
+	// the state is checked again when moving; a stale snapshot does not win the race
+	staleOptions := map[string]interface{}{
+		"routePath":       "/cart/pay",
+		"scenarios":       map[string]string{"checkout": "Filled"},
+		"advanceScenario": registry.Advance,
+	}
+	response := moduleConfig.doAction(*httptest.NewRequest(http.MethodPost, "/cart/pay", nil), "", staleOptions).(*StubResponse)
+	if response.Status != http.StatusNotFound {
+		t.Errorf("expected the stale snapshot not to pay, got %v %v", response.Status, response.Body)
+	}
+	if state, _ := registry.State("checkout"); state != "Empty" {
+		t.Errorf("expected the scenario to stay [Empty], got [%v]", state)
+	}
+}
@@ -20,27 +20,52 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/emicklei/go-restful"
 	"github.com/quoeamaster/echogogo_plugin"
-	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"plugin"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// consume format of form posts (application/x-www-form-urlencoded) besides json; e.g. the oidc token endpoint
+const FormatForm = "form"
+
+// consume format accepting any content type (*/*); e.g. the built-in echo module
+const FormatAny = "any"
+
 // structure for the Server instance's member variables
 type Server struct {
 	configFile        	string
 	configContentJson	ConfigContent
 
 	modules 			map[string]*EchoModule
+	loadOrder			[]*EchoModule	// modules initialized so far in load order; shutdown in reverse
+	scenarios			*ScenarioRegistry
+	faults				*FaultRegistry
+	rateLimits			*RateLimitRegistry
+	authPolicies		[]*authPolicy
+	metrics				*MetricsRegistry
+	tracer				*Tracer	// nil unless tracing is enabled
 
 	logConfig 			LogConfig
 	logger 				Logger
+
+	httpServer			*http.Server
+	state				int32	// ServerStateStarting, ServerStateReady or ServerStateStopping (see Health.go)
+	stopOnce			sync.Once
+	stopErr				error
 }
 
 // structure for a valid Echo-module
@@ -48,9 +73,15 @@ type EchoModule struct {
 	ModulePtr 			*plugin.Plugin
 	FxGetRestConfig 	plugin.Symbol
 	FxDoAction 			plugin.Symbol
+	FxInit				plugin.Symbol	// optional; func(map[string]interface{}) error called once with the module's settings
+	FxShutdown			plugin.Symbol	// optional; func() error called when the server stops
+	FxHealth			plugin.Symbol	// optional; func() error reporting the module's health (nil means healthy)
 	ModulePath			string
+	Settings			map[string]interface{}	// settings of the module (config modules.settings); also given to DoAction
 
 	WebservicePath		string
+	IsTemplated			bool	// string values of the DoAction result are rendered as response templates
+	Schemas				map[string]interface{}	// optional endpoint => schema description (see OpenApi.go)
 }
 
 
@@ -59,10 +90,13 @@ func NewServer(configFile string) *Server {
 	srv := new(Server)
 	srv.configFile = configFile
 	srv.modules = make(map[string]*EchoModule)
+	srv.scenarios = NewScenarioRegistry()
+	srv.faults = NewFaultRegistry()
+	srv.rateLimits = NewRateLimitRegistry()
+	srv.metrics = NewMetricsRegistry()
 
 	srv.logConfig = *new(LogConfig)
 	srv.logConfig.DefaultLevel = LogLevelInfo
-	srv.logConfig.DefaultFuncName = "StartServer"
 	srv.logConfig.Filename = "Server"
 
 	srv.logger = NewLogger(LogLevelInfo)
@@ -87,76 +121,217 @@ func NewEchoModule(modulePtr *plugin.Plugin, symGetRestConfig plugin.Symbol, sym
 func (srv *Server) StartServer() error {
 	srv.logger.LogWithFuncName("bootstrapping SERVER...", "StartServer", srv.logConfig)
 	// load the config file contents if valid
-	if srv.configFile == "" {
-		cModelPtr := new(ConfigContent)
-		cModelPtr.ModuleRepositoryLocation = "modules"
-		srv.configContentJson = *cModelPtr
+	if err := srv.loadConfig(); err != nil {
+		return err
+	}
+	// load the module(s) and setup the webservice container
+	wsContainerPtr, err := srv.setupContainer()
+	if err != nil {
+		return err
+	}
 
+	// https (and client certificates) if server.tls is configured
+	tlsConfig, err := NewServerTlsConfig(srv.configContentJson.Server.Tls)
+	if err != nil {
+		srv.shutdownModules()
+		return err
+	}
+	if tlsConfig != nil {
+		srv.logger.LogWithFuncName(fmt.Sprintf("SERVER started at %v (https, client certificates: %v)", srv.configContentJson.ListenAddress(), srv.configContentJson.Server.Tls.ClientAuth), "StartServer", srv.logConfig)
 	} else {
-		val, err := LoadConfigContent(srv.configFile)
-		if err != nil {
-			return err
+		srv.logger.LogWithFuncName(fmt.Sprintf("SERVER started at %v", srv.configContentJson.ListenAddress()), "StartServer", srv.logConfig)
+	}
+	// setup server
+	srv.httpServer = &http.Server{
+		Addr: srv.configContentJson.ListenAddress(),
+		Handler: wsContainerPtr,
+		TLSConfig: tlsConfig,
+		ReadTimeout: time.Duration(srv.configContentJson.Server.ReadTimeoutMs) * time.Millisecond,
+		WriteTimeout: time.Duration(srv.configContentJson.Server.WriteTimeoutMs) * time.Millisecond,
+	}
+	// SIGINT / SIGTERM stop the server gracefully
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		sig, ok := <-signals
+		if !ok {
+			return
 		}
-		srv.configContentJson = ConfigContent(*val)
-		// fmt.Printf("%v\n", srv.configContentJson.ModuleRepositoryLocation)
+		srv.logger.LogWithFuncName(fmt.Sprintf("received %v, stopping SERVER...", sig), "StartServer", srv.logConfig)
+		srv.StopServer()
+	}()
+
+	if tlsConfig != nil {
+		// the certificate is in the TLSConfig already
+		err = srv.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = srv.httpServer.ListenAndServe()
 	}
-	// load the module(s) available in the folder (load all files with suffix .so)
-	err, wsContainerPtr := srv.loadModulesFromRepos()
+	if err != http.ErrServerClosed {
+		// e.g. the address is in use
+		srv.shutdownModules()
+		return err
+	}
+	// stopped; StopServer only returns once the modules are shutdown too
+	return srv.StopServer()
+}
+
+// method to load the config file contents (defaults if no config file is given)
+func (srv *Server) loadConfig() error {
+	val, err := LoadConfigContent(srv.configFile)
+	if err != nil {
+		return err
+	}
+	srv.configContentJson = ConfigContent(*val)
+	// fmt.Printf("%v\n", srv.configContentJson.ModuleRepositoryLocation)
+	logLevel, _ := ParseLogLevel(srv.configContentJson.Logging.Level)
+	srv.logger = NewLogger(logLevel)
+	srv.logger.IsCallerEnabled = srv.configContentJson.Logging.Caller
+	sink, err := NewLogSink(srv.configContentJson.Logging)
 	if err != nil {
 		return err
 	}
+	srv.logger.Sink = sink
+	for _, warning := range srv.configContentJson.warnings {
+		srv.logger.Log(warning, LogLevelWarning, "", "")
+	}
+
+	// rate limits and fault injection configured upfront (can be changed later through the admin api)
+	if err := srv.rateLimits.Load(srv.configContentJson.RateLimits); err != nil {
+		return err
+	}
+	return srv.faults.Load(srv.configContentJson.Faults)
+}
+
+// method to load the module(s) and setup the webservice container with every route served
+func (srv *Server) setupContainer() (*restful.Container, error) {
+	// load the module(s) available in the repositories (files with suffix .so or .echo.json)
+	err, wsContainerPtr := srv.loadModulesFromRepos()
+	if err != nil {
+		return nil, err
+	}
+	// credentials required per module / endpoint; the jwt keys are read once the modules are loaded (a built-in
+	// issuer might write its public key)
+	if srv.authPolicies, err = newAuthPolicies(srv.configContentJson.Auth); err != nil {
+		srv.shutdownModules()
+		return nil, err
+	}
+	atomic.CompareAndSwapInt32(&srv.state, ServerStateStarting, ServerStateReady)
+	// setup the request id, tracing and metrics first; their filters cover the requests answered by the other filters too
+	srv.setupRequestId(wsContainerPtr)
+	if err := srv.setupTracing(wsContainerPtr); err != nil {
+		srv.shutdownModules()
+		return nil, err
+	}
+	srv.setupMetrics(wsContainerPtr)
 	// setup CORS for the wsContainer
 	srv.setupCors(wsContainerPtr)
-
-	srv.logger.LogWithFuncName("SERVER started at port 8001", "", srv.logConfig)
-	// setup server
-	wsServer := &http.Server{ Addr: ":8001", Handler: wsContainerPtr }
-	return wsServer.ListenAndServe()
-	//return http.ListenAndServe(":8001", nil)
+	// setup the admin api
+	srv.setupAdmin(wsContainerPtr)
+	// setup the OpenAPI document of the loaded modules
+	srv.setupOpenApi(wsContainerPtr)
+	// setup the aggregated health of the loaded modules and the liveness / readiness probes
+	srv.setupHealth(wsContainerPtr)
+	srv.setupProbes(wsContainerPtr)
+
+	return wsContainerPtr, nil
 }
 
+// method to stop the server; in-flight requests get up to server.shutdownTimeoutMs to finish, then the
+// modules' Shutdown hooks run. Only the first call stops the server, later calls return the same result
 func (srv *Server) StopServer() error {
-	return nil
+	srv.stopOnce.Do(func() {
+		// fail the readiness probe first; load balancers get server.shutdownDelayMs to stop sending requests
+		atomic.StoreInt32(&srv.state, ServerStateStopping)
+		if srv.httpServer != nil && srv.configContentJson.Server.ShutdownDelayMs > 0 {
+			time.Sleep(time.Duration(srv.configContentJson.Server.ShutdownDelayMs) * time.Millisecond)
+		}
+		if srv.httpServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(srv.configContentJson.Server.ShutdownTimeoutMs) * time.Millisecond)
+			defer cancel()
+			if err := srv.httpServer.Shutdown(ctx); err != nil {
+				srv.logger.Log(fmt.Sprintf("SERVER did not stop gracefully: %v", err), LogLevelWarning, "", "")
+			}
+		}
+		srv.stopErr = srv.shutdownModules()
+		if srv.tracer != nil {
+			srv.tracer.Close()
+		}
+		srv.logger.LogWithFuncName("SERVER stopped", "StopServer", srv.logConfig)
+		if srv.logger.Sink != nil {
+			srv.logger.Sink.Close()
+		}
+	})
+	return srv.stopErr
 }
 
-// load the files / modules within the given repo; modules have a suffix of "so"
+// load the files / modules within the configured repos (or module list); modules have a suffix of "so" (or ".echo.json" for declarative modules).
+// The built-in modules enabled follow
 func (srv *Server) loadModulesFromRepos() (error, *restful.Container) {
 	wsContainerPtr := restful.NewContainer()
 
-	matchedModulesSlice, err := srv._getModuleFileInfosFromRepos()
+	matchedModulesSlice, err := srv._getModulePaths()
 	if err != nil {
 		return err, nil
 	}
 	srv.logger.LogWithFuncName("searching MODULE(s) to bootstrap...", "loadModulesFromRepos", srv.logConfig)
 
 	// load the modules through plugin api
-	for _, matchedModule := range matchedModulesSlice {
-		matchedModulePath := fmt.Sprintf("%v/%v", srv.configContentJson.ModuleRepositoryLocation, matchedModule.Name())
-		modulePtr, err := srv._loadModule(matchedModulePath)
+	for _, matchedModulePath := range matchedModulesSlice {
+		var modulePtr *EchoModule
+		if strings.HasSuffix(matchedModulePath, DeclarativeModuleSuffix) {
+			modulePtr, err = srv._loadDeclarativeModule(matchedModulePath)
+		} else if strings.HasPrefix(matchedModulePath, BuiltinModulePathPrefix) {
+			modulePtr, err = srv._loadBuiltinModule(matchedModulePath)
+		} else {
+			modulePtr, err = srv._loadModule(matchedModulePath)
+		}
 		if err != nil {
 			/*	TODO: should ignore this unloaded module OR exit? (default is exit if any module can't be LOADED)  */
+			srv.metrics.IncModuleLoadFailure(matchedModulePath)
+			srv.shutdownModules()
 			return err, nil
 		}
-		srv.modules[matchedModule.Name()] = modulePtr
+		srv.loadOrder = append(srv.loadOrder, modulePtr)
 		// setup the REST api
 		err = srv._setupRestForModule(modulePtr, wsContainerPtr)
 		if err != nil {
+			srv.metrics.IncModuleLoadFailure(matchedModulePath)
+			srv.shutdownModules()
 			return err, nil
 		}
-		srv.logger.LogWithFuncName(fmt.Sprintf("bootstrapped module - %v", matchedModule.Name()), "loadModulesFromRepos", srv.logConfig)
+		srv.modules[matchedModulePath] = modulePtr
+		srv.metrics.SetModulesLoaded(len(srv.modules))
+		srv.logger.LogWithFuncName(fmt.Sprintf("bootstrapped module - %v", matchedModulePath), "loadModulesFromRepos", srv.logConfig)
+	}
+	// most likely a typo in the module file name
+	for moduleFileName := range srv.configContentJson.Modules.Settings {
+		isLoaded := false
+		for modulePath := range srv.modules {
+			isLoaded = isLoaded || filepath.Base(modulePath) == moduleFileName
+		}
+		if !isLoaded {
+			srv.logger.Log(fmt.Sprintf("settings given for %v but no such module is loaded", moduleFileName), LogLevelWarning, "", "")
+		}
 	}
 	return nil, wsContainerPtr
 }
 
 // setup the CORS for the webservice container
 func (srv *Server) setupCors(wsContainer *restful.Container) {
-	// TODO: the allowedDomains should be configured by some ways... (config file etc)
+	corsConfig := srv.configContentJson.Cors
+	if !corsConfig.Enabled {
+		srv.logger.LogWithFuncName("cors feature disabled on SERVER", "setupCors", srv.logConfig)
+		return
+	}
 	cors := restful.CrossOriginResourceSharing{
-		// ExposeHeaders:  []string{"X-My-Header"},
-		AllowedHeaders: []string{ "Content-Type", "Accept" },
-		AllowedMethods: []string{ "PUT", "POST", "DELETE", "GET" },
-		AllowedDomains: []string{ "*" },
-		CookiesAllowed: false,
+		ExposeHeaders:  corsConfig.ExposeHeaders,
+		AllowedHeaders: corsConfig.AllowedHeaders,
+		AllowedMethods: corsConfig.AllowedMethods,
+		AllowedDomains: corsConfig.AllowedDomains,
+		CookiesAllowed: corsConfig.CookiesAllowed,
+		MaxAge: corsConfig.MaxAge,
 		Container: wsContainer,
 	}
 	wsContainer.Filter(wsContainer.OPTIONSFilter)
@@ -165,25 +340,6 @@ func (srv *Server) setupCors(wsContainer *restful.Container) {
 	srv.logger.LogWithFuncName(fmt.Sprintf("cors feature configured on SERVER"), "setupCors", srv.logConfig)
 }
 
-// method to get all files in the repository and then filter valid module files out (suffix of .so)
-func (srv *Server) _getModuleFileInfosFromRepos() ([]os.FileInfo, error) {
-	matchedModulesPtr := make([]os.FileInfo, 0)
-	/*
-	 *	read files from the repos dir
-	 */
-	fileInfos, err := ioutil.ReadDir(srv.configContentJson.ModuleRepositoryLocation)
-	if err != nil {
-		return nil, err
-	}
-	/*	only suffix matches ".so" should be treated as a match */
-	for _, fileInfo := range fileInfos {
-		if strings.HasSuffix(fileInfo.Name(), ".so") {
-			matchedModulesPtr = append(matchedModulesPtr, fileInfo)
-		}
-	}
-	return matchedModulesPtr, nil
-}
-
 // method to load modules / plugins; returning a pointer to the actual running ".so" module / plugin / library
 func (srv *Server) _loadModule(modulePath string) (*EchoModule, error) {
 	modulePtr, err := plugin.Open(modulePath)
@@ -199,32 +355,113 @@ func (srv *Server) _loadModule(modulePath string) (*EchoModule, error) {
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := symGetRestConfig.(func() map[string]interface{}); !ok {
+		return nil, fmt.Errorf("invalid module [%v]: GetRestConfig must be a func() map[string]interface{}, got %T", modulePath, symGetRestConfig)
+	}
+	if _, ok := symDoAction.(func(http.Request, string, ...map[string]interface{}) interface{}); !ok {
+		return nil, fmt.Errorf("invalid module [%v]: DoAction must be a func(http.Request, string, ...map[string]interface{}) interface{}, got %T", modulePath, symDoAction)
+	}
 	// everything is good, setup the REST module now
 	echoModPtr := NewEchoModule(modulePtr, symGetRestConfig, symDoAction, modulePath)
+	echoModPtr.Settings = srv.configContentJson.ModuleSettings(modulePath)
+
+	// optional - Init receives the module's settings before any request is served
+	if symInit, err := modulePtr.Lookup("Init"); err == nil {
+		fxInit, ok := symInit.(func(map[string]interface{}) error)
+		if !ok {
+			return nil, fmt.Errorf("invalid module [%v]: Init must be a func(map[string]interface{}) error, got %T", modulePath, symInit)
+		}
+		if err := fxInit(echoModPtr.Settings); err != nil {
+			return nil, fmt.Errorf("module [%v] failed to initialize: %v", modulePath, err)
+		}
+		echoModPtr.FxInit = symInit
+	}
+	// optional - Shutdown is called by StopServer, Health is aggregated into the health endpoint
+	if symShutdown, err := modulePtr.Lookup("Shutdown"); err == nil {
+		if _, ok := symShutdown.(func() error); !ok {
+			return nil, fmt.Errorf("invalid module [%v]: Shutdown must be a func() error, got %T", modulePath, symShutdown)
+		}
+		echoModPtr.FxShutdown = symShutdown
+	}
+	if symHealth, err := modulePtr.Lookup("Health"); err == nil {
+		if _, ok := symHealth.(func() error); !ok {
+			return nil, fmt.Errorf("invalid module [%v]: Health must be a func() error, got %T", modulePath, symHealth)
+		}
+		echoModPtr.FxHealth = symHealth
+	}
+	return echoModPtr, nil
+}
+
+// method to load a declarative module (json description of stubs); its scenarios are registered on the Server
+func (srv *Server) _loadDeclarativeModule(modulePath string) (*EchoModule, error) {
+	moduleConfig, err := LoadDeclarativeModuleConfig(modulePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, scenarioConfig := range moduleConfig.Scenarios {
+		if err := srv.scenarios.Register(scenarioConfig); err != nil {
+			return nil, err
+		}
+	}
+	for _, stub := range moduleConfig.Stubs {
+		if stub.Scenario == "" {
+			continue
+		}
+		// scenarios referenced by a stub but never declared are registered with the defaults
+		if _, found := srv.scenarios.State(stub.Scenario); !found {
+			if err := srv.scenarios.Register(ScenarioConfig{Name: stub.Scenario}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	echoModPtr := NewDeclarativeEchoModule(moduleConfig, modulePath)
+	echoModPtr.Settings = srv.configContentJson.ModuleSettings(modulePath)
 
 	return echoModPtr, nil
 }
 
 func (srv *Server) _setupRestForModule(echoModPtr *EchoModule, wsContainerPtr *restful.Container) error {
 	ws := new(restful.WebService)
-	configMap := echoModPtr.FxGetRestConfig.(func() map[string]interface{})()
+	configMap, err := echoModPtr.getRestConfig()
+	if err != nil {
+		return err
+	}
 	// fmt.Printf("config returned => %v\n", configMap)
 
 	webservicePath := configMap["path"].(string)
+	// go-restful exits on a duplicated root path; the server's own paths (admin, health, ...) and modules from
+	// different repositories might clash
+	if _containsString(reservedWebservicePaths, webservicePath) {
+		return fmt.Errorf("module %v: path %v is reserved by the server", echoModPtr.ModulePath, webservicePath)
+	}
+	if existingModulePtr := srv._findModuleByWebservicePath(webservicePath); existingModulePtr != nil {
+		return fmt.Errorf("module %v: path %v is already served by module %v", echoModPtr.ModulePath, webservicePath, existingModulePtr.ModulePath)
+	}
 	echoModPtr.WebservicePath = webservicePath
 	ws.Path(webservicePath)
+	// optional; render the string values returned by DoAction as response templates
+	if isTemplated, ok := configMap["templateResponses"].(bool); ok {
+		echoModPtr.IsTemplated = isTemplated
+	}
+	// optional; schemas describing the endpoints in the OpenAPI document and validating the requests
+	if schemas, ok := configMap["schemas"].(map[string]interface{}); ok {
+		if err := CompileRequestSchemas(schemas); err != nil {
+			return fmt.Errorf("invalid schemas of module %v: %v", echoModPtr.ModulePath, err)
+		}
+		echoModPtr.Schemas = schemas
+	}
 
 	ws = srv._setWebserviceFormat(configMap["consumeFormat"].(string), ws, true)
 	ws = srv._setWebserviceFormat(configMap["produceFormat"].(string), ws, false)
 	// set endpoints too...
-	ws, err := srv._setWebserviceEndPoints(configMap["endPoints"].([]string), ws)
+	ws, err = srv._setWebserviceEndPoints(configMap["endPoints"].([]string), ws)
 	if err != nil {
 		return err
 	}
 	// add the valid WebService module to the container
 	wsContainerPtr.Add(ws)
 
-	srv.logger.Log(fmt.Sprintf("MODULE - %v mapped to %v successfully", echoModPtr.ModulePath, echoModPtr.WebservicePath), LogLevelDebug, "Server", "loadModulesFromRepos")
+	srv.logger.Log(fmt.Sprintf("MODULE - %v mapped to %v successfully", echoModPtr.ModulePath, echoModPtr.WebservicePath), LogLevelDebug, "", "")
 	return nil
 }
 
@@ -249,6 +486,18 @@ func (srv *Server) _setWebserviceFormat(format string, ws *restful.WebService, i
 		} else {
 			ws.Produces(restful.MIME_XML, restful.MIME_JSON)
 		}
+	case FormatForm:
+		if isConsume == true {
+			ws.Consumes("application/x-www-form-urlencoded", restful.MIME_JSON)
+		} else {
+			ws.Produces(restful.MIME_JSON)
+		}
+	case FormatAny:
+		if isConsume == true {
+			ws.Consumes("*/*")
+		} else {
+			ws.Produces(restful.MIME_JSON)
+		}
 	default:
 		if isConsume == true {
 			ws.Consumes(restful.MIME_XML, restful.MIME_JSON)
@@ -288,8 +537,14 @@ func (srv *Server) _setWebserviceEndPoints(endpoints []string, ws *restful.WebSe
 				ws1 = ws1.Route(ws1.DELETE(parts[1]).To(srv._webserviceActionRouter))
 			case "GET":
 				ws1 = ws1.Route(ws1.GET(parts[1]).To(srv._webserviceActionRouter))
+			case "PATCH":
+				ws1 = ws1.Route(ws1.PATCH(parts[1]).To(srv._webserviceActionRouter))
+			case "HEAD":
+				ws1 = ws1.Route(ws1.HEAD(parts[1]).To(srv._webserviceActionRouter))
+			case "OPTIONS":
+				ws1 = ws1.Route(ws1.Method("OPTIONS").Path(parts[1]).To(srv._webserviceActionRouter))
 			default:
-				ws1 = ws1.Route(ws1.GET(parts[1]).To(srv._webserviceActionRouter))
+				err = fmt.Errorf("invalid endpoint, http verb must be one of %v => %v\n", supportedEndPointVerbs, endpoint)
 			}
 		} else {
 			err = fmt.Errorf("invalid endpoint, format for a valid endpoint is [http_verb]::[target_path] (e.g. GET::/hobby ) => %v\n", endpoint)
@@ -309,6 +564,8 @@ func (srv *Server) _webserviceActionRouter(request *restful.Request, response *r
 		request.Request.Body.Close()
 	}()
 
+	// every log line of the request carries its id
+	logger := srv._requestLogger(request)
 	routePath := request.SelectedRoutePath()
 	parts := strings.Split(routePath, "/")
 	if len(parts) > 1 {
@@ -316,15 +573,70 @@ func (srv *Server) _webserviceActionRouter(request *restful.Request, response *r
 		targetModule := "/" + parts[1]
 		for _, modulePtr := range srv.modules {
 			if modulePtr.WebservicePath == targetModule {
+				// requests without valid credentials (if required) never reach the faults or the DoAction
+				if !srv._authenticate(modulePtr, request, response, logger) {
+					return
+				}
+				// clients over the rate limit (if any) get a 429
+				if !srv._applyRateLimit(modulePtr, request, response, logger) {
+					return
+				}
+				// faults (if any) are applied around the DoAction
+				if fault := srv.faults.Find(modulePtr.WebservicePath, request.Request.Method, routePath); fault != nil {
+					if srv._applyFaultBeforeAction(fault, response, logger) {
+						return
+					}
+					if faultWriter := newFaultResponseWriter(response.ResponseWriter, fault); faultWriter != nil {
+						response.ResponseWriter = faultWriter
+						defer func() {
+							if err := faultWriter.finish(); err != nil {
+								logger.Log(fmt.Sprintf("fault [%v]: %v", fault.Id, err), LogLevelError, "", "")
+							}
+						}()
+					}
+				}
+				// read the body once (it is put back on the request) for templates
+				requestData := NewRequestData(request.Request, request.PathParameters())
+				// requests not honouring the endpoint's schemas never reach the DoAction
+				if validationErrors := ValidateRequest(modulePtr.endPointSchema(request.Request.Method, routePath), requestData); len(validationErrors) > 0 {
+					srv.setCorsHeaders(request.Request, response)
+					srv._writeStubResponse(_newValidationErrorResponse(validationErrors), response, logger)
+					return
+				}
 				// invoke the DoAction()
+				actionStartTime := time.Now()
+				actionSpan := srv._startActionSpan(request, modulePtr)
 				model := modulePtr.FxDoAction.(func(http.Request, string, ...map[string]interface{}) interface{})(
-					*request.Request, targetModule, nil)
+					*request.Request, targetModule, srv._buildActionOptions(modulePtr, request, requestData))
+				srv.metrics.ObserveDoAction(modulePtr.WebservicePath, routePath, request.Request.Method, time.Since(actionStartTime))
+				if actionSpan != nil {
+					_, actionSpan.IsError = model.(error)
+					actionSpan.End()
+				}
 				// fmt.Printf("model => %v\n", model)
 
 				switch model.(type) {
 				case error:
-					// TODO: panic or just printf?
-					panic(model)
+					// the module failed; logged (with the request id) and answered with a 500
+					logger.Log(fmt.Sprintf("module %v failed: %v", modulePtr.ModulePath, model), LogLevelError, "", "")
+					srv.setCorsHeaders(request.Request, response)
+					srv._writeStubResponse(&StubResponse{Status: http.StatusInternalServerError,
+						Body: map[string]interface{}{"error": fmt.Sprintf("module failed: %v", model)}}, response, logger)
+					return
+				case *StubResponse:
+					// declarative modules decide on the status code and headers themselves
+					srv.setCorsHeaders(request.Request, response)
+					srv._writeStubResponse(model.(*StubResponse), response, logger)
+					return
+				}
+				if modulePtr.IsTemplated {
+					renderedModel, err := RenderResponseTemplateValue(model, requestData)
+					if err != nil {
+						srv.setCorsHeaders(request.Request, response)
+						srv._writeStubResponse(_newTemplateErrorResponse(err), response, logger)
+						return
+					}
+					model = renderedModel
 				}
 				// based on the response... create the output in either json (default) or xml
 				isHandled := false
@@ -333,7 +645,7 @@ func (srv *Server) _webserviceActionRouter(request *restful.Request, response *r
 						// add back CORS header(s)
 						srv.setCorsHeaders(request.Request, response)
 						if err := response.WriteAsJson(model); err != nil {
-							fmt.Printf("%v\n", err)
+							logger.Log(err.Error(), LogLevelError, "", "")
 						}
 						isHandled = true
 						break
@@ -343,7 +655,7 @@ func (srv *Server) _webserviceActionRouter(request *restful.Request, response *r
 						srv.setCorsHeaders(request.Request, response)
 						response.AddHeader("Content-Type", "application/xml")
 						if _, err := response.Write([]byte(xml)); err != nil {
-							fmt.Printf("%v\n", err)
+							logger.Log(err.Error(), LogLevelError, "", "")
 						}
 						isHandled = true
 						break
@@ -351,7 +663,7 @@ func (srv *Server) _webserviceActionRouter(request *restful.Request, response *r
 				}	// end -- for (parts - check request type => json or xml etc)
 				if !isHandled {
 					if err := response.WriteAsJson(model); err != nil {
-						fmt.Printf("%v\n", err)
+						logger.Log(err.Error(), LogLevelError, "", "")
 					}
 				}
 				break	// end - break of (invoke a Matched echo module)
@@ -359,8 +671,82 @@ func (srv *Server) _webserviceActionRouter(request *restful.Request, response *r
 		}	// end -- for (modules)
 	} else {
 		if err := response.WriteAsJson(fmt.Sprintf("unknown route path => %v\n", routePath)); err != nil {
-			// logging
-			fmt.Printf("%v\n", err)
+			logger.Log(err.Error(), LogLevelError, "", "")
+		}
+	}
+}
+
+// method to build the options handed to a module's DoAction
+func (srv *Server) _buildActionOptions(modulePtr *EchoModule, request *restful.Request, requestData *RequestData) map[string]interface{} {
+	options := make(map[string]interface{})
+	options["settings"] = modulePtr.Settings
+	options["requestId"], _ = request.Attribute(requestIdRequestAttribute).(string)
+	// logging in the server's format (with the request id and module); "logger" has the methods
+	// Trace / Debug / Info / Warning / Error(string), "log" is a func(level, message string, keyValues ...interface{})
+	moduleLogger := srv._requestLogger(request).Named(strings.TrimPrefix(modulePtr.WebservicePath, "/"), "DoAction").With("module", modulePtr.WebservicePath)
+	options["logger"] = moduleLogger
+	options["log"] = moduleLogger.LogFields
+	options["routePath"] = request.SelectedRoutePath()
+	// tracing (if enabled); traceId, spanId (of the server span) and sampled
+	if span, ok := request.Attribute(spanRequestAttribute).(*Span); ok {
+		options["traceContext"] = map[string]interface{}{
+			"traceId": span.Context.TraceId,
+			"spanId":  span.Context.SpanId,
+			"sampled": span.Context.IsSampled,
+		}
+	}
+	options["pathParameters"] = request.PathParameters()
+	// the verified client certificate (https with server.tls.clientAuth); subject, issuer, sans, fingerprintSha256...
+	if clientCertificate := ClientCertificateInfo(request.Request); clientCertificate != nil {
+		options["clientCertificate"] = clientCertificate
+	}
+	// the authenticated caller (if the module / endpoint requires credentials); scheme, subject and claims (JWT only)
+	if principal, ok := request.Attribute(authRequestAttribute).(*AuthPrincipal); ok {
+		options["auth"] = map[string]interface{}{
+			"scheme":  principal.Scheme,
+			"subject": principal.Subject,
+			"claims":  principal.Claims,
+		}
+	}
+	// response templates; func(templateText string) (string, error) rendered against this request
+	options["renderTemplate"] = func(text string) (string, error) {
+		return RenderResponseTemplate(text, requestData)
+	}
+	// scenario support; name => current state plus functions to move the state machine(s)
+	options["scenarios"] = srv.scenarios.Snapshot()
+	options["advanceScenario"] = srv.scenarios.Advance
+	options["setScenarioState"] = srv.scenarios.SetState
+
+	return options
+}
+
+// method to write the response of a declarative stub
+func (srv *Server) _writeStubResponse(stubResponse *StubResponse, response *restful.Response, logger Logger) {
+	var body []byte
+	switch stubResponse.Body.(type) {
+	case nil:
+		body = nil
+	case string:
+		body = []byte(stubResponse.Body.(string))
+	case []byte:
+		body = stubResponse.Body.([]byte)
+	default:
+		bArr, err := json.Marshal(stubResponse.Body)
+		if err != nil {
+			logger.Log(err.Error(), LogLevelError, "", "")
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body = bArr
+		response.AddHeader("Content-Type", restful.MIME_JSON)
+	}
+	for key, value := range stubResponse.Headers {
+		response.Header().Set(key, value)
+	}
+	response.WriteHeader(stubResponse.Status)
+	if len(body) > 0 {
+		if _, err := response.Write(body); err != nil {
+			logger.Log(err.Error(), LogLevelError, "", "")
 		}
 	}
 }
@@ -371,7 +757,15 @@ func (srv *Server) setCorsHeaders(request *http.Request, response *restful.Respo
 		response.Header.Add("Access-Control-Allow-Origin", request.Header.Get("Origin"))
 	}
 	*/
-	response.AddHeader("Access-Control-Allow-Origin", request.Header.Get("Origin"))
+	corsConfig := srv.configContentJson.Cors
+	origin := request.Header.Get("Origin")
+	if !corsConfig.Enabled || origin == "" || response.Header().Get("Access-Control-Allow-Origin") != "" {
+		// disabled, not a CORS request or already set by the CORS filter
+		return
+	}
+	if _containsString(corsConfig.AllowedDomains, "*") || _containsString(corsConfig.AllowedDomains, origin) {
+		response.AddHeader("Access-Control-Allow-Origin", origin)
+	}
 	//fmt.Printf("%v \n", request.Method)
 }
 
@@ -0,0 +1,217 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// method to create a module serving the given path with a single GET endpoint
+func newTestEchoModule(modulePath string, webservicePath string) *EchoModule {
+	getRestConfig := func() map[string]interface{} {
+		return map[string]interface{}{
+			"path":          webservicePath,
+			"consumeFormat": "json",
+			"produceFormat": "json",
+			"endPoints":     []string{"GET::/"},
+		}
+	}
+	doAction := func(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+		return map[string]interface{}{"path": webservicePath}
+	}
+	return NewEchoModule(nil, getRestConfig, doAction, modulePath)
+}
+
+// go-restful calls os.Exit on a duplicated root path; such modules must fail with an error instead
+func TestSetupRestForModuleRejectsClashingPaths(t *testing.T) {
+	testCases := []struct {
+		path    string
+		message string
+	}{
+		{AdminWebservicePath, "reserved by the server"},
+		{HealthWebservicePath, "reserved by the server"},
+		{LivenessWebservicePath, "reserved by the server"},
+		{ReadinessWebservicePath, "reserved by the server"},
+		{MetricsWebservicePath, "reserved by the server"},
+		{OpenApiWebservicePath, "reserved by the server"},
+		{"/orders", "already served by module orders.so"},
+	}
+	for _, testCase := range testCases {
+		srv := NewServer("")
+		wsContainerPtr := restful.NewContainer()
+		ordersModulePtr := newTestEchoModule("orders.so", "/orders")
+		if err := srv._setupRestForModule(ordersModulePtr, wsContainerPtr); err != nil {
+			t.Fatalf("orders module: %v", err)
+		}
+		srv.modules[ordersModulePtr.ModulePath] = ordersModulePtr
+
+		err := srv._setupRestForModule(newTestEchoModule("clash.so", testCase.path), wsContainerPtr)
+		if err == nil || !strings.Contains(err.Error(), testCase.message) {
+			t.Errorf("path %v: expected an error containing %q, got %v", testCase.path, testCase.message, err)
+		}
+		if len(wsContainerPtr.RegisteredWebServices()) != 1 {
+			t.Errorf("path %v: the clashing module must not be added to the container", testCase.path)
+		}
+	}
+}
+
+func TestSetWebserviceEndPointsVerbs(t *testing.T) {
+	srv := NewServer("")
+	ws, err := srv._setWebserviceEndPoints([]string{"GET::/", "PATCH::/{id}", "HEAD::/{id}", "OPTIONS::/"}, new(restful.WebService))
+	if err != nil {
+		t.Fatal(err)
+	}
+	methods := make([]string, 0)
+	for _, route := range ws.Routes() {
+		methods = append(methods, route.Method)
+	}
+	if strings.Join(methods, ",") != "GET,PATCH,HEAD,OPTIONS" {
+		t.Errorf("expected every verb routed as declared, got %v", methods)
+	}
+	// an unknown verb used to be routed as GET
+	if _, err := srv._setWebserviceEndPoints([]string{"FETCH::/"}, new(restful.WebService)); err == nil {
+		t.Error("expected an error for an unknown http verb")
+	}
+}
+
+func TestModuleErrorIsAnsweredWith500(t *testing.T) {
+	srv, wsContainerPtr, sink := newTestAdminServer()
+	modulePtr := newTestEchoModule("orders.so", "/orders")
+	modulePtr.FxDoAction = func(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+		return errors.New("database unavailable")
+	}
+	if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+		t.Fatal(err)
+	}
+	srv.modules[modulePtr.ModulePath] = modulePtr
+
+	recorder := serveTestRequest(wsContainerPtr, http.MethodGet, "/orders/", nil, "order-req-1")
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), "module failed: database unavailable") {
+		t.Errorf("expected a 500 naming the error, got %v %v", recorder.Code, recorder.Body.String())
+	}
+	entry := lastLogEntry(t, sink)
+	if entry.Level != LogLevelError || entry.Message != "module orders.so failed: database unavailable" || entry.RequestId != "order-req-1" {
+		t.Errorf("expected the error logged with the request id, got %+v", entry)
+	}
+}
+
+// method to register a built-in module recording the settings given to its Init (once) and DoAction (per request)
+func registerTestSettingsModule(name string, webservicePath string, initErr error, initSettings *[]map[string]interface{}) func() {
+	builtinModules[name] = func(baseDir string) *BuiltinModule {
+		return &BuiltinModule{
+			GetRestConfig: func() map[string]interface{} {
+				return map[string]interface{}{"path": webservicePath, "consumeFormat": "json", "produceFormat": "json", "endPoints": []string{"GET::/"}}
+			},
+			DoAction: func(request http.Request, endPoint string, options ...map[string]interface{}) interface{} {
+				return map[string]interface{}{"settings": options[0]["settings"]}
+			},
+			Init: func(settings map[string]interface{}) error {
+				*initSettings = append(*initSettings, settings)
+				return initErr
+			},
+		}
+	}
+	return func() {
+		delete(builtinModules, name)
+	}
+}
+
+func TestModuleSettingsReachInitAndDoAction(t *testing.T) {
+	initSettings := make([]map[string]interface{}, 0)
+	defer registerTestSettingsModule("test-greeter", "/greeter", nil, &initSettings)()
+	defer registerTestSettingsModule("test-plain", "/plain", nil, &initSettings)()
+	srv := NewServer("")
+	sink := new(recordingSink)
+	srv.logger.Sink = sink
+	srv.configContentJson.Modules.Builtin = []string{"test-greeter", "test-plain"}
+	srv.configContentJson.Modules.Settings = map[string]map[string]interface{}{
+		"test-greeter": {"greeting": "hello", "retries": float64(3)},
+		"test-typo":    {"greeting": "lost"},
+	}
+	err, wsContainerPtr := srv.loadModulesFromRepos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Init is called once per module with its own settings; no settings means an empty map
+	expectedSettings := map[string]interface{}{"greeting": "hello", "retries": float64(3)}
+	if len(initSettings) != 2 || !reflect.DeepEqual(initSettings[0], expectedSettings) || initSettings[1] == nil || len(initSettings[1]) != 0 {
+		t.Errorf("expected Init called with %v then an empty map, got %v", expectedSettings, initSettings)
+	}
+
+	// the same settings reach DoAction on every request
+	for idx := 0; idx < 2; idx++ {
+		recorder := serveTestRequest(wsContainerPtr, http.MethodGet, "/greeter/", nil, "")
+		body := decodeTestJson(t, recorder.Body.String()).(map[string]interface{})
+		if recorder.Code != http.StatusOK || !reflect.DeepEqual(body["settings"], expectedSettings) {
+			t.Errorf("expected DoAction to receive %v, got %v %v", expectedSettings, recorder.Code, recorder.Body.String())
+		}
+	}
+	if len(initSettings) != 2 {
+		t.Errorf("expected Init not to be called per request, got %v calls", len(initSettings))
+	}
+
+	// settings of a module that is not loaded are most likely a typo
+	found := false
+	for _, entry := range sink.entries {
+		found = found || (entry.Level == LogLevelWarning && entry.Message == "settings given for test-typo but no such module is loaded")
+	}
+	if !found {
+		t.Errorf("expected a warning about the settings of test-typo, got %v", sink.entries)
+	}
+}
+
+func TestInitErrorStopsTheModuleFromLoading(t *testing.T) {
+	initSettings := make([]map[string]interface{}, 0)
+	defer registerTestSettingsModule("test-first", "/first", nil, &initSettings)()
+	defer registerTestSettingsModule("test-failing", "/failing", errors.New("no database at db:5432"), &initSettings)()
+	defer registerTestSettingsModule("test-last", "/last", nil, &initSettings)()
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	srv.configContentJson.Modules.Builtin = []string{"test-first", "test-failing", "test-last"}
+	srv.configContentJson.Modules.Settings = map[string]map[string]interface{}{"test-failing": {"dsn": "db:5432"}}
+
+	err, wsContainerPtr := srv.loadModulesFromRepos()
+	if err == nil || err.Error() != "module [builtin/test-failing] failed to initialize: no database at db:5432" {
+		t.Fatalf("expected the Init error of test-failing, got %v", err)
+	}
+	if wsContainerPtr != nil {
+		t.Errorf("expected no container to serve")
+	}
+	// the failing module got its settings; the modules after it were not initialized
+	if len(initSettings) != 2 || !reflect.DeepEqual(initSettings[1], map[string]interface{}{"dsn": "db:5432"}) {
+		t.Errorf("expected Init of test-first and test-failing only, got %v", initSettings)
+	}
+	if _, ok := srv.modules[BuiltinModulePathPrefix+"test-failing"]; ok {
+		t.Errorf("expected test-failing not to be loaded")
+	}
+	var metricsText bytes.Buffer
+	if err := srv.metrics.WriteText(&metricsText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(metricsText.String(), `echogogo_module_load_failures_total{file="builtin/test-failing"} 1`) {
+		t.Errorf("expected the load failure counted, got:\n%v", metricsText.String())
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// client certificate modes
+const (
+	TlsClientAuthNone    = "none"
+	TlsClientAuthRequest = "request"
+	TlsClientAuthRequire = "require"
+)
+
+// method to build the tls config of the server; nil if tls is not configured (no server.tls.certFile)
+func NewServerTlsConfig(tlsConfig TlsConfig) (*tls.Config, error) {
+	if tlsConfig.CertFile == "" {
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("server.tls: %v", err)
+	}
+	serverTlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	switch tlsConfig.ClientAuth {
+	case TlsClientAuthRequest:
+		// a certificate is asked for; if one is presented it must verify against the client CAs
+		serverTlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case TlsClientAuthRequire:
+		serverTlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return serverTlsConfig, nil
+	}
+	bArrCaPem, err := ioutil.ReadFile(tlsConfig.ClientCaFile)
+	if err != nil {
+		return nil, fmt.Errorf("server.tls.clientCaFile: %v", err)
+	}
+	clientCas := x509.NewCertPool()
+	if !clientCas.AppendCertsFromPEM(bArrCaPem) {
+		return nil, fmt.Errorf("server.tls.clientCaFile: no certificate found in %v", tlsConfig.ClientCaFile)
+	}
+	serverTlsConfig.ClientCAs = clientCas
+
+	return serverTlsConfig, nil
+}
+
+// method to describe the verified client certificate of the request; nil for plain http or if the client
+// presented none. Given to DoAction as options["clientCertificate"]
+func ClientCertificateInfo(request *http.Request) map[string]interface{} {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	certificate := request.TLS.VerifiedChains[0][0]
+	fingerprint := sha256.Sum256(certificate.Raw)
+	ipAddresses := make([]string, 0, len(certificate.IPAddresses))
+	for _, ipAddress := range certificate.IPAddresses {
+		ipAddresses = append(ipAddresses, ipAddress.String())
+	}
+	uris := make([]string, 0, len(certificate.URIs))
+	for _, uri := range certificate.URIs {
+		uris = append(uris, uri.String())
+	}
+	return map[string]interface{}{
+		"subject":           certificate.Subject.String(),
+		"commonName":        certificate.Subject.CommonName,
+		"issuer":            certificate.Issuer.String(),
+		"serialNumber":      certificate.SerialNumber.String(),
+		"notBefore":         certificate.NotBefore.UTC().Format(time.RFC3339),
+		"notAfter":          certificate.NotAfter.UTC().Format(time.RFC3339),
+		"fingerprintSha256": _formatFingerprint(fingerprint[:]),
+		"sans": map[string]interface{}{
+			"dns":    _nonNilStrings(certificate.DNSNames),
+			"emails": _nonNilStrings(certificate.EmailAddresses),
+			"ips":    ipAddresses,
+			"uris":   uris,
+		},
+	}
+}
+
+// method to format a fingerprint as colon separated upper case hex e.g. AB:CD:..
+func _formatFingerprint(digest []byte) string {
+	parts := make([]string, len(digest))
+	for idx, value := range digest {
+		parts[idx] = fmt.Sprintf("%02X", value)
+	}
+	return strings.Join(parts, ":")
+}
+
+// method to get an empty list instead of nil (marshalled as [] instead of null)
+func _nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
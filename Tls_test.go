@@ -0,0 +1,237 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/emicklei/go-restful"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// structure of a test certificate and its key
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pem         []byte
+	keyPem      []byte
+}
+
+// method to issue a certificate; self signed (a CA) if issuer is nil
+func newTestCertificate(t *testing.T, template *x509.Certificate, issuer *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.certificate, issuer.key
+	}
+	bArrCertificate, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(bArrCertificate)
+	bArrKey, _ := x509.MarshalECPrivateKey(key)
+	return &testCertificate{certificate: certificate, key: key,
+		pem:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bArrCertificate}),
+		keyPem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: bArrKey})}
+}
+
+// method to issue a CA certificate
+func newTestCa(t *testing.T, name string, serialNumber int64) *testCertificate {
+	return newTestCertificate(t, &x509.Certificate{SerialNumber: big.NewInt(serialNumber), Subject: pkix.Name{CommonName: name},
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+}
+
+// method to get the tls certificate (for a client) of the test certificate
+func (c *testCertificate) tlsCertificate(t *testing.T) tls.Certificate {
+	certificate, err := tls.X509KeyPair(c.pem, c.keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func TestTlsClientAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "echogogo-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCa(t, "echogogo test ca", 1)
+	otherCa := newTestCa(t, "other ca", 2)
+	serverCertificate := newTestCertificate(t, &x509.Certificate{SerialNumber: big.NewInt(10), Subject: pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, ca)
+	spiffeId, _ := url.Parse("spiffe://example.org/orders")
+	clientCertificate := newTestCertificate(t, &x509.Certificate{SerialNumber: big.NewInt(11), Subject: pkix.Name{CommonName: "orders-client", Organization: []string{"Acme"}},
+		DNSNames: []string{"orders.internal"}, EmailAddresses: []string{"ops@example.org"}, URIs: []*url.URL{spiffeId},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca)
+	strangerCertificate := newTestCertificate(t, &x509.Certificate{SerialNumber: big.NewInt(12), Subject: pkix.Name{CommonName: "stranger"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, otherCa)
+	files := map[string][]byte{"ca.pem": ca.pem, "server.pem": serverCertificate.pem, "server.key": serverCertificate.keyPem}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootCas := x509.NewCertPool()
+	rootCas.AddCert(ca.certificate)
+
+	testCases := []struct {
+		name        string
+		clientAuth  string
+		certificate *testCertificate // presented by the client
+		isRefused   bool
+		commonName  string // of the clientCertificate echoed back; empty if none
+	}{
+		{"none", TlsClientAuthNone, nil, false, ""},
+		{"none ignores a certificate", TlsClientAuthNone, clientCertificate, false, ""},
+		{"request without a certificate", TlsClientAuthRequest, nil, false, ""},
+		{"request with a certificate", TlsClientAuthRequest, clientCertificate, false, "orders-client"},
+		{"request with an unknown issuer", TlsClientAuthRequest, strangerCertificate, true, ""},
+		{"require without a certificate", TlsClientAuthRequire, nil, true, ""},
+		{"require with a certificate", TlsClientAuthRequire, clientCertificate, false, "orders-client"},
+	}
+	for _, testCase := range testCases {
+		serverTlsConfig, err := NewServerTlsConfig(TlsConfig{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server.key"),
+			ClientAuth: testCase.clientAuth, ClientCaFile: filepath.Join(dir, "ca.pem")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := NewServer("")
+		srv.logger.Sink = new(recordingSink)
+		wsContainerPtr := restful.NewContainer()
+		modulePtr, err := srv._loadBuiltinModule(BuiltinModulePathPrefix + "echo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+			t.Fatal(err)
+		}
+		srv.modules[modulePtr.ModulePath] = modulePtr
+		server := httptest.NewUnstartedServer(wsContainerPtr)
+		server.TLS = serverTlsConfig
+		// refused handshakes are expected
+		server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+		server.StartTLS()
+
+		clientTlsConfig := &tls.Config{RootCAs: rootCas}
+		if testCase.certificate != nil {
+			// sent even if the server doesn't list its issuer as acceptable
+			certificate := testCase.certificate.tlsCertificate(t)
+			clientTlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &certificate, nil
+			}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTlsConfig}, Timeout: 5 * time.Second}
+		// any content type reaches the echo module
+		response, err := client.Post(server.URL+"/echo/orders", "text/plain", strings.NewReader("hello"))
+		if testCase.isRefused {
+			if err == nil {
+				response.Body.Close()
+				t.Errorf("%v: expected the handshake refused, got %v", testCase.name, response.Status)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", testCase.name, err)
+			server.Close()
+			continue
+		}
+		var echo map[string]interface{}
+		err = json.NewDecoder(response.Body).Decode(&echo)
+		response.Body.Close()
+		server.Close()
+		if err != nil || response.StatusCode != http.StatusOK || echo["tls"] != true || echo["body"] != "hello" {
+			t.Errorf("%v: expected the request echoed over tls, got %v %v (%v)", testCase.name, response.StatusCode, echo, err)
+			continue
+		}
+		clientCertificateInfo, hasCertificate := echo["clientCertificate"].(map[string]interface{})
+		if testCase.commonName == "" {
+			if hasCertificate {
+				t.Errorf("%v: expected no client certificate, got %v", testCase.name, clientCertificateInfo)
+			}
+			continue
+		}
+		if !hasCertificate || clientCertificateInfo["commonName"] != testCase.commonName {
+			t.Errorf("%v: expected the client certificate of %v, got %v", testCase.name, testCase.commonName, echo["clientCertificate"])
+		}
+	}
+}
+
+func TestClientCertificateInfo(t *testing.T) {
+	ca := newTestCa(t, "echogogo test ca", 1)
+	spiffeId, _ := url.Parse("spiffe://example.org/orders")
+	certificate := newTestCertificate(t, &x509.Certificate{SerialNumber: big.NewInt(4242), Subject: pkix.Name{CommonName: "orders-client", Organization: []string{"Acme"}},
+		DNSNames: []string{"orders.internal"}, EmailAddresses: []string{"ops@example.org"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		URIs: []*url.URL{spiffeId}}, ca)
+
+	request := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	if info := ClientCertificateInfo(request); info != nil {
+		t.Errorf("expected nothing for plain http, got %v", info)
+	}
+	request.TLS = &tls.ConnectionState{}
+	if info := ClientCertificateInfo(request); info != nil {
+		t.Errorf("expected nothing without a verified certificate, got %v", info)
+	}
+	request.TLS.VerifiedChains = [][]*x509.Certificate{{certificate.certificate, ca.certificate}}
+	info := ClientCertificateInfo(request)
+	expected := map[string]interface{}{
+		"subject":      "CN=orders-client,O=Acme",
+		"commonName":   "orders-client",
+		"issuer":       "CN=echogogo test ca",
+		"serialNumber": "4242",
+		"notBefore":    certificate.certificate.NotBefore.UTC().Format(time.RFC3339),
+		"notAfter":     certificate.certificate.NotAfter.UTC().Format(time.RFC3339),
+	}
+	for key, value := range expected {
+		if info[key] != value {
+			t.Errorf("%v: expected %v, got %v", key, value, info[key])
+		}
+	}
+	if fingerprint := info["fingerprintSha256"].(string); len(fingerprint) != 95 || strings.ToUpper(fingerprint) != fingerprint {
+		t.Errorf("expected 32 colon separated upper case bytes, got %v", fingerprint)
+	}
+	sans := info["sans"].(map[string]interface{})
+	if sans["dns"].([]string)[0] != "orders.internal" || sans["emails"].([]string)[0] != "ops@example.org" ||
+		sans["ips"].([]string)[0] != "10.0.0.1" || sans["uris"].([]string)[0] != "spiffe://example.org/orders" {
+		t.Errorf("unexpected sans %v", sans)
+	}
+}
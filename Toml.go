@@ -0,0 +1,333 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// method to parse a toml document into the same values encoding/json decodes to:
+// map[string]interface{}, []interface{}, string, float64 and bool.
+// Supported is the subset used by configuration files; [tables], [[arrays of tables]],
+// (dotted) keys, basic and literal strings, integers, floats, booleans, (multi-line) arrays
+// and inline tables. Dates are kept as strings; multi-line strings are not supported
+func ParseToml(content []byte) (map[string]interface{}, error) {
+	document := make(map[string]interface{})
+	current := document
+	lines := strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n")
+	for idx := 0; idx < len(lines); idx++ {
+		number := idx + 1
+		text := strings.TrimSpace(_stripTomlComment(lines[idx]))
+		if text == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "[["):
+			if !strings.HasSuffix(text, "]]") {
+				return nil, fmt.Errorf("toml line %v: invalid array of tables header => %v", number, text)
+			}
+			keys, err := _parseTomlKey(text[2 : len(text)-2])
+			if err != nil {
+				return nil, fmt.Errorf("toml line %v: %v", number, err)
+			}
+			parent, err := _getTomlTable(document, keys[:len(keys)-1])
+			if err != nil {
+				return nil, fmt.Errorf("toml line %v: %v", number, err)
+			}
+			last := keys[len(keys)-1]
+			tables, ok := parent[last].([]interface{})
+			if _, isPresent := parent[last]; isPresent && !ok {
+				return nil, fmt.Errorf("toml line %v: key [%v] is not an array of tables", number, strings.Join(keys, "."))
+			}
+			current = make(map[string]interface{})
+			parent[last] = append(tables, current)
+		case strings.HasPrefix(text, "["):
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("toml line %v: invalid table header => %v", number, text)
+			}
+			keys, err := _parseTomlKey(text[1 : len(text)-1])
+			if err != nil {
+				return nil, fmt.Errorf("toml line %v: %v", number, err)
+			}
+			current, err = _getTomlTable(document, keys)
+			if err != nil {
+				return nil, fmt.Errorf("toml line %v: %v", number, err)
+			}
+		default:
+			eqIdx := _indexOutsideQuotes(text, '=')
+			if eqIdx < 0 {
+				return nil, fmt.Errorf("toml line %v: expected [key = value] => %v", number, text)
+			}
+			keys, err := _parseTomlKey(text[:eqIdx])
+			if err != nil {
+				return nil, fmt.Errorf("toml line %v: %v", number, err)
+			}
+			valueText := strings.TrimSpace(text[eqIdx+1:])
+			// multi-line arrays continue until the brackets are balanced
+			for strings.HasPrefix(valueText, "[") && !_isTomlBalanced(valueText) && idx+1 < len(lines) {
+				idx++
+				valueText += " " + strings.TrimSpace(_stripTomlComment(lines[idx]))
+			}
+			value, err := _parseTomlValue(valueText)
+			if err != nil {
+				return nil, fmt.Errorf("toml line %v: %v", number, err)
+			}
+			table, err := _getTomlTable(current, keys[:len(keys)-1])
+			if err != nil {
+				return nil, fmt.Errorf("toml line %v: %v", number, err)
+			}
+			last := keys[len(keys)-1]
+			if _, ok := table[last]; ok {
+				return nil, fmt.Errorf("toml line %v: duplicated key [%v]", number, strings.Join(keys, "."))
+			}
+			table[last] = value
+		}
+	}
+	return document, nil
+}
+
+// method to get (or create) the table at the given keys; for an array of tables the last one is used
+func _getTomlTable(root map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	table := root
+	for idx, key := range keys {
+		switch child := table[key].(type) {
+		case nil:
+			created := make(map[string]interface{})
+			table[key] = created
+			table = created
+		case map[string]interface{}:
+			table = child
+		case []interface{}:
+			if len(child) == 0 {
+				return nil, fmt.Errorf("key [%v] is not a table", strings.Join(keys[:idx+1], "."))
+			}
+			last, ok := child[len(child)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("key [%v] is not a table", strings.Join(keys[:idx+1], "."))
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("key [%v] is not a table", strings.Join(keys[:idx+1], "."))
+		}
+	}
+	return table, nil
+}
+
+// method to parse a (dotted) key e.g. server.port or "a.b".c
+func _parseTomlKey(text string) ([]string, error) {
+	keys := make([]string, 0)
+	text = strings.TrimSpace(text)
+	for text != "" {
+		var key string
+		if text[0] == '"' || text[0] == '\'' {
+			end := _findYamlQuoteEnd(text)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted key => %v", text)
+			}
+			value, err := _parseTomlValue(text[:end+1])
+			if err != nil {
+				return nil, err
+			}
+			key = value.(string)
+			text = strings.TrimSpace(text[end+1:])
+		} else {
+			end := strings.Index(text, ".")
+			if end < 0 {
+				end = len(text)
+			}
+			key = strings.TrimSpace(text[:end])
+			text = text[end:]
+			for _, char := range key {
+				if !(char == '_' || char == '-' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9') {
+					return nil, fmt.Errorf("invalid bare key [%v]", key)
+				}
+			}
+		}
+		if key == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		keys = append(keys, key)
+		if text != "" {
+			if text[0] != '.' {
+				return nil, fmt.Errorf("invalid key => %v", text)
+			}
+			text = strings.TrimSpace(text[1:])
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("missing key")
+	}
+	return keys, nil
+}
+
+// method to parse a value; string, number, boolean, date (as string), array or inline table
+func _parseTomlValue(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return nil, fmt.Errorf("missing value")
+	case strings.HasPrefix(text, "\"\"\"") || strings.HasPrefix(text, "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported => %v", text)
+	case text[0] == '"':
+		if _findYamlQuoteEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("invalid string => %v", text)
+		}
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string => %v", text)
+		}
+		return value, nil
+	case text[0] == '\'':
+		if strings.Index(text[1:], "'") != len(text)-2 {
+			return nil, fmt.Errorf("invalid literal string => %v", text)
+		}
+		return text[1 : len(text)-1], nil
+	case text[0] == '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated array => %v", text)
+		}
+		array := make([]interface{}, 0)
+		for _, item := range _splitFlowItems(text[1 : len(text)-1]) {
+			value, err := _parseTomlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	case text[0] == '{':
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("unterminated inline table => %v", text)
+		}
+		table := make(map[string]interface{})
+		for _, item := range _splitFlowItems(text[1 : len(text)-1]) {
+			eqIdx := _indexOutsideQuotes(item, '=')
+			if eqIdx < 0 {
+				return nil, fmt.Errorf("expected [key = value] => %v", item)
+			}
+			keys, err := _parseTomlKey(item[:eqIdx])
+			if err != nil {
+				return nil, err
+			}
+			value, err := _parseTomlValue(item[eqIdx+1:])
+			if err != nil {
+				return nil, err
+			}
+			parent, err := _getTomlTable(table, keys[:len(keys)-1])
+			if err != nil {
+				return nil, err
+			}
+			parent[keys[len(keys)-1]] = value
+		}
+		return table, nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	}
+	if number, isNumber, err := _parseTomlNumber(text); isNumber {
+		return number, err
+	}
+	// dates / times e.g. 1979-05-27T07:32:00Z
+	if len(text) >= 8 && text[0] >= '0' && text[0] <= '9' && strings.ContainsAny(text, "-:") && !strings.ContainsAny(text, " ,") {
+		return text, nil
+	}
+	return nil, fmt.Errorf("invalid value => %v", text)
+}
+
+// method to parse an integer or a float; integers are decimal without leading zeros (0755 is not octal)
+// or prefixed with 0x, 0o or 0b. isNumber tells if the text is a (possibly invalid) number at all
+func _parseTomlNumber(text string) (number interface{}, isNumber bool, err error) {
+	cleaned := strings.Replace(text, "_", "", -1)
+	unsigned := strings.TrimLeft(cleaned, "+-")
+	if len(unsigned) > 2 && unsigned[0] == '0' && strings.IndexByte("xob", unsigned[1]) >= 0 {
+		if unsigned != cleaned {
+			return nil, true, fmt.Errorf("prefixed integers cannot be signed => %v", text)
+		}
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[unsigned[1]]
+		value, err := strconv.ParseInt(unsigned[2:], base, 64)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid integer => %v", text)
+		}
+		return float64(value), true, nil
+	}
+	value, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil || !strings.ContainsAny(cleaned, "0123456789") || strings.ContainsAny(cleaned, "xXpP") {
+		return nil, false, nil
+	}
+	if len(unsigned) > 1 && unsigned[0] == '0' && unsigned[1] >= '0' && unsigned[1] <= '9' {
+		return nil, true, fmt.Errorf("leading zeros are not allowed => %v", text)
+	}
+	return value, true, nil
+}
+
+// method to check if the brackets of a (multi-line) array are balanced
+func _isTomlBalanced(text string) bool {
+	depth := 0
+	var quote byte
+	for idx := 0; idx < len(text); idx++ {
+		char := text[idx]
+		switch {
+		case quote != 0:
+			if char == '\\' && quote == '"' {
+				idx++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '[' || char == '{':
+			depth++
+		case char == ']' || char == '}':
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// method to find the first occurrence of the char outside quotes; -1 if not found
+func _indexOutsideQuotes(text string, target byte) int {
+	var quote byte
+	for idx := 0; idx < len(text); idx++ {
+		char := text[idx]
+		switch {
+		case quote != 0:
+			if char == '\\' && quote == '"' {
+				idx++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == target:
+			return idx
+		}
+	}
+	return -1
+}
+
+// method to strip a comment (#...) that is not within quotes
+func _stripTomlComment(text string) string {
+	if idx := _indexOutsideQuotes(text, '#'); idx >= 0 {
+		return text[:idx]
+	}
+	return text
+}
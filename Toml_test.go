@@ -0,0 +1,103 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTomlValue(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected interface{}
+		err      string
+	}{
+		{`"a\tb"`, "a\tb", ""},
+		{`'C:\temp'`, `C:\temp`, ""},
+		{"true", true, ""},
+		{"42", float64(42), ""},
+		{"-17", float64(-17), ""},
+		{"+1_000", float64(1000), ""},
+		{"0", float64(0), ""},
+		{"0.5", 0.5, ""},
+		{"-0.5e2", float64(-50), ""},
+		{"0x1F", float64(31), ""},
+		{"0o755", float64(493), ""},
+		{"0b101", float64(5), ""},
+		{"0755", nil, "leading zeros are not allowed"},
+		{"-007", nil, "leading zeros are not allowed"},
+		{"00.5", nil, "leading zeros are not allowed"},
+		{"-0x1F", nil, "cannot be signed"},
+		{"0xZZ", nil, "invalid integer"},
+		{"1979-05-27T07:32:00Z", "1979-05-27T07:32:00Z", ""},
+		{"07:32:00", "07:32:00", ""},
+		{"[1, 'two', [true]]", []interface{}{float64(1), "two", []interface{}{true}}, ""},
+		{"{ a = 1, b.c = 'x' }", map[string]interface{}{"a": float64(1), "b": map[string]interface{}{"c": "x"}}, ""},
+		{`"""multi"""`, nil, "multi-line strings are not supported"},
+		{"yes", nil, "invalid value"},
+		{"", nil, "missing value"},
+	}
+	for _, testCase := range testCases {
+		value, err := _parseTomlValue(testCase.text)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v: expected an error containing %q, got %v (%v)", testCase.text, testCase.err, value, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(value, testCase.expected) {
+			t.Errorf("%v: expected %#v, got %#v (%v)", testCase.text, testCase.expected, value, err)
+		}
+	}
+}
+
+func TestParseToml(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected map[string]interface{}
+		err      string
+	}{
+		{"tables and dotted keys", "title = 'x' # comment\n[server]\nport = 9000\ntls.enabled = false\n",
+			map[string]interface{}{"title": "x", "server": map[string]interface{}{"port": float64(9000), "tls": map[string]interface{}{"enabled": false}}}, ""},
+		{"array of tables", "[[faults]]\nmodule = 'a'\n[[faults]]\nmodule = 'b'\n",
+			map[string]interface{}{"faults": []interface{}{map[string]interface{}{"module": "a"}, map[string]interface{}{"module": "b"}}}, ""},
+		{"multi-line array", "hosts = [\n  'a', # first\n  'b',\n]\n",
+			map[string]interface{}{"hosts": []interface{}{"a", "b"}}, ""},
+		{"duplicated key", "a = 1\na = 2\n", nil, "toml line 2: duplicated key [a]"},
+		{"leading zero", "[server]\nport = 08001\n", nil, "toml line 2: leading zeros are not allowed"},
+		{"not a table", "a = 1\n[a.b]\n", nil, "key [a] is not a table"},
+		{"missing equals", "a\n", nil, "toml line 1: expected [key = value]"},
+		{"invalid bare key", "a b = 1\n", nil, "invalid bare key"},
+	}
+	for _, testCase := range testCases {
+		document, err := ParseToml([]byte(testCase.content))
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v: expected an error containing %q, got %v", testCase.name, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(document, testCase.expected) {
+			t.Errorf("%v: expected %v, got %v (%v)", testCase.name, testCase.expected, document, err)
+		}
+	}
+}
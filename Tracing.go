@@ -0,0 +1,384 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trace propagation headers; W3C trace context and B3 (single and multi header)
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+	HeaderB3          = "b3"
+	HeaderB3TraceId   = "X-B3-TraceId"
+	HeaderB3SpanId    = "X-B3-SpanId"
+	HeaderB3Sampled   = "X-B3-Sampled"
+)
+
+// request attribute holding the server span of the request
+const spanRequestAttribute = "echogogo.span"
+
+// span kinds as numbered by OTLP
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+)
+
+// trace context formats (how the context was received and is echoed back)
+const (
+	traceFormatW3C      = "w3c"
+	traceFormatB3Single = "b3"
+	traceFormatB3Multi  = "b3multi"
+)
+
+// structure of a trace context; ids are lower case hex (32 and 16 chars). A context without ids carries
+// the sampling decision only (b3: 0, 1 or d)
+type SpanContext struct {
+	TraceId    string
+	SpanId     string
+	IsSampled  bool
+	TraceState string
+	format     string
+}
+
+// structure of a span; exported in the OTLP json format once ended
+type Span struct {
+	Context      SpanContext
+	ParentSpanId string
+	Name         string
+	Kind         int
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	IsError      bool
+
+	tracer *Tracer
+}
+
+// structure creating spans and exporting the sampled ones
+type Tracer struct {
+	serviceName string
+	exporter    SpanExporter
+}
+
+// interface of a span exporter
+type SpanExporter interface {
+	Export(span *Span) error
+	Close() error
+}
+
+// exporter writing every span as a line of OTLP json (the format of the OpenTelemetry collector's file exporter)
+type otlpJsonExporter struct {
+	lock        sync.Mutex
+	writer      io.Writer
+	closer      io.Closer
+	serviceName string
+}
+
+// ctor. Create instance of *Tracer exporting to stdout or (appending) to the given file
+func NewTracer(tracingConfig TracingConfig) (*Tracer, error) {
+	exporter := &otlpJsonExporter{writer: os.Stdout, serviceName: tracingConfig.ServiceName}
+	if tracingConfig.Exporter == TracingExporterFile {
+		file, err := os.OpenFile(tracingConfig.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %v", err)
+		}
+		exporter.writer = file
+		exporter.closer = file
+	}
+	return &Tracer{serviceName: tracingConfig.ServiceName, exporter: exporter}, nil
+}
+
+// method to start a span; a child of the parent context or the root of a new trace if there is no parent
+// (or the parent carries a sampling decision only)
+func (t *Tracer) StartSpan(name string, kind int, parent *SpanContext) *Span {
+	span := &Span{Name: name, Kind: kind, StartTime: time.Now(), Attributes: make(map[string]interface{}), tracer: t}
+	span.Context = SpanContext{TraceId: _newTraceId(16), SpanId: _newTraceId(8), IsSampled: true, format: traceFormatW3C}
+	if parent != nil {
+		span.Context.IsSampled = parent.IsSampled
+		span.Context.TraceState = parent.TraceState
+		span.Context.format = parent.format
+		if parent.TraceId != "" {
+			span.Context.TraceId = parent.TraceId
+			span.ParentSpanId = parent.SpanId
+		}
+	}
+	return span
+}
+
+// method to end the span; exported if sampled
+func (s *Span) End() {
+	s.EndTime = time.Now()
+	if !s.Context.IsSampled || s.tracer == nil {
+		return
+	}
+	if err := s.tracer.exporter.Export(s); err != nil {
+		fmt.Fprintf(os.Stderr, "tracing: failed to export span %v => %v\n", s.Context.SpanId, err)
+	}
+}
+
+// method to close the tracer's exporter
+func (t *Tracer) Close() error {
+	return t.exporter.Close()
+}
+
+// method to write the span as a line of OTLP json
+func (e *otlpJsonExporter) Export(span *Span) error {
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attributes := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		attributes = append(attributes, map[string]interface{}{"key": key, "value": _otlpAnyValue(span.Attributes[key])})
+	}
+	// 1 = OK, 2 = ERROR
+	statusCode := 1
+	if span.IsError {
+		statusCode = 2
+	}
+	otlpSpan := map[string]interface{}{
+		"traceId":           span.Context.TraceId,
+		"spanId":            span.Context.SpanId,
+		"name":              span.Name,
+		"kind":              span.Kind,
+		"startTimeUnixNano": strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            map[string]interface{}{"code": statusCode},
+	}
+	if span.ParentSpanId != "" {
+		otlpSpan["parentSpanId"] = span.ParentSpanId
+	}
+	if span.Context.TraceState != "" {
+		otlpSpan["traceState"] = span.Context.TraceState
+	}
+	bArrContent, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []interface{}{
+				map[string]interface{}{"key": "service.name", "value": _otlpAnyValue(e.serviceName)},
+			}},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "echogogo"},
+				"spans": []interface{}{otlpSpan},
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	_, err = e.writer.Write(append(bArrContent, '\n'))
+	return err
+}
+
+// method to close the file exporter (stdout is left open)
+func (e *otlpJsonExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// method to convert an attribute value to an OTLP AnyValue
+func _otlpAnyValue(value interface{}) map[string]interface{} {
+	switch value.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": value}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(value.(int))}
+	case float64:
+		return map[string]interface{}{"doubleValue": value}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprintf("%v", value)}
+}
+
+// method to parse the trace context of the request; W3C traceparent wins over B3. Nil if there is
+// none or it is malformed (the request then starts a new trace)
+func ParseTraceContext(header http.Header) *SpanContext {
+	if traceParent := header.Get(HeaderTraceParent); traceParent != "" {
+		// version 00 has exactly 4 parts; later versions may append more
+		parts := strings.Split(strings.TrimSpace(traceParent), "-")
+		if len(parts) < 4 || (parts[0] == "00" && len(parts) > 4) || len(parts[0]) != 2 || parts[0] == "ff" || !_isTraceId(parts[1], 32) || !_isTraceId(parts[2], 16) || len(parts[3]) != 2 {
+			return nil
+		}
+		flags, err := strconv.ParseUint(parts[3], 16, 8)
+		if err != nil {
+			return nil
+		}
+		return &SpanContext{TraceId: parts[1], SpanId: parts[2], IsSampled: flags&1 == 1,
+			TraceState: header.Get(HeaderTraceState), format: traceFormatW3C}
+	}
+	// b3: {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}, or the sampling state only (0, 1 or d)
+	if b3 := header.Get(HeaderB3); b3 != "" {
+		parts := strings.Split(strings.TrimSpace(b3), "-")
+		if len(parts) == 1 {
+			switch parts[0] {
+			case "0", "1", "d":
+				return &SpanContext{IsSampled: parts[0] != "0", format: traceFormatB3Single}
+			}
+			return nil
+		}
+		sampled := ""
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+		return _newB3SpanContext(parts[0], parts[1], sampled, traceFormatB3Single)
+	}
+	if traceId := header.Get(HeaderB3TraceId); traceId != "" {
+		return _newB3SpanContext(traceId, header.Get(HeaderB3SpanId), header.Get(HeaderB3Sampled), traceFormatB3Multi)
+	}
+	return nil
+}
+
+// method to create the span context out of the b3 values; 64 bit trace ids are left padded
+func _newB3SpanContext(traceId, spanId, sampled, format string) *SpanContext {
+	traceId = strings.ToLower(traceId)
+	spanId = strings.ToLower(spanId)
+	if len(traceId) == 16 {
+		traceId = strings.Repeat("0", 16) + traceId
+	}
+	if !_isTraceId(traceId, 32) || !_isTraceId(spanId, 16) {
+		return nil
+	}
+	// "d" (debug) implies sampled; no sampling decision means sampled
+	return &SpanContext{TraceId: traceId, SpanId: spanId, IsSampled: sampled != "0" && sampled != "false", format: format}
+}
+
+// method to set the trace context headers (same format as received) on the response
+func (c SpanContext) WriteHeaders(header http.Header) {
+	sampled := "0"
+	if c.IsSampled {
+		sampled = "1"
+	}
+	// 64 bit b3 trace ids were left padded; sent back as received
+	b3TraceId := c.TraceId
+	if strings.HasPrefix(b3TraceId, strings.Repeat("0", 16)) {
+		b3TraceId = b3TraceId[16:]
+	}
+	switch c.format {
+	case traceFormatB3Single:
+		header.Set(HeaderB3, fmt.Sprintf("%v-%v-%v", b3TraceId, c.SpanId, sampled))
+	case traceFormatB3Multi:
+		header.Set(HeaderB3TraceId, b3TraceId)
+		header.Set(HeaderB3SpanId, c.SpanId)
+		header.Set(HeaderB3Sampled, sampled)
+	default:
+		header.Set(HeaderTraceParent, fmt.Sprintf("00-%v-%v-0%v", c.TraceId, c.SpanId, sampled))
+		if c.TraceState != "" {
+			header.Set(HeaderTraceState, c.TraceState)
+		}
+	}
+}
+
+// method to check the value is a non-zero lower case hex id of the given length
+func _isTraceId(value string, length int) bool {
+	if len(value) != length || value == strings.Repeat("0", length) {
+		return false
+	}
+	for _, char := range value {
+		if !(char >= '0' && char <= '9' || char >= 'a' && char <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// method to generate a random id of the given number of bytes (hex encoded)
+func _newTraceId(size int) string {
+	bArrId := make([]byte, size)
+	if _, err := rand.Read(bArrId); err != nil {
+		// fallback; time based ids are good enough for a mock server
+		copy(bArrId, strconv.FormatInt(time.Now().UnixNano(), 16))
+	}
+	return hex.EncodeToString(bArrId)
+}
+
+// setup the tracing filter; a server span per request (child of the received trace context, if any)
+// with the trace context echoed back on the response
+func (srv *Server) setupTracing(wsContainer *restful.Container) error {
+	tracingConfig := srv.configContentJson.Tracing
+	if !tracingConfig.Enabled {
+		return nil
+	}
+	tracer, err := NewTracer(tracingConfig)
+	if err != nil {
+		return err
+	}
+	srv.tracer = tracer
+	wsContainer.Filter(srv._tracingFilter)
+
+	srv.logger.LogWithFuncName(fmt.Sprintf("tracing enabled; spans exported to %v", tracingConfig.Exporter), "setupTracing", srv.logConfig)
+	return nil
+}
+
+// container filter creating the server span of the request
+func (srv *Server) _tracingFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	routePath := request.SelectedRoutePath()
+	spanName := request.Request.Method
+	if routePath != "" {
+		spanName = fmt.Sprintf("%v %v", request.Request.Method, routePath)
+	}
+	span := srv.tracer.StartSpan(spanName, SpanKindServer, ParseTraceContext(request.Request.Header))
+	span.Attributes["http.method"] = request.Request.Method
+	span.Attributes["http.target"] = request.Request.URL.RequestURI()
+	if routePath != "" {
+		span.Attributes["http.route"] = routePath
+	}
+	if requestId, ok := request.Attribute(requestIdRequestAttribute).(string); ok {
+		span.Attributes["http.request_id"] = requestId
+	}
+	// the span id sent back is the server span's; the caller sees echogogo as its child
+	span.Context.WriteHeaders(response.Header())
+	request.SetAttribute(spanRequestAttribute, span)
+
+	chain.ProcessFilter(request, response)
+
+	span.Attributes["http.status_code"] = response.StatusCode()
+	span.IsError = response.StatusCode() >= http.StatusInternalServerError
+	span.End()
+}
+
+// method to start a span (child of the request's server span) around a module's DoAction; nil if tracing is disabled
+func (srv *Server) _startActionSpan(request *restful.Request, modulePtr *EchoModule) *Span {
+	serverSpan, ok := request.Attribute(spanRequestAttribute).(*Span)
+	if !ok || srv.tracer == nil {
+		return nil
+	}
+	span := srv.tracer.StartSpan(fmt.Sprintf("DoAction %v", modulePtr.WebservicePath), SpanKindInternal, &serverSpan.Context)
+	span.Attributes["echogogo.module"] = modulePtr.WebservicePath
+	span.Attributes["echogogo.module.file"] = modulePtr.ModulePath
+	serverSpan.Attributes["echogogo.module"] = modulePtr.WebservicePath
+	return span
+}
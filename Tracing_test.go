@@ -0,0 +1,229 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanId  = "00f067aa0ba902b7"
+)
+
+// exporter keeping the ended spans
+type recordingSpanExporter struct {
+	spans []*Span
+}
+
+func (e *recordingSpanExporter) Export(span *Span) error {
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+func (e *recordingSpanExporter) Close() error {
+	return nil
+}
+
+func TestParseTraceContext(t *testing.T) {
+	testCases := []struct {
+		name      string
+		header    map[string]string
+		traceId   string // empty if no context is expected
+		spanId    string
+		isSampled bool
+		format    string
+	}{
+		{"traceparent", map[string]string{"traceparent": "00-" + testTraceId + "-" + testSpanId + "-01", "tracestate": "vendor=1"}, testTraceId, testSpanId, true, traceFormatW3C},
+		{"traceparent not sampled", map[string]string{"traceparent": "00-" + testTraceId + "-" + testSpanId + "-00"}, testTraceId, testSpanId, false, traceFormatW3C},
+		{"traceparent of a later version", map[string]string{"traceparent": "01-" + testTraceId + "-" + testSpanId + "-01-extra"}, testTraceId, testSpanId, true, traceFormatW3C},
+		{"traceparent 00 with extra parts", map[string]string{"traceparent": "00-" + testTraceId + "-" + testSpanId + "-01-extra"}, "", "", false, ""},
+		{"traceparent version ff", map[string]string{"traceparent": "ff-" + testTraceId + "-" + testSpanId + "-01"}, "", "", false, ""},
+		{"traceparent upper case", map[string]string{"traceparent": "00-" + strings.ToUpper(testTraceId) + "-" + testSpanId + "-01"}, "", "", false, ""},
+		{"traceparent zero trace id", map[string]string{"traceparent": "00-" + strings.Repeat("0", 32) + "-" + testSpanId + "-01"}, "", "", false, ""},
+		{"traceparent wins over b3", map[string]string{"traceparent": "00-" + testTraceId + "-" + testSpanId + "-01", "b3": "0"}, testTraceId, testSpanId, true, traceFormatW3C},
+		{"b3 single", map[string]string{"b3": testTraceId + "-" + testSpanId + "-1-05e3ac9a4f6e3b90"}, testTraceId, testSpanId, true, traceFormatB3Single},
+		{"b3 single 64 bit trace id", map[string]string{"b3": "a3ce929d0e0e4736-" + testSpanId + "-0"}, "0000000000000000a3ce929d0e0e4736", testSpanId, false, traceFormatB3Single},
+		{"b3 single without sampling state", map[string]string{"b3": testTraceId + "-" + testSpanId}, testTraceId, testSpanId, true, traceFormatB3Single},
+		{"b3 single debug", map[string]string{"b3": testTraceId + "-" + testSpanId + "-d"}, testTraceId, testSpanId, true, traceFormatB3Single},
+		{"b3 sampling only 0", map[string]string{"b3": "0"}, "", "", false, traceFormatB3Single},
+		{"b3 sampling only 1", map[string]string{"b3": "1"}, "", "", true, traceFormatB3Single},
+		{"b3 sampling only d", map[string]string{"b3": "d"}, "", "", true, traceFormatB3Single},
+		{"b3 single malformed", map[string]string{"b3": "x"}, "", "", false, ""},
+		{"b3 multi", map[string]string{"X-B3-TraceId": testTraceId, "X-B3-SpanId": testSpanId, "X-B3-Sampled": "0"}, testTraceId, testSpanId, false, traceFormatB3Multi},
+		{"b3 multi without span id", map[string]string{"X-B3-TraceId": testTraceId}, "", "", false, ""},
+		{"none", map[string]string{}, "", "", false, ""},
+	}
+	for _, testCase := range testCases {
+		header := make(http.Header)
+		for name, value := range testCase.header {
+			header.Set(name, value)
+		}
+		spanContext := ParseTraceContext(header)
+		if testCase.format == "" {
+			if spanContext != nil {
+				t.Errorf("%v: expected no trace context, got %+v", testCase.name, spanContext)
+			}
+			continue
+		}
+		if spanContext == nil {
+			t.Errorf("%v: expected a trace context", testCase.name)
+			continue
+		}
+		if spanContext.TraceId != testCase.traceId || spanContext.SpanId != testCase.spanId ||
+			spanContext.IsSampled != testCase.isSampled || spanContext.format != testCase.format {
+			t.Errorf("%v: expected %v-%v sampled=%v (%v), got %+v", testCase.name, testCase.traceId, testCase.spanId,
+				testCase.isSampled, testCase.format, spanContext)
+		}
+	}
+	if spanContext := ParseTraceContext(http.Header{"Traceparent": {"00-" + testTraceId + "-" + testSpanId + "-01"}, "Tracestate": {"vendor=1"}}); spanContext.TraceState != "vendor=1" {
+		t.Errorf("expected the tracestate kept, got %+v", spanContext)
+	}
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	exporter := new(recordingSpanExporter)
+	srv := NewServer("")
+	srv.logger.Sink = new(recordingSink)
+	srv.tracer = &Tracer{serviceName: "echogogo", exporter: exporter}
+	wsContainerPtr := restful.NewContainer()
+	wsContainerPtr.Filter(srv._tracingFilter)
+	modulePtr := newTestEchoModule("orders.so", "/orders")
+	if err := srv._setupRestForModule(modulePtr, wsContainerPtr); err != nil {
+		t.Fatal(err)
+	}
+	srv.modules[modulePtr.ModulePath] = modulePtr
+
+	testCases := []struct {
+		name           string
+		header         map[string]string
+		responseHeader string
+		prefix         string // of the response header; the span id is echogogo's
+		parentSpanId   string
+		spanCount      int // exported
+	}{
+		{"traceparent", map[string]string{"traceparent": "00-" + testTraceId + "-" + testSpanId + "-01"}, "traceparent", "00-" + testTraceId + "-", testSpanId, 2},
+		{"b3 single", map[string]string{"b3": testTraceId + "-" + testSpanId + "-1"}, "b3", testTraceId + "-", testSpanId, 2},
+		{"b3 multi", map[string]string{"X-B3-TraceId": "a3ce929d0e0e4736", "X-B3-SpanId": testSpanId, "X-B3-Sampled": "1"}, "X-B3-TraceId", "a3ce929d0e0e4736", testSpanId, 2},
+		{"not sampled", map[string]string{"traceparent": "00-" + testTraceId + "-" + testSpanId + "-00"}, "traceparent", "00-" + testTraceId + "-", testSpanId, 0},
+		{"b3 sampling only 0", map[string]string{"b3": "0"}, "b3", "", "", 0},
+		{"new trace", map[string]string{}, "traceparent", "00-", "", 2},
+	}
+	for _, testCase := range testCases {
+		exporter.spans = nil
+		request := httptest.NewRequest(http.MethodGet, "/orders/", nil)
+		for name, value := range testCase.header {
+			request.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		wsContainerPtr.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%v: expected 200, got %v", testCase.name, recorder.Code)
+		}
+		if value := recorder.Header().Get(testCase.responseHeader); value == "" || !strings.HasPrefix(value, testCase.prefix) || strings.Contains(value, testSpanId) {
+			t.Errorf("%v: expected %v to start with %q and carry echogogo's span id, got %q", testCase.name, testCase.responseHeader, testCase.prefix, value)
+		}
+		if len(exporter.spans) != testCase.spanCount {
+			t.Errorf("%v: expected %v spans exported, got %v", testCase.name, testCase.spanCount, len(exporter.spans))
+			continue
+		}
+		if testCase.spanCount == 0 {
+			continue
+		}
+		// the action span ends first and is a child of the server span
+		actionSpan, serverSpan := exporter.spans[0], exporter.spans[1]
+		if serverSpan.Name != "GET /orders/" || serverSpan.Kind != SpanKindServer || serverSpan.ParentSpanId != testCase.parentSpanId {
+			t.Errorf("%v: unexpected server span %+v", testCase.name, serverSpan)
+		}
+		if actionSpan.Name != "DoAction /orders" || actionSpan.ParentSpanId != serverSpan.Context.SpanId || actionSpan.Context.TraceId != serverSpan.Context.TraceId {
+			t.Errorf("%v: expected the action span to be a child of the server span, got %+v", testCase.name, actionSpan)
+		}
+		if serverSpan.Attributes["http.status_code"] != http.StatusOK || serverSpan.Attributes["http.route"] != "/orders/" {
+			t.Errorf("%v: unexpected server span attributes %v", testCase.name, serverSpan.Attributes)
+		}
+	}
+}
+
+func TestOtlpJsonExport(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	tracer := &Tracer{serviceName: "orders-mock", exporter: &otlpJsonExporter{writer: buffer, serviceName: "orders-mock"}}
+	span := tracer.StartSpan("GET /orders/{id}", SpanKindServer, &SpanContext{TraceId: testTraceId, SpanId: testSpanId, IsSampled: true, TraceState: "vendor=1"})
+	span.StartTime = time.Unix(1, 0)
+	span.Attributes["http.status_code"] = 503
+	span.Attributes["http.method"] = "GET"
+	span.Attributes["echogogo.cached"] = false
+	span.IsError = true
+	span.End()
+	// not sampled; not exported
+	tracer.StartSpan("GET /orders", SpanKindServer, &SpanContext{TraceId: testTraceId, SpanId: testSpanId}).End()
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected a single line, got %v", lines)
+	}
+	var exported struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]interface{} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []map[string]interface{} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &exported); err != nil {
+		t.Fatal(err)
+	}
+	resourceSpans := exported.ResourceSpans[0]
+	if serviceName := resourceSpans.Resource.Attributes[0]; serviceName["key"] != "service.name" || serviceName["value"].(map[string]interface{})["stringValue"] != "orders-mock" {
+		t.Errorf("expected the service name, got %v", serviceName)
+	}
+	otlpSpan := resourceSpans.ScopeSpans[0].Spans[0]
+	expected := map[string]interface{}{
+		"traceId":           testTraceId,
+		"spanId":            span.Context.SpanId,
+		"parentSpanId":      testSpanId,
+		"traceState":        "vendor=1",
+		"name":              "GET /orders/{id}",
+		"kind":              float64(SpanKindServer),
+		"startTimeUnixNano": "1000000000",
+	}
+	for key, value := range expected {
+		if otlpSpan[key] != value {
+			t.Errorf("%v: expected %v, got %v", key, value, otlpSpan[key])
+		}
+	}
+	if status := otlpSpan["status"].(map[string]interface{}); status["code"] != float64(2) {
+		t.Errorf("expected the error status, got %v", status)
+	}
+	// sorted by key, typed as OTLP AnyValue(s)
+	bArrAttributes, _ := json.Marshal(otlpSpan["attributes"])
+	expectedAttributes := `[{"key":"echogogo.cached","value":{"boolValue":false}},{"key":"http.method","value":{"stringValue":"GET"}},{"key":"http.status_code","value":{"intValue":"503"}}]`
+	if string(bArrAttributes) != expectedAttributes {
+		t.Errorf("expected %v, got %v", expectedAttributes, string(bArrAttributes))
+	}
+}
@@ -0,0 +1,505 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compiled "pattern"(s) of JSON Schemas
+var jsonSchemaPatternCache sync.Map
+
+// keywords of a JSON Schema accepted by CompileRequestSchemas (validated or annotations only); the ones
+// holding sub schemas or a pattern are checked by _compileJsonSchema itself
+var jsonSchemaKeywords = map[string]bool{
+	"type": true, "nullable": true, "enum": true, "const": true, "minLength": true, "maxLength": true, "format": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true, "multipleOf": true,
+	"required": true, "minProperties": true, "maxProperties": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	// annotations (OpenAPI ones included)
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true, "example": true,
+	"examples": true, "readOnly": true, "writeOnly": true, "deprecated": true, "xml": true, "externalDocs": true, "discriminator": true,
+}
+
+// "uuid" format of a JSON Schema
+var jsonSchemaUuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// structure of a single validation error
+type ValidationError struct {
+	Location string `json:"location" description:"query, header, body..."`
+	Field    string `json:"field" description:"name of the parameter or path into the body e.g. $.items[0].id"`
+	Message  string `json:"message"`
+}
+
+// method to validate a request against the schema description of its endpoint; the description
+// is the same one used for the OpenAPI document (see OpenApi.go):
+//
+//	requiredQueryParameters, requiredHeaders ([]string), requestBodyRequired (bool),
+//	requestSchema (JSON Schema, for json bodies) and requestXsd (xml schema, for xml bodies)
+func ValidateRequest(schemaInfo map[string]interface{}, data *RequestData) []ValidationError {
+	validationErrors := make([]ValidationError, 0)
+	if schemaInfo == nil {
+		return validationErrors
+	}
+	for _, name := range _toStringSlice(schemaInfo["requiredQueryParameters"]) {
+		if _, ok := data.Query[name]; !ok {
+			validationErrors = append(validationErrors, ValidationError{Location: "query", Field: name, Message: "required query parameter missing"})
+		}
+	}
+	for _, name := range _toStringSlice(schemaInfo["requiredHeaders"]) {
+		if _, ok := data.Headers[http.CanonicalHeaderKey(name)]; !ok {
+			validationErrors = append(validationErrors, ValidationError{Location: "header", Field: name, Message: "required header missing"})
+		}
+	}
+	requestSchema, hasJsonSchema := schemaInfo["requestSchema"].(map[string]interface{})
+	requestXsd, hasXsd := schemaInfo["requestXsd"].(string)
+	isBodyRequired, _ := schemaInfo["requestBodyRequired"].(bool)
+	if len(data.Body) == 0 {
+		if isBodyRequired {
+			validationErrors = append(validationErrors, ValidationError{Location: "body", Field: "$", Message: "request body required"})
+		}
+		return validationErrors
+	}
+	// the schema applied follows the content type; xml bodies use the xsd, anything else the JSON Schema
+	if strings.Contains(data.Headers.Get("Content-Type"), "xml") || (hasXsd && !hasJsonSchema) {
+		if !hasXsd {
+			return validationErrors
+		}
+		xmlSchema, err := CompileXmlSchema(requestXsd)
+		if err != nil {
+			return append(validationErrors, ValidationError{Location: "body", Field: "/", Message: err.Error()})
+		}
+		document, err := data.XmlBody()
+		if err != nil {
+			return append(validationErrors, ValidationError{Location: "body", Field: "/", Message: fmt.Sprintf("body is not valid xml (%v)", err)})
+		}
+		return append(validationErrors, xmlSchema.Validate(document)...)
+	}
+	if hasJsonSchema {
+		document, err := data.JsonBody()
+		if err != nil {
+			return append(validationErrors, ValidationError{Location: "body", Field: "$", Message: fmt.Sprintf("body is not valid json (%v)", err)})
+		}
+		validationErrors = append(validationErrors, ValidateJsonSchema(requestSchema, document, "$")...)
+	}
+	return validationErrors
+}
+
+// method to create the 400 response listing the validation errors of a request
+func _newValidationErrorResponse(validationErrors []ValidationError) *StubResponse {
+	response := new(StubResponse)
+	response.Status = http.StatusBadRequest
+	response.Body = map[string]interface{}{
+		"error":            "request validation failed",
+		"validationErrors": validationErrors,
+	}
+	return response
+}
+
+// method to get the schema description of an endpoint of the module e.g. POST + /orders/{id} => "POST::/{id}"
+func (m *EchoModule) endPointSchema(method string, routePath string) map[string]interface{} {
+	endPoint := fmt.Sprintf("%v::/%v", method, strings.TrimLeft(strings.TrimPrefix(routePath, m.WebservicePath), "/"))
+	schemaInfo, _ := m.Schemas[endPoint].(map[string]interface{})
+	return schemaInfo
+}
+
+// method to check the request schemas of a module's endpoints upfront (JSON Schema keywords, regular expressions
+// and xml schemas)
+func CompileRequestSchemas(schemas map[string]interface{}) error {
+	for endPoint, element := range schemas {
+		schemaInfo, ok := element.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("schemas [%v]: expected an object", endPoint)
+		}
+		if requestXsd, ok := schemaInfo["requestXsd"].(string); ok {
+			if _, err := CompileXmlSchema(requestXsd); err != nil {
+				return fmt.Errorf("schemas [%v]: %v", endPoint, err)
+			}
+		}
+		if requestSchema, ok := schemaInfo["requestSchema"].(map[string]interface{}); ok {
+			if err := _compileJsonSchema(requestSchema, "#"); err != nil {
+				return fmt.Errorf("schemas [%v]: %v", endPoint, err)
+			}
+		}
+	}
+	return nil
+}
+
+// method to validate a decoded json value against a (subset of) JSON Schema:
+// type (incl. a list of types) / nullable, enum, const, allOf / anyOf / oneOf / not,
+// minLength, maxLength, pattern, format, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf,
+// required, properties, additionalProperties, minProperties, maxProperties,
+// items, minItems, maxItems and uniqueItems
+func ValidateJsonSchema(schema map[string]interface{}, value interface{}, path string) []ValidationError {
+	validationErrors := make([]ValidationError, 0)
+	addError := func(format string, args ...interface{}) {
+		validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if isNullable, _ := schema["nullable"].(bool); isNullable && value == nil {
+		return validationErrors
+	}
+	if schemaTypes := _getJsonSchemaTypes(schema["type"]); len(schemaTypes) > 0 {
+		isTypeMatched := false
+		for _, schemaType := range schemaTypes {
+			if _isJsonType(value, schemaType) {
+				isTypeMatched = true
+				break
+			}
+		}
+		if !isTypeMatched {
+			addError("expected type %v but was %v", strings.Join(schemaTypes, " or "), _jsonTypeOf(value))
+			return validationErrors
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		isFound := false
+		for _, candidate := range enum {
+			if JsonValueToString(candidate) == JsonValueToString(value) {
+				isFound = true
+				break
+			}
+		}
+		if !isFound {
+			addError("value %v is not one of %v", JsonValueToString(value), JsonValueToString(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && JsonValueToString(constant) != JsonValueToString(value) {
+		addError("value %v is not equal to %v", JsonValueToString(value), JsonValueToString(constant))
+	}
+	// combinators
+	if subSchemas, ok := schema["allOf"].([]interface{}); ok {
+		for _, element := range subSchemas {
+			if subSchema, ok := element.(map[string]interface{}); ok {
+				validationErrors = append(validationErrors, ValidateJsonSchema(subSchema, value, path)...)
+			}
+		}
+	}
+	if subSchemas, ok := schema["anyOf"].([]interface{}); ok && _countValidJsonSchemas(subSchemas, value, path) == 0 {
+		addError("value does not match any of the anyOf schemas")
+	}
+	if subSchemas, ok := schema["oneOf"].([]interface{}); ok {
+		if count := _countValidJsonSchemas(subSchemas, value, path); count != 1 {
+			addError("value must match exactly one of the oneOf schemas but matched %v", count)
+		}
+	}
+	if subSchema, ok := schema["not"].(map[string]interface{}); ok && len(ValidateJsonSchema(subSchema, value, path)) == 0 {
+		addError("value must not match the \"not\" schema")
+	}
+	switch value.(type) {
+	case string:
+		text := value.(string)
+		length := float64(len([]rune(text)))
+		if limit, ok := schema["minLength"].(float64); ok && length < limit {
+			addError("length %v is less than minLength %v", length, limit)
+		}
+		if limit, ok := schema["maxLength"].(float64); ok && length > limit {
+			addError("length %v is greater than maxLength %v", length, limit)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if compiled, err := _getJsonSchemaPattern(pattern); err != nil || !compiled.MatchString(text) {
+				addError("value %v does not match pattern %v", text, pattern)
+			}
+		}
+		if format, ok := schema["format"].(string); ok && !_isJsonSchemaFormat(format, text) {
+			addError("value %v is not a valid %v", text, format)
+		}
+	case float64:
+		number := value.(float64)
+		if limit, ok := schema["minimum"].(float64); ok {
+			// draft 4 / OpenAPI 3.0 style boolean exclusiveMinimum
+			if isExclusive, _ := schema["exclusiveMinimum"].(bool); (isExclusive && number <= limit) || number < limit {
+				addError("value %v is less than the minimum %v", number, limit)
+			}
+		}
+		if limit, ok := schema["maximum"].(float64); ok {
+			if isExclusive, _ := schema["exclusiveMaximum"].(bool); (isExclusive && number >= limit) || number > limit {
+				addError("value %v is greater than the maximum %v", number, limit)
+			}
+		}
+		if limit, ok := schema["exclusiveMinimum"].(float64); ok && number <= limit {
+			addError("value %v must be greater than %v", number, limit)
+		}
+		if limit, ok := schema["exclusiveMaximum"].(float64); ok && number >= limit {
+			addError("value %v must be less than %v", number, limit)
+		}
+		if divisor, ok := schema["multipleOf"].(float64); ok && divisor > 0 {
+			if quotient := number / divisor; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+				addError("value %v is not a multiple of %v", number, divisor)
+			}
+		}
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		for _, name := range _toStringSlice(schema["required"]) {
+			if _, ok := object[name]; !ok {
+				validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path + "." + name, Message: "required property missing"})
+			}
+		}
+		if limit, ok := schema["minProperties"].(float64); ok && float64(len(object)) < limit {
+			addError("object has less than %v properties", limit)
+		}
+		if limit, ok := schema["maxProperties"].(float64); ok && float64(len(object)) > limit {
+			addError("object has more than %v properties", limit)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+				validationErrors = append(validationErrors, ValidateJsonSchema(propertySchema, object[name], path+"."+name)...)
+				continue
+			}
+			if _, isDeclared := properties[name]; isDeclared {
+				continue
+			}
+			switch additionalProperties := schema["additionalProperties"].(type) {
+			case bool:
+				if !additionalProperties {
+					validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path + "." + name, Message: "additional property not allowed"})
+				}
+			case map[string]interface{}:
+				validationErrors = append(validationErrors, ValidateJsonSchema(additionalProperties, object[name], path+"."+name)...)
+			}
+		}
+	case []interface{}:
+		items := value.([]interface{})
+		if limit, ok := schema["minItems"].(float64); ok && float64(len(items)) < limit {
+			addError("array has less than %v items", limit)
+		}
+		if limit, ok := schema["maxItems"].(float64); ok && float64(len(items)) > limit {
+			addError("array has more than %v items", limit)
+		}
+		if isUnique, _ := schema["uniqueItems"].(bool); isUnique {
+			seen := make(map[string]bool)
+			for idx, item := range items {
+				key := JsonValueToString(item)
+				if seen[key] {
+					addError("item #%v is a duplicate, items must be unique", idx)
+					break
+				}
+				seen[key] = true
+			}
+		}
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for idx, item := range items {
+				validationErrors = append(validationErrors, ValidateJsonSchema(itemSchema, item, fmt.Sprintf("%v[%v]", path, idx))...)
+			}
+		}
+	}
+	return validationErrors
+}
+
+// method to count the sub schemas the value is valid against (anyOf / oneOf)
+func _countValidJsonSchemas(subSchemas []interface{}, value interface{}, path string) int {
+	count := 0
+	for _, element := range subSchemas {
+		if subSchema, ok := element.(map[string]interface{}); ok && len(ValidateJsonSchema(subSchema, value, path)) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// method to read "type" which is either a single type or a list of types
+func _getJsonSchemaTypes(value interface{}) []string {
+	if schemaType, ok := value.(string); ok {
+		return []string{schemaType}
+	}
+	return _toStringSlice(value)
+}
+
+// method to get a (cached) compiled pattern of a JSON Schema
+func _getJsonSchemaPattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := jsonSchemaPatternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	jsonSchemaPatternCache.Store(pattern, compiled)
+	return compiled, nil
+}
+
+// method to check a JSON Schema upfront; every keyword must be one validated (or an annotation) and every
+// pattern must compile. Unsupported keywords e.g. $ref, definitions or $defs are errors instead of being
+// silently ignored (which would accept any body). pointer locates the schema e.g. #/properties/items
+func _compileJsonSchema(schema map[string]interface{}, pointer string) error {
+	keywords := make([]string, 0, len(schema))
+	for keyword := range schema {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		value := schema[keyword]
+		keywordPointer := pointer + "/" + keyword
+		switch keyword {
+		case "pattern":
+			pattern, _ := value.(string)
+			if _, err := _getJsonSchemaPattern(pattern); err != nil {
+				return fmt.Errorf("invalid pattern [%v] at %v: %v", pattern, keywordPointer, err)
+			}
+		case "not", "items":
+			subSchema, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%v must be a schema object", keywordPointer)
+			}
+			if err := _compileJsonSchema(subSchema, keywordPointer); err != nil {
+				return err
+			}
+		case "additionalProperties":
+			if subSchema, ok := value.(map[string]interface{}); ok {
+				if err := _compileJsonSchema(subSchema, keywordPointer); err != nil {
+					return err
+				}
+			} else if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%v must be a boolean or a schema object", keywordPointer)
+			}
+		case "allOf", "anyOf", "oneOf":
+			subSchemas, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%v must be a list of schema objects", keywordPointer)
+			}
+			for idx, element := range subSchemas {
+				subSchema, ok := element.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%v/%v must be a schema object", keywordPointer, idx)
+				}
+				if err := _compileJsonSchema(subSchema, fmt.Sprintf("%v/%v", keywordPointer, idx)); err != nil {
+					return err
+				}
+			}
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%v must be an object", keywordPointer)
+			}
+			names := make([]string, 0, len(properties))
+			for name := range properties {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				subSchema, ok := properties[name].(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%v/%v must be a schema object", keywordPointer, name)
+				}
+				if err := _compileJsonSchema(subSchema, keywordPointer+"/"+name); err != nil {
+					return err
+				}
+			}
+		default:
+			if !jsonSchemaKeywords[keyword] {
+				return fmt.Errorf("unsupported JSON Schema keyword [%v] at %v", keyword, pointer)
+			}
+		}
+	}
+	return nil
+}
+
+// method to check a string against a JSON Schema format; unknown formats are accepted
+func _isJsonSchemaFormat(format string, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "email":
+		_, err := mail.ParseAddress(value)
+		return err == nil && !strings.Contains(value, " ")
+	case "uuid":
+		return jsonSchemaUuidPattern.MatchString(value)
+	case "uri":
+		parsed, err := url.Parse(value)
+		return err == nil && parsed.Scheme != ""
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && strings.Contains(value, ".")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	default:
+		return true
+	}
+}
+
+// method to check if a decoded json value is of the given JSON Schema type
+func _isJsonType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return _jsonTypeOf(value) == schemaType
+	}
+}
+
+// method to get the JSON Schema type name of a decoded json value
+func _jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// method to read a []string out of a decoded json value ([]interface{} of strings) or a []string
+func _toStringSlice(value interface{}) []string {
+	switch value.(type) {
+	case []string:
+		return value.([]string)
+	case []interface{}:
+		values := make([]string, 0)
+		for _, element := range value.([]interface{}) {
+			if text, ok := element.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
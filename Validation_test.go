@@ -0,0 +1,152 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// method to decode a json document of a test case
+func decodeTestJson(t *testing.T, text string) interface{} {
+	data := &RequestData{Body: []byte(text)}
+	value, err := data.JsonBody()
+	if err != nil {
+		t.Fatalf("invalid json %v: %v", text, err)
+	}
+	return value
+}
+
+// method to join the field / message of the validation errors e.g. "$.a: required property missing"
+func describeValidationErrors(validationErrors []ValidationError) []string {
+	descriptions := make([]string, 0, len(validationErrors))
+	for _, validationError := range validationErrors {
+		descriptions = append(descriptions, validationError.Field+": "+validationError.Message)
+	}
+	return descriptions
+}
+
+func TestValidateJsonSchema(t *testing.T) {
+	schema := decodeTestJson(t, `{
+		"type": "object",
+		"required": ["id", "items"],
+		"additionalProperties": false,
+		"properties": {
+			"id": {"type": "string", "format": "uuid"},
+			"status": {"enum": ["open", "closed"]},
+			"total": {"type": "number", "minimum": 0, "exclusiveMaximum": 1000, "multipleOf": 0.01},
+			"note": {"type": ["string", "null"], "maxLength": 5},
+			"code": {"type": "string", "pattern": "^[A-Z]{3}$"},
+			"items": {"type": "array", "minItems": 1, "uniqueItems": true, "items": {"type": "integer"}},
+			"payment": {"oneOf": [{"required": ["card"]}, {"required": ["iban"]}]}
+		}
+	}`).(map[string]interface{})
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{"valid", `{"id": "8a3c6f4e-1b2d-4c5e-9f00-123456789abc", "status": "open", "total": 12.5, "note": null, "code": "ABC", "items": [1, 2], "payment": {"card": "x"}}`, []string{}},
+		{"missing required", `{"items": [1]}`, []string{"$.id: required property missing"}},
+		{"wrong type", `[]`, []string{"$: expected type object but was array"}},
+		{"additional property", `{"id": "8a3c6f4e-1b2d-4c5e-9f00-123456789abc", "items": [1], "extra": 1}`, []string{"$.extra: additional property not allowed"}},
+		{"format and enum", `{"id": "42", "status": "lost", "items": [1]}`, []string{"$.id: value 42 is not a valid uuid", `$.status: value lost is not one of ["open","closed"]`}},
+		{"number limits", `{"id": "8a3c6f4e-1b2d-4c5e-9f00-123456789abc", "total": 1000, "items": [1]}`, []string{"$.total: value 1000 must be less than 1000"}},
+		{"multipleOf", `{"id": "8a3c6f4e-1b2d-4c5e-9f00-123456789abc", "total": 0.005, "items": [1]}`, []string{"$.total: value 0.005 is not a multiple of 0.01"}},
+		{"string limits", `{"id": "8a3c6f4e-1b2d-4c5e-9f00-123456789abc", "note": "too long", "code": "abc", "items": [1]}`, []string{"$.code: value abc does not match pattern ^[A-Z]{3}$", "$.note: length 8 is greater than maxLength 5"}},
+		{"array items", `{"id": "8a3c6f4e-1b2d-4c5e-9f00-123456789abc", "items": [1, 1.5, 1]}`, []string{"$.items: item #2 is a duplicate, items must be unique", "$.items[1]: expected type integer but was number"}},
+		{"oneOf", `{"id": "8a3c6f4e-1b2d-4c5e-9f00-123456789abc", "items": [1], "payment": {"card": "x", "iban": "y"}}`, []string{"$.payment: value must match exactly one of the oneOf schemas but matched 2"}},
+	}
+	for _, testCase := range testCases {
+		validationErrors := describeValidationErrors(ValidateJsonSchema(schema, decodeTestJson(t, testCase.document), "$"))
+		if strings.Join(validationErrors, "\n") != strings.Join(testCase.expected, "\n") {
+			t.Errorf("%v: expected %v, got %v", testCase.name, testCase.expected, validationErrors)
+		}
+	}
+}
+
+func TestCompileRequestSchemas(t *testing.T) {
+	testCases := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{"supported keywords and annotations", `{"title": "order", "type": "object", "properties": {"id": {"type": "string", "pattern": "^[0-9]+$", "example": "1"}}, "additionalProperties": {"type": "string"}}`, ""},
+		{"$ref", `{"type": "object", "properties": {"customer": {"$ref": "#/definitions/customer"}}}`, "unsupported JSON Schema keyword [$ref] at #/properties/customer"},
+		{"definitions", `{"definitions": {"customer": {"type": "object"}}}`, "unsupported JSON Schema keyword [definitions] at #"},
+		{"$defs", `{"allOf": [{"$defs": {}}]}`, "unsupported JSON Schema keyword [$defs] at #/allOf/0"},
+		{"misspelled keyword", `{"items": {"maxLenght": 3}}`, "unsupported JSON Schema keyword [maxLenght] at #/items"},
+		{"invalid pattern", `{"not": {"pattern": "(["}}`, "invalid pattern [([] at #/not/pattern"},
+		{"tuple items", `{"items": [{"type": "string"}]}`, "#/items must be a schema object"},
+	}
+	for _, testCase := range testCases {
+		schemas := map[string]interface{}{"POST::/": map[string]interface{}{"requestSchema": decodeTestJson(t, testCase.schema)}}
+		err := CompileRequestSchemas(schemas)
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("%v: expected no error, got %v", testCase.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), "schemas [POST::/]: "+testCase.err) {
+			t.Errorf("%v: expected %q, got %v", testCase.name, testCase.err, err)
+		}
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	schemaInfo := map[string]interface{}{
+		"requiredQueryParameters": []interface{}{"tenant"},
+		"requiredHeaders":         []interface{}{"x-api-version"},
+		"requestBodyRequired":     true,
+		"requestSchema":           map[string]interface{}{"type": "object", "required": []interface{}{"item"}},
+		"requestXsd":              `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="order" type="xs:string"/></xs:schema>`,
+	}
+	testCases := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		expected    []string
+	}{
+		{"valid json", "tenant=a", "application/json", `{"item": "x"}`, []string{}},
+		{"missing parameters and body", "", "", "", []string{"tenant: required query parameter missing", "x-api-version: required header missing", "$: request body required"}},
+		{"invalid json body", "tenant=a", "application/json", `{"item": `, []string{"$: body is not valid json (unexpected end of JSON input)"}},
+		{"json schema", "tenant=a", "application/json", `{}`, []string{"$.item: required property missing"}},
+		{"xml body uses the xsd", "tenant=a", "application/xml", `<order>x</order>`, []string{}},
+		{"xml body, wrong root", "tenant=a", "text/xml", `<item/>`, []string{"/item: root element not declared in the xml schema"}},
+	}
+	for _, testCase := range testCases {
+		headers := http.Header{}
+		if testCase.query != "" {
+			headers.Set("X-Api-Version", "1")
+		}
+		if testCase.contentType != "" {
+			headers.Set("Content-Type", testCase.contentType)
+		}
+		query, _ := url.ParseQuery(testCase.query)
+		data := &RequestData{Query: query, Headers: headers, Body: []byte(testCase.body)}
+		validationErrors := describeValidationErrors(ValidateRequest(schemaInfo, data))
+		if strings.Join(validationErrors, "\n") != strings.Join(testCase.expected, "\n") {
+			t.Errorf("%v: expected %v, got %v", testCase.name, testCase.expected, validationErrors)
+		}
+	}
+}
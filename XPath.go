@@ -0,0 +1,250 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// structure for an element of a parsed xml document
+type XmlNode struct {
+	Name       string
+	Attributes map[string]string
+	Children   []*XmlNode
+	Text       string
+	Parent     *XmlNode
+}
+
+// structure for a single step of a (simplified) XPath expression
+type xPathStep struct {
+	name        string // element name, "*" for any element
+	descendant  bool   // "//" step
+	attribute   string // final "@attr" step
+	isText      bool   // final "text()" step
+	position    int    // [n] predicate (1 based); 0 means no predicate
+	filterAttr  string // [@attr='value'] predicate
+	filterValue string
+}
+
+// method to parse an xml document into a tree of XmlNode(s); the returned node is a
+// virtual document node whose only child is the root element
+func ParseXmlDocument(body []byte) (*XmlNode, error) {
+	document := &XmlNode{Name: "#document"}
+	current := document
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			element := token.(xml.StartElement)
+			node := &XmlNode{Name: element.Name.Local, Attributes: make(map[string]string), Parent: current}
+			for _, attr := range element.Attr {
+				node.Attributes[attr.Name.Local] = attr.Value
+			}
+			current.Children = append(current.Children, node)
+			current = node
+		case xml.EndElement:
+			if current.Parent != nil {
+				current = current.Parent
+			}
+		case xml.CharData:
+			current.Text += string(token.(xml.CharData))
+		}
+	}
+	if len(document.Children) == 0 {
+		return nil, fmt.Errorf("xml document has no root element")
+	}
+	return document, nil
+}
+
+// method to get the text content of the node (including the text of all descendants)
+func (n *XmlNode) TextContent() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(n.Text)
+	for _, child := range n.Children {
+		buffer.WriteString(child.TextContent())
+	}
+	return strings.TrimSpace(buffer.String())
+}
+
+// method to evaluate an XPath expression against a parsed document; returns the string value
+// of every matched node. Supported syntax: /a/b, //b, *, [n], [@attr='v'], @attr, text(); other functions
+// (count(), contains()...), axes and operators are not and are reported as errors
+func EvaluateXPath(document *XmlNode, expression string) ([]string, error) {
+	steps, err := _parseXPath(expression)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*XmlNode{document}
+	values := make([]string, 0)
+	for idx, step := range steps {
+		isLast := idx == len(steps)-1
+		if step.attribute != "" || step.isText {
+			if !isLast {
+				return nil, fmt.Errorf("invalid xpath, @attribute and text() must be the last step => %v", expression)
+			}
+			for _, node := range nodes {
+				if step.isText {
+					values = append(values, strings.TrimSpace(node.Text))
+				} else if value, ok := node.Attributes[step.attribute]; ok {
+					values = append(values, value)
+				}
+			}
+			return values, nil
+		}
+		nextNodes := make([]*XmlNode, 0)
+		for _, node := range nodes {
+			candidates := node.Children
+			if step.descendant {
+				candidates = _xPathDescendants(node)
+			}
+			matched := make([]*XmlNode, 0)
+			for _, candidate := range candidates {
+				if step.name != "*" && candidate.Name != step.name {
+					continue
+				}
+				if step.filterAttr != "" && candidate.Attributes[step.filterAttr] != step.filterValue {
+					continue
+				}
+				matched = append(matched, candidate)
+			}
+			if step.position > 0 {
+				if step.position <= len(matched) {
+					nextNodes = append(nextNodes, matched[step.position-1])
+				}
+			} else {
+				nextNodes = append(nextNodes, matched...)
+			}
+		}
+		nodes = nextNodes
+	}
+	for _, node := range nodes {
+		values = append(values, node.TextContent())
+	}
+	return values, nil
+}
+
+// method to parse the XPath expression into steps
+func _parseXPath(expression string) ([]xPathStep, error) {
+	expression = strings.TrimSpace(expression)
+	if !strings.HasPrefix(expression, "/") {
+		if strings.Contains(expression, "(") {
+			return nil, fmt.Errorf("xpath functions are not supported, only text() as the last step => %v", expression)
+		}
+		return nil, fmt.Errorf("invalid xpath, must start with / or // => %v", expression)
+	}
+	steps := make([]xPathStep, 0)
+	remaining := expression
+	for len(remaining) > 0 {
+		var step xPathStep
+		if strings.HasPrefix(remaining, "//") {
+			step.descendant = true
+			remaining = remaining[2:]
+		} else if strings.HasPrefix(remaining, "/") {
+			remaining = remaining[1:]
+		} else {
+			return nil, fmt.Errorf("invalid xpath near [%v] => %v", remaining, expression)
+		}
+		// a step ends at the next "/" outside of a predicate
+		end := len(remaining)
+		depth := 0
+		for idx, char := range remaining {
+			if char == '[' {
+				depth++
+			} else if char == ']' {
+				depth--
+			} else if char == '/' && depth == 0 {
+				end = idx
+				break
+			}
+		}
+		token := remaining[:end]
+		remaining = remaining[end:]
+
+		if err := _parseXPathStep(token, &step); err != nil {
+			return nil, fmt.Errorf("%v => %v", err, expression)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// method to parse a single step token e.g. item[2] or item[@type='book'] or @id
+func _parseXPathStep(token string, step *xPathStep) error {
+	if token == "" {
+		return fmt.Errorf("invalid xpath, empty step")
+	}
+	if token == "text()" {
+		step.isText = true
+		return nil
+	}
+	if strings.Contains(token, "(") || strings.Contains(token, "::") {
+		return fmt.Errorf("xpath functions and axes are not supported, only text() as the last step [%v]", token)
+	}
+	if strings.HasPrefix(token, "@") {
+		step.attribute = token[1:]
+		return nil
+	}
+	predicateStart := strings.Index(token, "[")
+	if predicateStart < 0 {
+		step.name = token
+		return nil
+	}
+	if !strings.HasSuffix(token, "]") {
+		return fmt.Errorf("invalid xpath predicate [%v]", token)
+	}
+	step.name = token[:predicateStart]
+	predicate := strings.TrimSpace(token[predicateStart+1 : len(token)-1])
+	if strings.HasPrefix(predicate, "@") {
+		parts := strings.SplitN(predicate[1:], "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid xpath predicate [%v]", predicate)
+		}
+		step.filterAttr = strings.TrimSpace(parts[0])
+		step.filterValue = strings.Trim(strings.TrimSpace(parts[1]), "'\"")
+		return nil
+	}
+	position, err := strconv.Atoi(predicate)
+	if err != nil || position < 1 {
+		return fmt.Errorf("invalid xpath predicate [%v]", predicate)
+	}
+	step.position = position
+	return nil
+}
+
+// method to list all descendant elements of the node (depth first)
+func _xPathDescendants(node *XmlNode) []*XmlNode {
+	results := make([]*XmlNode, 0)
+	for _, child := range node.Children {
+		results = append(results, child)
+		results = append(results, _xPathDescendants(child)...)
+	}
+	return results
+}
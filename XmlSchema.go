@@ -0,0 +1,463 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compiled xml schemas keyed by their source text
+var xmlSchemaCache sync.Map
+
+// structure of a parsed xml schema (XSD); a subset is supported:
+// element (name, type, ref, minOccurs, maxOccurs), complexType (sequence, choice, all, attribute,
+// simpleContent / extension), simpleType (restriction with enumeration, pattern, length and range
+// facets) and the common built-in types (string, boolean, int, integer, decimal, date, dateTime...)
+type XmlSchema struct {
+	elements     map[string]*XmlNode
+	complexTypes map[string]*XmlNode
+	simpleTypes  map[string]*XmlNode
+}
+
+// method to parse (and cache) an xml schema
+func CompileXmlSchema(xsd string) (*XmlSchema, error) {
+	if cached, ok := xmlSchemaCache.Load(xsd); ok {
+		return cached.(*XmlSchema), nil
+	}
+	document, err := ParseXmlDocument([]byte(xsd))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xml schema: %v", err)
+	}
+	root := document.Children[0]
+	if root.Name != "schema" {
+		return nil, fmt.Errorf("invalid xml schema: root element must be schema, got [%v]", root.Name)
+	}
+	schema := &XmlSchema{
+		elements:     make(map[string]*XmlNode),
+		complexTypes: make(map[string]*XmlNode),
+		simpleTypes:  make(map[string]*XmlNode),
+	}
+	for _, child := range root.Children {
+		name := child.Attributes["name"]
+		switch child.Name {
+		case "element":
+			schema.elements[name] = child
+		case "complexType":
+			schema.complexTypes[name] = child
+		case "simpleType":
+			schema.simpleTypes[name] = child
+		}
+	}
+	if len(schema.elements) == 0 {
+		return nil, fmt.Errorf("invalid xml schema: no top level element declared")
+	}
+	xmlSchemaCache.Store(xsd, schema)
+	return schema, nil
+}
+
+// method to validate a parsed xml document; the root element must be one of the top level elements
+func (s *XmlSchema) Validate(document *XmlNode) []ValidationError {
+	root := document.Children[0]
+	declaration, ok := s.elements[root.Name]
+	if !ok {
+		return []ValidationError{{Location: "body", Field: "/" + root.Name, Message: "root element not declared in the xml schema"}}
+	}
+	return s.validateElement(declaration, root, "/"+root.Name)
+}
+
+// method to validate an element against its declaration
+func (s *XmlSchema) validateElement(declaration *XmlNode, node *XmlNode, path string) []ValidationError {
+	if ref := declaration.Attributes["ref"]; ref != "" {
+		referenced, ok := s.elements[_stripXmlPrefix(ref)]
+		if !ok {
+			return []ValidationError{{Location: "body", Field: path, Message: fmt.Sprintf("xml schema references unknown element [%v]", ref)}}
+		}
+		declaration = referenced
+	}
+	if typeName := declaration.Attributes["type"]; typeName != "" {
+		return s.validateType(_stripXmlPrefix(typeName), node, path)
+	}
+	for _, child := range declaration.Children {
+		switch child.Name {
+		case "complexType":
+			return s.validateComplexType(child, node, path)
+		case "simpleType":
+			return s.validateSimpleNode(child, node, path)
+		}
+	}
+	// no type at all => anyType
+	return nil
+}
+
+// method to validate an element against a named (or built-in) type
+func (s *XmlSchema) validateType(typeName string, node *XmlNode, path string) []ValidationError {
+	if complexType, ok := s.complexTypes[typeName]; ok {
+		return s.validateComplexType(complexType, node, path)
+	}
+	if simpleType, ok := s.simpleTypes[typeName]; ok {
+		return s.validateSimpleNode(simpleType, node, path)
+	}
+	if typeName == "anyType" {
+		return nil
+	}
+	if len(node.Children) > 0 {
+		return []ValidationError{{Location: "body", Field: path, Message: fmt.Sprintf("element of type %v cannot have child elements", typeName)}}
+	}
+	if err := s.checkSimpleValue(typeName, nil, strings.TrimSpace(node.Text)); err != nil {
+		return []ValidationError{{Location: "body", Field: path, Message: err.Error()}}
+	}
+	return nil
+}
+
+// method to validate an element holding a simple value (simpleType declaration)
+func (s *XmlSchema) validateSimpleNode(simpleType *XmlNode, node *XmlNode, path string) []ValidationError {
+	if len(node.Children) > 0 {
+		return []ValidationError{{Location: "body", Field: path, Message: "element of a simple type cannot have child elements"}}
+	}
+	if err := s.checkSimpleValue("", simpleType, strings.TrimSpace(node.Text)); err != nil {
+		return []ValidationError{{Location: "body", Field: path, Message: err.Error()}}
+	}
+	return nil
+}
+
+// method to validate the attributes and the content of an element against a complexType
+func (s *XmlSchema) validateComplexType(complexType *XmlNode, node *XmlNode, path string) []ValidationError {
+	validationErrors := make([]ValidationError, 0)
+	var particle *XmlNode
+	attributes := make([]*XmlNode, 0)
+	isSimpleContent := false
+	for _, child := range complexType.Children {
+		switch child.Name {
+		case "sequence", "choice", "all":
+			particle = child
+		case "attribute":
+			attributes = append(attributes, child)
+		case "simpleContent":
+			// <simpleContent><extension base="xs:string"><attribute .../></extension></simpleContent>
+			isSimpleContent = true
+			for _, extension := range child.Children {
+				if extension.Name != "extension" && extension.Name != "restriction" {
+					continue
+				}
+				for _, attribute := range extension.Children {
+					if attribute.Name == "attribute" {
+						attributes = append(attributes, attribute)
+					}
+				}
+				if base := extension.Attributes["base"]; base != "" {
+					if err := s.checkSimpleValue(_stripXmlPrefix(base), nil, strings.TrimSpace(node.Text)); err != nil {
+						validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path, Message: err.Error()})
+					}
+				}
+			}
+		}
+	}
+	for _, attribute := range attributes {
+		name := attribute.Attributes["name"]
+		value, isPresent := node.Attributes[name]
+		if !isPresent {
+			if attribute.Attributes["use"] == "required" {
+				validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path + "/@" + name, Message: "required attribute missing"})
+			}
+			continue
+		}
+		if err := s.checkAttributeValue(attribute, value); err != nil {
+			validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path + "/@" + name, Message: err.Error()})
+		}
+	}
+	if isSimpleContent {
+		if len(node.Children) > 0 {
+			validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path, Message: "element with simple content cannot have child elements"})
+		}
+		return validationErrors
+	}
+	if particle == nil {
+		if len(node.Children) > 0 {
+			validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path + "/" + node.Children[0].Name, Message: "unexpected element"})
+		}
+		return validationErrors
+	}
+	idx, particleErrors := s.matchParticle(particle, node.Children, 0, path)
+	validationErrors = append(validationErrors, particleErrors...)
+	for ; idx < len(node.Children); idx++ {
+		validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path + "/" + node.Children[idx].Name, Message: "unexpected element"})
+	}
+	return validationErrors
+}
+
+// method to match the child elements (from idx) against a sequence, choice or all; returns
+// the index of the first child not consumed
+func (s *XmlSchema) matchParticle(particle *XmlNode, children []*XmlNode, idx int, path string) (int, []ValidationError) {
+	validationErrors := make([]ValidationError, 0)
+	switch particle.Name {
+	case "sequence":
+		for _, item := range particle.Children {
+			var itemErrors []ValidationError
+			idx, itemErrors = s.matchOccurrences(item, children, idx, path)
+			validationErrors = append(validationErrors, itemErrors...)
+		}
+	case "choice":
+		for _, item := range particle.Children {
+			if s.startsWith(item, children, idx) {
+				return s.matchOccurrences(item, children, idx, path)
+			}
+		}
+		minOccurs, _ := _getXmlOccurs(particle)
+		if minOccurs > 0 {
+			validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path,
+				Message: fmt.Sprintf("expected one of %v", s.describeParticle(particle))})
+		}
+	case "all":
+		seen := make(map[string]bool)
+		declarations := make(map[string]*XmlNode)
+		for _, item := range particle.Children {
+			if item.Name == "element" {
+				declarations[_getXmlElementName(item)] = item
+			}
+		}
+		for ; idx < len(children); idx++ {
+			child := children[idx]
+			declaration, ok := declarations[child.Name]
+			if !ok || seen[child.Name] {
+				break
+			}
+			seen[child.Name] = true
+			validationErrors = append(validationErrors, s.validateElement(declaration, child, path+"/"+child.Name)...)
+		}
+		for name, declaration := range declarations {
+			if minOccurs, _ := _getXmlOccurs(declaration); minOccurs > 0 && !seen[name] {
+				validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path + "/" + name, Message: "required element missing"})
+			}
+		}
+	}
+	return idx, validationErrors
+}
+
+// method to match an element or nested group, honouring its minOccurs / maxOccurs
+func (s *XmlSchema) matchOccurrences(item *XmlNode, children []*XmlNode, idx int, path string) (int, []ValidationError) {
+	validationErrors := make([]ValidationError, 0)
+	minOccurs, maxOccurs := _getXmlOccurs(item)
+	count := 0
+	for (maxOccurs < 0 || count < maxOccurs) && idx < len(children) && s.startsWith(item, children, idx) {
+		if item.Name == "element" {
+			child := children[idx]
+			childPath := fmt.Sprintf("%v/%v", path, child.Name)
+			if maxOccurs < 0 || maxOccurs > 1 {
+				childPath = fmt.Sprintf("%v[%v]", childPath, count+1)
+			}
+			validationErrors = append(validationErrors, s.validateElement(item, child, childPath)...)
+			idx++
+		} else {
+			nextIdx, groupErrors := s.matchParticle(item, children, idx, path)
+			validationErrors = append(validationErrors, groupErrors...)
+			if nextIdx == idx {
+				break
+			}
+			idx = nextIdx
+		}
+		count++
+	}
+	if count < minOccurs {
+		validationErrors = append(validationErrors, ValidationError{Location: "body", Field: path,
+			Message: fmt.Sprintf("expected %v but found %v occurrence(s) of %v", minOccurs, count, s.describeParticle(item))})
+	}
+	return idx, validationErrors
+}
+
+// method to check if the child at idx could start the given element or group
+func (s *XmlSchema) startsWith(item *XmlNode, children []*XmlNode, idx int) bool {
+	if idx >= len(children) {
+		return false
+	}
+	switch item.Name {
+	case "element":
+		return children[idx].Name == _getXmlElementName(item)
+	case "any":
+		return true
+	case "sequence", "choice", "all":
+		for _, child := range item.Children {
+			if s.startsWith(child, children, idx) {
+				return true
+			}
+			// a mandatory first element of a sequence decides
+			if minOccurs, _ := _getXmlOccurs(child); item.Name == "sequence" && minOccurs > 0 {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// method to describe an element or group in a validation message
+func (s *XmlSchema) describeParticle(item *XmlNode) string {
+	if item.Name == "element" {
+		return fmt.Sprintf("element [%v]", _getXmlElementName(item))
+	}
+	names := make([]string, 0)
+	for _, child := range item.Children {
+		names = append(names, s.describeParticle(child))
+	}
+	return fmt.Sprintf("%v(%v)", item.Name, strings.Join(names, ", "))
+}
+
+// method to check an attribute value against its declared type
+func (s *XmlSchema) checkAttributeValue(attribute *XmlNode, value string) error {
+	if typeName := attribute.Attributes["type"]; typeName != "" {
+		return s.checkSimpleValue(_stripXmlPrefix(typeName), nil, value)
+	}
+	for _, child := range attribute.Children {
+		if child.Name == "simpleType" {
+			return s.checkSimpleValue("", child, value)
+		}
+	}
+	return nil
+}
+
+// method to check a simple value against a (named or built-in) type or an inline simpleType
+func (s *XmlSchema) checkSimpleValue(typeName string, simpleType *XmlNode, value string) error {
+	if simpleType == nil {
+		if named, ok := s.simpleTypes[typeName]; ok {
+			simpleType = named
+		} else {
+			return _checkXsdBuiltinValue(typeName, value)
+		}
+	}
+	for _, child := range simpleType.Children {
+		if child.Name != "restriction" {
+			// list / union are not checked
+			continue
+		}
+		if base := child.Attributes["base"]; base != "" {
+			if err := s.checkSimpleValue(_stripXmlPrefix(base), nil, value); err != nil {
+				return err
+			}
+		}
+		return _checkXsdFacets(child, value)
+	}
+	return nil
+}
+
+// method to check the facets of a restriction
+func _checkXsdFacets(restriction *XmlNode, value string) error {
+	enumeration := make([]string, 0)
+	for _, facet := range restriction.Children {
+		facetValue := facet.Attributes["value"]
+		switch facet.Name {
+		case "enumeration":
+			enumeration = append(enumeration, facetValue)
+		case "pattern":
+			pattern, err := regexp.Compile("^(?:" + facetValue + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid pattern facet [%v]: %v", facetValue, err)
+			}
+			if !pattern.MatchString(value) {
+				return fmt.Errorf("value [%v] does not match pattern [%v]", value, facetValue)
+			}
+		case "length", "minLength", "maxLength":
+			limit, _ := strconv.Atoi(facetValue)
+			length := len([]rune(value))
+			if (facet.Name == "length" && length != limit) || (facet.Name == "minLength" && length < limit) || (facet.Name == "maxLength" && length > limit) {
+				return fmt.Errorf("length of value [%v] violates %v %v", value, facet.Name, limit)
+			}
+		case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+			limit, errLimit := strconv.ParseFloat(facetValue, 64)
+			number, errNumber := strconv.ParseFloat(value, 64)
+			if errLimit != nil || errNumber != nil {
+				continue
+			}
+			if (facet.Name == "minInclusive" && number < limit) || (facet.Name == "maxInclusive" && number > limit) ||
+				(facet.Name == "minExclusive" && number <= limit) || (facet.Name == "maxExclusive" && number >= limit) {
+				return fmt.Errorf("value [%v] violates %v %v", value, facet.Name, facetValue)
+			}
+		}
+	}
+	if len(enumeration) > 0 && !_containsString(enumeration, value) {
+		return fmt.Errorf("value [%v] is not one of %v", value, enumeration)
+	}
+	return nil
+}
+
+// method to check a value against a built-in xml schema type; unknown types are accepted
+func _checkXsdBuiltinValue(typeName string, value string) error {
+	var err error
+	switch typeName {
+	case "boolean":
+		if value != "true" && value != "false" && value != "1" && value != "0" {
+			err = fmt.Errorf("not a boolean")
+		}
+	case "int", "integer", "long", "short", "byte":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "positiveInteger", "nonNegativeInteger", "unsignedInt", "unsignedLong":
+		var number int64
+		number, err = strconv.ParseInt(value, 10, 64)
+		if err == nil && (number < 0 || (typeName == "positiveInteger" && number == 0)) {
+			err = fmt.Errorf("out of range")
+		}
+	case "decimal", "float", "double":
+		_, err = strconv.ParseFloat(value, 64)
+	case "date":
+		_, err = time.Parse("2006-01-02", value)
+	case "dateTime":
+		_, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			_, err = time.Parse("2006-01-02T15:04:05", value)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("value [%v] is not a valid %v", value, typeName)
+	}
+	return nil
+}
+
+// method to get the name of an element declaration (name or ref)
+func _getXmlElementName(declaration *XmlNode) string {
+	if name := declaration.Attributes["name"]; name != "" {
+		return name
+	}
+	return _stripXmlPrefix(declaration.Attributes["ref"])
+}
+
+// method to read minOccurs / maxOccurs (default 1); unbounded is returned as -1
+func _getXmlOccurs(declaration *XmlNode) (int, int) {
+	minOccurs, maxOccurs := 1, 1
+	if value, ok := declaration.Attributes["minOccurs"]; ok {
+		minOccurs, _ = strconv.Atoi(value)
+	}
+	if value, ok := declaration.Attributes["maxOccurs"]; ok {
+		if value == "unbounded" {
+			maxOccurs = -1
+		} else {
+			maxOccurs, _ = strconv.Atoi(value)
+		}
+	}
+	return minOccurs, maxOccurs
+}
+
+// method to strip the namespace prefix e.g. xs:string => string
+func _stripXmlPrefix(name string) string {
+	if idx := strings.Index(name, ":"); idx >= 0 {
+		return name[idx+1:]
+	}
+	return name
+}
@@ -0,0 +1,106 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// xml schema of an order; named, anonymous and simple types, attributes, a choice and occurrences
+const testOrderXsd = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="order" type="orderType"/>
+  <xs:element name="note" type="xs:string"/>
+  <xs:complexType name="orderType">
+    <xs:sequence>
+      <xs:element name="id" type="xs:int"/>
+      <xs:element name="status" type="statusType" minOccurs="0"/>
+      <xs:choice>
+        <xs:element name="card" type="xs:string"/>
+        <xs:element name="iban" type="xs:string"/>
+      </xs:choice>
+      <xs:element name="item" maxOccurs="3">
+        <xs:complexType>
+          <xs:simpleContent>
+            <xs:extension base="xs:string">
+              <xs:attribute name="quantity" type="xs:positiveInteger" use="required"/>
+            </xs:extension>
+          </xs:simpleContent>
+        </xs:complexType>
+      </xs:element>
+      <xs:element ref="note" minOccurs="0"/>
+    </xs:sequence>
+    <xs:attribute name="created" type="xs:date"/>
+  </xs:complexType>
+  <xs:simpleType name="statusType">
+    <xs:restriction base="xs:string">
+      <xs:enumeration value="open"/>
+      <xs:enumeration value="closed"/>
+    </xs:restriction>
+  </xs:simpleType>
+</xs:schema>`
+
+func TestXmlSchemaValidate(t *testing.T) {
+	xmlSchema, err := CompileXmlSchema(testOrderXsd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{"valid", `<order created="2020-01-31"><id>1</id><status>open</status><card>4111</card><item quantity="2">pen</item><note>fast</note></order>`, []string{}},
+		{"optional elements left out", `<order><id>1</id><iban>DE00</iban><item quantity="1">pen</item></order>`, []string{}},
+		{"root not declared", `<invoice/>`, []string{"/invoice: root element not declared in the xml schema"}},
+		{"built-in type", `<order><id>one</id><card>4111</card><item quantity="1">pen</item></order>`, []string{"/order/id: value [one] is not a valid int"}},
+		{"enumeration", `<order><id>1</id><status>lost</status><card>4111</card><item quantity="1">pen</item></order>`, []string{"/order/status: value [lost] is not one of [open closed]"}},
+		{"attributes", `<order created="yesterday"><id>1</id><card>4111</card><item>pen</item></order>`, []string{"/order/@created: value [yesterday] is not a valid date", "/order/item[1]/@quantity: required attribute missing"}},
+		{"missing choice", `<order><id>1</id><item quantity="1">pen</item></order>`, []string{"/order: expected 1 but found 0 occurrence(s) of choice(element [card], element [iban])"}},
+		{"too many occurrences", `<order><id>1</id><card>4111</card><item quantity="1">a</item><item quantity="1">b</item><item quantity="1">c</item><item quantity="1">d</item></order>`, []string{"/order/item: unexpected element"}},
+	}
+	for _, testCase := range testCases {
+		document, err := ParseXmlDocument([]byte(testCase.document))
+		if err != nil {
+			t.Fatalf("%v: %v", testCase.name, err)
+		}
+		validationErrors := describeValidationErrors(xmlSchema.Validate(document))
+		if strings.Join(validationErrors, "\n") != strings.Join(testCase.expected, "\n") {
+			t.Errorf("%v: expected %v, got %v", testCase.name, testCase.expected, validationErrors)
+		}
+	}
+}
+
+func TestCompileXmlSchemaErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		xsd  string
+		err  string
+	}{
+		{"not xml", `<xs:schema`, "invalid xml schema:"},
+		{"not a schema", `<element name="order"/>`, "root element must be schema, got [element]"},
+		{"no element", `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:simpleType name="a"/></xs:schema>`, "no top level element declared"},
+	}
+	for _, testCase := range testCases {
+		if _, err := CompileXmlSchema(testCase.xsd); err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("%v: expected an error containing %q, got %v", testCase.name, testCase.err, err)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// structure of a significant (non blank, non comment) line of a yaml document
+type yamlLine struct {
+	number int    // 1 based line number, for error messages
+	indent int    // leading spaces
+	text   string // content without indentation and trailing comment
+	raw    string // the original line (block scalars keep their content as-is)
+}
+
+// structure of the yaml parser state
+type yamlParser struct {
+	lines []*yamlLine
+	pos   int
+}
+
+// method to parse a yaml document into the same values encoding/json decodes to:
+// map[string]interface{}, []interface{}, string, float64, bool and nil.
+// Supported is the subset used by configuration files; block mappings and sequences,
+// flow sequences / mappings ([a, b] / {a: b}), plain, single and double quoted scalars,
+// block scalars (| and >) and comments. Anchors, aliases, tags and multiple documents are not
+func ParseYaml(content []byte) (interface{}, error) {
+	parser := new(yamlParser)
+	hasContent := false
+	for idx, raw := range strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n") {
+		text := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml line %v: tabs are not allowed for indentation", idx+1)
+		}
+		trimmed = _stripYamlComment(trimmed)
+		if trimmed == "" || (!hasContent && trimmed == "---") {
+			// keep blank lines for block scalars; they are skipped everywhere else
+			parser.lines = append(parser.lines, &yamlLine{number: idx + 1, indent: -1, raw: raw})
+			continue
+		}
+		if trimmed == "..." {
+			break
+		}
+		hasContent = true
+		parser.lines = append(parser.lines, &yamlLine{number: idx + 1, indent: len(text) - len(strings.TrimLeft(text, " ")), text: trimmed, raw: raw})
+	}
+	parser.skipBlankLines()
+	if parser.pos >= len(parser.lines) {
+		return map[string]interface{}{}, nil
+	}
+	value, err := parser.parseBlock(parser.lines[parser.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	parser.skipBlankLines()
+	if parser.pos < len(parser.lines) {
+		line := parser.lines[parser.pos]
+		return nil, fmt.Errorf("yaml line %v: unexpected indentation => %v", line.number, line.text)
+	}
+	return value, nil
+}
+
+// method to move past blank (and comment only) lines
+func (p *yamlParser) skipBlankLines() {
+	for p.pos < len(p.lines) && p.lines[p.pos].indent < 0 {
+		p.pos++
+	}
+}
+
+// method to parse the block (mapping or sequence) starting at the current line
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	line := p.lines[p.pos]
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+// method to parse a block mapping; every key is at the given indentation
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := make(map[string]interface{})
+	for {
+		p.skipBlankLines()
+		if p.pos >= len(p.lines) || p.lines[p.pos].indent < indent {
+			return mapping, nil
+		}
+		line := p.lines[p.pos]
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml line %v: unexpected indentation => %v", line.number, line.text)
+		}
+		if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+			return nil, fmt.Errorf("yaml line %v: sequence item where a mapping key was expected => %v", line.number, line.text)
+		}
+		key, rest, err := _splitYamlKeyValue(line.text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %v: %v", line.number, err)
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, fmt.Errorf("yaml line %v: duplicated key [%v]", line.number, key)
+		}
+		p.pos++
+		value, err := p.parseValue(rest, indent, line, true)
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+}
+
+// method to parse a block sequence; every "- " is at the given indentation
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	sequence := make([]interface{}, 0)
+	for {
+		p.skipBlankLines()
+		if p.pos >= len(p.lines) || p.lines[p.pos].indent < indent {
+			return sequence, nil
+		}
+		line := p.lines[p.pos]
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml line %v: unexpected indentation => %v", line.number, line.text)
+		}
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			// the sequence was the value of a key at the same indentation; the mapping continues
+			return sequence, nil
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest != "" && !_isYamlFlowOrQuoted(rest) {
+			if _, _, err := _splitYamlKeyValue(rest); err == nil {
+				// "- key: value" starts a mapping indented at the position of "key"
+				line.indent = indent + len(line.text) - len(rest)
+				line.text = rest
+				value, err := p.parseMapping(line.indent)
+				if err != nil {
+					return nil, err
+				}
+				sequence = append(sequence, value)
+				continue
+			}
+		}
+		p.pos++
+		value, err := p.parseValue(rest, indent, line, false)
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+}
+
+// method to parse the value after "key:" or "- "; empty means a nested block (or null)
+func (p *yamlParser) parseValue(text string, indent int, line *yamlLine, isMappingValue bool) (interface{}, error) {
+	if text == "|" || text == ">" || text == "|-" || text == ">-" {
+		return p.parseBlockScalar(text, indent), nil
+	}
+	if text != "" {
+		value, err := _parseYamlScalar(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %v: %v", line.number, err)
+		}
+		return value, nil
+	}
+	p.skipBlankLines()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent {
+		return p.parseBlock(next.indent)
+	}
+	// a sequence may sit at the same indentation as its key
+	if isMappingValue && next.indent == indent && (next.text == "-" || strings.HasPrefix(next.text, "- ")) {
+		return p.parseSequence(indent)
+	}
+	return nil, nil
+}
+
+// method to read a literal (|) or folded (>) block scalar
+func (p *yamlParser) parseBlockScalar(indicator string, indent int) string {
+	blockLines := make([]string, 0)
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		raw := strings.TrimRight(line.raw, " \t")
+		rawIndent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if raw != "" && rawIndent <= indent {
+			break
+		}
+		if raw != "" && blockIndent < 0 {
+			blockIndent = rawIndent
+		}
+		if raw == "" {
+			blockLines = append(blockLines, "")
+		} else if rawIndent < blockIndent {
+			blockLines = append(blockLines, raw[rawIndent:])
+		} else {
+			blockLines = append(blockLines, raw[blockIndent:])
+		}
+		p.pos++
+	}
+	// trailing blank lines don't belong to the scalar
+	for len(blockLines) > 0 && blockLines[len(blockLines)-1] == "" {
+		blockLines = blockLines[:len(blockLines)-1]
+	}
+	var text string
+	if strings.HasPrefix(indicator, "|") {
+		text = strings.Join(blockLines, "\n")
+	} else {
+		// folded; lines are joined with a space, a blank line becomes a line break
+		for idx, blockLine := range blockLines {
+			switch {
+			case blockLine == "":
+				text += "\n"
+			case idx > 0 && blockLines[idx-1] != "":
+				text += " " + blockLine
+			default:
+				text += blockLine
+			}
+		}
+	}
+	if !strings.HasSuffix(indicator, "-") && text != "" {
+		text += "\n"
+	}
+	return text
+}
+
+// method to split "key: value" (or "key:") into its key and value
+func _splitYamlKeyValue(text string) (string, string, error) {
+	var key string
+	rest := text
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		end := _findYamlQuoteEnd(text)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted key => %v", text)
+		}
+		unquoted, err := _parseYamlScalar(text[:end+1])
+		if err != nil {
+			return "", "", err
+		}
+		key = fmt.Sprintf("%v", unquoted)
+		rest = text[end+1:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("expected [key: value] => %v", text)
+		}
+		return key, strings.TrimSpace(rest[1:]), nil
+	}
+	idx := strings.Index(text, ": ")
+	if idx < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", fmt.Errorf("expected [key: value] => %v", text)
+		}
+		idx = len(text) - 1
+	}
+	key = strings.TrimSpace(text[:idx])
+	if key == "" {
+		return "", "", fmt.Errorf("missing key => %v", text)
+	}
+	return key, strings.TrimSpace(text[idx+1:]), nil
+}
+
+// method to check if the text is a flow collection or a quoted scalar (never a "key: value")
+func _isYamlFlowOrQuoted(text string) bool {
+	return strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") ||
+		(strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'")) && _findYamlQuoteEnd(text) == len(text)-1
+}
+
+// method to parse a scalar or flow collection
+func _parseYamlScalar(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(text, "\""):
+		if _findYamlQuoteEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("invalid double quoted string => %v", text)
+		}
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double quoted string => %v", text)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if _findYamlQuoteEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("invalid single quoted string => %v", text)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence => %v", text)
+		}
+		sequence := make([]interface{}, 0)
+		for _, item := range _splitFlowItems(text[1 : len(text)-1]) {
+			value, err := _parseYamlScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+		}
+		return sequence, nil
+	case strings.HasPrefix(text, "{"):
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("unterminated flow mapping => %v", text)
+		}
+		mapping := make(map[string]interface{})
+		for _, item := range _splitFlowItems(text[1 : len(text)-1]) {
+			key, rest, err := _splitYamlKeyValue(item)
+			if err != nil {
+				return nil, err
+			}
+			value, err := _parseYamlScalar(rest)
+			if err != nil {
+				return nil, err
+			}
+			mapping[key] = value
+		}
+		return mapping, nil
+	}
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if number, err := strconv.ParseFloat(strings.Replace(text, "_", "", -1), 64); err == nil && strings.ContainsAny(text, "0123456789") && !strings.ContainsAny(text, "xXpP") {
+		return number, nil
+	}
+	return text, nil
+}
+
+// method to split the items of a flow collection on the commas outside quotes and nested collections
+func _splitFlowItems(text string) []string {
+	items := make([]string, 0)
+	depth := 0
+	var quote byte
+	start := 0
+	for idx := 0; idx < len(text); idx++ {
+		char := text[idx]
+		switch {
+		case quote != 0:
+			if char == '\\' && quote == '"' {
+				idx++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '[' || char == '{':
+			depth++
+		case char == ']' || char == '}':
+			depth--
+		case char == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(text[start:idx]))
+			start = idx + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// method to find the closing quote of a quoted scalar at the start of the text; -1 if unterminated
+func _findYamlQuoteEnd(text string) int {
+	quote := text[0]
+	for idx := 1; idx < len(text); idx++ {
+		if quote == '"' && text[idx] == '\\' {
+			idx++
+			continue
+		}
+		if text[idx] == quote {
+			if quote == '\'' && idx+1 < len(text) && text[idx+1] == '\'' {
+				idx++
+				continue
+			}
+			return idx
+		}
+	}
+	return -1
+}
+
+// method to strip a trailing comment (" #...") that is not within quotes
+func _stripYamlComment(text string) string {
+	if strings.HasPrefix(text, "#") {
+		return ""
+	}
+	var quote byte
+	for idx := 0; idx < len(text); idx++ {
+		char := text[idx]
+		switch {
+		case quote != 0:
+			if char == '\\' && quote == '"' {
+				idx++
+			} else if char == quote {
+				quote = 0
+			}
+		case (char == '"' || char == '\'') && (idx == 0 || strings.ContainsRune(" :-[{,", rune(text[idx-1]))):
+			quote = char
+		case char == '#' && idx > 0 && (text[idx-1] == ' ' || text[idx-1] == '\t'):
+			return strings.TrimRight(text[:idx], " \t")
+		}
+	}
+	return text
+}
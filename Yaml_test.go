@@ -0,0 +1,85 @@
+/*
+ * Licensed to Echogogo under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Echogogo licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYamlScalar(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected interface{}
+	}{
+		{"", nil},
+		{"~", nil},
+		{"True", true},
+		{"false", false},
+		{"8001", float64(8001)},
+		{"-1.5", -1.5},
+		{"1_000", float64(1000)},
+		{"0x1F", "0x1F"},
+		{"plain text", "plain text"},
+		{`"a\nb"`, "a\nb"},
+		{"'it''s'", "it's"},
+		{"[a, 'b, c', [1]]", []interface{}{"a", "b, c", []interface{}{float64(1)}}},
+		{"{a: 1, b: [x]}", map[string]interface{}{"a": float64(1), "b": []interface{}{"x"}}},
+	}
+	for _, testCase := range testCases {
+		value, err := _parseYamlScalar(testCase.text)
+		if err != nil || !reflect.DeepEqual(value, testCase.expected) {
+			t.Errorf("%v: expected %#v, got %#v (%v)", testCase.text, testCase.expected, value, err)
+		}
+	}
+}
+
+func TestParseYaml(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected interface{}
+		err      string
+	}{
+		{"empty", "# nothing\n", map[string]interface{}{}, ""},
+		{"nested mappings", "---\nserver:\n  port: 9000 # comment\n  host: ''\nlogging:\n  level: debug\n",
+			map[string]interface{}{"server": map[string]interface{}{"port": float64(9000), "host": ""}, "logging": map[string]interface{}{"level": "debug"}}, ""},
+		{"sequence of mappings", "faults:\n  - module: a\n    status: 503\n  - module: b\n",
+			map[string]interface{}{"faults": []interface{}{map[string]interface{}{"module": "a", "status": float64(503)}, map[string]interface{}{"module": "b"}}}, ""},
+		{"block scalars", "literal: |\n  a\n  b\nfolded: >\n  a\n  b\n",
+			map[string]interface{}{"literal": "a\nb\n", "folded": "a b\n"}, ""},
+		{"url with a hash", "url: http://a.com/#x\n", map[string]interface{}{"url": "http://a.com/#x"}, ""},
+		{"tab indentation", "server:\n\tport: 1\n", nil, "yaml line 2: tabs are not allowed"},
+		{"bad indentation", "a: 1\n  b: 2\n", nil, "yaml line 2"},
+		{"unterminated quote", "a: \"x\n", nil, "invalid double quoted string"},
+	}
+	for _, testCase := range testCases {
+		document, err := ParseYaml([]byte(testCase.content))
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v: expected an error containing %q, got %v", testCase.name, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(document, testCase.expected) {
+			t.Errorf("%v: expected %v, got %v (%v)", testCase.name, testCase.expected, document, err)
+		}
+	}
+}